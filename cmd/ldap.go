@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+	"gitee.com/golden-go/golden-go/pkg/utils/config"
+	"gitee.com/golden-go/golden-go/pkg/utils/ldap"
+	"gitee.com/golden-go/golden-go/pkg/utils/types"
+	"github.com/spf13/cobra"
+)
+
+var ldapCmd = &cobra.Command{
+	Use:   "ldap",
+	Short: "LDAP 工具",
+}
+
+var ldapTestCmd = &cobra.Command{
+	Use:   "test",
+	Short: "测试 LDAP 配置",
+	Long:  `按 auth.ldap.servers 的配置依次连接每个 LDAP 服务，执行绑定、查询用户和用户绑定，输出每一步的结果和查到的用户，最后按服务重新加载配置的方式创建所有的 LDAP 服务并登录`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		username, _ := cmd.Flags().GetString("username")
+		password, _ := cmd.Flags().GetString("password")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		if err := config.UnmarshalKey("auth.normalize", &types.Normalize); err != nil {
+			return err
+		}
+		username = types.Normalize.Username(username)
+		sc, err := config.LDAPServers()
+		if err != nil {
+			return err
+		}
+		if len(sc) == 0 {
+			return ldap.ErrNoLDAPServers
+		}
+		failed := 0
+		for i, c := range sc {
+			fmt.Printf("auth.ldap.servers[%d] %s:%d\n", i, c.Host, c.Port)
+			if err := c.Validate(); err != nil {
+				printStep("config", err)
+				failed++
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			u, err := testLDAPServer(ctx, c, username, password)
+			cancel()
+			if err != nil {
+				failed++
+				continue
+			}
+			printLDAPUser(u)
+		}
+		// 和服务重新加载配置时一样创建 LDAP 服务，按 auth.ldap.order 登录
+		fmt.Println("auth.ldap.servers")
+		if err := testMultiLDAP(timeout, username, password); err != nil {
+			failed++
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d 个 LDAP 服务测试失败", failed)
+		}
+		return nil
+	},
+}
+
+// testLDAPServer 依次执行连接、绑定、查询用户和用户绑定，返回第一个失败的步骤的错误
+func testLDAPServer(ctx context.Context, c *ldap.ServerConfig, username, password string) (*models.User, error) {
+	server := ldap.NewLDAPServer(c)
+	if err := printStep("dial", server.DialContext(ctx)); err != nil {
+		return nil, err
+	}
+	defer server.Close()
+	ld := &types.LoginData{Name: username, Password: password}
+	// BindDN 中有 %s 时使用用户的账号密码绑定后查询
+	if strings.Contains(c.BindDN, "%s") {
+		u, err := server.LoginContext(ctx, ld)
+		return u, printStep(loginStage(err, "user bind"), err)
+	}
+	bindStage := "anonymous bind"
+	if c.BindPassword != "" || c.BindMethod == ldap.BindExternal {
+		bindStage = "admin bind"
+	}
+	if err := printStep(bindStage, server.BindContext(ctx)); err != nil {
+		return nil, err
+	}
+	if _, err := server.LookupUserContext(ctx, username); err != nil {
+		if errors.Is(err, ldap.ErrInvalidCredentials) {
+			// 查到了用户但不在配置的组中
+			err = fmt.Errorf("用户不在 groups 配置的组中: %w", err)
+		}
+		return nil, printStep(loginStage(err, "search"), err)
+	}
+	printStep("search", nil)
+	u, err := server.LoginContext(ctx, ld)
+	return u, printStep(loginStage(err, "user bind"), err)
+}
+
+// testMultiLDAP 使用重新加载 LDAP 服务的方法创建所有的服务并登录
+func testMultiLDAP(timeout time.Duration, username, password string) error {
+	servers, err := ldap.NewReloadable(newMultiLDAP)
+	if err != nil {
+		return printStep("config", err)
+	}
+	if err = printStep("reload", servers.Reload()); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, err = servers.Load().LoginContext(ctx, &types.LoginData{Name: username, Password: password})
+	return printStep("login", err)
+}
+
+// loginStage 按错误的类型判断失败的步骤，不能判断时为 stage
+func loginStage(err error, stage string) string {
+	switch {
+	case err == nil:
+		return stage
+	case errors.Is(err, ldap.ErrConnection):
+		return "connection"
+	case errors.Is(err, ldap.ErrSearchFailed), errors.Is(err, ldap.ErrCouldNotFindUser), errors.Is(err, ldap.ErrMultipleUsersFound):
+		return "search"
+	}
+	return stage
+}
+
+// printStep 输出步骤的结果，返回 err
+func printStep(stage string, err error) error {
+	if err != nil {
+		fmt.Printf("  %-15s FAILED: %v\n", stage, err)
+	} else {
+		fmt.Printf("  %-15s ok\n", stage)
+	}
+	return err
+}
+
+func printLDAPUser(u *models.User) {
+	fmt.Println("  user:")
+	fmt.Println("    login:        ", u.Login)
+	fmt.Println("    dn:           ", u.DN)
+	fmt.Println("    name:         ", u.Name)
+	fmt.Println("    email:        ", u.Email)
+	fmt.Println("    role:         ", u.Role)
+	fmt.Println("    super_admin:  ", u.SuperAdmin)
+	fmt.Println("    org_roles:    ", u.OrgRoles)
+	fmt.Println("    direct_groups:", strings.Join(u.DirectGroups, "; "))
+	fmt.Println("    groups:       ", strings.Join(u.Groups, "; "))
+}
+
+func init() {
+	ldapTestCmd.Flags().String("username", "", "用户名")
+	ldapTestCmd.MarkFlagRequired("username")
+	ldapTestCmd.Flags().String("password", "", "密码")
+	ldapTestCmd.MarkFlagRequired("password")
+	ldapTestCmd.Flags().Duration("timeout", 10*time.Second, "每个 LDAP 服务的超时时间")
+
+	ldapCmd.AddCommand(ldapTestCmd)
+	rootCmd.AddCommand(ldapCmd)
+}
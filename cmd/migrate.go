@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/db"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "数据库迁移",
+	Long:  `数据库迁移，执行过的迁移记录在 schema_migrations 表`,
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "执行所有未执行的迁移",
+	Long:  `执行所有未执行的迁移，--dry-run 时只输出会执行的 SQL，有未执行的迁移时以非 0 状态退出`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := openDB(); err != nil {
+			return err
+		}
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			return db.SetupDatabaseDryRun(db.DB)
+		}
+		ids, err := db.MigrateUp(db.DB)
+		for _, id := range ids {
+			fmt.Println("applied", id)
+		}
+		return err
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down [N]",
+	Short: "回滚最近执行的 N 个迁移，默认 1 个",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		n := 1
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+				return fmt.Errorf("N 必须是正整数: %s", args[0])
+			}
+		}
+		if err := openDB(); err != nil {
+			return err
+		}
+		ids, err := db.MigrateDown(db.DB, n)
+		for _, id := range ids {
+			fmt.Println("rolled back", id)
+		}
+		return err
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "查看迁移的执行状态",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := openDB(); err != nil {
+			return err
+		}
+		states, err := db.MigrationStatus(db.DB)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTATUS\tAPPLIED AT")
+		for _, state := range states {
+			if state.Applied {
+				fmt.Fprintf(w, "%s\tapplied\t%s\n", state.ID, state.AppliedAt.Format(time.RFC3339))
+			} else {
+				fmt.Fprintf(w, "%s\tpending\t\n", state.ID)
+			}
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	migrateUpCmd.Flags().Bool("dry-run", false, "只输出会执行的 SQL，不修改数据库")
+
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
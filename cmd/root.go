@@ -3,6 +3,7 @@ package cmd
 import (
 	"gitee.com/golden-go/golden-go/pkg/utils/config"
 	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	zl "gitee.com/golden-go/golden-go/pkg/utils/zap_logger"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
@@ -39,5 +40,14 @@ func rootInit() {
 	if err := config.InitConfig(cfgFile, "golden_go"); err != nil {
 		logger.GetLogger().Fatal("InitConfig Fail!!!", zap.Error(err))
 	}
+	if err := config.Validate(); err != nil {
+		logger.GetLogger().Fatal("配置错误!!!", zap.Error(err))
+	}
+	sc := zl.SamplingConfig{}
+	if err := config.UnmarshalKey("log.sampling", &sc); err != nil {
+		logger.GetLogger().Fatal("配置错误!!!", zap.Error(err))
+	}
+	logger.SetSampling(sc)
 	logger.Debug("config:", zap.Any("all", viper.ConfigFileUsed()))
+	config.DumpEffective()
 }
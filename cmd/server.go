@@ -1,13 +1,24 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
 	"gitee.com/golden-go/golden-go/pkg/db"
 	"gitee.com/golden-go/golden-go/pkg/server/http_server"
 	"gitee.com/golden-go/golden-go/pkg/service"
+	"gitee.com/golden-go/golden-go/pkg/utils/config"
+	"gitee.com/golden-go/golden-go/pkg/utils/gin_middleware"
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
 	"gitee.com/golden-go/golden-go/pkg/utils/jwt"
 	"gitee.com/golden-go/golden-go/pkg/utils/ldap"
 	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	"gitee.com/golden-go/golden-go/pkg/utils/oidc"
+	"gitee.com/golden-go/golden-go/pkg/utils/types"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/viper"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
@@ -26,7 +37,9 @@ var serverCmd = &cobra.Command{
 			return err
 		}
 
-		return s.ListenAndServe()
+		err = s.ListenAndServe()
+		webhookClose()
+		return err
 	},
 }
 
@@ -44,25 +57,114 @@ func init() {
 	serverCmd.Flags().BoolP("migrate", "", false, "数据库migrate")
 }
 
-func ldapInit() (iml ldap.IMultiLDAP, err error) {
-	sc := []*ldap.ServerConfig{}
-	err = viper.UnmarshalKey("auth.ldap.servers", &sc)
+// newMultiLDAP 按配置创建 LDAP 服务，不连接服务
+func newMultiLDAP() (ldap.IMultiLDAP, error) {
+	sc, err := config.LDAPServers()
 	if err != nil {
 		return nil, err
 	}
-	iml = ldap.NewMultiLDAP(sc)
-	lss, err := iml.Ping()
-	if err != nil {
+	// 重新加载配置时没有经过 config.Validate
+	for i, c := range sc {
+		if err = c.Validate(); err != nil {
+			return nil, fmt.Errorf("auth.ldap.servers[%d]: %w", i, err)
+		}
+	}
+	ml := ldap.NewMultiLDAP(sc)
+	ml.Order = ldap.ServerOrder(viper.GetString("auth.ldap.order"))
+	if viper.GetBool("http.metrics.enable") {
+		if ml.Metrics, err = ldap.NewMetrics(prometheus.DefaultRegisterer); err != nil {
+			return nil, err
+		}
+	}
+	return ml, nil
+}
+
+// ldapInit 按配置创建 LDAP 服务，有服务不可用时返回错误。
+// 连接失败时按 auth.ldap.ping_retries 重试，间隔从 auth.ldap.ping_interval 开始逐次翻倍，
+// 避免启动时 DNS 等还没就绪导致 pod 反复重启，配置错误等不是连接失败的错误不重试。
+// 只在启动时使用，重新加载配置时使用不连接服务的 newMultiLDAP
+func ldapInit() (iml ldap.IMultiLDAP, err error) {
+	if iml, err = newMultiLDAP(); err != nil {
 		return nil, err
 	}
-	for _, ls := range lss {
-		err = multierr.Append(err, ls.Error)
+	return iml, ldap.PingWithRetry(iml, viper.GetInt("auth.ldap.ping_retries"), viper.GetDuration("auth.ldap.ping_interval"))
+}
+
+// ldapInitOptional 和 ldapInit 一样，但 LDAP 服务不可用时只输出警告，以降级模式启动，
+// 本地登录等不依赖 LDAP 的接口照常使用
+func ldapInitOptional() (ldap.IMultiLDAP, error) {
+	iml, err := ldapInit()
+	if iml != nil && err != nil {
+		logger.Warn("LDAP 服务不可用，以降级模式运行", zap.Error(err))
+		return iml, nil
 	}
 	return iml, err
 }
 
+// ldapReady 至少有一个 LDAP 服务可用时就绪
+func ldapReady(ctx context.Context, iml ldap.IMultiLDAP) (err error) {
+	for _, ss := range iml.HealthCheck(ctx) {
+		if ss.Available {
+			return nil
+		}
+		err = multierr.Append(err, ss.Error)
+	}
+	if err == nil {
+		err = ldap.ErrNoLDAPServers
+	}
+	return err
+}
+
+// openDB 按配置连接数据库
+func openDB() error {
+	pc := db.PoolConfig{}
+	if err := config.UnmarshalKey("mysql", &pc); err != nil {
+		return err
+	}
+	return db.OpenDB("golden_go", viper.GetString("mysql.dsn"), viper.GetStringSlice("mysql.replicas"), pc)
+}
+
+// passwordInit 按配置设置并检查密码策略
+func passwordInit() error {
+	if err := config.UnmarshalKey("password", &service.Password); err != nil {
+		return err
+	}
+	_, err := service.HashPassword("")
+	return err
+}
+
+// auditInit 按配置设置审计日志的存储，需要先连接数据库
+func auditInit() (err error) {
+	ac := service.AuditConfig{}
+	if err = config.UnmarshalKey("audit", &ac); err != nil {
+		return err
+	}
+	service.Audit.Sink, err = service.NewAuditSink(ac, db.DB)
+	return err
+}
+
+// webhookInit 按配置开始发送用户事件的 webhook，没有配置 webhook.urls 时不发送
+func webhookInit() error {
+	wc := service.WebhookConfig{}
+	if err := config.UnmarshalKey("webhook", &wc); err != nil {
+		return err
+	}
+	service.Webhook = service.NewWebhookDispatcher(wc)
+	service.Webhook.Start()
+	return nil
+}
+
+// webhookClose 等待队列中的 webhook 发送完成，最多等待 listen.shutdown_timeout
+func webhookClose() {
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("listen.shutdown_timeout"))
+	defer cancel()
+	if err := service.Webhook.Close(ctx); err != nil {
+		logger.Warn("等待 webhook 发送超时!!!", zap.Error(err))
+	}
+}
+
 func serverInit(cmd *cobra.Command) (s *http_server.HttpServer, err error) {
-	if err = db.OpenDB("golden_go", viper.GetString("mysql.dsn")); err != nil {
+	if err = openDB(); err != nil {
 		return nil, err
 	}
 	if migrate, _ := cmd.Flags().GetBool("migrate"); migrate {
@@ -70,24 +172,158 @@ func serverInit(cmd *cobra.Command) (s *http_server.HttpServer, err error) {
 			return nil, err
 		}
 	}
-	if err = service.GetUserServiceDB(db.DB).InitSuperAdmin(); err != nil {
+	if err = passwordInit(); err != nil {
 		return nil, err
 	}
-	s = http_server.NewHttpServer(viper.GetString("env"), viper.GetString("listen"))
-	gj, err := jwt.NewGoldenJwt(viper.GetInt("jwt.exp"), viper.GetString("jwt.publicKey"), viper.GetString("jwt.privateKey"))
+	if err = config.UnmarshalKey("auth.normalize", &types.Normalize); err != nil {
+		return nil, err
+	}
+	service.Lockout.MaxAttempts = viper.GetInt("auth.lockout.max_attempts")
+	service.Lockout.Window = viper.GetDuration("auth.lockout.window")
+	service.Lockout.Duration = viper.GetDuration("auth.lockout.duration")
+	if err = auditInit(); err != nil {
+		return nil, err
+	}
+	if err = webhookInit(); err != nil {
+		return nil, err
+	}
+	ac := service.SuperAdminConfig{}
+	if err = config.UnmarshalKey("admin", &ac); err != nil {
+		return nil, err
+	}
+	if err = service.GetUserServiceDB(db.DB).InitSuperAdmin(ac); err != nil {
+		return nil, err
+	}
+	s = http_server.NewHttpServer(viper.GetString("env"), config.ListenAddr())
+	s.SetShutdownTimeout(viper.GetDuration("listen.shutdown_timeout"))
+	s.CertFile = viper.GetString("listen.tls.cert_file")
+	s.KeyFile = viper.GetString("listen.tls.key_file")
+	s.ClientCAFile = viper.GetString("listen.tls.client_ca_file")
+	s.ClientAuth = http_server.ClientAuthType(viper.GetString("listen.tls.client_auth"))
+	if err = config.UnmarshalKey("listen.listeners", &s.Listeners); err != nil {
+		return nil, err
+	}
+	s.ReadTimeout = viper.GetDuration("listen.timeouts.read")
+	s.ReadHeaderTimeout = viper.GetDuration("listen.timeouts.read_header")
+	s.WriteTimeout = viper.GetDuration("listen.timeouts.write")
+	s.IdleTimeout = viper.GetDuration("listen.timeouts.idle")
+	s.EnableMetrics = viper.GetBool("http.metrics.enable")
+	s.EnablePprof = viper.GetBool("debug.pprof")
+	s.EnableSwagger = viper.GetBool("http.swagger.enable")
+	s.TrustedProxies = viper.GetStringSlice("http.trusted_proxies")
+	s.BasePath = viper.GetString("http.base_path")
+	s.LegacyRoutes = viper.GetBool("http.legacy_routes")
+	prk := viper.GetString("jwt.privateKey")
+	if strings.HasPrefix(viper.GetString("jwt.alg"), "HS") {
+		prk = viper.GetString("jwt.secret")
+	}
+	gj, err := jwt.NewGoldenJwtWithAlg(viper.GetString("jwt.alg"), viper.GetInt("jwt.exp"), viper.GetString("jwt.publicKey"), prk,
+		viper.GetString("jwt.issuer"), viper.GetStringSlice("jwt.audience"))
 	if err != nil {
 		return nil, err
 	}
+	gj.Leeway = viper.GetDuration("jwt.leeway")
+	gj.RefreshExp = viper.GetInt("jwt.refresh_exp")
+	if err = config.UnmarshalKey("jwt.cookie", &gj.Cookie); err != nil {
+		return nil, err
+	}
+	gj.UnauthorizedHandler = func(c *gin.Context, code int, err error) {
+		r := ghttp.CommonErrResult(err)
+		r.Code = code
+		c.AbortWithStatusJSON(http.StatusUnauthorized, r)
+	}
 
-	s.AddMiddleware(gj.GinJwtMiddleware, db.GormMiddleware())
+	if n := viper.GetInt("http.max_concurrent"); n > 0 {
+		// 放在其它中间件之前，超过并发限制的请求不再做其它处理
+		cl := gin_middleware.NewConcurrencyLimiter(gin_middleware.ConcurrencyConfig{
+			MaxConcurrent: n,
+			MaxQueued:     viper.GetInt("http.max_queued"),
+			QueueTimeout:  viper.GetDuration("http.queue_timeout"),
+		})
+		if s.EnableMetrics {
+			if err = cl.Register(prometheus.DefaultRegisterer); err != nil {
+				return nil, err
+			}
+		}
+		s.AddMiddleware(cl.Handler())
+	}
+	s.AddMiddleware(gin_middleware.GinMaxBodySize(viper.GetInt64("http.max_body_bytes")))
+	if viper.GetBool("http.security_headers.enable") {
+		sc := gin_middleware.SecurityHeadersConfig{}
+		if err = config.UnmarshalKey("http.security_headers", &sc); err != nil {
+			return nil, err
+		}
+		s.AddMiddleware(gin_middleware.GinSecurityHeaders(sc))
+	}
+	if viper.GetBool("http.cors.enable") {
+		cc := gin_middleware.CORSConfig{}
+		if err = config.UnmarshalKey("http.cors", &cc); err != nil {
+			return nil, err
+		}
+		s.AddMiddleware(gin_middleware.GinCORS(cc))
+	}
+	s.AddReadinessCheck("db", func(ctx context.Context) error {
+		sqlDB, err := db.DB.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	})
+	var ids []jwt.CertIdentity
+	if err = config.UnmarshalKey("auth.mtls.identities", &ids); err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		// 需要在 token 校验之前，携带匹配的客户端证书的请求不校验 token
+		s.AddMiddleware(jwt.GinClientCertMiddleware(ids))
+	}
+	s.AddMiddleware(gj.GinJwtMiddlewareWithSkipper(jwt.PathSkipper(jwt.PublicPaths(s.BasePaths()...)...)), db.GormMiddlewareWithTimeout(viper.GetDuration("mysql.query_timeout")))
+	if viper.GetBool("http.ratelimit.enable") {
+		rl := gin_middleware.NewRateLimiter(gin_middleware.RateLimitConfig{
+			Rate:  viper.GetFloat64("http.ratelimit.rate"),
+			Burst: viper.GetInt("http.ratelimit.burst"),
+		})
+		s.AddMiddleware(rl.Handler())
+		config.OnReload(func() {
+			rl.SetLimit(viper.GetFloat64("http.ratelimit.rate"), viper.GetInt("http.ratelimit.burst"))
+		})
+	}
 	if viper.GetBool("auth.ldap.enable") {
 		logger.Debug("ldap 开启")
-		iml, err := ldapInit()
+		build, addReadinessCheck := ldapInit, s.AddReadinessCheck
+		if !viper.GetBool("auth.ldap.required") {
+			build, addReadinessCheck = ldapInitOptional, s.AddOptionalReadinessCheck
+		}
+		iml, err := build()
 		if err != nil {
 			return nil, err
 		}
+		// 修改配置文件后重新创建 LDAP 服务，进行中的登录继续使用原来的服务。
+		// 重新加载时不连接服务，避免阻塞其它配置的重新加载，服务是否可用由就绪检查判断
+		servers := ldap.NewReloadableWith(iml, newMultiLDAP)
+		config.OnReload(func() {
+			if err := servers.Reload(); err != nil {
+				logger.Warn("重新加载 LDAP 配置失败!!!错误信息：", zap.Error(err))
+				return
+			}
+			logger.Info("LDAP 配置已重新加载")
+		})
+		s.AddMiddleware(func(c *gin.Context) {
+			c.Set("IML", servers.Load())
+		})
+		addReadinessCheck("ldap", func(ctx context.Context) error {
+			return ldapReady(ctx, servers.Load())
+		})
+	}
+	if viper.GetBool("auth.oidc.enable") {
+		logger.Debug("oidc 开启")
+		oc := &oidc.Config{}
+		if err = config.UnmarshalKey("auth.oidc", oc); err != nil {
+			return nil, err
+		}
+		p := oidc.NewProvider(oc)
 		s.AddMiddleware(func(c *gin.Context) {
-			c.Set("IML", iml)
+			c.Set("OIDC", p)
 		})
 	}
 	return
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"gitee.com/golden-go/golden-go/pkg/db"
+	"gitee.com/golden-go/golden-go/pkg/models"
+	"gitee.com/golden-go/golden-go/pkg/service"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/spf13/cobra"
+)
+
+// cliActor 命令行操作在审计日志中的操作人
+const cliActor = "cli"
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "用户管理",
+	Long:  `直接连接数据库管理用户，HTTP 服务不可用时使用`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := openDB(); err != nil {
+			return err
+		}
+		if err := passwordInit(); err != nil {
+			return err
+		}
+		if err := auditInit(); err != nil {
+			return err
+		}
+		return webhookInit()
+	},
+	// 只有操作成功时才会发送 webhook，失败时不执行 PersistentPostRun 也没有需要等待的事件
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		webhookClose()
+	},
+}
+
+var userSetPasswordCmd = &cobra.Command{
+	Use:   "set-password",
+	Short: "重置用户密码",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		username, _ := cmd.Flags().GetString("username")
+		password, _ := cmd.Flags().GetString("password")
+		return patchUser(service.GetUserServiceDB(db.DB), username, &models.UserPatch{Password: &password})
+	},
+}
+
+var userDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "禁用用户",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		username, _ := cmd.Flags().GetString("username")
+		disabled := true
+		return patchUser(service.GetUserServiceDB(db.DB), username, &models.UserPatch{Disabled: &disabled})
+	},
+}
+
+var userCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "创建用户",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		uc := &models.UserCreate{}
+		uc.Name, _ = cmd.Flags().GetString("username")
+		uc.Password, _ = cmd.Flags().GetString("password")
+		uc.DisplayName, _ = cmd.Flags().GetString("display-name")
+		uc.Email, _ = cmd.Flags().GetString("email")
+		uc.Role, _ = cmd.Flags().GetString("role")
+		uc.SuperAdmin, _ = cmd.Flags().GetBool("super-admin")
+		if err := binding.Validator.ValidateStruct(uc); err != nil {
+			return err
+		}
+		u := uc.User()
+		err := service.GetUserServiceDB(db.DB).CreateUser(u)
+		record(models.AuditUserCreate, u, err)
+		if err != nil {
+			return err
+		}
+		fmt.Println("created", u.Name, u.ID)
+		return nil
+	},
+}
+
+// patchUser 按用户名部分更新用户，和 PATCH /user/:userid 一样校验参数，
+// 版本号使用查询到的用户当前的版本号
+func patchUser(us service.UserService, username string, p *models.UserPatch) error {
+	if username == "" {
+		return errors.New("--username 不能为空")
+	}
+	u, err := us.GetUserWithName(username)
+	if err != nil {
+		return fmt.Errorf("查询用户 %s 失败: %w", username, err)
+	}
+	p.Version = &u.Version
+	if err := binding.Validator.ValidateStruct(p); err != nil {
+		return err
+	}
+	err = us.PatchUser(int(u.ID), p)
+	record(models.AuditUserUpdate, &u, err)
+	if err != nil {
+		return err
+	}
+	fmt.Println("updated", u.Name)
+	return nil
+}
+
+// record 和 HTTP 接口一样记录审计日志，操作成功时发送 webhook
+func record(action string, u *models.User, err error) {
+	l := &models.AuditLog{Actor: cliActor, Action: action, TargetID: u.ID, TargetName: u.Name, Success: err == nil, Error: errorString(err)}
+	service.Audit.Record(l)
+	if l.Success && service.WebhookEvents[action] {
+		service.Webhook.Send(&service.WebhookEvent{Type: action, UserID: u.ID, UserName: u.Name, Actor: cliActor, Time: l.Time})
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func init() {
+	for _, c := range []*cobra.Command{userSetPasswordCmd, userDisableCmd, userCreateCmd} {
+		c.Flags().String("username", "", "用户名")
+		c.MarkFlagRequired("username")
+	}
+	userSetPasswordCmd.Flags().String("password", "", "新密码")
+	userSetPasswordCmd.MarkFlagRequired("password")
+	userCreateCmd.Flags().String("password", "", "密码")
+	userCreateCmd.MarkFlagRequired("password")
+	userCreateCmd.Flags().String("display-name", "", "显示名称")
+	userCreateCmd.Flags().String("email", "", "邮箱地址")
+	userCreateCmd.Flags().String("role", "", "角色")
+	userCreateCmd.Flags().Bool("super-admin", false, "是否是超级用户")
+
+	userCmd.AddCommand(userSetPasswordCmd, userDisableCmd, userCreateCmd)
+	rootCmd.AddCommand(userCmd)
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+	"gitee.com/golden-go/golden-go/pkg/service"
+)
+
+// fakeUserService 只实现 patchUser 用到的方法
+type fakeUserService struct {
+	service.UserService
+	user    models.User
+	id      int
+	patched *models.UserPatch
+}
+
+func (f *fakeUserService) GetUserWithName(name string) (models.User, error) {
+	return f.user, nil
+}
+
+func (f *fakeUserService) PatchUser(id int, p *models.UserPatch) error {
+	f.id, f.patched = id, p
+	return nil
+}
+
+func TestPatchUserUsesCurrentVersion(t *testing.T) {
+	us := &fakeUserService{user: models.User{ID: 2, Name: "jdoe", Version: 5}}
+	password := "new-password"
+	if err := patchUser(us, "jdoe", &models.UserPatch{Password: &password}); err != nil {
+		t.Fatal(err)
+	}
+	if us.id != 2 || us.patched.Version == nil || *us.patched.Version != 5 {
+		t.Errorf("expected user 2 to be patched with version 5, got %d %+v", us.id, us.patched)
+	}
+
+	short := "short"
+	if err := patchUser(us, "jdoe", &models.UserPatch{Password: &short}); err == nil {
+		t.Error("expected the password to be validated")
+	}
+	if err := patchUser(us, "", &models.UserPatch{}); err == nil {
+		t.Error("expected an error without a username")
+	}
+}
+
+func TestPatchUserSendsWebhook(t *testing.T) {
+	received := make(chan service.WebhookEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := service.WebhookEvent{}
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Error(err)
+		}
+		received <- e
+	}))
+	defer srv.Close()
+	old := service.Webhook
+	defer func() { service.Webhook = old }()
+	service.Webhook = service.NewWebhookDispatcher(service.WebhookConfig{URLs: []string{srv.URL}, Timeout: time.Second, QueueSize: 10})
+	service.Webhook.Start()
+
+	us := &fakeUserService{user: models.User{ID: 2, Name: "jdoe", Version: 5}}
+	disabled := true
+	if err := patchUser(us, "jdoe", &models.UserPatch{Disabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Webhook.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-received:
+		if e.Type != models.AuditUserUpdate || e.UserID != 2 || e.UserName != "jdoe" || e.Actor != cliActor {
+			t.Errorf("unexpected event %+v", e)
+		}
+	default:
+		t.Fatal("expected the update to be sent to the webhook")
+	}
+}
@@ -1,7 +1,12 @@
 package db
 
 import (
+	"database/sql"
+	"time"
+
 	"gitee.com/golden-go/golden-go/pkg/models"
+	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	"go.uber.org/zap"
 
 	"gorm.io/gorm"
 )
@@ -10,3 +15,31 @@ var (
 	DB               *gorm.DB
 	ModelWithHistory = []interface{}{&models.User{}}
 )
+
+// PoolConfig 数据库连接池配置
+type PoolConfig struct {
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`    //最大连接数，0 表示不限制
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`    //最大空闲连接数
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"` //连接最长使用时间，应小于 MySQL 的 wait_timeout，0 表示不限制
+	PingRetries     int           `mapstructure:"ping_retries"`      //启动时连接失败的重试次数
+	PingInterval    time.Duration `mapstructure:"ping_interval"`     //重试间隔
+}
+
+// setupPool 设置连接池，并等待数据库可以连接
+func setupPool(sqlDB *sql.DB, pc PoolConfig) error {
+	sqlDB.SetMaxOpenConns(pc.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(pc.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(pc.ConnMaxLifetime)
+	return pingWithRetry(sqlDB.Ping, pc.PingRetries, pc.PingInterval)
+}
+
+// pingWithRetry 连接失败时重试 retries 次，数据库可能还在启动
+func pingWithRetry(ping func() error, retries int, interval time.Duration) (err error) {
+	for i := 0; ; i++ {
+		if err = ping(); err == nil || i >= retries {
+			return err
+		}
+		logger.Warn("数据库连接失败，等待重试", zap.Int("retry", i+1), zap.Duration("interval", interval), zap.Error(err))
+		time.Sleep(interval)
+	}
+}
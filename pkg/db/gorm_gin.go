@@ -1,41 +1,189 @@
 package db
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"net/http"
+	"time"
 
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
 	"gitee.com/golden-go/golden-go/pkg/utils/logger"
 	"github.com/gin-gonic/gin"
 	jwtgo "github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 )
 
+// UsePrimaryKey gin context 中为 true 时 GormMiddleware 设置的数据库接口查询也使用主库
+const UsePrimaryKey = "DB_USE_PRIMARY"
+
+// GormMiddleware 设置使用请求 context 的数据库接口，请求取消（例如客户端断开）时正在执行的查询也会取消
 func GormMiddleware() gin.HandlerFunc {
+	return GormMiddlewareWithTimeout(0)
+}
+
+// GormMiddlewareWithTimeout 和 GormMiddleware 一样，但请求中的数据库操作最多执行 timeout，
+// 超时后取消查询，timeout 小于等于 0 时不超时
+func GormMiddlewareWithTimeout(timeout time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx := context.Background()
-		defer func() {
-			c.Set("DB", DB.WithContext(ctx))
-		}()
+		ctx := gormContext(c)
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		tx := DB.WithContext(ctx)
+		if c.GetBool(UsePrimaryKey) {
+			tx = usePrimary(tx)
+		}
+		c.Set("DB", tx)
 		logger.Debug("设置数据库接口成功！！！")
-		golden_claims_I, exists := c.Get("golden_claims")
-		if !exists {
+		c.Next()
+	}
+}
+
+// UsePrimary 之后的查询都使用主库，用于写入后立即读取，避免从库同步延迟读到旧数据
+func UsePrimary(c *gin.Context) {
+	c.Set(UsePrimaryKey, true)
+	if tx, ok := c.Value("DB").(*gorm.DB); ok {
+		c.Set("DB", usePrimary(tx))
+	}
+}
+
+func usePrimary(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(dbresolver.Write).Session(&gorm.Session{})
+}
+
+// GormTransactionMiddleware 和 GormMiddleware 一样设置数据库接口，但每个请求都在一个事务中执行。
+// 处理完成后响应状态码为 2xx 并且没有通过 c.Error 记录错误时提交事务，否则回滚；
+// panic 时先回滚事务再继续 panic，交给 Recovery 处理。
+// 处理函数的响应先缓存，事务提交后再写给客户端，提交失败时丢弃缓存的响应并返回 500。
+// 只读接口不需要事务，应该使用 GormMiddleware。
+func GormTransactionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tx := DB.WithContext(gormContext(c)).Begin()
+		if tx.Error != nil {
+			logger.Error("开启事务失败！！！", zap.Error(tx.Error))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ghttp.CommonErrResult(tx.Error))
 			return
 		}
-		golden_claims, ok := golden_claims_I.(jwtgo.MapClaims)
-		if !ok {
-			logger.Error("转换golden_claims失败")
+		c.Set("DB", tx)
+		logger.Debug("设置数据库事务接口成功！！！")
+
+		w := &bufferedWriter{ResponseWriter: c.Writer, status: http.StatusOK}
+		c.Writer = w
+		committed := false
+		defer func() {
+			c.Writer = w.ResponseWriter
+			if committed {
+				return
+			}
+			if err := tx.Rollback().Error; err != nil {
+				logger.Error("回滚事务失败！！！", zap.Error(err))
+			}
+		}()
+
+		c.Next()
+
+		c.Writer = w.ResponseWriter
+		if status := w.Status(); status < 200 || status > 299 || len(c.Errors) > 0 {
+			logger.Debug("请求失败，回滚事务", zap.Int("status", status))
+			w.flush()
 			return
 		}
-		if golden_claims["name"] != nil {
-			ctx = context.WithValue(ctx, "userid", fmt.Sprintf("%v", golden_claims["name"]))
-			ctx = context.WithValue(ctx, "username", fmt.Sprintf("%v", golden_claims["name"]))
-		} else {
-			ctx = context.WithValue(ctx, "userid", "nobody")
-			ctx = context.WithValue(ctx, "username", "nobody")
-		}
-		if golden_claims["display_name"] != nil {
-			ctx = context.WithValue(ctx, "username", fmt.Sprintf("%v", golden_claims["display_name"]))
+		committed = true
+		if err := tx.Commit().Error; err != nil {
+			logger.Error("提交事务失败！！！", zap.Error(err))
+			c.AbortWithStatusJSON(http.StatusInternalServerError, ghttp.CommonErrResult(err))
+			return
 		}
+		w.flush()
+	}
+}
 
+// bufferedWriter 缓存响应的状态码和内容，flush 时才写入 ResponseWriter，header 直接写入 ResponseWriter
+type bufferedWriter struct {
+	gin.ResponseWriter
+	status  int
+	written bool
+	body    bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
 	}
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
 
+func (w *bufferedWriter) Written() bool {
+	return w.written
+}
+
+// Flush 缓存的响应要等事务结束才能写出
+func (w *bufferedWriter) Flush() {}
+
+// flush 把缓存的响应写入 ResponseWriter
+func (w *bufferedWriter) flush() {
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.WriteHeaderNow()
+	if w.body.Len() > 0 {
+		if _, err := w.ResponseWriter.Write(w.body.Bytes()); err != nil {
+			logger.Warn("写入响应失败！！！", zap.Error(err))
+		}
+	}
+}
+
+// gormContext 数据库操作的 context，记录当前登录用户，请求取消时随之取消
+func gormContext(c *gin.Context) context.Context {
+	ctx := context.Background()
+	if c.Request != nil {
+		ctx = c.Request.Context()
+	}
+	golden_claims_I, exists := c.Get("golden_claims")
+	if !exists {
+		return ctx
+	}
+	golden_claims, ok := golden_claims_I.(jwtgo.MapClaims)
+	if !ok {
+		logger.Error("转换golden_claims失败")
+		return ctx
+	}
+	if golden_claims["name"] != nil {
+		ctx = context.WithValue(ctx, "userid", fmt.Sprintf("%v", golden_claims["name"]))
+		ctx = context.WithValue(ctx, "username", fmt.Sprintf("%v", golden_claims["name"]))
+	} else {
+		ctx = context.WithValue(ctx, "userid", "nobody")
+		ctx = context.WithValue(ctx, "username", "nobody")
+	}
+	if golden_claims["display_name"] != nil {
+		ctx = context.WithValue(ctx, "username", fmt.Sprintf("%v", golden_claims["display_name"]))
+	}
+	return ctx
 }
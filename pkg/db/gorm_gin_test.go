@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// fakeConnPool 记录事务的提交和回滚
+type fakeConnPool struct {
+	gorm.ConnPool
+	committed  int
+	rolledBack int
+	commitErr  error
+}
+
+func (p *fakeConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return &fakeTx{p}, nil
+}
+
+type fakeTx struct {
+	*fakeConnPool
+}
+
+func (tx *fakeTx) Commit() error {
+	tx.committed++
+	return tx.commitErr
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.rolledBack++
+	return nil
+}
+
+func TestGormTransactionMiddleware(t *testing.T) {
+	pool := &fakeConnPool{}
+	var err error
+	DB, err = gorm.Open(mysql.New(mysql.Config{Conn: pool, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { DB = nil }()
+
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(gin.Recovery(), GormTransactionMiddleware())
+	g.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	g.GET("/fail", func(c *gin.Context) { c.Status(http.StatusBadRequest) })
+	g.GET("/error", func(c *gin.Context) {
+		c.Error(errors.New("failed"))
+		c.Status(http.StatusOK)
+	})
+	g.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	tests := []struct {
+		path       string
+		committed  int
+		rolledBack int
+	}{
+		{"/ok", 1, 0},
+		{"/fail", 1, 1},
+		{"/error", 1, 2},
+		{"/panic", 1, 3},
+	}
+	for _, test := range tests {
+		g.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, test.path, nil))
+		if pool.committed != test.committed || pool.rolledBack != test.rolledBack {
+			t.Errorf("%s: expected %d commits %d rollbacks, got %d %d",
+				test.path, test.committed, test.rolledBack, pool.committed, pool.rolledBack)
+		}
+	}
+}
+
+func TestGormTransactionMiddlewareCommitFailed(t *testing.T) {
+	pool := &fakeConnPool{}
+	var err error
+	DB, err = gorm.Open(mysql.New(mysql.Config{Conn: pool, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { DB = nil }()
+
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(gin.Recovery(), GormTransactionMiddleware())
+	g.POST("/ok", func(c *gin.Context) {
+		c.Header("X-Test", "1")
+		c.JSON(http.StatusCreated, gin.H{"ok": true})
+	})
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ok", nil))
+	if w.Code != http.StatusCreated || w.Body.String() != `{"ok":true}` || w.Header().Get("X-Test") != "1" {
+		t.Errorf("expected the response after the commit, got %d %s %v", w.Code, w.Body, w.Header())
+	}
+
+	// 提交失败时处理函数的响应不能写给客户端
+	pool.commitErr = errors.New("commit failed")
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/ok", nil))
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "ok") {
+		t.Errorf("expected 500 after the commit failed, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestUsePrimary(t *testing.T) {
+	var err error
+	DB, err = gorm.Open(mysql.New(mysql.Config{Conn: &fakeConnPool{}, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { DB = nil }()
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	GormMiddleware()(c)
+	if _, ok := c.MustGet("DB").(*gorm.DB).Statement.Clauses[dbresolver.Write.Name()]; ok {
+		t.Error("expected reads to use the replicas by default")
+	}
+	UsePrimary(c)
+	if _, ok := c.MustGet("DB").(*gorm.DB).Statement.Clauses[dbresolver.Write.Name()]; !ok {
+		t.Error("expected reads to use the primary after UsePrimary")
+	}
+}
+
+// slowConnPool 的查询一直执行到 ctx 取消
+type slowConnPool struct {
+	gorm.ConnPool
+}
+
+func (p *slowConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(10 * time.Second):
+		return nil, errors.New("query was not canceled")
+	}
+}
+
+func TestGormMiddlewareCancelsQueries(t *testing.T) {
+	var err error
+	DB, err = gorm.Open(mysql.New(mysql.Config{Conn: &slowConnPool{}, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { DB = nil }()
+
+	gin.SetMode(gin.TestMode)
+	for _, tc := range []struct {
+		name    string
+		timeout time.Duration
+		cancel  bool
+		err     error
+	}{
+		{"request canceled", 0, true, context.Canceled},
+		{"query timeout", 50 * time.Millisecond, false, context.DeadlineExceeded},
+	} {
+		var queryErr error
+		g := gin.New()
+		g.Use(GormMiddlewareWithTimeout(tc.timeout))
+		g.GET("/slow", func(c *gin.Context) {
+			var n int
+			queryErr = c.MustGet("DB").(*gorm.DB).Raw("SELECT SLEEP(10)").Scan(&n).Error
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		if tc.cancel {
+			time.AfterFunc(50*time.Millisecond, cancel)
+		}
+		start := time.Now()
+		g.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil).WithContext(ctx))
+		cancel()
+		if !errors.Is(queryErr, tc.err) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.err, queryErr)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: query took %s", tc.name, elapsed)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPingWithRetry(t *testing.T) {
+	calls := 0
+	ping := func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	if err := pingWithRetry(ping, 5, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 pings, got %d", calls)
+	}
+
+	calls = 0
+	if err := pingWithRetry(func() error { calls++; return errors.New("down") }, 2, time.Millisecond); err == nil {
+		t.Error("expected an error after the retries")
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 pings, got %d", calls)
+	}
+}
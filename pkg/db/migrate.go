@@ -0,0 +1,282 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Migration 数据库迁移，按注册顺序执行，ID 不能重复，执行过的迁移记录在 schema_migrations 表
+type Migration struct {
+	ID   string
+	Up   func(tx *gorm.DB) error
+	Down func(tx *gorm.DB) error
+}
+
+// SchemaMigration 已执行的迁移
+type SchemaMigration struct {
+	ID        string    `gorm:"column:id;primaryKey;size:191"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationState 迁移的执行状态
+type MigrationState struct {
+	ID        string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// ErrPendingMigrations dry run 时有未执行的迁移
+var ErrPendingMigrations = errors.New("有未执行的迁移")
+
+var migrations = []*Migration{
+	{
+		ID: "0001_auto_migrate",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(ModelWithHistory...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(ModelWithHistory...)
+		},
+	},
+	{
+		ID: "0002_user_groups",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.UserGroup{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.UserGroup{})
+		},
+	},
+	{
+		ID: "0003_audit_logs",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.AuditLog{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.AuditLog{})
+		},
+	},
+	{
+		// 0001 在新建的库中已经按当前的模型创建了 version
+		ID: "0004_user_version",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&models.User{}, "Version") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&models.User{}, "Version")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.User{}, "Version")
+		},
+	},
+	{
+		// 0001 在新建的库中已经按当前的模型创建了 external_id 和索引
+		ID: "0005_user_external_id",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if !m.HasColumn(&models.User{}, "ExternalID") {
+				if err := m.AddColumn(&models.User{}, "ExternalID"); err != nil {
+					return err
+				}
+			}
+			if m.HasIndex(&models.User{}, "ExternalID") {
+				return nil
+			}
+			return m.CreateIndex(&models.User{}, "ExternalID")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.User{}, "ExternalID")
+		},
+	},
+}
+
+// RegisterMigration 注册迁移，在 MigrateUp 之前调用
+func RegisterMigration(m *Migration) error {
+	if m.ID == "" || m.Up == nil {
+		return errors.New("迁移的 ID 和 Up 不能为空")
+	}
+	for _, registered := range migrations {
+		if registered.ID == m.ID {
+			return fmt.Errorf("迁移 %s 已经注册", m.ID)
+		}
+	}
+	migrations = append(migrations, m)
+	return nil
+}
+
+// MigrateUp 按顺序执行所有未执行的迁移，返回本次执行的迁移 ID
+func MigrateUp(db *gorm.DB) (ids []string, err error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range pendingMigrations(migrations, applied) {
+		logger.Info("执行迁移", zap.String("id", m.ID))
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{ID: m.ID, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return ids, fmt.Errorf("执行迁移 %s 失败: %w", m.ID, err)
+		}
+		ids = append(ids, m.ID)
+	}
+	return ids, nil
+}
+
+// MigrateDown 按相反顺序回滚最近执行的 n 个迁移，返回本次回滚的迁移 ID
+func MigrateDown(db *gorm.DB, n int) (ids []string, err error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	rollback, err := rollbackMigrations(migrations, applied, n)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range rollback {
+		logger.Info("回滚迁移", zap.String("id", m.ID))
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{ID: m.ID}).Error
+		})
+		if err != nil {
+			return ids, fmt.Errorf("回滚迁移 %s 失败: %w", m.ID, err)
+		}
+		ids = append(ids, m.ID)
+	}
+	return ids, nil
+}
+
+// MigrationStatus 所有注册的迁移的执行状态
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		state := MigrationState{ID: m.ID}
+		if sm, ok := applied[m.ID]; ok {
+			state.Applied = true
+			state.AppliedAt = &sm.AppliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// appliedMigrations 已执行的迁移，schema_migrations 表不存在时创建
+func appliedMigrations(db *gorm.DB) (map[string]SchemaMigration, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var sms []SchemaMigration
+	if err := db.Find(&sms).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[string]SchemaMigration, len(sms))
+	for _, sm := range sms {
+		applied[sm.ID] = sm
+	}
+	return applied, nil
+}
+
+// pendingMigrations 未执行的迁移
+func pendingMigrations(ms []*Migration, applied map[string]SchemaMigration) (pending []*Migration) {
+	for _, m := range ms {
+		if _, ok := applied[m.ID]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return
+}
+
+// rollbackMigrations 需要回滚的 n 个迁移，按回滚顺序排列
+func rollbackMigrations(ms []*Migration, applied map[string]SchemaMigration, n int) (rollback []*Migration, err error) {
+	for i := len(ms) - 1; i >= 0 && len(rollback) < n; i-- {
+		m := ms[i]
+		if _, ok := applied[m.ID]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return nil, fmt.Errorf("迁移 %s 不能回滚", m.ID)
+		}
+		rollback = append(rollback, m)
+	}
+	return
+}
+
+// MigrateUpDryRun 返回执行所有未执行的迁移会执行的 SQL，不修改数据库。
+// 查询仍然在数据库上执行，用于判断表和列是否存在，写操作只记录不执行
+func MigrateUpDryRun(db *gorm.DB) (sqls []string, err error) {
+	pool := &dryRunConnPool{ConnPool: db.Statement.ConnPool, explain: db.Dialector.Explain}
+	// 写操作不能使用事务，否则会在真实的连接上执行
+	tx := db.Session(&gorm.Session{NewDB: true, SkipDefaultTransaction: true})
+	tx.Statement.ConnPool = pool
+	applied := map[string]SchemaMigration{}
+	if tx.Migrator().HasTable(&SchemaMigration{}) {
+		if applied, err = appliedMigrations(tx); err != nil {
+			return pool.sqls, err
+		}
+	} else if err = tx.AutoMigrate(&SchemaMigration{}); err != nil {
+		return pool.sqls, err
+	}
+	for _, m := range pendingMigrations(migrations, applied) {
+		if err = m.Up(tx); err != nil {
+			return pool.sqls, fmt.Errorf("迁移 %s 失败: %w", m.ID, err)
+		}
+		if err = tx.Create(&SchemaMigration{ID: m.ID, AppliedAt: time.Now()}).Error; err != nil {
+			return pool.sqls, err
+		}
+	}
+	return pool.sqls, nil
+}
+
+// dryRunConnPool 记录写操作的 SQL 而不执行，查询使用 ConnPool 执行。
+// 实现 gorm.TxCommitter 使 dbresolver 把它当作事务，不切换到其他连接
+type dryRunConnPool struct {
+	gorm.ConnPool
+	explain func(sql string, vars ...interface{}) string
+	sqls    []string
+}
+
+func (p *dryRunConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	p.sqls = append(p.sqls, p.explain(query, args...))
+	return dryRunResult{}, nil
+}
+
+func (p *dryRunConnPool) Commit() error {
+	return nil
+}
+
+func (p *dryRunConnPool) Rollback() error {
+	return nil
+}
+
+// dryRunResult 没有执行的写操作的结果
+type dryRunResult struct{}
+
+func (dryRunResult) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+func (dryRunResult) RowsAffected() (int64, error) {
+	return 0, nil
+}
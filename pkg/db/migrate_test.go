@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func migrationIDs(ms []*Migration) (ids []string) {
+	for _, m := range ms {
+		ids = append(ids, m.ID)
+	}
+	return
+}
+
+func TestPendingAndRollbackMigrations(t *testing.T) {
+	ms := []*Migration{{ID: "0001"}, {ID: "0002"}, {ID: "0003"}}
+	applied := map[string]SchemaMigration{"0001": {ID: "0001"}, "0002": {ID: "0002"}}
+
+	if ids := migrationIDs(pendingMigrations(ms, applied)); !reflect.DeepEqual(ids, []string{"0003"}) {
+		t.Errorf("expected 0003 pending, got %v", ids)
+	}
+
+	if _, err := rollbackMigrations(ms, applied, 1); err == nil {
+		t.Error("expected an error for a migration without Down")
+	}
+	for _, m := range ms {
+		m.Down = func(tx *gorm.DB) error { return nil }
+	}
+	rollback, err := rollbackMigrations(ms, applied, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := migrationIDs(rollback); !reflect.DeepEqual(ids, []string{"0002", "0001"}) {
+		t.Errorf("expected 0002 0001 rolled back in order, got %v", ids)
+	}
+}
+
+func TestRegisterMigration(t *testing.T) {
+	defer func(ms []*Migration) { migrations = ms }(migrations)
+
+	if err := RegisterMigration(&Migration{ID: migrations[0].ID, Up: migrations[0].Up}); err == nil {
+		t.Error("expected an error for a duplicated ID")
+	}
+	if err := RegisterMigration(&Migration{ID: "0002_test", Up: migrations[0].Up}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDryRunConnPool(t *testing.T) {
+	pool := &dryRunConnPool{explain: func(sql string, vars ...interface{}) string { return sql }}
+	if _, ok := interface{}(pool).(gorm.TxCommitter); !ok {
+		t.Error("expected dryRunConnPool to be a gorm.TxCommitter")
+	}
+	result, err := pool.ExecContext(context.Background(), "CREATE TABLE `t` (`id` bigint)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := result.LastInsertId(); err != nil || id != 0 {
+		t.Errorf("expected LastInsertId 0, got %d %v", id, err)
+	}
+	if !reflect.DeepEqual(pool.sqls, []string{"CREATE TABLE `t` (`id` bigint)"}) {
+		t.Errorf("expected the SQL recorded, got %v", pool.sqls)
+	}
+}
@@ -10,11 +10,15 @@ import (
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/schema"
+	"gorm.io/plugin/dbresolver"
 )
 
-func OpenDB(serviceName, dsn string) (err error) {
+// OpenDB 连接数据库，配置了 replicas 时查询使用从库，写操作和事务使用主库
+func OpenDB(serviceName, dsn string, replicas []string, pc PoolConfig) (err error) {
 
 	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
+		// 由 setupPool 重试连接
+		DisableAutomaticPing: true,
 		NamingStrategy: schema.NamingStrategy{
 			TablePrefix: strings.ToLower(serviceName) + "_", // 表名前缀，`User` 的表名应该是 `t_users`
 			//SingularTable: true,                              // 使用单数表名，启用该选项，此时，`User` 的表名应该是 `t_user`
@@ -24,16 +28,56 @@ func OpenDB(serviceName, dsn string) (err error) {
 		logger.Error("Database connection failed.", zap.Error(err))
 		return err
 	}
+	if len(replicas) > 0 {
+		rc := dbresolver.Config{}
+		for _, replica := range replicas {
+			rc.Replicas = append(rc.Replicas, mysql.Open(replica))
+		}
+		resolver := dbresolver.Register(rc).
+			SetMaxOpenConns(pc.MaxOpenConns).
+			SetMaxIdleConns(pc.MaxIdleConns).
+			SetConnMaxLifetime(pc.ConnMaxLifetime)
+		if err = DB.Use(resolver); err != nil {
+			logger.Error("Database replicas connection failed.", zap.Error(err))
+			return err
+		}
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	if err = setupPool(sqlDB, pc); err != nil {
+		logger.Error("Database connection failed.", zap.Error(err))
+		return err
+	}
 	return nil
 }
 
+// SetupDatabase 执行所有未执行的迁移
 func SetupDatabase(db *gorm.DB) error {
 	//db.Exec("create extension IF NOT EXISTS hstore;")
 	//db.AutoMigrate(ModelNoHistory...)
-	err := db.AutoMigrate(ModelWithHistory...)
+	_, err := MigrateUp(db)
 	if err != nil {
 		logger.Error("setup database failed.", zap.Error(err))
 		return err
 	}
 	return nil
 }
+
+// SetupDatabaseDryRun 输出执行所有未执行的迁移会执行的 SQL，不修改数据库，
+// 有需要执行的 SQL 时返回 ErrPendingMigrations，用于发布前检查
+func SetupDatabaseDryRun(db *gorm.DB) error {
+	sqls, err := MigrateUpDryRun(db)
+	for _, sql := range sqls {
+		logger.Info("dry run", zap.String("sql", sql))
+	}
+	if err != nil {
+		logger.Error("setup database dry run failed.", zap.Error(err))
+		return err
+	}
+	if len(sqls) > 0 {
+		return ErrPendingMigrations
+	}
+	return nil
+}
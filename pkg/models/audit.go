@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+// 审计日志的操作
+const (
+	AuditUserCreate  = "user.create"
+	AuditUserUpdate  = "user.update"
+	AuditUserDelete  = "user.delete"
+	AuditUserRestore = "user.restore"
+	AuditUserImport  = "user.import"
+	AuditLoginLocal  = "login.local"
+	AuditLoginLDAP   = "login.ldap"
+	AuditLoginOIDC   = "login.oidc"
+	// AuditConfigReload 重新加载配置，不是对用户的操作，目标为空
+	AuditConfigReload = "config.reload"
+)
+
+// AuditLog 审计日志，记录用户的创建、修改、删除和登录
+type AuditLog struct {
+	ID         int64     `json:"id" gorm:"primaryKey"`
+	Time       time.Time `json:"time" gorm:"column:time;index"`
+	Actor      string    `json:"actor" gorm:"column:actor;size:191;index"` //操作人，token 的 sub，登录时为登录的用户名
+	Action     string    `json:"action" gorm:"column:action;size:64;index"`
+	TargetID   int64     `json:"target_id" gorm:"column:target_id"`              //目标用户ID，未知时为0
+	TargetName string    `json:"target_name" gorm:"column:target_name;size:191"` //目标用户名
+	IP         string    `json:"ip" gorm:"column:ip;size:64"`                    //来源IP
+	Success    bool      `json:"success" gorm:"column:success"`
+	Error      string    `json:"error,omitempty" gorm:"column:error;size:512"` //失败原因
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
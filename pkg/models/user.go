@@ -4,10 +4,14 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"time"
+
+	"gorm.io/gorm"
 )
 
 const (
 	AuthModuleLDAP = "ldap"
+	AuthModuleOIDC = "oidc"
 )
 
 type User struct {
@@ -21,14 +25,278 @@ type User struct {
 	Organization string `json:"organization" gorm:"column:organization"` //工作组织
 	Affiliation  string `json:"affiliation" gorm:"column:affiliation"`   //工作单位
 	Position     string `json:"position" gorm:"column:position"`         //职位
-	Password     string `json:"password" gorm:"column:password"`         //用户密码不更新密码不用填
+	Password     string `json:"-" gorm:"column:password"`                //用户密码，不会序列化，设置密码使用 UserCreate UserUpdate
 	Email        string `json:"email" gorm:"column:email"`               //邮箱地址
 	Mobile       string `json:"mobile" gorm:"column:mobile"`             //手机号
 	Extend       Extend `json:"extend" gorm:"column:extend"`             //扩展数据
+	//登录名 LDAP用户的username属性
+	Login string `json:"login,omitempty" gorm:"-" swaggerignore:"true"`
+	//LDAP条目DN
+	DN string `json:"dn,omitempty" gorm:"-" swaggerignore:"true"`
+	//LDAP所属组
+	Groups []string `json:"groups,omitempty" gorm:"-" swaggerignore:"true"`
+	//LDAP直接所属的组，不包括嵌套解析出的上级组
+	DirectGroups []string `json:"direct_groups,omitempty" gorm:"-" swaggerignore:"true"`
+	//LDAP组映射得到的组织角色 组织ID->角色
+	OrgRoles map[int64]string `json:"org_roles,omitempty" gorm:"-" swaggerignore:"true"`
+	//LDAP配置的额外属性 属性名->属性值
+	Attributes map[string][]string `json:"attributes,omitempty" gorm:"-" swaggerignore:"true"`
+	//是否禁用
+	Disabled bool `json:"disabled" gorm:"column:disabled"`
+	//版本号，每次更新加1，更新时需要传入获取用户时返回的版本号
+	Version int64 `json:"version" gorm:"column:version;not null;default:1"`
+	//外部身份的唯一标识 OIDC用户为 issuer 和 sub，不返回给客户端
+	ExternalID string `json:"-" gorm:"column:external_id;size:191;index"`
 	BaseModel
 	//OldPassword string `json:"old_password" gorm:"-" swaggerignore:"true"`
 }
 
+// UserCreate 创建用户的参数
+type UserCreate struct {
+	Name         string `json:"name" binding:"required,max=64"`           //用户名
+	Password     string `json:"password" binding:"required,min=8,max=72"` //用户密码
+	Email        string `json:"email" binding:"omitempty,email"`          //邮箱地址
+	DisplayName  string `json:"display_name"`                             //显示名称
+	SuperAdmin   bool   `json:"super_admin"`                              //是否是超级用户
+	Role         string `json:"role"`                                     //角色
+	Group        int    `json:"group"`                                    //group
+	Organization string `json:"organization"`                             //工作组织
+	Affiliation  string `json:"affiliation"`                              //工作单位
+	Position     string `json:"position"`                                 //职位
+	Mobile       string `json:"mobile"`                                   //手机号
+	Extend       Extend `json:"extend"`                                   //扩展数据
+}
+
+// User 要创建的用户
+func (u *UserCreate) User() *User {
+	return &User{
+		Name:         u.Name,
+		Password:     u.Password,
+		Email:        u.Email,
+		DisplayName:  u.DisplayName,
+		SuperAdmin:   u.SuperAdmin,
+		Role:         u.Role,
+		Group:        u.Group,
+		Organization: u.Organization,
+		Affiliation:  u.Affiliation,
+		Position:     u.Position,
+		Mobile:       u.Mobile,
+		Extend:       u.Extend,
+	}
+}
+
+// UserPatch 部分更新用户的参数，只更新请求中有的字段
+type UserPatch struct {
+	DisplayName  *string `json:"display_name"`                              //显示名称
+	Email        *string `json:"email" binding:"omitempty,email"`           //邮箱地址
+	Password     *string `json:"password" binding:"omitempty,min=8,max=72"` //用户密码
+	SuperAdmin   *bool   `json:"super_admin"`                               //是否是超级用户，仅超级管理员可修改
+	Role         *string `json:"role"`                                      //角色，仅超级管理员可修改
+	Disabled     *bool   `json:"disabled"`                                  //是否禁用，仅超级管理员可修改
+	Group        *int    `json:"group"`                                     //group
+	Organization *string `json:"organization"`                              //工作组织
+	Affiliation  *string `json:"affiliation"`                               //工作单位
+	Position     *string `json:"position"`                                  //职位
+	Mobile       *string `json:"mobile"`                                    //手机号
+	Extend       *Extend `json:"extend"`                                    //扩展数据
+	//所属的组，替换用户直接所属的组，仅超级管理员可修改
+	Groups *[]string `json:"groups"`
+	//获取用户时返回的版本号，和当前版本号不一致时说明用户已被修改
+	Version *int64 `json:"version" binding:"required"`
+}
+
+// UserImmutableFields 创建后不能修改的字段
+var UserImmutableFields = []string{"id", "name", "auth_module"}
+
+// Privileged 是否修改了仅超级管理员可修改的字段
+func (p *UserPatch) Privileged() bool {
+	return p.SuperAdmin != nil || p.Role != nil || p.Disabled != nil || p.Groups != nil
+}
+
+// Updates 要更新的字段 列名->值，密码为明文，不包括 Groups
+func (p *UserPatch) Updates() map[string]interface{} {
+	m := map[string]interface{}{}
+	if p.DisplayName != nil {
+		m["display_name"] = *p.DisplayName
+	}
+	if p.Email != nil {
+		m["email"] = *p.Email
+	}
+	if p.Password != nil {
+		m["password"] = *p.Password
+	}
+	if p.SuperAdmin != nil {
+		m["super_admin"] = *p.SuperAdmin
+	}
+	if p.Role != nil {
+		m["role"] = *p.Role
+	}
+	if p.Disabled != nil {
+		m["disabled"] = *p.Disabled
+	}
+	if p.Group != nil {
+		m["group"] = *p.Group
+	}
+	if p.Organization != nil {
+		m["organization"] = *p.Organization
+	}
+	if p.Affiliation != nil {
+		m["affiliation"] = *p.Affiliation
+	}
+	if p.Position != nil {
+		m["position"] = *p.Position
+	}
+	if p.Mobile != nil {
+		m["mobile"] = *p.Mobile
+	}
+	if p.Extend != nil {
+		m["extend"] = *p.Extend
+	}
+	return m
+}
+
+// UserUpdate 更新用户的参数，User 的密码不会序列化，通过 Password 接收
+type UserUpdate struct {
+	User
+	Password string `json:"password"` //用户密码不更新密码不用填
+}
+
+// Patch 转换为部分更新的参数，零值的字段不更新，UserPatch 以外的字段（如 deleted_at）忽略
+func (u *UserUpdate) Patch() *UserPatch {
+	p := &UserPatch{}
+	if u.DisplayName != "" {
+		p.DisplayName = &u.DisplayName
+	}
+	if u.Email != "" {
+		p.Email = &u.Email
+	}
+	if u.Password != "" {
+		p.Password = &u.Password
+	}
+	if u.SuperAdmin {
+		p.SuperAdmin = &u.SuperAdmin
+	}
+	if u.Role != "" {
+		p.Role = &u.Role
+	}
+	if u.Disabled {
+		p.Disabled = &u.Disabled
+	}
+	if u.Group != 0 {
+		p.Group = &u.Group
+	}
+	if u.Organization != "" {
+		p.Organization = &u.Organization
+	}
+	if u.Affiliation != "" {
+		p.Affiliation = &u.Affiliation
+	}
+	if u.Position != "" {
+		p.Position = &u.Position
+	}
+	if u.Mobile != "" {
+		p.Mobile = &u.Mobile
+	}
+	if u.Extend != nil {
+		p.Extend = &u.Extend
+	}
+	if u.Version > 0 {
+		p.Version = &u.Version
+	}
+	return p
+}
+
+// UserView 返回用户信息时可见字段的范围
+type UserView int
+
+const (
+	// UserViewBasic 普通用户可见的字段，不包括认证方式、禁用状态等管理字段
+	UserViewBasic UserView = iota
+	// UserViewAdmin 超级管理员可见的全部字段
+	UserViewAdmin
+)
+
+// PublicUser 返回给调用方的用户信息，不包括密码，UserAdminFields 仅 UserViewAdmin 时返回
+type PublicUser struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`         //用户名
+	DisplayName  string    `json:"display_name"` //显示名称
+	SuperAdmin   bool      `json:"super_admin"`  //是否是超级用户
+	Role         string    `json:"role"`         //角色
+	Group        int       `json:"group"`        //group
+	Organization string    `json:"organization"` //工作组织
+	Affiliation  string    `json:"affiliation"`  //工作单位
+	Position     string    `json:"position"`     //职位
+	Email        string    `json:"email"`        //邮箱地址
+	Mobile       string    `json:"mobile"`       //手机号
+	Version      int64     `json:"version"`      //版本号，更新用户时需要传入
+	CreatedAt    time.Time `json:"create_time"`  //创建时间
+	UpdatedAt    time.Time `json:"update_time"`  //更新时间
+	*UserAdminFields
+}
+
+// UserAdminFields 仅超级管理员可见的用户字段
+type UserAdminFields struct {
+	AuthModule     string         `json:"auth_module"`                                          //认证方式
+	Disabled       bool           `json:"disabled"`                                             //是否禁用
+	Extend         Extend         `json:"extend"`                                               //扩展数据
+	HandleUserCode string         `json:"handle_user_code" swaggerignore:"true"`                //上次操作用户ID
+	HandleUserName string         `json:"handle_user_name"`                                     //上次操作用户
+	DeletedAt      gorm.DeletedAt `json:"deleted_at" swaggertype:"string" swaggerignore:"true"` //删除时间
+}
+
+// Public 转换为 view 可见的用户信息
+func (u *User) Public(view UserView) PublicUser {
+	pu := PublicUser{
+		ID:           u.ID,
+		Name:         u.Name,
+		DisplayName:  u.DisplayName,
+		SuperAdmin:   u.SuperAdmin,
+		Role:         u.Role,
+		Group:        u.Group,
+		Organization: u.Organization,
+		Affiliation:  u.Affiliation,
+		Position:     u.Position,
+		Email:        u.Email,
+		Mobile:       u.Mobile,
+		Version:      u.Version,
+		CreatedAt:    u.CreatedAt,
+		UpdatedAt:    u.UpdatedAt,
+	}
+	if view == UserViewAdmin {
+		pu.UserAdminFields = &UserAdminFields{
+			AuthModule:     u.AuthModule,
+			Disabled:       u.Disabled,
+			Extend:         u.Extend,
+			HandleUserCode: u.HandleUserCode,
+			HandleUserName: u.HandleUserName,
+			DeletedAt:      u.DeletedAt,
+		}
+	}
+	return pu
+}
+
+// PublicUsers 把 users 转换为 view 可见的用户信息
+func PublicUsers(users []User, view UserView) []PublicUser {
+	pus := make([]PublicUser, len(users))
+	for i := range users {
+		pus[i] = users[i].Public(view)
+	}
+	return pus
+}
+
+// UserGroup 用户所属的组，本地用户和从LDAP导入的用户都记录在这里
+type UserGroup struct {
+	UserID int64  `json:"user_id" gorm:"column:user_id;primaryKey;autoIncrement:false"`
+	Group  string `json:"group" gorm:"column:group_name;primaryKey;size:191;index"` //组名，LDAP组为DN
+	//是否直接所属，false 为通过嵌套的组间接所属
+	Direct bool `json:"direct" gorm:"column:direct"`
+}
+
+func (UserGroup) TableName() string {
+	return "user_groups"
+}
+
 type Extend map[string]interface{}
 
 func (t *Extend) Scan(value interface{}) error {
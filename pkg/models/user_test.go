@@ -0,0 +1,45 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestUserJSONHidesPassword(t *testing.T) {
+	const hash = "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+	u := User{ID: 1, Name: "jdoe", Password: hash, AuthModule: AuthModuleLDAP, Disabled: true}
+
+	for name, v := range map[string]interface{}{
+		"user":         u,
+		"users":        []User{u},
+		"admin view":   u.Public(UserViewAdmin),
+		"basic view":   u.Public(UserViewBasic),
+		"public users": PublicUsers([]User{u}, UserViewAdmin),
+	} {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(b), hash) || strings.Contains(string(b), `"password"`) {
+			t.Errorf("%s: expected no password in %s", name, b)
+		}
+	}
+
+	b, _ := json.Marshal(u.Public(UserViewBasic))
+	if strings.Contains(string(b), "auth_module") || strings.Contains(string(b), "disabled") {
+		t.Errorf("expected no admin fields in the basic view, got %s", b)
+	}
+	b, _ = json.Marshal(u.Public(UserViewAdmin))
+	if !strings.Contains(string(b), `"auth_module":"ldap"`) || !strings.Contains(string(b), `"disabled":true`) {
+		t.Errorf("expected admin fields in the admin view, got %s", b)
+	}
+
+	var update UserUpdate
+	if err := json.Unmarshal([]byte(`{"id":1,"name":"jdoe","password":"s3cret-passw0rd"}`), &update); err != nil {
+		t.Fatal(err)
+	}
+	if update.ID != 1 || update.Password != "s3cret-passw0rd" {
+		t.Errorf("expected the password to be accepted on update, got %+v", update)
+	}
+}
@@ -0,0 +1,1457 @@
+// GENERATED BY THE COMMAND ABOVE; DO NOT EDIT
+// This file was generated by swaggo/swag
+
+package docs
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/alecthomas/template"
+	"github.com/swaggo/swag"
+)
+
+var doc = `{
+    "schemes": {{ marshal .Schemes }},
+    "swagger": "2.0",
+    "info": {
+        "description": "{{.Description}}",
+        "title": "{{.Title}}",
+        "contact": {},
+        "version": "{{.Version}}"
+    },
+    "host": "{{.Host}}",
+    "basePath": "{{.BasePath}}",
+    "paths": {
+        "/config/reload": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "重新读取配置文件，重新应用日志级别、LDAP 服务等可以热加载的配置，仅超级管理员可用。\napplied 为已修改并重新应用的配置，restart_required 为和启动时不同、需要重启才能生效的配置",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "调试相关接口"
+                ],
+                "summary": "重新加载配置",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/http.HttpResult"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/config.ReloadResult"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "409": {
+                        "description": "启动时没有使用配置文件",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            }
+        },
+        "/debug/loglevel": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "查询当前的日志级别，仅超级管理员可用",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "调试相关接口"
+                ],
+                "summary": "查询日志级别",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "修改日志级别 debug info warn error，立即生效不需要重启，仅超级管理员可用",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "调试相关接口"
+                ],
+                "summary": "修改日志级别",
+                "parameters": [
+                    {
+                        "description": "日志级别",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.LogLevelData"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/login/local": {
+            "post": {
+                "description": "本地用户登录",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "登录相关接口"
+                ],
+                "summary": "本地用户登录",
+                "parameters": [
+                    {
+                        "description": "登录信息",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.LoginData"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/login/oidc": {
+            "get": {
+                "description": "跳转到 OIDC 身份提供方登录，登录后回调 /v1/login/oidc/callback",
+                "tags": [
+                    "登录相关接口"
+                ],
+                "summary": "OIDC登录",
+                "responses": {
+                    "302": {
+                        "description": ""
+                    }
+                }
+            }
+        },
+        "/v1/login/oidc/callback": {
+            "get": {
+                "description": "OIDC 身份提供方登录后的回调，校验 state 和 id_token 后保存用户并签发 token。\n用户按 issuer 和 sub 确定，用户名已被其它认证方式或其它 sub 的用户使用时返回 409",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "登录相关接口"
+                ],
+                "summary": "OIDC登录回调",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "授权码",
+                        "name": "code",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "登录时生成的 state",
+                        "name": "state",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    },
+                    "409": {
+                        "description": "用户名已被其它用户使用",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/login/refresh": {
+            "post": {
+                "description": "使用 refresh token 换取新的 token，refresh token 从请求体或 golden_refresh cookie 获取，使用后作废。\n用户已被禁用时返回 403",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "登录相关接口"
+                ],
+                "summary": "刷新token",
+                "parameters": [
+                    {
+                        "description": "refresh token",
+                        "name": "data",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/types.RefreshData"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    },
+                    "403": {
+                        "description": "用户已被禁用",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/logout": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "登出",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "登录相关接口"
+                ],
+                "summary": "登出",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/user": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "搜索用户",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "用户相关接口"
+                ],
+                "summary": "搜索用户",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "过滤关键词",
+                        "name": "filter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "模糊搜索用户名和邮箱，不区分大小写",
+                        "name": "q",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "邮箱",
+                        "name": "email",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "认证方式，例：ldap",
+                        "name": "auth_module",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "是否禁用",
+                        "name": "disabled",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "页码，默认1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "单页条数，默认20，最大为配置的 user.search.max_page_size",
+                        "name": "page_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "游标分页，有该参数时忽略 page 且不返回总数，第一页为空，之后为上一页返回的 next_cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "是否包括已删除的用户，仅超级管理员可用",
+                        "name": "include_deleted",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "排序字段：id name display_name email auth_module create_time update_time",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "排序方向：asc desc",
+                        "name": "order",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "按 id 更新用户，零值的字段不更新，和 PATCH 一样不能修改 name auth_module，校验密码和邮箱。\nversion 为查询用户时返回的版本号，用户已被其它请求修改时返回 409，需要重新查询后再更新",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "用户相关接口"
+                ],
+                "summary": "更新用户",
+                "parameters": [
+                    {
+                        "description": "用户",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UserUpdate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    },
+                    "400": {
+                        "description": "参数校验失败、没有传入版本号或修改了不能修改的字段",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    },
+                    "403": {
+                        "description": "非超级管理员修改了角色和权限或其他用户",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    },
+                    "409": {
+                        "description": "邮箱已存在或版本号不是当前版本号",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "创建用户",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "用户相关接口"
+                ],
+                "summary": "创建用户",
+                "parameters": [
+                    {
+                        "description": "用户",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UserCreate"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    },
+                    "400": {
+                        "description": "参数校验失败，data 为每个字段的错误原因",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    },
+                    "403": {
+                        "description": "非超级管理员设置了 super_admin 或 role",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    },
+                    "409": {
+                        "description": "用户名或邮箱已存在",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "删除user，仅超级管理员可用",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "用户相关接口"
+                ],
+                "summary": "删除user",
+                "parameters": [
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "integer"
+                        },
+                        "description": "多个ID 每个ID之间用,分隔，例：123,233",
+                        "name": "ids",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "是否从数据库删除，默认只标记删除",
+                        "name": "hard",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    },
+                    "403": {
+                        "description": "非超级管理员",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/user/batch": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "先校验所有用户，有任何一个不合法时都不创建，data 为每个不合法用户的下标和原因。\n默认在一个事务中创建，任何一个失败时全部不创建；atomic=false 时逐个创建，data 为每个用户的结果",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "用户相关接口"
+                ],
+                "summary": "批量创建用户",
+                "parameters": [
+                    {
+                        "description": "用户列表",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.UserCreate"
+                            }
+                        }
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "是否全部成功或全部失败，默认 true",
+                        "name": "atomic",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/http.HttpResult"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/types.BatchResult"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "参数校验失败",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/http.HttpResult"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/types.BatchResult"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "403": {
+                        "description": "非超级管理员设置了 super_admin 或 role",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    },
+                    "409": {
+                        "description": "用户名或邮箱已存在",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/http.HttpResult"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "type": "array",
+                                            "items": {
+                                                "$ref": "#/definitions/types.BatchResult"
+                                            }
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/user/group": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "有 group 参数时分页查询属于组的用户，LDAP 组为组的 DN，否则查询 groupid 分组的用户",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "用户相关接口"
+                ],
+                "summary": "查询组的用户",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "组名",
+                        "name": "group",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "是否包括通过嵌套的组间接所属的用户，默认false",
+                        "name": "nested",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "页码，默认1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "单页条数，默认20，最大为配置的 user.search.max_page_size",
+                        "name": "page_size",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "分组ID，没有 group 参数时使用",
+                        "name": "groupid",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/http.HttpResult"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/types.GroupMembers"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/user/import/ldap": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "按登录名从LDAP批量查询用户并保存到本地，已存在的用户会更新用户信息，返回每个登录名的导入结果，单次最多 1000 个登录名",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "用户相关接口"
+                ],
+                "summary": "从LDAP导入用户",
+                "parameters": [
+                    {
+                        "description": "登录名列表",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.ImportData"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    },
+                    "400": {
+                        "description": "登录名数超过上限",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/user/restore": {
+            "put": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "恢复已删除的user，仅超级管理员可用",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "用户相关接口"
+                ],
+                "summary": "恢复已删除的user",
+                "parameters": [
+                    {
+                        "type": "array",
+                        "items": {
+                            "type": "integer"
+                        },
+                        "description": "多个ID 每个ID之间用,分隔，例：123,233",
+                        "name": "ids",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/user/{userid}": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "获取用户，非超级管理员看不到认证方式、禁用状态等管理字段",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "用户相关接口"
+                ],
+                "summary": "获取用户",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "用户ID",
+                        "name": "userid",
+                        "in": "path"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "是否包括已删除的用户，仅超级管理员可用",
+                        "name": "include_deleted",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "上次响应的 ETag，用户没有修改时返回 304",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/http.HttpResult"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/models.PublicUser"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "304": {
+                        "description": "用户没有修改"
+                    }
+                }
+            },
+            "patch": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "只更新请求中有的字段，不能修改 id name auth_module，super_admin role disabled 仅超级管理员可修改，\n非超级管理员只能修改自己。\nversion 必填，为查询用户时返回的版本号，用户已被其它请求修改时返回 409，需要重新查询后再更新",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "用户相关接口"
+                ],
+                "summary": "部分更新用户",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "用户ID",
+                        "name": "userid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "要更新的字段",
+                        "name": "data",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.UserPatch"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "allOf": [
+                                {
+                                    "$ref": "#/definitions/http.HttpResult"
+                                },
+                                {
+                                    "type": "object",
+                                    "properties": {
+                                        "data": {
+                                            "$ref": "#/definitions/models.PublicUser"
+                                        }
+                                    }
+                                }
+                            ]
+                        }
+                    },
+                    "400": {
+                        "description": "参数校验失败或修改了不能修改的字段",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    },
+                    "403": {
+                        "description": "非超级管理员修改了仅超级管理员可修改的字段或其他用户",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    },
+                    "409": {
+                        "description": "邮箱已存在或版本号不是当前版本号",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/userinfo": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "获取登录用户信息",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "登录相关接口"
+                ],
+                "summary": "获取登录用户信息",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/verify": {
+            "get": {
+                "description": "获取验证码",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "登录相关接口"
+                ],
+                "summary": "获取验证码",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/whoami": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "只解析当前 token 的 claims，不查询数据库，没有有效的 token 时返回 401",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "登录相关接口"
+                ],
+                "summary": "获取当前token的用户",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/http.HttpResult"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "config.ReloadResult": {
+            "type": "object",
+            "properties": {
+                "applied": {
+                    "description": "已修改并重新应用的配置",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "restart_required": {
+                    "description": "和启动时不同、需要重启才能生效的配置，为 RestartKeys 中的配置",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "http.HttpResult": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "type": "integer"
+                },
+                "data": {
+                    "type": "object"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Extend": {
+            "type": "object",
+            "additionalProperties": true
+        },
+        "models.PublicUser": {
+            "type": "object",
+            "properties": {
+                "affiliation": {
+                    "description": "工作单位",
+                    "type": "string"
+                },
+                "auth_module": {
+                    "description": "认证方式",
+                    "type": "string"
+                },
+                "create_time": {
+                    "description": "创建时间",
+                    "type": "string"
+                },
+                "disabled": {
+                    "description": "是否禁用",
+                    "type": "boolean"
+                },
+                "display_name": {
+                    "description": "显示名称",
+                    "type": "string"
+                },
+                "email": {
+                    "description": "邮箱地址",
+                    "type": "string"
+                },
+                "extend": {
+                    "description": "扩展数据",
+                    "$ref": "#/definitions/models.Extend"
+                },
+                "group": {
+                    "description": "group",
+                    "type": "integer"
+                },
+                "handle_user_name": {
+                    "description": "上次操作用户",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "mobile": {
+                    "description": "手机号",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "用户名",
+                    "type": "string"
+                },
+                "organization": {
+                    "description": "工作组织",
+                    "type": "string"
+                },
+                "position": {
+                    "description": "职位",
+                    "type": "string"
+                },
+                "role": {
+                    "description": "角色",
+                    "type": "string"
+                },
+                "super_admin": {
+                    "description": "是否是超级用户",
+                    "type": "boolean"
+                },
+                "update_time": {
+                    "description": "更新时间",
+                    "type": "string"
+                },
+                "version": {
+                    "description": "版本号，更新用户时需要传入",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.UserCreate": {
+            "type": "object",
+            "required": [
+                "name",
+                "password"
+            ],
+            "properties": {
+                "affiliation": {
+                    "description": "工作单位",
+                    "type": "string"
+                },
+                "display_name": {
+                    "description": "显示名称",
+                    "type": "string"
+                },
+                "email": {
+                    "description": "邮箱地址",
+                    "type": "string"
+                },
+                "extend": {
+                    "description": "扩展数据",
+                    "$ref": "#/definitions/models.Extend"
+                },
+                "group": {
+                    "description": "group",
+                    "type": "integer"
+                },
+                "mobile": {
+                    "description": "手机号",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "用户名",
+                    "type": "string"
+                },
+                "organization": {
+                    "description": "工作组织",
+                    "type": "string"
+                },
+                "password": {
+                    "description": "用户密码",
+                    "type": "string"
+                },
+                "position": {
+                    "description": "职位",
+                    "type": "string"
+                },
+                "role": {
+                    "description": "角色",
+                    "type": "string"
+                },
+                "super_admin": {
+                    "description": "是否是超级用户",
+                    "type": "boolean"
+                }
+            }
+        },
+        "models.UserPatch": {
+            "type": "object",
+            "required": [
+                "version"
+            ],
+            "properties": {
+                "affiliation": {
+                    "description": "工作单位",
+                    "type": "string"
+                },
+                "disabled": {
+                    "description": "是否禁用，仅超级管理员可修改",
+                    "type": "boolean"
+                },
+                "display_name": {
+                    "description": "显示名称",
+                    "type": "string"
+                },
+                "email": {
+                    "description": "邮箱地址",
+                    "type": "string"
+                },
+                "extend": {
+                    "description": "扩展数据",
+                    "$ref": "#/definitions/models.Extend"
+                },
+                "group": {
+                    "description": "group",
+                    "type": "integer"
+                },
+                "groups": {
+                    "description": "所属的组，替换用户直接所属的组，仅超级管理员可修改",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "mobile": {
+                    "description": "手机号",
+                    "type": "string"
+                },
+                "organization": {
+                    "description": "工作组织",
+                    "type": "string"
+                },
+                "password": {
+                    "description": "用户密码",
+                    "type": "string"
+                },
+                "position": {
+                    "description": "职位",
+                    "type": "string"
+                },
+                "role": {
+                    "description": "角色，仅超级管理员可修改",
+                    "type": "string"
+                },
+                "super_admin": {
+                    "description": "是否是超级用户，仅超级管理员可修改",
+                    "type": "boolean"
+                },
+                "version": {
+                    "description": "获取用户时返回的版本号，和当前版本号不一致时说明用户已被修改",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.UserUpdate": {
+            "type": "object",
+            "properties": {
+                "affiliation": {
+                    "description": "工作单位",
+                    "type": "string"
+                },
+                "auth_module": {
+                    "description": "认证方式",
+                    "type": "string"
+                },
+                "create_time": {
+                    "description": "创建时间",
+                    "type": "string"
+                },
+                "disabled": {
+                    "description": "是否禁用",
+                    "type": "boolean"
+                },
+                "display_name": {
+                    "description": "显示名称",
+                    "type": "string"
+                },
+                "email": {
+                    "description": "邮箱地址",
+                    "type": "string"
+                },
+                "extend": {
+                    "description": "扩展数据",
+                    "$ref": "#/definitions/models.Extend"
+                },
+                "group": {
+                    "description": "group",
+                    "type": "integer"
+                },
+                "handle_user_name": {
+                    "description": "上次操作用户",
+                    "type": "string"
+                },
+                "id": {
+                    "description": "ID创建时不用传",
+                    "type": "integer"
+                },
+                "mobile": {
+                    "description": "手机号",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "用户名",
+                    "type": "string"
+                },
+                "organization": {
+                    "description": "工作组织",
+                    "type": "string"
+                },
+                "password": {
+                    "description": "用户密码不更新密码不用填",
+                    "type": "string"
+                },
+                "position": {
+                    "description": "职位",
+                    "type": "string"
+                },
+                "role": {
+                    "description": "角色",
+                    "type": "string"
+                },
+                "super_admin": {
+                    "description": "是否是超级用户",
+                    "type": "boolean"
+                },
+                "update_time": {
+                    "description": "更新时间",
+                    "type": "string"
+                },
+                "version": {
+                    "description": "版本号，每次更新加1，更新时需要传入获取用户时返回的版本号",
+                    "type": "integer"
+                }
+            }
+        },
+        "types.BatchResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "失败原因",
+                    "type": "string"
+                },
+                "fields": {
+                    "description": "参数校验失败的字段 字段名-\u003e原因",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "description": "创建成功的用户ID",
+                    "type": "integer"
+                },
+                "index": {
+                    "description": "请求中的下标 从0开始",
+                    "type": "integer"
+                },
+                "name": {
+                    "description": "用户名",
+                    "type": "string"
+                },
+                "success": {
+                    "description": "是否创建成功",
+                    "type": "boolean"
+                }
+            }
+        },
+        "types.GroupMembers": {
+            "type": "object",
+            "properties": {
+                "group": {
+                    "type": "string"
+                },
+                "items": {
+                    "type": "object"
+                },
+                "nested": {
+                    "description": "是否包括通过嵌套的组间接所属的成员",
+                    "type": "boolean"
+                },
+                "page": {
+                    "type": "integer"
+                },
+                "page_size": {
+                    "type": "integer"
+                },
+                "total": {
+                    "type": "integer"
+                }
+            }
+        },
+        "types.ImportData": {
+            "type": "object",
+            "properties": {
+                "logins": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "types.LogLevelData": {
+            "type": "object",
+            "required": [
+                "level"
+            ],
+            "properties": {
+                "level": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.LoginData": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string"
+                },
+                "verify": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.RefreshData": {
+            "type": "object",
+            "properties": {
+                "refresh_token": {
+                    "type": "string"
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "BearerAuth": {
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
+        }
+    }
+}`
+
+type swaggerInfo struct {
+	Version     string
+	Host        string
+	BasePath    string
+	Schemes     []string
+	Title       string
+	Description string
+}
+
+// SwaggerInfo holds exported Swagger Info so clients can modify it
+var SwaggerInfo = swaggerInfo{
+	Version:     "1.0",
+	Host:        "",
+	BasePath:    "/api/golden-go",
+	Schemes:     []string{},
+	Title:       "GOLDEN-GO接口",
+	Description: "GOLDEN-GO接口",
+}
+
+type s struct{}
+
+func (s *s) ReadDoc() string {
+	sInfo := SwaggerInfo
+	sInfo.Description = strings.Replace(sInfo.Description, "\n", "\\n", -1)
+
+	t, err := template.New("swagger_info").Funcs(template.FuncMap{
+		"marshal": func(v interface{}) string {
+			a, _ := json.Marshal(v)
+			return string(a)
+		},
+	}).Parse(doc)
+	if err != nil {
+		return doc
+	}
+
+	var tpl bytes.Buffer
+	if err := t.Execute(&tpl, sInfo); err != nil {
+		return doc
+	}
+
+	return tpl.String()
+}
+
+func init() {
+	swag.Register(swag.Name, &s{})
+}
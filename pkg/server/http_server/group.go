@@ -0,0 +1,101 @@
+package http_server
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// groupMiddleware 只作用于 prefix 下路由的中间件
+type groupMiddleware struct {
+	prefix   string
+	handlers []gin.HandlerFunc
+}
+
+// AddGroupMiddleware 添加只作用于 prefix 下路由的中间件，prefix 按路径段匹配，
+// 如 /api/golden-go/v1/login 匹配 /api/golden-go/v1/login/local，不匹配 /api/golden-go/v1/loginx。
+// 中间件在注册路由时加入路由的处理链，只对通过 HttpServer.Group 注册的路由生效，
+// 需要在 ListenAndServe 之前调用
+func (hs *HttpServer) AddGroupMiddleware(prefix string, ms ...gin.HandlerFunc) {
+	hs.groupMiddlewares = append(hs.groupMiddlewares, groupMiddleware{prefix: prefix, handlers: ms})
+}
+
+// RouterGroup 在 gin.RouterGroup 的基础上，注册子分组和路由时加上 AddGroupMiddleware 添加的中间件
+type RouterGroup struct {
+	*gin.RouterGroup
+	hs *HttpServer
+}
+
+// Group 创建路由分组，RouterFunc 中需要分组中间件生效时使用
+func (hs *HttpServer) Group(relativePath string, handlers ...gin.HandlerFunc) *RouterGroup {
+	rg := &RouterGroup{RouterGroup: &hs.g.RouterGroup, hs: hs}
+	return rg.group("", relativePath, handlers...)
+}
+
+// Group 创建子分组
+func (rg *RouterGroup) Group(relativePath string, handlers ...gin.HandlerFunc) *RouterGroup {
+	return rg.group(rg.BasePath(), relativePath, handlers...)
+}
+
+// group 创建子分组，加上匹配子分组但不匹配 parent 的分组中间件，匹配 parent 的已经在 parent 上
+func (rg *RouterGroup) group(parent, relativePath string, handlers ...gin.HandlerFunc) *RouterGroup {
+	ms := rg.hs.matchGroupMiddlewares(parent, joinPaths(rg.BasePath(), relativePath))
+	return &RouterGroup{RouterGroup: rg.RouterGroup.Group(relativePath, append(ms, handlers...)...), hs: rg.hs}
+}
+
+// Handle 注册路由，加上匹配路由但不匹配分组的分组中间件
+func (rg *RouterGroup) Handle(httpMethod, relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	ms := rg.hs.matchGroupMiddlewares(rg.BasePath(), joinPaths(rg.BasePath(), relativePath))
+	return rg.RouterGroup.Handle(httpMethod, relativePath, append(ms, handlers...)...)
+}
+
+func (rg *RouterGroup) GET(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return rg.Handle(http.MethodGet, relativePath, handlers...)
+}
+
+func (rg *RouterGroup) POST(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return rg.Handle(http.MethodPost, relativePath, handlers...)
+}
+
+func (rg *RouterGroup) PUT(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return rg.Handle(http.MethodPut, relativePath, handlers...)
+}
+
+func (rg *RouterGroup) PATCH(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return rg.Handle(http.MethodPatch, relativePath, handlers...)
+}
+
+func (rg *RouterGroup) DELETE(relativePath string, handlers ...gin.HandlerFunc) gin.IRoutes {
+	return rg.Handle(http.MethodDelete, relativePath, handlers...)
+}
+
+// matchGroupMiddlewares 返回匹配 fullPath 但不匹配 parent 的分组中间件，parent 为空时不匹配任何前缀
+func (hs *HttpServer) matchGroupMiddlewares(parent, fullPath string) []gin.HandlerFunc {
+	var ms []gin.HandlerFunc
+	for _, gm := range hs.groupMiddlewares {
+		if matchPrefix(fullPath, gm.prefix) && (parent == "" || !matchPrefix(parent, gm.prefix)) {
+			ms = append(ms, gm.handlers...)
+		}
+	}
+	return ms
+}
+
+// matchPrefix 判断 p 是否在 prefix 下，按路径段匹配
+func matchPrefix(p, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// joinPaths 同 gin 的 joinPaths，保留 relativePath 末尾的 /
+func joinPaths(absolutePath, relativePath string) string {
+	if relativePath == "" {
+		return absolutePath
+	}
+	finalPath := path.Join(absolutePath, relativePath)
+	if strings.HasSuffix(relativePath, "/") && !strings.HasSuffix(finalPath, "/") {
+		return finalPath + "/"
+	}
+	return finalPath
+}
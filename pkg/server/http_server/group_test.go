@@ -0,0 +1,47 @@
+package http_server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGroupMiddleware(t *testing.T) {
+	mark := func(name string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("marks", append(c.GetStringSlice("marks"), name))
+		}
+	}
+	handler := func(c *gin.Context) {
+		c.String(http.StatusOK, strings.Join(c.GetStringSlice("marks"), ","))
+	}
+
+	hs := NewHttpServer("test", "")
+	hs.AddGroupMiddleware("/ext", mark("ext"))
+	hs.AddGroupMiddleware("/ext/login/", mark("login"))
+	hs.AddGroupMiddleware("/other", mark("other"))
+	hs.ExtendRouter(func(g *gin.Engine) {
+		ext := hs.Group("/ext")
+		ext.GET("/login/local", handler)
+		ext.GET("/loginx", handler)
+		ext.Group("/login").GET("/refresh", handler)
+		g.GET("/plain", handler)
+	})
+	hs.router()
+
+	for path, want := range map[string]string{
+		"/ext/login/local":   "ext,login",
+		"/ext/loginx":        "ext",
+		"/ext/login/refresh": "ext,login",
+		"/plain":             "",
+	} {
+		w := httptest.NewRecorder()
+		hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("%s: expected %q, got %d %q", path, want, w.Code, w.Body)
+		}
+	}
+}
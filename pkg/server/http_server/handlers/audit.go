@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"gitee.com/golden-go/golden-go/pkg/models"
+	"gitee.com/golden-go/golden-go/pkg/service"
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
+	"gitee.com/golden-go/golden-go/pkg/utils/jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// audit 记录当前登录用户对用户 targetID 的操作，err 为 nil 时为成功
+func audit(ctx *gin.Context, action string, targetID int64, targetName string, err error) {
+	actor := ""
+	if claims, e := jwt.ClaimsFromContext(ctx); e == nil {
+		actor = claims.Subject
+	}
+	auditAs(ctx, actor, action, targetID, targetName, err)
+}
+
+// auditLogin 记录用户 name 的登录，失败时 id 为 0
+func auditLogin(ctx *gin.Context, action, name string, id int64, err error) {
+	auditAs(ctx, name, action, id, name, err)
+}
+
+// auditAs 记录审计日志，成功的操作同时发送 webhook
+func auditAs(ctx *gin.Context, actor, action string, targetID int64, targetName string, err error) {
+	l := &models.AuditLog{
+		Actor:      actor,
+		Action:     action,
+		TargetID:   targetID,
+		TargetName: targetName,
+		IP:         ghttp.ClientIP(ctx),
+		Success:    err == nil,
+	}
+	if err != nil {
+		l.Error = err.Error()
+	}
+	service.Audit.Record(l)
+	if l.Success && service.WebhookEvents[action] {
+		service.Webhook.Send(&service.WebhookEvent{Type: action, UserID: targetID, UserName: targetName, Actor: actor, Time: l.Time})
+	}
+}
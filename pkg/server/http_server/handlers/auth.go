@@ -2,7 +2,13 @@ package handlers
 
 import (
 	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
 
+	"gitee.com/golden-go/golden-go/pkg/models"
 	"gitee.com/golden-go/golden-go/pkg/service"
 	"gitee.com/golden-go/golden-go/pkg/utils/captcha"
 	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
@@ -14,6 +20,7 @@ import (
 	jwtgo "github.com/golang-jwt/jwt"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 // @Tags 登录相关接口
@@ -31,7 +38,7 @@ func Verify(ctx *gin.Context) {
 		return
 	}
 	ctx.SetCookie("captchaid", id, 60, "", "", false, false)
-	ghttp.CommonSuccessResponse(ctx, bs)
+	ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(bs))
 }
 
 // @Tags 登录相关接口
@@ -47,23 +54,35 @@ func LoginLocal(ctx *gin.Context) {
 	if err != nil {
 		return
 	}
-	ok, _ := service.GetUserServiceDBWithContext(ctx).CheckPassword(ld.Name, ld.Password)
+	if err := service.Lockout.Check(ld.Name); lockedResponse(ctx, err) {
+		auditLogin(ctx, models.AuditLoginLocal, ld.Name, 0, err)
+		return
+	}
+	ok, err := service.GetUserServiceDBWithContext(ctx).CheckPassword(ld.Name, ld.Password)
+	if errors.Is(err, service.ErrUserDisabled) {
+		auditLogin(ctx, models.AuditLoginLocal, ld.Name, 0, err)
+		userCheckFailed(ctx, ld.Name, err)
+		return
+	}
 	if !ok {
 		logger.Warn("用户名密码验证失败!!!")
 		if viper.GetBool("auth.ldap.enable") {
 			loginLdap(ctx, ld)
 		} else {
-			ghttp.CommonFailCodeResponse(ctx, 50003, "用户名密码验证失败!!!")
+			auditLogin(ctx, models.AuditLoginLocal, ld.Name, 0, errors.New("用户名密码验证失败"))
+			loginFailed(ctx, ld.Name, http.StatusOK, 50003, "用户名密码验证失败!!!")
 		}
 
 		return
 	}
+	loginSucceeded(ld.Name)
 	u, err := service.GetUserServiceDBWithContext(ctx).GetUserWithName(ld.Name)
 	if err != nil {
 		logger.Warn("获取用户信息失败!!!")
 		ghttp.CommonFailCodeResponse(ctx, 50004, "获取用户信息失败!!!")
 		return
 	}
+	auditLogin(ctx, models.AuditLoginLocal, ld.Name, u.ID, nil)
 	u.Password = ""
 	golden_jwt_I, exists := ctx.Get("golden_jwt")
 	if !exists {
@@ -77,11 +96,58 @@ func LoginLocal(ctx *gin.Context) {
 		ghttp.CommonFailCodeResponse(ctx, 50006, "获取JWT失败!!!")
 		return
 	}
+	tokenStr, _ := golden_jwt.CreateTokenAndSetCookie(userClaims(&u), ctx)
+
+	ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(tokenStr))
+}
+
+// userClaims 登录用户的 claims，包括用户信息和角色、组、组织。
+// sub 和 name 为登录名，LDAP 用户的 Name 是显示名称，不唯一也可能变化，使用 Login，显示名称放在 display_name
+func userClaims(u *models.User) jwtgo.MapClaims {
 	claims := jwtgo.MapClaims{}
 	types.JsonStruct(u, &claims)
-	tokenStr, _ := golden_jwt.CreateTokenAndSetCookie(claims, ctx)
+	delete(claims, "password")
 
-	ghttp.CommonSuccessResponse(ctx, tokenStr)
+	var roles []string
+	seen := map[string]bool{}
+	addRole := func(role string) {
+		if role != "" && !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	addRole(u.Role)
+	var orgIds []int64
+	for orgId, role := range u.OrgRoles {
+		orgIds = append(orgIds, orgId)
+		addRole(role)
+	}
+	sort.Strings(roles)
+	sort.Slice(orgIds, func(i, j int) bool { return orgIds[i] < orgIds[j] })
+
+	name, displayName := u.Name, u.DisplayName
+	if u.Login != "" {
+		name = u.Login
+		if displayName == "" {
+			displayName = u.Name
+		}
+	}
+	c := &jwt.Claims{
+		Subject:     name,
+		ID:          u.ID,
+		Name:        name,
+		DisplayName: displayName,
+		Email:       u.Email,
+		SuperAdmin:  u.SuperAdmin,
+		Roles:       roles,
+		Groups:      u.Groups,
+		Extra:       claims,
+	}
+	if len(orgIds) > 0 {
+		// 属于多个组织时使用 ID 最小的组织
+		c.OrgId = orgIds[0]
+	}
+	return c.MapClaims()
 }
 
 func loginFirstCheck(ctx *gin.Context) (*types.LoginData, error) {
@@ -91,6 +157,7 @@ func loginFirstCheck(ctx *gin.Context) (*types.LoginData, error) {
 		ghttp.CommonErrorCodeResponse(ctx, 50000, err)
 		return nil, err
 	}
+	ld.Name = types.Normalize.Username(ld.Name)
 	captchaid, err := ctx.Cookie("captchaid")
 	if err != nil {
 		logger.Warn("验证码已过期!!!")
@@ -106,33 +173,107 @@ func loginFirstCheck(ctx *gin.Context) (*types.LoginData, error) {
 	return ld, nil
 }
 
+// lockedResponse err 是账号锁定的错误时返回锁定的响应
+func lockedResponse(ctx *gin.Context, err error) bool {
+	var le *service.AccountLockedError
+	if !errors.As(err, &le) {
+		if err != nil {
+			logger.Warn("调用服务 Lockout 错误!!!错误信息：", zap.Error(err))
+		}
+		return false
+	}
+	logger.Warn("账号已被临时锁定!!!", zap.Time("until", le.Until))
+	ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(le.Until).Seconds()))))
+	ghttp.CommonFailCodeResponse(ctx, service.CodeAccountLocked, le.Error())
+	return true
+}
+
+// loginFailed 记录登录失败，达到次数限制时返回账号锁定的响应
+func loginFailed(ctx *gin.Context, name string, status, code int, err string) {
+	if lockedResponse(ctx, service.Lockout.Fail(name)) {
+		return
+	}
+	r := ghttp.CommonFailResult(err)
+	r.Code = code
+	ghttp.Render(ctx, status, r)
+}
+
+// codeServiceUnavailable 依赖的服务不可用
+const codeServiceUnavailable = 50300
+
+// ldapLoginFailed 按 LDAP 错误的类型返回响应，LDAP 服务不可用返回 503，
+// LDAP 服务错误（管理员绑定失败、查询失败、查到多个用户）返回 500，都不计入登录失败次数，
+// 其它错误（用户名密码错误、用户不存在）返回 401
+func ldapLoginFailed(ctx *gin.Context, name string, err error) {
+	switch {
+	case errors.Is(err, ldap.ErrConnection):
+		logger.Warn("LDAP服务不可用!!!错误信息：", zap.Error(err))
+		r := ghttp.CommonFailResult("LDAP服务不可用!!!")
+		r.Code = codeServiceUnavailable
+		ghttp.Render(ctx, http.StatusServiceUnavailable, r)
+	case errors.Is(err, ldap.ErrBindFailed), errors.Is(err, ldap.ErrSearchFailed), errors.Is(err, ldap.ErrMultipleUsersFound):
+		logger.Warn("LDAP服务错误!!!错误信息：", zap.Error(err))
+		ghttp.Render(ctx, http.StatusInternalServerError, ghttp.CommonFailResult("LDAP服务错误!!!"))
+	default:
+		logger.Warn("LDAP登录失败!!!错误信息：", zap.Error(err))
+		loginFailed(ctx, name, http.StatusUnauthorized, 50004, "LDAP登录失败!!!")
+	}
+}
+
+// loginSucceeded 登录成功，清除登录失败记录
+func loginSucceeded(name string) {
+	if err := service.Lockout.Success(name); err != nil {
+		logger.Warn("调用服务 Lockout 错误!!!错误信息：", zap.Error(err))
+	}
+}
+
 func LoginLdap(ctx *gin.Context) {
 	ld, err := loginFirstCheck(ctx)
 	if err != nil {
 		return
 	}
+	if err := service.Lockout.Check(ld.Name); lockedResponse(ctx, err) {
+		auditLogin(ctx, models.AuditLoginLDAP, ld.Name, 0, err)
+		return
+	}
 	loginLdap(ctx, ld)
 }
 
-func loginLdap(ctx *gin.Context, ld *types.LoginData) {
+// getIML 获取 gin context 中的 LDAP 接口，获取失败时返回错误响应
+func getIML(ctx *gin.Context) (ldap.IMultiLDAP, bool) {
 	imli, ok := ctx.Get("IML")
 	if !ok {
 		logger.Warn("获取IML失败!!!")
 		ghttp.CommonFailCodeResponse(ctx, 50006, "获取IML失败!!!")
-		return
+		return nil, false
 	}
 	iml, ok := imli.(ldap.IMultiLDAP)
 	if !ok {
 		logger.Warn("转换IML失败!!!")
 		ghttp.CommonFailCodeResponse(ctx, 50006, "转换IML失败!!!")
+		return nil, false
+	}
+	return iml, true
+}
+
+func loginLdap(ctx *gin.Context, ld *types.LoginData) {
+	iml, ok := getIML(ctx)
+	if !ok {
+		return
+	}
+	u, err := iml.LoginContext(ctx.Request.Context(), ld)
+	if err != nil {
+		auditLogin(ctx, models.AuditLoginLDAP, ld.Name, 0, err)
+		ldapLoginFailed(ctx, ld.Name, err)
 		return
 	}
-	u, err := iml.Login(ld)
+	err = checkUserEnabled(ctx, ld.Name)
+	auditLogin(ctx, models.AuditLoginLDAP, ld.Name, 0, err)
 	if err != nil {
-		logger.Warn("LDAP登录失败!!!")
-		ghttp.CommonFailCodeResponse(ctx, 50004, "LDAP登录失败!!!")
+		userCheckFailed(ctx, ld.Name, err)
 		return
 	}
+	loginSucceeded(ld.Name)
 	golden_jwt_I, exists := ctx.Get("golden_jwt")
 	if !exists {
 		logger.Warn("获取用户信息失败!!!")
@@ -145,11 +286,108 @@ func loginLdap(ctx *gin.Context, ld *types.LoginData) {
 		ghttp.CommonFailCodeResponse(ctx, 50006, "获取JWT失败!!!")
 		return
 	}
-	claims := jwtgo.MapClaims{}
-	types.JsonStruct(u, &claims)
-	tokenStr, _ := golden_jwt.CreateTokenAndSetCookie(claims, ctx)
+	tokenStr, _ := golden_jwt.CreateTokenAndSetCookie(userClaims(u), ctx)
+
+	ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(tokenStr))
+}
+
+// checkUserEnabled 本地用户已被禁用时返回 ErrUserDisabled，用户不存在时不算禁用
+func checkUserEnabled(ctx *gin.Context, name string) error {
+	return userEnabled(service.GetUserServiceDBWithContext(ctx).GetUserWithName(name))
+}
+
+// checkClaimsEnabled 同 checkUserEnabled，按 token 中稳定的标识查询用户：
+// 本地用户使用 id，没有 id 的 LDAP 用户使用登录名 sub，name 和 display_name 可能是显示名称
+func checkClaimsEnabled(ctx *gin.Context, c *jwt.Claims) error {
+	us := service.GetUserServiceDBWithContext(ctx)
+	if c.ID != 0 {
+		return userEnabled(us.GetUser(int(c.ID)))
+	}
+	return userEnabled(us.GetUserWithName(c.Subject))
+}
+
+// userEnabled 查询到的用户已被禁用时返回 ErrUserDisabled，用户不存在时不算禁用
+func userEnabled(u models.User, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if u.Disabled {
+		return service.ErrUserDisabled
+	}
+	return nil
+}
 
-	ghttp.CommonSuccessResponse(ctx, tokenStr)
+// userCheckFailed checkUserEnabled 失败时的响应，用户已被禁用时返回 403
+func userCheckFailed(ctx *gin.Context, name string, err error) {
+	if !errors.Is(err, service.ErrUserDisabled) {
+		logger.Warn("获取用户信息失败!!!", zap.String("name", name), zap.Error(err))
+		ghttp.CommonFailCodeResponse(ctx, 50004, "获取用户信息失败!!!")
+		return
+	}
+	logger.Warn("用户已被禁用!!!", zap.String("name", name))
+	r := ghttp.CommonErrResult(err)
+	r.Code = codeForbidden
+	ghttp.Render(ctx, http.StatusForbidden, r)
+}
+
+// @Tags 登录相关接口
+// ShowAccount godoc
+// @Summary 刷新token
+// @Description 使用 refresh token 换取新的 token，refresh token 从请求体或 golden_refresh cookie 获取，使用后作废。
+// @Description 用户已被禁用时返回 403
+// @Produce  json
+// @Param data body types.RefreshData  false "refresh token"
+// @Router /v1/login/refresh [post]
+// @Success 200 {object} ghttp.HttpResult
+// @Failure 403 {object} ghttp.HttpResult "用户已被禁用"
+func RefreshToken(ctx *gin.Context) {
+	rd := &types.RefreshData{}
+	if ctx.Request.ContentLength != 0 {
+		if err := ghttp.GetBody(ctx, rd); err != nil {
+			logger.Warn("调用服务 GetBody 错误!!!错误信息：", zap.Error(err))
+			ghttp.CommonErrorCodeResponse(ctx, 50000, err)
+			return
+		}
+	}
+	if rd.RefreshToken == "" {
+		rd.RefreshToken, _ = ctx.Cookie(jwt.RefreshCookie)
+	}
+	if rd.RefreshToken == "" {
+		logger.Warn("refresh token不存在!!!")
+		ghttp.CommonFailCodeResponse(ctx, jwt.CodeTokenMissing, "refresh token不存在!!!")
+		return
+	}
+	golden_jwt_I, exists := ctx.Get("golden_jwt")
+	if !exists {
+		logger.Warn("获取JWT失败!!!")
+		ghttp.CommonFailCodeResponse(ctx, 50005, "获取JWT失败!!!")
+		return
+	}
+	golden_jwt, ok := golden_jwt_I.(*jwt.GoldenJwt)
+	if !ok {
+		logger.Warn("获取JWT失败!!!")
+		ghttp.CommonFailCodeResponse(ctx, 50006, "获取JWT失败!!!")
+		return
+	}
+	if mc, err := golden_jwt.GetClaimsFromToken(rd.RefreshToken); err == nil {
+		if c, err := jwt.NewClaims(mc); err == nil {
+			if err := checkClaimsEnabled(ctx, c); err != nil {
+				userCheckFailed(ctx, c.Subject, err)
+				return
+			}
+		}
+	}
+	tokenStr, refreshStr, err := golden_jwt.Refresh(rd.RefreshToken)
+	if err != nil {
+		logger.Warn("调用服务 Refresh 错误!!!错误信息：", zap.Error(err))
+		ghttp.CommonErrorCodeResponse(ctx, jwt.ErrorCode(err), err)
+		return
+	}
+	golden_jwt.SetCookie(ctx, tokenStr, refreshStr)
+	ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(types.TokenData{AccessToken: tokenStr, RefreshToken: refreshStr}))
 }
 
 // @Tags 登录相关接口
@@ -157,13 +395,14 @@ func loginLdap(ctx *gin.Context, ld *types.LoginData) {
 // @Summary 获取登录用户信息
 // @Description 获取登录用户信息
 // @Produce  json
+// @Security BearerAuth
 // @Router /v1/userinfo [get]
 // @Success 200 {object} ghttp.HttpResult
 func UserInfo(ctx *gin.Context) {
 	golden_claims_I, exists := ctx.Get("golden_claims")
 	if !exists {
 		logger.Warn("获取用户信息失败!!!")
-		ghttp.CommonFailCodeResponse(ctx, 50000, "获取用户信息失败!!!")
+		ghttp.CommonFailCodeResponse(ctx, jwt.CodeTokenMissing, "获取用户信息失败!!!")
 		return
 	}
 	golden_claims, ok := golden_claims_I.(jwtgo.MapClaims)
@@ -172,7 +411,39 @@ func UserInfo(ctx *gin.Context) {
 		ghttp.CommonFailCodeResponse(ctx, 50001, "获取用户信息失败!!!")
 		return
 	}
-	ghttp.CommonSuccessResponse(ctx, golden_claims)
+	ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(golden_claims))
+}
+
+// @Tags 登录相关接口
+// ShowAccount godoc
+// @Summary 获取当前token的用户
+// @Description 只解析当前 token 的 claims，不查询数据库，没有有效的 token 时返回 401
+// @Produce  json
+// @Security BearerAuth
+// @Router /v1/whoami [get]
+// @Success 200 {object} ghttp.HttpResult
+// @Failure 401 {object} ghttp.HttpResult
+func WhoAmI(ctx *gin.Context) {
+	claims, err := jwt.ClaimsFromContext(ctx)
+	if err != nil {
+		logger.Warn("获取用户信息失败!!!错误信息：", zap.Error(err))
+		r := ghttp.CommonFailResult("未登录!!!")
+		r.Code = jwt.CodeTokenMissing
+		ghttp.Render(ctx, http.StatusUnauthorized, r)
+		return
+	}
+	ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(types.WhoAmIData{
+		Subject:     claims.Subject,
+		ID:          claims.ID,
+		Name:        claims.Name,
+		DisplayName: claims.DisplayName,
+		Email:       claims.Email,
+		SuperAdmin:  claims.SuperAdmin,
+		Roles:       claims.Roles,
+		Groups:      claims.Groups,
+		OrgId:       claims.OrgId,
+		ExpiresAt:   claims.ExpiresAt(),
+	}))
 }
 
 // @Tags 登录相关接口
@@ -180,11 +451,30 @@ func UserInfo(ctx *gin.Context) {
 // @Summary 登出
 // @Description 登出
 // @Produce  json
+// @Security BearerAuth
 // @Router /v1/logout [get]
 // @Success 200 {object} ghttp.HttpResult
 func LogOut(ctx *gin.Context) {
-	ctx.SetCookie("golden_key", "", 0, "", "", false, false)
-	ghttp.CommonSuccessResponse(ctx, nil)
+	if golden_jwt, ok := ctx.Value("golden_jwt").(*jwt.GoldenJwt); ok {
+		// 吊销当前的 token 和 refresh token，避免登出后 token 仍然可用
+		if golden_claims, ok := ctx.Get(jwt.GoldenClaims); ok {
+			if claims, ok := golden_claims.(jwtgo.MapClaims); ok {
+				if err := golden_jwt.RevokeClaims(claims); err != nil {
+					logger.Warn("调用服务 RevokeClaims 错误!!!错误信息：", zap.Error(err))
+				}
+			}
+		}
+		if refreshStr, err := ctx.Cookie(jwt.RefreshCookie); err == nil {
+			if err = golden_jwt.RevokeToken(refreshStr); err != nil {
+				logger.Warn("调用服务 RevokeToken 错误!!!错误信息：", zap.Error(err))
+			}
+		}
+		golden_jwt.ClearCookie(ctx)
+	} else {
+		ctx.SetCookie(jwt.DefaultCookieName, "", -1, "", "", false, true)
+		ctx.SetCookie(jwt.RefreshCookie, "", -1, "", "", false, true)
+	}
+	ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(nil))
 }
 
 //
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+	"gitee.com/golden-go/golden-go/pkg/utils/config"
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
+	"gitee.com/golden-go/golden-go/pkg/utils/jwt"
+	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	"gitee.com/golden-go/golden-go/pkg/utils/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// @Tags 调试相关接口
+// ShowAccount godoc
+// @Summary 查询日志级别
+// @Description 查询当前的日志级别，仅超级管理员可用
+// @Produce  json
+// @Security BearerAuth
+// @Router /debug/loglevel [get]
+// @Success 200 {object} ghttp.HttpResult
+func GetLogLevel(ctx *gin.Context) {
+	ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(types.LogLevelData{Level: logger.Level().String()}))
+}
+
+// @Tags 调试相关接口
+// ShowAccount godoc
+// @Summary 修改日志级别
+// @Description 修改日志级别 debug info warn error，立即生效不需要重启，仅超级管理员可用
+// @Produce  json
+// @Param data body types.LogLevelData  true "日志级别"
+// @Security BearerAuth
+// @Router /debug/loglevel [put]
+// @Success 200 {object} ghttp.HttpResult
+func SetLogLevel(ctx *gin.Context) {
+	args := &types.LogLevelData{}
+	if err := ctx.ShouldBindJSON(args); err != nil {
+		logger.Warn("参数校验失败!!!错误信息：", zap.Error(err))
+		ghttp.CommonValidationFailResponse(ctx, err)
+		return
+	}
+	old := logger.Level().String()
+	if err := logger.SetLevel(args.Level); err != nil {
+		logger.Warn("日志级别错误!!!错误信息：", zap.Error(err))
+		ghttp.CommonFailResponse(ctx, err.Error())
+		return
+	}
+	operator := ""
+	if claims, err := jwt.ClaimsFromContext(ctx); err == nil {
+		operator = claims.Name
+	}
+	logger.Warn("日志级别已修改", zap.String("operator", operator), zap.String("from", old), zap.String("to", logger.Level().String()))
+	ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(types.LogLevelData{Level: logger.Level().String()}))
+}
+
+// @Tags 调试相关接口
+// ShowAccount godoc
+// @Summary 重新加载配置
+// @Description 重新读取配置文件，重新应用日志级别、LDAP 服务等可以热加载的配置，仅超级管理员可用。
+// @Description applied 为已修改并重新应用的配置，restart_required 为和启动时不同、需要重启才能生效的配置
+// @Produce  json
+// @Security BearerAuth
+// @Router /config/reload [post]
+// @Success 200 {object} ghttp.HttpResult{data=config.ReloadResult}
+// @Failure 409 {object} ghttp.HttpResult "启动时没有使用配置文件"
+func ReloadConfig(ctx *gin.Context) {
+	result, err := config.Reload()
+	audit(ctx, models.AuditConfigReload, 0, "", err)
+	if err != nil {
+		logger.Warn("重新加载配置失败!!!错误信息：", zap.Error(err))
+		if errors.Is(err, config.ErrNoConfigFile) {
+			r := ghttp.CommonErrResult(err)
+			r.Code = 40900
+			ghttp.Render(ctx, http.StatusConflict, r)
+			return
+		}
+		ghttp.CommonFailResponse(ctx, err.Error())
+		return
+	}
+	logger.Info("配置已重新加载", zap.Strings("applied", result.Applied), zap.Strings("restart_required", result.RestartRequired))
+	ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(result))
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+	"gitee.com/golden-go/golden-go/pkg/service"
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
+	"gitee.com/golden-go/golden-go/pkg/utils/jwt"
+	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	"gitee.com/golden-go/golden-go/pkg/utils/oidc"
+	"gitee.com/golden-go/golden-go/pkg/utils/types"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// OIDC 登录过程中保存 state 和 nonce 的 cookie
+const (
+	oidcStateCookie = "oidc_state"
+	oidcNonceCookie = "oidc_nonce"
+	// oidcCookieMaxAge 需要在这个时间内完成身份提供方的登录，单位秒
+	oidcCookieMaxAge = 600
+)
+
+// getOIDC 获取 gin context 中的 OIDC 身份提供方，获取失败时返回错误响应
+func getOIDC(ctx *gin.Context) (*oidc.Provider, bool) {
+	p, ok := ctx.Value("OIDC").(*oidc.Provider)
+	if !ok {
+		logger.Warn("获取OIDC失败!!!")
+		ghttp.CommonFailCodeResponse(ctx, 50006, "获取OIDC失败!!!")
+		return nil, false
+	}
+	return p, true
+}
+
+// setOIDCCookie 设置 OIDC 登录过程中的 cookie，maxAge 小于 0 时删除
+func setOIDCCookie(ctx *gin.Context, name, value string, maxAge int) {
+	// 身份提供方回调是跨站的 GET 请求，需要 Lax 才会带上 cookie
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(name, value, maxAge, "/", "", ctx.Request.TLS != nil, true)
+}
+
+// @Tags 登录相关接口
+// ShowAccount godoc
+// @Summary OIDC登录
+// @Description 跳转到 OIDC 身份提供方登录，登录后回调 /v1/login/oidc/callback
+// @Router /v1/login/oidc [get]
+// @Success 302
+func LoginOidc(ctx *gin.Context) {
+	p, ok := getOIDC(ctx)
+	if !ok {
+		return
+	}
+	state, err := oidc.RandomString()
+	if err != nil {
+		ghttp.CommonErrorCodeResponse(ctx, 50000, err)
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		ghttp.CommonErrorCodeResponse(ctx, 50000, err)
+		return
+	}
+	url, err := p.AuthCodeURL(ctx.Request.Context(), state, nonce)
+	if err != nil {
+		logger.Warn("OIDC服务不可用!!!错误信息：", zap.Error(err))
+		r := ghttp.CommonFailResult("OIDC服务不可用!!!")
+		r.Code = codeServiceUnavailable
+		ghttp.Render(ctx, http.StatusServiceUnavailable, r)
+		return
+	}
+	setOIDCCookie(ctx, oidcStateCookie, state, oidcCookieMaxAge)
+	setOIDCCookie(ctx, oidcNonceCookie, nonce, oidcCookieMaxAge)
+	ctx.Redirect(http.StatusFound, url)
+}
+
+// @Tags 登录相关接口
+// ShowAccount godoc
+// @Summary OIDC登录回调
+// @Description OIDC 身份提供方登录后的回调，校验 state 和 id_token 后保存用户并签发 token。
+// @Description 用户按 issuer 和 sub 确定，用户名已被其它认证方式或其它 sub 的用户使用时返回 409
+// @Produce  json
+// @Param code query string true "授权码"
+// @Param state query string true "登录时生成的 state"
+// @Router /v1/login/oidc/callback [get]
+// @Success 200 {object} ghttp.HttpResult
+// @Failure 409 {object} ghttp.HttpResult "用户名已被其它用户使用"
+func LoginOidcCallback(ctx *gin.Context) {
+	p, ok := getOIDC(ctx)
+	if !ok {
+		return
+	}
+	state, _ := ctx.Cookie(oidcStateCookie)
+	nonce, _ := ctx.Cookie(oidcNonceCookie)
+	setOIDCCookie(ctx, oidcStateCookie, "", -1)
+	setOIDCCookie(ctx, oidcNonceCookie, "", -1)
+	if e := ctx.Query("error"); e != "" {
+		logger.Warn("OIDC登录失败!!!", zap.String("error", e), zap.String("description", ctx.Query("error_description")))
+		r := ghttp.CommonFailResult("OIDC登录失败!!!")
+		r.Code = 50004
+		ghttp.Render(ctx, http.StatusUnauthorized, r)
+		return
+	}
+	if state == "" || ctx.Query("state") != state {
+		logger.Warn("OIDC state 校验失败!!!")
+		r := ghttp.CommonFailResult("登录已过期或state不匹配!!!")
+		r.Code = 40000
+		ghttp.Render(ctx, http.StatusBadRequest, r)
+		return
+	}
+	ou, err := p.Exchange(ctx.Request.Context(), ctx.Query("code"), nonce)
+	if err != nil {
+		logger.Warn("调用服务 Exchange 错误!!!错误信息：", zap.Error(err))
+		auditLogin(ctx, models.AuditLoginOIDC, "", 0, err)
+		r := ghttp.CommonFailResult("OIDC登录失败!!!")
+		r.Code = 50004
+		ghttp.Render(ctx, http.StatusUnauthorized, r)
+		return
+	}
+	ou.Name = types.Normalize.Username(ou.Name)
+
+	us := service.GetUserServiceDBWithContext(ctx)
+	// 按 issuer 和 sub 确定用户，不允许 OIDC 用户登录同名的本地、LDAP 用户或其它 sub 的 OIDC 用户
+	lu := oidcLocalUser(ou)
+	if err := us.UpsertOIDCUser(lu); errors.Is(err, service.ErrUsernameTaken) {
+		logger.Warn("用户名已被其它用户使用!!!", zap.String("name", ou.Name), zap.String("external_id", ou.ExternalID))
+		auditLogin(ctx, models.AuditLoginOIDC, ou.Name, 0, err)
+		r := ghttp.CommonErrResult(err)
+		r.Code = 40900
+		ghttp.Render(ctx, http.StatusConflict, r)
+		return
+	} else if err != nil {
+		logger.Warn("调用服务 UpsertOIDCUser 错误!!!错误信息：", zap.Error(err))
+		ghttp.CommonFailCodeResponse(ctx, 50004, "保存用户信息失败!!!")
+		return
+	}
+	u, err := us.GetUserWithName(lu.Name)
+	if err != nil {
+		logger.Warn("获取用户信息失败!!!", zap.Error(err))
+		ghttp.CommonFailCodeResponse(ctx, 50004, "获取用户信息失败!!!")
+		return
+	}
+	if u.Disabled {
+		auditLogin(ctx, models.AuditLoginOIDC, u.Name, u.ID, service.ErrUserDisabled)
+		userCheckFailed(ctx, u.Name, service.ErrUserDisabled)
+		return
+	}
+	u.Groups = ou.Groups
+	auditLogin(ctx, models.AuditLoginOIDC, u.Name, u.ID, nil)
+
+	golden_jwt, ok := ctx.Value("golden_jwt").(*jwt.GoldenJwt)
+	if !ok {
+		logger.Warn("获取JWT失败!!!")
+		ghttp.CommonFailCodeResponse(ctx, 50006, "获取JWT失败!!!")
+		return
+	}
+	tokenStr, _ := golden_jwt.CreateTokenAndSetCookie(userClaims(&u), ctx)
+
+	ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(tokenStr))
+}
+
+// oidcLocalUser OIDC用户对应的本地用户
+func oidcLocalUser(u *models.User) *models.User {
+	return &models.User{
+		AuthModule:  models.AuthModuleOIDC,
+		Name:        u.Name,
+		ExternalID:  u.ExternalID,
+		DisplayName: u.DisplayName,
+		Email:       u.Email,
+	}
+}
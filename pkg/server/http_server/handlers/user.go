@@ -1,14 +1,23 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"strconv"
+	"strings"
 
 	"gitee.com/golden-go/golden-go/pkg/models"
 	"gitee.com/golden-go/golden-go/pkg/service"
 	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
+	"gitee.com/golden-go/golden-go/pkg/utils/jwt"
+	"gitee.com/golden-go/golden-go/pkg/utils/ldap"
 	"gitee.com/golden-go/golden-go/pkg/utils/logger"
 	"gitee.com/golden-go/golden-go/pkg/utils/types"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -18,8 +27,17 @@ import (
 // @Description 搜索用户
 // @Produce  json
 // @Param filter query string  false "过滤关键词"
-// @Param pageNo query []int  false "多个ID 每个ID之间用,分隔，例：123,233 注：跟 name 参数只有一个会生效，hostids参数优先级"
-// @Param pageSize query int  false "单页条数"
+// @Param q query string  false "模糊搜索用户名和邮箱，不区分大小写"
+// @Param email query string  false "邮箱"
+// @Param auth_module query string  false "认证方式，例：ldap"
+// @Param disabled query bool  false "是否禁用"
+// @Param page query int  false "页码，默认1"
+// @Param page_size query int  false "单页条数，默认20，最大为配置的 user.search.max_page_size"
+// @Param cursor query string  false "游标分页，有该参数时忽略 page 且不返回总数，第一页为空，之后为上一页返回的 next_cursor"
+// @Param include_deleted query bool  false "是否包括已删除的用户，仅超级管理员可用"
+// @Param sort query string  false "排序字段：id name display_name email auth_module create_time update_time"
+// @Param order query string  false "排序方向：asc desc"
+// @Security BearerAuth
 // @Router /v1/user [get]
 // @Success 200 {object} ghttp.HttpResult
 func SearchUser(ctx *gin.Context) {
@@ -28,37 +46,67 @@ func SearchUser(ctx *gin.Context) {
 	if keyword != "" && filter == "" {
 		filter = keyword
 	}
-	pageNo, err := strconv.Atoi(ctx.Query("pageNo"))
-	if err != nil {
-		pageNo = 1
+	opts := pageOptions(ctx)
+
+	us := service.UserSearch{
+		Filter:     filter,
+		Q:          ctx.Query("q"),
+		Email:      ctx.Query("email"),
+		AuthModule: ctx.Query("auth_module"),
+		Page:       opts.Page,
+		PageSize:   opts.PageSize,
+		Sort:       opts.Sort,
+		Order:      opts.Order,
 	}
-	if pageNo < 1 {
-		pageNo = 1
+	if v, ok := ctx.GetQuery("disabled"); ok {
+		disabled, err := strconv.ParseBool(v)
+		if err != nil {
+			logger.Warn("disabled 参数错误!!!错误信息：", zap.Error(err))
+			ghttp.CommonFailResponse(ctx, err.Error())
+			return
+		}
+		us.Disabled = &disabled
 	}
-	pageSize, err := strconv.Atoi(ctx.Query("pageSize"))
-	if err != nil {
-		pageSize = 1000
+	userService, ok := userServiceWithDeleted(ctx)
+	if !ok {
+		return
 	}
-	if pageSize < 1 {
-		pageSize = 1
+	// 有 cursor 参数时使用游标分页，忽略 page
+	if cursor, ok := ctx.GetQuery("cursor"); ok {
+		if d, err := userService.SearchUserCursor(us, cursor); err != nil {
+			logger.Warn("调用服务 SearchUserCursor 错误!!!错误信息：", zap.Error(err))
+			ghttp.CommonFailResponse(ctx, err.Error())
+		} else {
+			d.Items = publicUsers(ctx, d.Items)
+			ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(d))
+		}
+		return
 	}
-
-	if d, err := service.GetUserServiceDBWithContext(ctx).SearchUser(filter, pageNo, pageSize); err != nil {
+	if d, err := userService.SearchUser(us); err != nil {
 		logger.Warn("调用服务 SearchUser 错误!!!错误信息：", zap.Error(err))
 		ghttp.CommonFailResponse(ctx, err.Error())
 	} else {
-		ghttp.CommonSuccessResponse(ctx, d)
+		ghttp.Render(ctx, http.StatusOK, ghttp.CommonListResult(publicUsers(ctx, d.Items), d.Total, d.Page, d.PageSize))
 	}
 }
 
+// pageOptions 获取分页和排序参数，单页条数最大为 user.search.max_page_size
+func pageOptions(ctx *gin.Context) service.PageOptions {
+	return service.PageOptionsFromContext(ctx, viper.GetInt("user.search.max_page_size"))
+}
+
 // @Tags 用户相关接口
 // ShowAccount godoc
 // @Summary 获取用户
-// @Description 获取用户
+// @Description 获取用户，非超级管理员看不到认证方式、禁用状态等管理字段
 // @Produce  json
 // @Param userid path int  false "用户ID"
+// @Param include_deleted query bool  false "是否包括已删除的用户，仅超级管理员可用"
+// @Param If-None-Match header string  false "上次响应的 ETag，用户没有修改时返回 304"
+// @Security BearerAuth
 // @Router /v1/user/{userid} [get]
-// @Success 200 {object} ghttp.HttpResult
+// @Success 200 {object} ghttp.HttpResult{data=models.PublicUser}
+// @Success 304 "用户没有修改"
 func GetUser(ctx *gin.Context) {
 	id, err := strconv.Atoi(ctx.Param("userid"))
 	if err != nil {
@@ -66,15 +114,46 @@ func GetUser(ctx *gin.Context) {
 		ghttp.CommonFailResponse(ctx, err.Error())
 		return
 	}
-	if d, err := service.GetUserServiceDBWithContext(ctx).GetUser(id); err != nil {
+	userService, ok := userServiceWithDeleted(ctx)
+	if !ok {
+		return
+	}
+	if d, err := userService.GetUser(id); err != nil {
 		logger.Warn("调用服务 SearchUser 错误!!!错误信息：", zap.Error(err))
 		ghttp.CommonFailResponse(ctx, err.Error())
-	} else {
-		ghttp.CommonSuccessResponse(ctx, d)
+	} else if pu := d.Public(userView(ctx)); !userNotModified(ctx, pu) {
+		ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(pu))
+	}
+}
+
+// userNotModified 设置用户的 ETag，请求的 If-None-Match 匹配时响应 304 并返回 true
+func userNotModified(ctx *gin.Context, u models.PublicUser) bool {
+	etag, err := ghttp.ETag(u)
+	if err != nil {
+		logger.Warn("计算用户 ETag 错误!!!错误信息：", zap.Error(err))
+		return false
 	}
+	return ghttp.NotModified(ctx, etag)
 }
 
+// @Tags 用户相关接口
+// ShowAccount godoc
+// @Summary 查询组的用户
+// @Description 有 group 参数时分页查询属于组的用户，LDAP 组为组的 DN，否则查询 groupid 分组的用户
+// @Produce  json
+// @Param group query string  false "组名"
+// @Param nested query bool  false "是否包括通过嵌套的组间接所属的用户，默认false"
+// @Param page query int  false "页码，默认1"
+// @Param page_size query int  false "单页条数，默认20，最大为配置的 user.search.max_page_size"
+// @Param groupid query int  false "分组ID，没有 group 参数时使用"
+// @Security BearerAuth
+// @Router /v1/user/group [get]
+// @Success 200 {object} ghttp.HttpResult{data=types.GroupMembers}
 func GetUserWithGroup(ctx *gin.Context) {
+	if group, ok := ctx.GetQuery("group"); ok {
+		getUsersInGroup(ctx, group)
+		return
+	}
 	id, err := strconv.Atoi(ctx.Query("groupid"))
 	if err != nil {
 		logger.Warn("get group id 错误!!!错误信息：", zap.Error(err))
@@ -85,73 +164,430 @@ func GetUserWithGroup(ctx *gin.Context) {
 		logger.Warn("调用服务 GetUserWithGroup 错误!!!错误信息：", zap.Error(err))
 		ghttp.CommonFailResponse(ctx, err.Error())
 	} else {
-		ghttp.CommonSuccessResponse(ctx, d)
+		ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(models.PublicUsers(d, userView(ctx))))
 	}
 }
 
+// getUsersInGroup 分页查询属于组 group 的用户
+func getUsersInGroup(ctx *gin.Context, group string) {
+	nested := false
+	if v, ok := ctx.GetQuery("nested"); ok {
+		var err error
+		if nested, err = strconv.ParseBool(v); err != nil {
+			logger.Warn("nested 参数错误!!!错误信息：", zap.Error(err))
+			ghttp.CommonFailResponse(ctx, err.Error())
+			return
+		}
+	}
+	opts := pageOptions(ctx)
+	d, err := service.GetUserServiceDBWithContext(ctx).GetUsersInGroup(group, nested, opts.Page, opts.PageSize)
+	if err != nil {
+		logger.Warn("调用服务 GetUsersInGroup 错误!!!错误信息：", zap.Error(err))
+		ghttp.CommonFailResponse(ctx, err.Error())
+		return
+	}
+	d.Items = publicUsers(ctx, d.Items)
+	ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(types.GroupMembers{Group: group, Nested: nested, PageData: *d}))
+}
+
 // @Tags 用户相关接口
 // ShowAccount godoc
 // @Summary 创建用户
 // @Description 创建用户
 // @Produce  json
-// @Param data body models.User  true "用户"
+// @Param data body models.UserCreate  true "用户"
+// @Security BearerAuth
 // @Router /v1/user [post]
 // @Success 200 {object} ghttp.HttpResult
+// @Failure 400 {object} ghttp.HttpResult "参数校验失败，data 为每个字段的错误原因"
+// @Failure 403 {object} ghttp.HttpResult "非超级管理员设置了 super_admin 或 role"
+// @Failure 409 {object} ghttp.HttpResult "用户名或邮箱已存在"
 func CreateUser(ctx *gin.Context) {
-	args := &models.User{}
-	if err := ghttp.GetBody(ctx, args); err != nil {
-		logger.Warn("调用服务 GetBody 错误!!!错误信息：", zap.Error(err))
-		ghttp.CommonFailResponse(ctx, err.Error())
+	args := &models.UserCreate{}
+	if err := ctx.ShouldBindJSON(args); err != nil {
+		logger.Warn("参数校验失败!!!错误信息：", zap.Error(err))
+		ghttp.CommonValidationFailResponse(ctx, err)
 		return
 	}
-	if err := service.GetUserServiceDBWithContext(ctx).CreateUser(args); err != nil {
-		logger.Warn("调用服务 SearchUser 错误!!!错误信息：", zap.Error(err))
-		ghttp.CommonFailResponse(ctx, err.Error())
+	if (args.SuperAdmin || args.Role != "") && !isSuperAdmin(ctx) {
+		createForbidden(ctx, args.Name)
+		return
+	}
+	u := args.User()
+	err := service.GetUserServiceDBWithContext(ctx).CreateUser(u)
+	audit(ctx, models.AuditUserCreate, u.ID, u.Name, err)
+	if err != nil {
+		logger.Warn("调用服务 CreateUser 错误!!!错误信息：", zap.Error(err))
+		if errors.Is(err, service.ErrDuplicateName) || errors.Is(err, service.ErrDuplicateEmail) {
+			r := ghttp.CommonErrResult(err)
+			r.Code = 40900
+			ghttp.Render(ctx, http.StatusConflict, r)
+			return
+		}
+		// 不返回数据库的错误信息
+		ghttp.CommonFailResponse(ctx, "创建用户失败!!!")
 	} else {
-		if d, err := service.GetUserServiceDBWithContext(ctx).SearchUser("", 1, 1000); err != nil {
+		if d, err := service.GetUserServiceDBWithContext(ctx).SearchUser(service.UserSearch{Page: 1, PageSize: 1000}); err != nil {
 			logger.Warn("调用服务 SearchUser 错误!!!错误信息：", zap.Error(err))
 			ghttp.CommonFailResponse(ctx, err.Error())
 		} else {
-			ghttp.CommonSuccessResponse(ctx, d)
+			ghttp.Render(ctx, http.StatusOK, ghttp.CommonListResult(publicUsers(ctx, d.Items), d.Total, d.Page, d.PageSize))
 		}
 	}
 }
 
+// createForbidden 非超级管理员创建超级管理员或设置角色时返回 403，names 为设置了角色和权限的用户
+func createForbidden(ctx *gin.Context, names ...string) {
+	logger.Warn("非超级管理员不能设置角色和权限!!!", zap.Strings("names", names))
+	for _, name := range names {
+		audit(ctx, models.AuditUserCreate, 0, name, errors.New("非超级管理员不能设置角色和权限"))
+	}
+	r := ghttp.CommonFailResult("非超级管理员不能设置角色和权限!!!")
+	r.Code = codeForbidden
+	ghttp.Render(ctx, http.StatusForbidden, r)
+}
+
+// maxBatchUsers 批量创建或从LDAP导入用户单次最多的用户数
+const maxBatchUsers = 1000
+
+// @Tags 用户相关接口
+// ShowAccount godoc
+// @Summary 批量创建用户
+// @Description 先校验所有用户，有任何一个不合法时都不创建，data 为每个不合法用户的下标和原因。
+// @Description 默认在一个事务中创建，任何一个失败时全部不创建；atomic=false 时逐个创建，data 为每个用户的结果
+// @Produce  json
+// @Param data body []models.UserCreate  true "用户列表"
+// @Param atomic query bool  false "是否全部成功或全部失败，默认 true"
+// @Security BearerAuth
+// @Router /v1/user/batch [post]
+// @Success 200 {object} ghttp.HttpResult{data=[]types.BatchResult}
+// @Failure 400 {object} ghttp.HttpResult{data=[]types.BatchResult} "参数校验失败"
+// @Failure 403 {object} ghttp.HttpResult "非超级管理员设置了 super_admin 或 role"
+// @Failure 409 {object} ghttp.HttpResult{data=[]types.BatchResult} "用户名或邮箱已存在"
+func CreateUsers(ctx *gin.Context) {
+	body, err := ctx.GetRawData()
+	if err != nil {
+		ghttp.CommonValidationFailResponse(ctx, err)
+		return
+	}
+	// 不使用 ShouldBindJSON，由 validateBatchUsers 逐个校验并返回每个用户的错误
+	var args []models.UserCreate
+	if err := json.Unmarshal(body, &args); err != nil {
+		logger.Warn("参数校验失败!!!错误信息：", zap.Error(err))
+		ghttp.CommonValidationFailResponse(ctx, err)
+		return
+	}
+	if len(args) == 0 || len(args) > maxBatchUsers {
+		ghttp.CommonValidationFailResponse(ctx, fmt.Errorf("用户数必须在 1 到 %d 之间", maxBatchUsers))
+		return
+	}
+	atomic := true
+	if v, ok := ctx.GetQuery("atomic"); ok {
+		if atomic, err = strconv.ParseBool(v); err != nil {
+			ghttp.CommonValidationFailResponse(ctx, fmt.Errorf("atomic 参数错误：%s", v))
+			return
+		}
+	}
+	if !isSuperAdmin(ctx) {
+		var privileged []string
+		for i := range args {
+			if args[i].SuperAdmin || args[i].Role != "" {
+				privileged = append(privileged, args[i].Name)
+			}
+		}
+		if len(privileged) > 0 {
+			createForbidden(ctx, privileged...)
+			return
+		}
+	}
+	if invalid := validateBatchUsers(args); len(invalid) > 0 {
+		logger.Warn("批量创建用户参数校验失败!!!", zap.Int("invalid", len(invalid)))
+		r := ghttp.CommonFailResult("参数校验失败")
+		r.Code = 40000
+		r.Data = invalid
+		ghttp.Render(ctx, http.StatusBadRequest, r)
+		return
+	}
+	users := make([]*models.User, len(args))
+	for i := range args {
+		users[i] = args[i].User()
+	}
+	us := service.GetUserServiceDBWithContext(ctx)
+	results := make([]types.BatchResult, len(users))
+	if !atomic {
+		for i, u := range users {
+			err := us.CreateUser(u)
+			if err != nil {
+				logger.Warn("调用服务 CreateUser 错误!!!错误信息：", zap.String("name", u.Name), zap.Error(err))
+			}
+			audit(ctx, models.AuditUserCreate, u.ID, u.Name, err)
+			results[i] = batchResult(i, u, err)
+		}
+		ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(results))
+		return
+	}
+	if err := us.CreateUsers(users); err != nil {
+		logger.Warn("调用服务 CreateUsers 错误!!!错误信息：", zap.Error(err))
+		var be *service.BatchError
+		if !errors.As(err, &be) {
+			ghttp.CommonFailResponse(ctx, "批量创建用户失败!!!")
+			return
+		}
+		u := users[be.Index]
+		audit(ctx, models.AuditUserCreate, 0, u.Name, be.Err)
+		if !errors.Is(err, service.ErrDuplicateName) && !errors.Is(err, service.ErrDuplicateEmail) {
+			// 不返回数据库的错误信息
+			ghttp.CommonFailResponse(ctx, "批量创建用户失败!!!")
+			return
+		}
+		r := ghttp.CommonErrResult(err)
+		r.Code = 40900
+		r.Data = []types.BatchResult{batchResult(be.Index, u, be.Err)}
+		ghttp.Render(ctx, http.StatusConflict, r)
+		return
+	}
+	for i, u := range users {
+		results[i] = batchResult(i, u, nil)
+		audit(ctx, models.AuditUserCreate, u.ID, u.Name, nil)
+	}
+	ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(results))
+}
+
+// validateBatchUsers 校验每个用户的参数，以及请求中是否有重复的用户名或邮箱，返回不合法的用户
+func validateBatchUsers(args []models.UserCreate) []types.BatchResult {
+	var invalid []types.BatchResult
+	names, emails := map[string]int{}, map[string]int{}
+	for i := range args {
+		a := &args[i]
+		result := types.BatchResult{Index: i, Name: a.Name}
+		if err := binding.Validator.ValidateStruct(a); err != nil {
+			result.Error = err.Error()
+			result.Fields = ghttp.ValidationErrors(err)
+		} else if j, ok := names[strings.ToLower(a.Name)]; ok {
+			result.Error = fmt.Sprintf("用户名和第 %d 个用户重复", j)
+		} else if j, ok := emails[strings.ToLower(a.Email)]; ok && a.Email != "" {
+			result.Error = fmt.Sprintf("邮箱和第 %d 个用户重复", j)
+		}
+		if result.Error != "" {
+			invalid = append(invalid, result)
+			continue
+		}
+		names[strings.ToLower(a.Name)] = i
+		if a.Email != "" {
+			emails[strings.ToLower(a.Email)] = i
+		}
+	}
+	return invalid
+}
+
+// batchResult 用户 u 的创建结果，不返回数据库的错误信息
+func batchResult(i int, u *models.User, err error) types.BatchResult {
+	result := types.BatchResult{Index: i, Name: u.Name, ID: u.ID, Success: err == nil}
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrDuplicateName) || errors.Is(err, service.ErrDuplicateEmail):
+		result.ID, result.Error = 0, err.Error()
+	default:
+		result.ID, result.Error = 0, "创建用户失败"
+	}
+	return result
+}
+
 // @Tags 用户相关接口
 // ShowAccount godoc
 // @Summary 更新用户
-// @Description 更新用户
+// @Description 按 id 更新用户，零值的字段不更新，和 PATCH 一样不能修改 name auth_module，校验密码和邮箱。
+// @Description version 为查询用户时返回的版本号，用户已被其它请求修改时返回 409，需要重新查询后再更新
 // @Produce  json
-// @Param data body models.User  true "用户"
+// @Param data body models.UserUpdate  true "用户"
+// @Security BearerAuth
 // @Router /v1/user [put]
 // @Success 200 {object} ghttp.HttpResult
+// @Failure 400 {object} ghttp.HttpResult "参数校验失败、没有传入版本号或修改了不能修改的字段"
+// @Failure 403 {object} ghttp.HttpResult "非超级管理员修改了角色和权限或其他用户"
+// @Failure 409 {object} ghttp.HttpResult "邮箱已存在或版本号不是当前版本号"
 func UpdateUser(ctx *gin.Context) {
-	args := &models.User{}
-	if err := ghttp.GetBody(ctx, args); err != nil {
+	raw, err := ctx.GetRawData()
+	if err != nil {
+		ghttp.CommonValidationFailResponse(ctx, err)
 		return
 	}
-	if err := service.GetUserServiceDBWithContext(ctx).UpdateUser(args); err != nil {
-		logger.Warn("调用服务 SearchUser 错误!!!错误信息：", zap.Error(err))
-		ghttp.CommonFailResponse(ctx, err.Error())
+	// id 是要更新的用户，其它不能修改的字段和 PATCH 一样拒绝
+	if !immutableFieldsAbsent(ctx, raw, "id") {
+		return
+	}
+	body := &models.UserUpdate{}
+	if err := json.Unmarshal(raw, body); err != nil {
+		logger.Warn("参数校验失败!!!错误信息：", zap.Error(err))
+		ghttp.CommonValidationFailResponse(ctx, err)
+		return
+	}
+	args := &body.User
+	if args.Version <= 0 {
+		logger.Warn("参数校验失败!!!没有传入版本号")
+		ghttp.CommonValidationFailResponse(ctx, errors.New("version 必须为查询用户时返回的版本号"))
+		return
+	}
+	patch := body.Patch()
+	if err := binding.Validator.ValidateStruct(patch); err != nil {
+		logger.Warn("参数校验失败!!!错误信息：", zap.Error(err))
+		ghttp.CommonValidationFailResponse(ctx, err)
+		return
+	}
+	// 零值的字段不会更新，非零值的 super_admin role disabled 即为修改
+	if patch.Privileged() && !isSuperAdmin(ctx) {
+		logger.Warn("非超级管理员不能修改角色和权限!!!")
+		audit(ctx, models.AuditUserUpdate, args.ID, args.Name, errors.New("非超级管理员不能修改角色和权限"))
+		r := ghttp.CommonFailResult("非超级管理员不能修改角色和权限!!!")
+		r.Code = codeForbidden
+		ghttp.Render(ctx, http.StatusForbidden, r)
+		return
+	}
+	if !canModifyUser(ctx, args.ID) {
+		logger.Warn("非超级管理员只能修改自己!!!", zap.Int64("id", args.ID))
+		audit(ctx, models.AuditUserUpdate, args.ID, args.Name, errors.New("非超级管理员只能修改自己"))
+		r := ghttp.CommonFailResult("非超级管理员只能修改自己!!!")
+		r.Code = codeForbidden
+		ghttp.Render(ctx, http.StatusForbidden, r)
+		return
+	}
+	err = service.GetUserServiceDBWithContext(ctx).PatchUser(int(args.ID), patch)
+	audit(ctx, models.AuditUserUpdate, args.ID, args.Name, err)
+	if err != nil {
+		logger.Warn("调用服务 PatchUser 错误!!!错误信息：", zap.Error(err))
+		if errors.Is(err, service.ErrDuplicateEmail) || errors.Is(err, service.ErrVersionConflict) {
+			r := ghttp.CommonErrResult(err)
+			r.Code = 40900
+			ghttp.Render(ctx, http.StatusConflict, r)
+			return
+		}
+		ghttp.CommonFailResponse(ctx, "更新用户失败!!!")
 	} else {
-		if d, err := service.GetUserServiceDBWithContext(ctx).SearchUser("", 1, 1000); err != nil {
+		if d, err := service.GetUserServiceDBWithContext(ctx).SearchUser(service.UserSearch{Page: 1, PageSize: 1000}); err != nil {
 			logger.Warn("调用服务 SearchUser 错误!!!错误信息：", zap.Error(err))
 			ghttp.CommonFailResponse(ctx, err.Error())
 		} else {
-			ghttp.CommonSuccessResponse(ctx, d)
+			ghttp.Render(ctx, http.StatusOK, ghttp.CommonListResult(publicUsers(ctx, d.Items), d.Total, d.Page, d.PageSize))
 
 		}
 	}
 }
 
+// immutableFieldsAbsent 请求体中没有 UserImmutableFields 中除 allowed 以外的字段时返回 true，
+// 否则返回参数校验失败的响应
+func immutableFieldsAbsent(ctx *gin.Context, body []byte, allowed ...string) bool {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		logger.Warn("参数校验失败!!!错误信息：", zap.Error(err))
+		ghttp.CommonValidationFailResponse(ctx, err)
+		return false
+	}
+	for _, f := range allowed {
+		delete(fields, f)
+	}
+	for _, f := range models.UserImmutableFields {
+		if _, ok := fields[f]; ok {
+			logger.Warn("不能修改的字段!!!", zap.String("field", f))
+			ghttp.CommonValidationFailResponse(ctx, fmt.Errorf("不能修改字段：%s", f))
+			return false
+		}
+	}
+	return true
+}
+
+// @Tags 用户相关接口
+// ShowAccount godoc
+// @Summary 部分更新用户
+// @Description 只更新请求中有的字段，不能修改 id name auth_module，super_admin role disabled 仅超级管理员可修改，
+// @Description 非超级管理员只能修改自己。
+// @Description version 必填，为查询用户时返回的版本号，用户已被其它请求修改时返回 409，需要重新查询后再更新
+// @Produce  json
+// @Param userid path int  true "用户ID"
+// @Param data body models.UserPatch  true "要更新的字段"
+// @Security BearerAuth
+// @Router /v1/user/{userid} [patch]
+// @Success 200 {object} ghttp.HttpResult{data=models.PublicUser}
+// @Failure 400 {object} ghttp.HttpResult "参数校验失败或修改了不能修改的字段"
+// @Failure 403 {object} ghttp.HttpResult "非超级管理员修改了仅超级管理员可修改的字段或其他用户"
+// @Failure 409 {object} ghttp.HttpResult "邮箱已存在或版本号不是当前版本号"
+func PatchUser(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("userid"))
+	if err != nil {
+		logger.Warn("patch服务 id 错误!!!错误信息：", zap.Error(err))
+		ghttp.CommonValidationFailResponse(ctx, err)
+		return
+	}
+	body, err := ctx.GetRawData()
+	if err != nil {
+		ghttp.CommonValidationFailResponse(ctx, err)
+		return
+	}
+	if !immutableFieldsAbsent(ctx, body) {
+		return
+	}
+	args := &models.UserPatch{}
+	if err := json.Unmarshal(body, args); err != nil {
+		logger.Warn("参数校验失败!!!错误信息：", zap.Error(err))
+		ghttp.CommonValidationFailResponse(ctx, err)
+		return
+	}
+	if err := binding.Validator.ValidateStruct(args); err != nil {
+		logger.Warn("参数校验失败!!!错误信息：", zap.Error(err))
+		ghttp.CommonValidationFailResponse(ctx, err)
+		return
+	}
+	if args.Privileged() && !isSuperAdmin(ctx) {
+		logger.Warn("非超级管理员不能修改角色和权限!!!")
+		audit(ctx, models.AuditUserUpdate, int64(id), "", errors.New("非超级管理员不能修改角色和权限"))
+		r := ghttp.CommonFailResult("非超级管理员不能修改角色和权限!!!")
+		r.Code = codeForbidden
+		ghttp.Render(ctx, http.StatusForbidden, r)
+		return
+	}
+	if !canModifyUser(ctx, int64(id)) {
+		logger.Warn("非超级管理员只能修改自己!!!", zap.Int("id", id))
+		audit(ctx, models.AuditUserUpdate, int64(id), "", errors.New("非超级管理员只能修改自己"))
+		r := ghttp.CommonFailResult("非超级管理员只能修改自己!!!")
+		r.Code = codeForbidden
+		ghttp.Render(ctx, http.StatusForbidden, r)
+		return
+	}
+	us := service.GetUserServiceDBWithContext(ctx)
+	err = us.PatchUser(id, args)
+	audit(ctx, models.AuditUserUpdate, int64(id), "", err)
+	if err != nil {
+		logger.Warn("调用服务 PatchUser 错误!!!错误信息：", zap.Error(err))
+		if errors.Is(err, service.ErrDuplicateEmail) || errors.Is(err, service.ErrVersionConflict) {
+			r := ghttp.CommonErrResult(err)
+			r.Code = 40900
+			ghttp.Render(ctx, http.StatusConflict, r)
+			return
+		}
+		ghttp.CommonFailResponse(ctx, "更新用户失败!!!")
+		return
+	}
+	if d, err := us.GetUser(id); err != nil {
+		logger.Warn("调用服务 GetUser 错误!!!错误信息：", zap.Error(err))
+		ghttp.CommonFailResponse(ctx, err.Error())
+	} else {
+		// 返回更新后的 ETag，PATCH 请求不会响应 304
+		pu := d.Public(userView(ctx))
+		userNotModified(ctx, pu)
+		ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(pu))
+	}
+}
+
 // @Tags 用户相关接口
 // ShowAccount godoc
 // @Summary 删除user
-// @Description 删除user
+// @Description 删除user，仅超级管理员可用
 // @Produce  json
 // @Param ids query []int  false "多个ID 每个ID之间用,分隔，例：123,233"
+// @Param hard query bool  false "是否从数据库删除，默认只标记删除"
+// @Security BearerAuth
 // @Router /v1/user [delete]
 // @Success 200 {object} ghttp.HttpResult
+// @Failure 403 {object} ghttp.HttpResult "非超级管理员"
 func DeleteUser(ctx *gin.Context) {
 	id_str := ctx.QueryArray("ids")
 	ids, err := types.SliceStringToInt(id_str)
@@ -160,10 +596,209 @@ func DeleteUser(ctx *gin.Context) {
 		ghttp.CommonFailResponse(ctx, err.Error())
 		return
 	}
-	if err := service.GetUserServiceDBWithContext(ctx).DelUser(ids); err != nil {
+	if !isSuperAdmin(ctx) {
+		logger.Warn("非超级管理员不能删除用户!!!", zap.Ints("ids", ids))
+		for _, id := range ids {
+			audit(ctx, models.AuditUserDelete, int64(id), "", errors.New("非超级管理员不能删除用户"))
+		}
+		r := ghttp.CommonFailResult("非超级管理员不能删除用户!!!")
+		r.Code = codeForbidden
+		ghttp.Render(ctx, http.StatusForbidden, r)
+		return
+	}
+	hard := ctx.Query("hard") == "true"
+	err = service.GetUserServiceDBWithContext(ctx).DelUser(ids, hard)
+	for _, id := range ids {
+		audit(ctx, models.AuditUserDelete, int64(id), "", err)
+	}
+	if err != nil {
 		logger.Warn("调用服务 DelUser 错误!!!错误信息：", zap.Error(err))
 		ghttp.CommonFailResponse(ctx, err.Error())
 	} else {
-		ghttp.CommonSuccessResponse(ctx, nil)
+		ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(nil))
+	}
+}
+
+// @Tags 用户相关接口
+// ShowAccount godoc
+// @Summary 恢复已删除的user
+// @Description 恢复已删除的user，仅超级管理员可用
+// @Produce  json
+// @Param ids query []int  false "多个ID 每个ID之间用,分隔，例：123,233"
+// @Security BearerAuth
+// @Router /v1/user/restore [put]
+// @Success 200 {object} ghttp.HttpResult
+func RestoreUser(ctx *gin.Context) {
+	if !isSuperAdmin(ctx) {
+		logger.Warn("非超级管理员不能恢复用户!!!")
+		ghttp.CommonFailCodeResponse(ctx, codeForbidden, "非超级管理员不能恢复用户!!!")
+		return
+	}
+	id_str := ctx.QueryArray("ids")
+	ids, err := types.SliceStringToInt(id_str)
+	if err != nil {
+		logger.Warn("id，无法转化！！！", zap.Any("ids", id_str), zap.Error(err))
+		ghttp.CommonFailResponse(ctx, err.Error())
+		return
+	}
+	err = service.GetUserServiceDBWithContext(ctx).RestoreUser(ids)
+	for _, id := range ids {
+		audit(ctx, models.AuditUserRestore, int64(id), "", err)
+	}
+	if err != nil {
+		logger.Warn("调用服务 RestoreUser 错误!!!错误信息：", zap.Error(err))
+		ghttp.CommonFailResponse(ctx, err.Error())
+	} else {
+		ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(nil))
+	}
+}
+
+// codeForbidden 没有权限
+const codeForbidden = 40300
+
+// isSuperAdmin 当前登录用户是否是超级管理员
+func isSuperAdmin(ctx *gin.Context) bool {
+	claims, err := jwt.ClaimsFromContext(ctx)
+	if err != nil {
+		return false
+	}
+	return claims.SuperAdmin
+}
+
+// canModifyUser 超级管理员可以修改所有用户，其他用户只能修改自己（包括密码）
+func canModifyUser(ctx *gin.Context, id int64) bool {
+	claims, err := jwt.ClaimsFromContext(ctx)
+	if err != nil {
+		return false
+	}
+	return claims.SuperAdmin || (claims.ID != 0 && claims.ID == id)
+}
+
+// AdminRequired 非超级管理员返回 403
+func AdminRequired(ctx *gin.Context) {
+	if !isSuperAdmin(ctx) {
+		logger.Warn("非超级管理员没有权限!!!", zap.String("path", ctx.Request.URL.Path))
+		r := ghttp.CommonFailResult("非超级管理员没有权限!!!")
+		r.Code = codeForbidden
+		ctx.Abort()
+		ghttp.Render(ctx, http.StatusForbidden, r)
+	}
+}
+
+// userView 当前用户可见的用户字段范围，超级管理员可以看到管理字段
+func userView(ctx *gin.Context) models.UserView {
+	if isSuperAdmin(ctx) {
+		return models.UserViewAdmin
+	}
+	return models.UserViewBasic
+}
+
+// publicUsers 把服务返回的用户列表转换为当前用户可见的用户信息
+func publicUsers(ctx *gin.Context, items interface{}) interface{} {
+	if users, ok := items.([]models.User); ok {
+		return models.PublicUsers(users, userView(ctx))
+	}
+	return items
+}
+
+// userServiceWithDeleted 参数 include_deleted=true 时返回包括已删除用户的 UserService，仅超级管理员可用
+func userServiceWithDeleted(ctx *gin.Context) (service.UserService, bool) {
+	userService := service.GetUserServiceDBWithContext(ctx)
+	if ctx.Query("include_deleted") != "true" {
+		return userService, true
+	}
+	if !isSuperAdmin(ctx) {
+		logger.Warn("非超级管理员不能查询已删除用户!!!")
+		ghttp.CommonFailCodeResponse(ctx, codeForbidden, "非超级管理员不能查询已删除用户!!!")
+		return nil, false
+	}
+	return userService.Unscoped(), true
+}
+
+// @Tags 用户相关接口
+// ShowAccount godoc
+// @Summary 从LDAP导入用户
+// @Description 按登录名从LDAP批量查询用户并保存到本地，已存在的用户会更新用户信息，返回每个登录名的导入结果，单次最多 1000 个登录名
+// @Produce  json
+// @Param data body types.ImportData  true "登录名列表"
+// @Security BearerAuth
+// @Router /v1/user/import/ldap [post]
+// @Success 200 {object} ghttp.HttpResult
+// @Failure 400 {object} ghttp.HttpResult "登录名数超过上限"
+func ImportLdapUsers(ctx *gin.Context) {
+	args := &types.ImportData{}
+	if err := ghttp.GetBody(ctx, args); err != nil {
+		logger.Warn("调用服务 GetBody 错误!!!错误信息：", zap.Error(err))
+		ghttp.CommonFailResponse(ctx, err.Error())
+		return
+	}
+	var logins []string
+	seen := map[string]bool{}
+	for _, login := range args.Logins {
+		login = strings.TrimSpace(login)
+		if login != "" && !seen[strings.ToLower(login)] {
+			seen[strings.ToLower(login)] = true
+			logins = append(logins, login)
+		}
+	}
+	if len(logins) == 0 {
+		ghttp.CommonFailResponse(ctx, "登录名不能为空!!!")
+		return
+	}
+	if len(logins) > maxBatchUsers {
+		ghttp.CommonValidationFailResponse(ctx, fmt.Errorf("登录名数不能超过 %d", maxBatchUsers))
+		return
+	}
+	iml, ok := getIML(ctx)
+	if !ok {
+		return
+	}
+	// 多个LDAP服务器存在同一用户时使用第一个，不在配置的组中的用户不导入
+	users, failed, err := iml.LookupUsers(logins)
+	if err != nil {
+		logger.Warn("调用服务 LookupUsers 错误!!!错误信息：", zap.Error(err))
+		ghttp.CommonFailResponse(ctx, err.Error())
+		return
+	}
+	lookupErrs := make(map[string]error, len(failed))
+	for _, f := range failed {
+		lookupErrs[strings.ToLower(f.Login)] = f.Err
+	}
+	us := service.GetUserServiceDBWithContext(ctx)
+	results := make([]types.ImportResult, 0, len(logins))
+	for _, login := range logins {
+		result := types.ImportResult{Login: login}
+		u, found := users[strings.ToLower(login)]
+		err := lookupErrs[strings.ToLower(login)]
+		if !found && err == nil {
+			err = ldap.ErrDidNotFindUser
+		}
+		if err != nil {
+			logger.Warn("调用服务 LookupUsers 错误!!!错误信息：", zap.String("login", login), zap.Error(err))
+			result.Error = err.Error()
+		} else if err = us.UpsertUser(ldapLocalUser(u)); err != nil {
+			logger.Warn("调用服务 UpsertUser 错误!!!错误信息：", zap.String("login", login), zap.Error(err))
+			result.Error = err.Error()
+		} else {
+			if err := us.SetUserGroups(u.Login, u.DirectGroups, u.Groups); err != nil {
+				logger.Warn("调用服务 SetUserGroups 错误!!!错误信息：", zap.String("login", login), zap.Error(err))
+			}
+			result.Success = true
+		}
+		audit(ctx, models.AuditUserImport, 0, login, err)
+		results = append(results, result)
+	}
+	ghttp.Render(ctx, http.StatusOK, ghttp.CommonResult(results))
+}
+
+// ldapLocalUser LDAP用户对应的本地用户，LDAP的登录名作为本地用户名
+func ldapLocalUser(u *models.User) *models.User {
+	return &models.User{
+		AuthModule:  models.AuthModuleLDAP,
+		SuperAdmin:  u.SuperAdmin,
+		Name:        u.Login,
+		DisplayName: u.Name,
+		Role:        u.Role,
+		Email:       u.Email,
 	}
 }
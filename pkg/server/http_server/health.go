@@ -0,0 +1,87 @@
+package http_server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout 就绪检查的超时时间
+const readinessTimeout = 3 * time.Second
+
+// ReadinessCheck 就绪检查，依赖不可用时返回错误
+type ReadinessCheck func(ctx context.Context) error
+
+type namedReadinessCheck struct {
+	name  string
+	check ReadinessCheck
+	// optional 检查失败时降级运行，仍然就绪
+	optional bool
+}
+
+// AddReadinessCheck 添加 /readyz 的依赖检查
+func (hs *HttpServer) AddReadinessCheck(name string, check ReadinessCheck) {
+	hs.readinessChecks = append(hs.readinessChecks, namedReadinessCheck{name: name, check: check})
+}
+
+// AddOptionalReadinessCheck 添加 /readyz 的可选依赖检查，依赖不可用时仍然返回 200，
+// 在响应中列出不可用的依赖
+func (hs *HttpServer) AddOptionalReadinessCheck(name string, check ReadinessCheck) {
+	hs.readinessChecks = append(hs.readinessChecks, namedReadinessCheck{name: name, check: check, optional: true})
+}
+
+// healthRouter 注册探针接口，需要在全局中间件之前注册，探针不需要 token
+func (hs *HttpServer) healthRouter() {
+	hs.g.GET("/healthz", healthz)
+	hs.g.GET("/readyz", hs.readyz)
+}
+
+// healthz 存活检查，进程在运行就返回 200
+func healthz(ctx *gin.Context) {
+	ghttp.CommonSuccessResponse(ctx, "ok")
+}
+
+// readyz 就绪检查，有依赖不可用时返回 503 和不可用的依赖，
+// 只有可选依赖不可用时返回 200 和不可用的依赖
+func (hs *HttpServer) readyz(ctx *gin.Context) {
+	c, cancel := context.WithTimeout(ctx.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := map[string]string{}
+	ready := true
+	for _, rc := range hs.readinessChecks {
+		wg.Add(1)
+		go func(rc namedReadinessCheck) {
+			defer wg.Done()
+			if err := rc.check(c); err != nil {
+				mu.Lock()
+				failed[rc.name] = err.Error()
+				ready = ready && rc.optional
+				mu.Unlock()
+			}
+		}(rc)
+	}
+	wg.Wait()
+
+	if !ready {
+		ghttp.Render(ctx, http.StatusServiceUnavailable, ghttp.HttpResult{
+			Code:    50300,
+			Data:    failed,
+			Message: "err:依赖服务不可用",
+		})
+		return
+	}
+	if len(failed) > 0 {
+		r := ghttp.CommonSuccessResult(failed)
+		r.Message = "OK:降级运行，部分依赖服务不可用"
+		ghttp.Render(ctx, http.StatusOK, r)
+		return
+	}
+	ghttp.CommonSuccessResponse(ctx, "ok")
+}
@@ -0,0 +1,70 @@
+package http_server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadyz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hs := NewHttpServer("test", "")
+	hs.AddReadinessCheck("db", func(ctx context.Context) error { return nil })
+	hs.AddReadinessCheck("ldap", func(ctx context.Context) error { return errors.New("ldap down") })
+	hs.healthRouter()
+
+	w := httptest.NewRecorder()
+	hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+	var result ghttp.HttpResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	failed, _ := result.Data.(map[string]interface{})
+	if len(failed) != 1 || failed["ldap"] != "ldap down" {
+		t.Errorf("expected only ldap to fail, got %v", result.Data)
+	}
+
+	w = httptest.NewRecorder()
+	hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("expected healthz 200, got %d", w.Code)
+	}
+}
+
+func TestReadyzOptionalCheck(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hs := NewHttpServer("test", "")
+	hs.AddReadinessCheck("db", func(ctx context.Context) error { return nil })
+	hs.AddOptionalReadinessCheck("ldap", func(ctx context.Context) error { return errors.New("ldap down") })
+	hs.healthRouter()
+
+	w := httptest.NewRecorder()
+	hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 while degraded, got %d", w.Code)
+	}
+	var result ghttp.HttpResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	failed, _ := result.Data.(map[string]interface{})
+	if len(failed) != 1 || failed["ldap"] != "ldap down" {
+		t.Errorf("expected ldap to be reported unavailable, got %v", result.Data)
+	}
+
+	hs.AddReadinessCheck("cache", func(ctx context.Context) error { return errors.New("cache down") })
+	w = httptest.NewRecorder()
+	hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 when a required check fails, got %d", w.Code)
+	}
+}
@@ -0,0 +1,208 @@
+package http_server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"go.uber.org/multierr"
+)
+
+// Listener 一个监听地址及其 TLS 设置，所有 Listener 共用同一个 gin engine
+type Listener struct {
+	// Addr 监听地址，unix:/path/to.sock 格式时监听 unix socket
+	Addr string `mapstructure:"addr"`
+	// CertFile KeyFile 配置后使用 HTTPS 监听，收到 SIGHUP 时重新加载证书
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// ClientCAFile 校验客户端证书的 CA 证书文件（PEM），配置后按 ClientAuth 要求客户端证书
+	ClientCAFile string `mapstructure:"client_ca_file"`
+	// ClientAuth 客户端证书的要求，见 ClientAuthType
+	ClientAuth ClientAuthType `mapstructure:"client_auth"`
+	// TLSConfig 可选的 TLS 配置，CertFile KeyFile 未配置时需要自带证书
+	TLSConfig *tls.Config `mapstructure:"-"`
+}
+
+// ClientAuthType 客户端证书的要求
+type ClientAuthType string
+
+const (
+	// ClientAuthNone 不要求客户端证书
+	ClientAuthNone ClientAuthType = ""
+	// ClientAuthVerifyIfGiven 客户端可以不提供证书，提供时需要由 ClientCAFile 签发，
+	// 浏览器使用 JWT、内部服务使用证书时用这个
+	ClientAuthVerifyIfGiven ClientAuthType = "verify_if_given"
+	// ClientAuthRequire 客户端必须提供由 ClientCAFile 签发的证书
+	ClientAuthRequire ClientAuthType = "require"
+)
+
+// tlsClientAuth 转换为 tls.ClientAuthType，不支持的值返回 false
+func (t ClientAuthType) tlsClientAuth() (tls.ClientAuthType, bool) {
+	switch t {
+	case ClientAuthNone:
+		return tls.NoClientCert, true
+	case ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven, true
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, true
+	}
+	return tls.NoClientCert, false
+}
+
+// AddListener 添加监听，配置了 Listeners 时忽略 Addr CertFile KeyFile TLSConfig
+func (hs *HttpServer) AddListener(ls ...Listener) {
+	hs.Listeners = append(hs.Listeners, ls...)
+}
+
+// listeners 返回需要监听的地址，没有配置 Listeners 时由 Addr CertFile KeyFile TLSConfig 组成一个
+func (hs *HttpServer) listeners() []Listener {
+	if len(hs.Listeners) > 0 {
+		return hs.Listeners
+	}
+	return []Listener{{Addr: hs.Addr, CertFile: hs.CertFile, KeyFile: hs.KeyFile, ClientCAFile: hs.ClientCAFile, ClientAuth: hs.ClientAuth, TLSConfig: hs.TLSConfig}}
+}
+
+// serving 一个 Listener 对应的 http.Server
+type serving struct {
+	Listener
+	srv *http.Server
+	ln  net.Listener
+	// reloader CertFile KeyFile 配置时不为空
+	reloader *certReloader
+}
+
+// newServing 创建 l 的监听和 http.Server，失败时不会留下打开的监听
+func (hs *HttpServer) newServing(l Listener) (*serving, error) {
+	s := &serving{
+		Listener: l,
+		srv: &http.Server{
+			Addr:              l.Addr,
+			Handler:           hs.g,
+			ReadTimeout:       hs.ReadTimeout,
+			ReadHeaderTimeout: hs.ReadHeaderTimeout,
+			WriteTimeout:      hs.WriteTimeout,
+			IdleTimeout:       hs.IdleTimeout,
+		},
+	}
+	if l.CertFile != "" && l.KeyFile != "" {
+		reloader, err := newCertReloader(l.CertFile, l.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.reloader = reloader
+		s.srv.TLSConfig = tlsConfig(l.TLSConfig)
+		s.srv.TLSConfig.GetCertificate = reloader.GetCertificate
+	} else if l.TLSConfig != nil {
+		s.srv.TLSConfig = tlsConfig(l.TLSConfig)
+	}
+	if l.ClientCAFile != "" {
+		if s.srv.TLSConfig == nil {
+			return nil, fmt.Errorf("%s: client_ca_file 需要同时配置 cert_file 和 key_file", l.Addr)
+		}
+		if err := clientCAs(s.srv.TLSConfig, l.ClientCAFile, l.ClientAuth); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := listen(l.Addr)
+	if err != nil {
+		return nil, err
+	}
+	s.ln = ln
+	return s, nil
+}
+
+// serve 阻塞处理请求，直到 srv 被关闭
+func (s *serving) serve() error {
+	if s.srv.TLSConfig != nil {
+		return s.srv.ServeTLS(s.ln, "", "")
+	}
+	return s.srv.Serve(s.ln)
+}
+
+// listen 创建监听，addr 为 unix:/path/to.sock 格式时监听 unix socket，否则监听 TCP。
+// unix socket 文件在监听关闭时（包括优雅关闭）由 net.UnixListener 删除，
+// 上次未正常退出留下的 socket 文件由 removeStaleSocket 清理
+func listen(addr string) (net.Listener, error) {
+	if path := strings.TrimPrefix(addr, "unix:"); path != addr {
+		if err := removeStaleSocket(path); err != nil {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	}
+	if addr == "" {
+		addr = ":http"
+	}
+	return net.Listen("tcp", addr)
+}
+
+// removeStaleSocket 清理上次未正常退出留下的 socket 文件，path 不是 socket 时不删除，
+// 避免配置错误删除普通文件，仍有进程在监听时返回 EADDRINUSE，避免删除另一个实例正在使用的 socket
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s 已存在且不是 unix socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s 已被其它进程监听: %w", path, syscall.EADDRINUSE)
+	}
+	return os.Remove(path)
+}
+
+// tlsConfig returns a copy of c, or an empty config when it is not set
+func tlsConfig(c *tls.Config) *tls.Config {
+	if c == nil {
+		return &tls.Config{}
+	}
+	return c.Clone()
+}
+
+// clientCAs 从 caFile 加载校验客户端证书的 CA，按 auth 设置 c.ClientAuth
+func clientCAs(c *tls.Config, caFile string, auth ClientAuthType) error {
+	ca, ok := auth.tlsClientAuth()
+	if !ok {
+		return fmt.Errorf("不支持的 client_auth %q", auth)
+	}
+	if ca == tls.NoClientCert {
+		return fmt.Errorf("配置 client_ca_file 时 client_auth 需要为 %s 或 %s", ClientAuthVerifyIfGiven, ClientAuthRequire)
+	}
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("%s 中没有 PEM 格式的证书", caFile)
+	}
+	c.ClientCAs = pool
+	c.ClientAuth = ca
+	return nil
+}
+
+// shutdownAll 同时优雅关闭所有 srvs，全部关闭后返回
+func (hs *HttpServer) shutdownAll(srvs []*http.Server) error {
+	errs := make([]error, len(srvs))
+	var wg sync.WaitGroup
+	for i, srv := range srvs {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			errs[i] = hs.shutdown(srv)
+		}(i, srv)
+	}
+	wg.Wait()
+	return multierr.Combine(errs...)
+}
@@ -0,0 +1,24 @@
+package http_server
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pprofProfiles runtime/pprof 的标准 profile
+var pprofProfiles = []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"}
+
+// pprofRouter 注册 /debug/pprof/* 接口，gin 不会自动包装 net/http/pprof 的 handler，需要逐个注册
+func pprofRouter(rg *RouterGroup) {
+	p := rg.Group("/pprof")
+	p.GET("/", gin.WrapF(pprof.Index))
+	p.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	p.GET("/profile", gin.WrapF(pprof.Profile))
+	p.GET("/symbol", gin.WrapF(pprof.Symbol))
+	p.POST("/symbol", gin.WrapF(pprof.Symbol))
+	p.GET("/trace", gin.WrapF(pprof.Trace))
+	for _, name := range pprofProfiles {
+		p.GET("/"+name, gin.WrapH(pprof.Handler(name)))
+	}
+}
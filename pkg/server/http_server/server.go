@@ -2,14 +2,19 @@ package http_server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"gitee.com/golden-go/golden-go/pkg/server/http_server/handlers"
+	"gitee.com/golden-go/golden-go/pkg/utils/config"
 	"gitee.com/golden-go/golden-go/pkg/utils/gin_middleware"
 	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
 	"gitee.com/golden-go/golden-go/pkg/utils/logger"
@@ -24,6 +29,29 @@ func (ger ginZapRecoveryErrResponse) SetErr(err error) interface{} {
 	return ghttp.CommonErrResult(err)
 }
 
+const (
+	// DefaultShutdownTimeout 默认优雅关闭的超时时间
+	DefaultShutdownTimeout = 5 * time.Second
+	// DefaultReadHeaderTimeout 默认读取请求头的超时时间
+	DefaultReadHeaderTimeout = 10 * time.Second
+	// DefaultIdleTimeout 默认 keep-alive 连接的空闲超时时间
+	DefaultIdleTimeout = 120 * time.Second
+	// DefaultBasePath 默认接口的前缀
+	DefaultBasePath = "/api/golden-go"
+	// LegacyBasePath 拼写错误的旧接口前缀，LegacyRoutes 开启时注册。
+	// Deprecated: 使用 BasePath，之后的版本会删除
+	LegacyBasePath = "/api/goldden-go"
+)
+
+// ListenAndServe 处理的信号，其它信号保持默认行为
+var (
+	// ShutdownSignals 优雅关闭服务，等待正在处理的请求完成，最长 ShutdownTimeout
+	ShutdownSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	// ReloadSignals 重新加载配置文件（见 config.Reload）和 CertFile KeyFile 证书，不关闭服务，
+	// 已有的连接和正在处理的请求不受影响
+	ReloadSignals = []os.Signal{syscall.SIGHUP}
+)
+
 type HttpServer struct {
 	g *gin.Engine
 	//viper.GetString("listen")
@@ -31,11 +59,85 @@ type HttpServer struct {
 	Env         string
 	Addr        string
 	middlewares []gin.HandlerFunc
-	routers     []RouterFunc
+	// groupMiddlewares 只作用于指定前缀下路由的中间件
+	groupMiddlewares []groupMiddleware
+	routers          []RouterFunc
+	// ShutdownTimeout 优雅关闭时等待请求处理完成的时间，超时后强制断开
+	ShutdownTimeout time.Duration
+	// Listeners 同时监听的多个地址，共用同一个 gin engine，
+	// 为空时使用 Addr CertFile KeyFile TLSConfig 作为唯一的监听
+	Listeners []Listener
+	// CertFile KeyFile 配置后使用 HTTPS 监听，收到 ReloadSignals 时重新加载证书
+	CertFile string
+	KeyFile  string
+	// ClientCAFile ClientAuth 配置后校验客户端证书（mTLS），见 Listener
+	ClientCAFile string
+	ClientAuth   ClientAuthType
+	// TLSConfig 可选的 TLS 配置，CertFile KeyFile 未配置时需要自带证书
+	TLSConfig *tls.Config
+	// 对应 http.Server 的超时设置，0 表示不超时
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	// EnableMetrics 开启请求指标统计和 /metrics 接口
+	EnableMetrics bool
+	// EnablePprof 开启 /debug/pprof/* 接口，仅超级管理员可用
+	EnablePprof bool
+	// TrustedProxies 可信代理的 CIDR 或 IP，直接连接的地址是可信代理时从 X-Forwarded-For 获取客户端 IP
+	TrustedProxies []string
+	// EnableSwagger 开启 /swagger/*any 接口文档，生产环境不要开启
+	EnableSwagger bool
+	// BasePath 接口的前缀，网关转发时去掉的前缀不同时修改
+	BasePath string
+	// LegacyRoutes 在 LegacyBasePath 下同时注册一份接口，兼容旧的客户端，
+	// 请求旧接口时输出废弃日志
+	LegacyRoutes bool
+
+	readinessChecks []namedReadinessCheck
+	// inflight 正在处理的请求数
+	inflight int64
 }
 
 func NewHttpServer(env, addr string) *HttpServer {
-	return &HttpServer{g: gin.New(), Env: env, Addr: addr}
+	return &HttpServer{
+		g:                 gin.New(),
+		Env:               env,
+		Addr:              addr,
+		ShutdownTimeout:   DefaultShutdownTimeout,
+		ReadHeaderTimeout: DefaultReadHeaderTimeout,
+		IdleTimeout:       DefaultIdleTimeout,
+		BasePath:          DefaultBasePath,
+		LegacyRoutes:      true,
+	}
+}
+
+// BasePaths 返回注册接口的前缀，开启 LegacyRoutes 时包括 LegacyBasePath
+func (hs *HttpServer) BasePaths() []string {
+	if hs.LegacyRoutes {
+		return []string{hs.BasePath, LegacyBasePath}
+	}
+	return []string{hs.BasePath}
+}
+
+// SetShutdownTimeout 设置优雅关闭的超时时间，小于等于0时使用默认值
+func (hs *HttpServer) SetShutdownTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	hs.ShutdownTimeout = timeout
+}
+
+// InFlight 返回正在处理的请求数
+func (hs *HttpServer) InFlight() int64 {
+	return atomic.LoadInt64(&hs.inflight)
+}
+
+// countInFlight 统计正在处理的请求数的中间件
+func (hs *HttpServer) countInFlight(ctx *gin.Context) {
+	atomic.AddInt64(&hs.inflight, 1)
+	defer atomic.AddInt64(&hs.inflight, -1)
+	ctx.Next()
 }
 
 func (hs *HttpServer) Server() *gin.Engine {
@@ -45,103 +147,209 @@ func (hs *HttpServer) Server() *gin.Engine {
 // @title GOLDEN-GO接口
 // @version 1.0
 // @description GOLDEN-GO接口
+// @BasePath /api/golden-go
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
 func (hs *HttpServer) router() {
-	basePath := hs.g.Group("/api/golden-go")
+	if hs.EnableMetrics {
+		hs.g.GET("/metrics", gin_middleware.MetricsHandler())
+	}
+	if hs.EnableSwagger {
+		hs.swaggerRouter()
+	}
+	//调试相关 仅超级管理员可用
+	debug := hs.Group("/debug", handlers.AdminRequired)
+	debug.GET("/loglevel", handlers.GetLogLevel)
+	debug.PUT("/loglevel", handlers.SetLogLevel)
+	if hs.EnablePprof {
+		pprofRouter(debug)
+	}
+	hs.Group("/config", handlers.AdminRequired).POST("/reload", handlers.ReloadConfig)
+	apiRouter(hs.Group(hs.BasePath))
+	if hs.LegacyRoutes {
+		apiRouter(hs.Group(LegacyBasePath, legacyRouteDeprecated(hs.BasePath)))
+	}
+	for _, rf := range hs.routers {
+		rf(hs.g)
+	}
+}
+
+// legacyRouteDeprecated 记录请求旧接口的调用方，并通过响应头提示使用 basePath 下的接口
+func legacyRouteDeprecated(basePath string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		successor := path.Join(basePath, strings.TrimPrefix(ctx.Request.URL.Path, LegacyBasePath))
+		logger.Warn("请求了废弃的接口前缀 "+LegacyBasePath,
+			zap.String("path", ctx.Request.URL.Path),
+			zap.String("successor", successor),
+			zap.String("ip", ghttp.ClientIP(ctx)),
+			zap.String("user_agent", ctx.Request.UserAgent()),
+		)
+		ctx.Header("Deprecation", "true")
+		ctx.Header("Link", "<"+successor+">; rel=\"successor-version\"")
+		ctx.Next()
+	}
+}
+
+// apiRouter 在 basePath 下注册接口
+func apiRouter(basePath *RouterGroup) {
 	v1 := basePath.Group("/v1")
 	//用户相关
 	v1.GET("/user/:userid", handlers.GetUser)
 	v1.GET("/user", handlers.SearchUser)
 	v1.GET("/user/group", handlers.GetUserWithGroup)
 	v1.PUT("/user", handlers.UpdateUser)
+	v1.PATCH("/user/:userid", handlers.PatchUser)
 	v1.POST("/user", handlers.CreateUser)
+	v1.POST("/user/batch", handlers.CreateUsers)
 	v1.DELETE("/user", handlers.DeleteUser)
+	v1.PUT("/user/restore", handlers.RestoreUser)
+	v1.POST("/user/import/ldap", handlers.ImportLdapUsers)
 
 	//登录相关
 	v1.GET("/verify", handlers.Verify)
 	v1.GET("/logout", handlers.LogOut)
 	v1.POST("/login/local", handlers.LoginLocal)
+	v1.POST("/login/refresh", handlers.RefreshToken)
+	v1.GET("/login/oidc", handlers.LoginOidc)
+	v1.GET("/login/oidc/callback", handlers.LoginOidcCallback)
 	v1.GET("/userinfo", handlers.UserInfo)
-	basePath_old := hs.g.Group("/api/goldden-go")
-	v1_old := basePath_old.Group("/v1")
-	//用户相关
-	v1_old.GET("/user/:userid", handlers.GetUser)
-	v1_old.GET("/user", handlers.SearchUser)
-	v1_old.GET("/user/group", handlers.GetUserWithGroup)
-	v1_old.PUT("/user", handlers.UpdateUser)
-	v1_old.POST("/user", handlers.CreateUser)
-	v1_old.DELETE("/user", handlers.DeleteUser)
-
-	//登录相关
-	v1_old.GET("/verify", handlers.Verify)
-	v1_old.GET("/logout", handlers.LogOut)
-	v1_old.POST("/login/local", handlers.LoginLocal)
-	v1_old.GET("/userinfo", handlers.UserInfo)
-	for _, rf := range hs.routers {
-		rf(hs.g)
-	}
+	v1.GET("/whoami", handlers.WhoAmI)
 }
 
 type RouterFunc func(g *gin.Engine)
 
+// ExtendRouter 添加自定义路由，需要 AddGroupMiddleware 添加的中间件生效时通过 hs.Group 注册
 func (hs *HttpServer) ExtendRouter(rfs ...RouterFunc) {
 	hs.routers = append(hs.routers, rfs...)
 }
 
 func (hs *HttpServer) listenAndServe() error {
-	logger.Info("start listenAndServe", zap.String("listen addr", hs.Addr))
-	srv := &http.Server{
-		Addr:    hs.Addr,
-		Handler: hs.g,
-	}
-	// Initializing the server in a goroutine so that
-	// it won't block the graceful shutdown handling below
-	var err error
-	go func() {
-		if err = srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Error("listen fail", zap.Error(err))
+	var servings []*serving
+	for _, l := range hs.listeners() {
+		s, err := hs.newServing(l)
+		if err != nil {
+			logger.Error("listen fail", zap.String("listen addr", l.Addr), zap.Error(err))
+			for _, s := range servings {
+				s.ln.Close()
+			}
+			return err
 		}
-	}()
-	// Wait for interrupt signal to gracefully shutdown the server with
-	// a timeout of 5 seconds.
+		servings = append(servings, s)
+	}
+	// 在开始处理请求之前注册信号，启动过程中收到的信号也会被处理
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(quit, ShutdownSignals...)
+	defer signal.Stop(quit)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, ReloadSignals...)
+	defer signal.Stop(hup)
+	srvs := make([]*http.Server, 0, len(servings))
+	// Initializing the servers in goroutines so that
+	// they won't block the graceful shutdown handling below
+	errc := make(chan error, len(servings))
+	for _, s := range servings {
+		srvs = append(srvs, s.srv)
+		logger.Info("start listenAndServe", zap.String("listen addr", s.Addr))
+		go func(s *serving) {
+			if err := s.serve(); err != nil && err != http.ErrServerClosed {
+				logger.Error("listen fail", zap.String("listen addr", s.Addr), zap.Error(err))
+				errc <- err
+			}
+		}(s)
+	}
 	for {
 		select {
-		case <-quit:
+		case err := <-errc:
+			// 一个监听出错时关闭其它监听后退出
+			hs.shutdownAll(srvs)
+			return err
+		case sig := <-hup:
+			// 重新加载，不关闭监听，已有连接不受影响
+			logger.Info("Reloading", zap.Stringer("signal", sig))
+			reloadConfig()
+			reloadCerts(servings)
+		case sig := <-quit:
 			// kill (no param) default send syscall.SIGTERM
 			// kill -2 is syscall.SIGINT
 			// kill -9 is syscall.SIGKILL but can't be catch, so don't need add it
-			logger.Debug("Shutting down server...")
-
-			// The context is used to inform the server it has 5 seconds to finish
-			// the request it is currently handling
-			context.Background()
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			if err = srv.Shutdown(ctx); err != nil {
-				logger.Error("Server forced to shutdown ", zap.Error(err))
-			}
-
+			logger.Debug("Shutting down server...", zap.Stringer("signal", sig))
+			hs.shutdownAll(srvs)
 			logger.Debug("Server exiting")
 			return nil
-		default:
-			if err != nil {
-				if strings.HasSuffix(err.Error(), "Server closed") {
-					return nil
-				}
-				return err
-			}
 		}
 	}
+}
 
+// reloadConfig 重新读取配置文件并应用可以热加载的配置，没有使用配置文件时跳过
+func reloadConfig() {
+	result, err := config.Reload()
+	switch {
+	case errors.Is(err, config.ErrNoConfigFile):
+		logger.Info("没有使用配置文件，跳过重新加载配置")
+	case err != nil:
+		logger.Error("重新加载配置失败!!!", zap.Error(err))
+	default:
+		logger.Info("配置已重新加载", zap.Strings("applied", result.Applied), zap.Strings("restart_required", result.RestartRequired))
+	}
+}
+
+// reloadCerts 重新读取配置了 CertFile KeyFile 的监听的证书，新的 TLS 握手使用新证书，
+// 读取失败时继续使用原来的证书
+func reloadCerts(servings []*serving) {
+	for _, s := range servings {
+		if s.reloader == nil {
+			continue
+		}
+		if err := s.reloader.reload(); err != nil {
+			logger.Error("reload cert fail", zap.String("cert", s.CertFile), zap.Error(err))
+		} else {
+			logger.Info("cert reloaded", zap.String("cert", s.CertFile))
+		}
+	}
+}
+
+// shutdown gracefully shuts srv down, the requests which are still running
+// after hs.ShutdownTimeout are cut off
+func (hs *HttpServer) shutdown(srv *http.Server) error {
+	timeout := hs.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	// The context is used to inform the server it has timeout to finish
+	// the request it is currently handling
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	logger.Info("Shutting down, waiting for in-flight requests", zap.Int64("inflight", hs.InFlight()), zap.Duration("timeout", timeout))
+	if err := srv.Shutdown(ctx); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			logger.Error("Server forced to shutdown, in-flight requests cut off", zap.Int64("inflight", hs.InFlight()), zap.Error(err))
+		} else {
+			logger.Error("Server forced to shutdown ", zap.Error(err))
+		}
+		srv.Close()
+		return err
+	}
+	logger.Info("All in-flight requests completed")
+	return nil
 }
 
 func (hs *HttpServer) AddMiddleware(ms ...gin.HandlerFunc) {
 	hs.middlewares = append(hs.middlewares, ms...)
 }
 
+// ListenAndServe 开始监听并阻塞处理请求，收到 ShutdownSignals 时优雅关闭后返回，
+// 收到 ReloadSignals 时重新加载配置和证书后继续处理请求
 func (hs *HttpServer) ListenAndServe() error {
-	hs.g.Use(gin_middleware.GinZapLogger(logger.GetLogger()), gin_middleware.GinZapRecovery(logger.GetLogger(), ginZapRecoveryErrResponse{}))
+	resolver, err := ghttp.NewClientIPResolver(hs.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	hs.g.Use(gin_middleware.GinClientIP(resolver), hs.countInFlight, gin_middleware.GinRequestID(), gin_middleware.GinZapLogger(logger.GetLogger()), gin_middleware.GinZapRecovery(logger.GetLogger(), ginZapRecoveryErrResponse{}))
+	hs.healthRouter()
+	if hs.EnableMetrics {
+		hs.g.Use(gin_middleware.GinMetrics())
+	}
 	hs.g.Use(hs.middlewares...)
 	hs.router()
 	return hs.listenAndServe()
@@ -0,0 +1,850 @@
+package http_server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+	"gitee.com/golden-go/golden-go/pkg/service"
+	"gitee.com/golden-go/golden-go/pkg/utils/config"
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
+	"gitee.com/golden-go/golden-go/pkg/utils/jwt"
+	"gitee.com/golden-go/golden-go/pkg/utils/ldap"
+	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	"gitee.com/golden-go/golden-go/pkg/utils/types"
+	"github.com/gin-gonic/gin"
+	jwtgo "github.com/golang-jwt/jwt"
+	"github.com/spf13/viper"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// serveSlow serves a handler of hs which takes delay to answer and sends one request to it,
+// it returns the server once the request is being handled and the channel
+// receiving the result of the request
+func serveSlow(t *testing.T, hs *HttpServer, delay time.Duration) (*http.Server, <-chan error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	g := gin.New()
+	g.Use(hs.countInFlight)
+	g.GET("/", func(ctx *gin.Context) {
+		close(started)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Request.Context().Done():
+		}
+		ctx.Status(http.StatusOK)
+	})
+	srv := &http.Server{Handler: g}
+	go srv.Serve(ln)
+
+	result := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err == nil {
+			resp.Body.Close()
+		}
+		result <- err
+	}()
+	<-started
+	return srv, result
+}
+
+func TestShutdownWaitsForRequests(t *testing.T) {
+	hs := NewHttpServer("test", "")
+	hs.SetShutdownTimeout(2 * time.Second)
+	srv, result := serveSlow(t, hs, 100*time.Millisecond)
+	if n := hs.InFlight(); n != 1 {
+		t.Errorf("expected 1 request in flight, got %d", n)
+	}
+
+	if err := hs.shutdown(srv); err != nil {
+		t.Errorf("expected graceful shutdown, got %v", err)
+	}
+	if err := <-result; err != nil {
+		t.Errorf("expected request to complete, got %v", err)
+	}
+	if n := hs.InFlight(); n != 0 {
+		t.Errorf("expected no request in flight, got %d", n)
+	}
+}
+
+func TestShutdownCutsOffSlowRequests(t *testing.T) {
+	hs := NewHttpServer("test", "")
+	hs.SetShutdownTimeout(100 * time.Millisecond)
+	srv, result := serveSlow(t, hs, 10*time.Second)
+
+	start := time.Now()
+	if err := hs.shutdown(srv); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected shutdown to time out, got %v", err)
+	}
+	if err := <-result; err == nil {
+		t.Error("expected request to be cut off")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("shutdown took %s", elapsed)
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden.sock")
+	// a stale socket file left by a previous run
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	hs := NewHttpServer("test", "unix:"+path)
+
+	ln, err := listen(hs.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ln.Addr().Network() != "unix" {
+		t.Errorf("expected unix listener, got %s", ln.Addr().Network())
+	}
+	// another instance listening on the socket keeps it
+	if _, err := listen(hs.Addr); !errors.Is(err, syscall.EADDRINUSE) {
+		t.Errorf("expected EADDRINUSE while the socket is in use, got %v", err)
+	}
+	ln.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected socket file to be removed, got %v", err)
+	}
+}
+
+func TestListenUnixSocketKeepsRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden.conf")
+	if err := os.WriteFile(path, []byte("keep"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listen("unix:" + path); err == nil {
+		t.Error("expected an error for a regular file")
+	}
+	if b, err := os.ReadFile(path); err != nil || string(b) != "keep" {
+		t.Errorf("expected the regular file to be kept, got %q %v", b, err)
+	}
+}
+
+func TestListenersDefaultToAddr(t *testing.T) {
+	hs := NewHttpServer("test", ":8080")
+	hs.CertFile, hs.KeyFile = "cert.pem", "key.pem"
+	if ls := hs.listeners(); len(ls) != 1 || ls[0].Addr != ":8080" || ls[0].CertFile != "cert.pem" || ls[0].KeyFile != "key.pem" {
+		t.Errorf("expected the single address as one listener, got %+v", ls)
+	}
+	hs.AddListener(Listener{Addr: "127.0.0.1:8081"}, Listener{Addr: "unix:/tmp/golden.sock"})
+	if ls := hs.listeners(); len(ls) != 2 || ls[0].Addr != "127.0.0.1:8081" {
+		t.Errorf("expected the added listeners, got %+v", ls)
+	}
+}
+
+func TestServeMultipleListeners(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "golden.sock")
+	hs := NewHttpServer("test", "")
+	hs.SetShutdownTimeout(2 * time.Second)
+	hs.g.Use(hs.countInFlight)
+	release := make(chan struct{})
+	hs.g.GET("/", func(ctx *gin.Context) {
+		if ctx.Query("slow") != "" {
+			<-release
+		}
+		ctx.String(http.StatusOK, "ok")
+	})
+	var srvs []*http.Server
+	var addrs []string
+	for _, addr := range []string{"127.0.0.1:0", "unix:" + sock} {
+		s, err := hs.newServing(Listener{Addr: addr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go s.serve()
+		srvs = append(srvs, s.srv)
+		addrs = append(addrs, s.ln.Addr().String())
+	}
+	tcp := &http.Client{}
+	unix := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	for _, c := range []struct {
+		client *http.Client
+		url    string
+	}{{tcp, "http://" + addrs[0] + "/"}, {unix, "http://unix/"}} {
+		resp, err := c.client.Get(c.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", c.url, resp.StatusCode)
+		}
+	}
+
+	// a request in flight on one listener holds the shutdown of all of them
+	result := make(chan error, 1)
+	go func() {
+		resp, err := unix.Get("http://unix/?slow=1")
+		if err == nil {
+			resp.Body.Close()
+		}
+		result <- err
+	}()
+	for hs.InFlight() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan error, 1)
+	go func() { done <- hs.shutdownAll(srvs) }()
+	select {
+	case err := <-done:
+		t.Fatalf("expected shutdown to wait for the request in flight, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("expected graceful shutdown, got %v", err)
+	}
+	if err := <-result; err != nil {
+		t.Errorf("expected request to complete, got %v", err)
+	}
+	if _, err := tcp.Get("http://" + addrs[0] + "/"); err == nil {
+		t.Error("expected the tcp listener to be closed")
+	}
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("expected socket file to be removed, got %v", err)
+	}
+}
+
+func TestLogLevelRequiresSuperAdmin(t *testing.T) {
+	for _, tc := range []struct {
+		claims jwtgo.MapClaims
+		code   int
+	}{
+		{nil, http.StatusForbidden},
+		{jwtgo.MapClaims{"name": "user"}, http.StatusForbidden},
+		{jwtgo.MapClaims{"name": "admin", "super_admin": true}, http.StatusOK},
+	} {
+		hs := NewHttpServer("test", "")
+		claims := tc.claims
+		hs.g.Use(func(c *gin.Context) {
+			if claims != nil {
+				c.Set(jwt.GoldenClaims, claims)
+			}
+		})
+		hs.router()
+
+		w := httptest.NewRecorder()
+		hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/debug/loglevel", strings.NewReader(`{"level":"warn"}`)))
+		if w.Code != tc.code {
+			t.Errorf("claims %v: expected status %d, got %d %s", claims, tc.code, w.Code, w.Body)
+		}
+	}
+	if level := logger.Level().String(); level != "warn" {
+		t.Errorf("expected level warn, got %s", level)
+	}
+	logger.SetLevel("debug")
+}
+
+func TestReloadConfigRequiresSuperAdmin(t *testing.T) {
+	for _, tc := range []struct {
+		claims jwtgo.MapClaims
+		code   int
+	}{
+		{jwtgo.MapClaims{"name": "user"}, http.StatusForbidden},
+		// 测试时没有使用配置文件
+		{jwtgo.MapClaims{"name": "admin", "super_admin": true}, http.StatusConflict},
+	} {
+		hs := NewHttpServer("test", "")
+		claims := tc.claims
+		hs.g.Use(func(c *gin.Context) {
+			c.Set(jwt.GoldenClaims, claims)
+		})
+		hs.router()
+
+		w := httptest.NewRecorder()
+		hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/config/reload", nil))
+		if w.Code != tc.code {
+			t.Errorf("claims %v: expected status %d, got %d %s", claims, tc.code, w.Code, w.Body)
+		}
+	}
+}
+
+func TestPprofRouter(t *testing.T) {
+	for _, enable := range []bool{false, true} {
+		hs := NewHttpServer("test", "")
+		hs.EnablePprof = enable
+		hs.g.Use(func(c *gin.Context) {
+			c.Set(jwt.GoldenClaims, jwtgo.MapClaims{"name": "admin", "super_admin": true})
+		})
+		hs.router()
+
+		for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine", "/debug/pprof/cmdline"} {
+			w := httptest.NewRecorder()
+			hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			want := http.StatusNotFound
+			if enable {
+				want = http.StatusOK
+			}
+			if w.Code != want {
+				t.Errorf("pprof %v %s: expected status %d, got %d", enable, path, want, w.Code)
+			}
+		}
+	}
+}
+
+func TestWhoAmI(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	for _, tc := range []struct {
+		claims jwtgo.MapClaims
+		code   int
+	}{
+		{nil, http.StatusUnauthorized},
+		{jwtgo.MapClaims{"sub": "jdoe", "name": "jdoe", "roles": []interface{}{"Admin"}, "email": "jdoe@example.com", "exp": float64(exp)}, http.StatusOK},
+	} {
+		hs := NewHttpServer("test", "")
+		claims := tc.claims
+		hs.g.Use(func(c *gin.Context) {
+			if claims != nil {
+				c.Set(jwt.GoldenClaims, claims)
+			}
+		})
+		hs.router()
+
+		w := httptest.NewRecorder()
+		hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/golden-go/v1/whoami", nil))
+		if w.Code != tc.code {
+			t.Errorf("claims %v: expected status %d, got %d %s", claims, tc.code, w.Code, w.Body)
+		}
+		if tc.code != http.StatusOK {
+			continue
+		}
+		for _, want := range []string{`"sub":"jdoe"`, `"roles":["Admin"]`, `"email":"jdoe@example.com"`, `"expires_at":"` + time.Unix(exp, 0).Format(time.RFC3339)} {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("expected %s in %s", want, w.Body)
+			}
+		}
+	}
+}
+
+func TestPatchUserRejected(t *testing.T) {
+	hs := NewHttpServer("test", "")
+	hs.g.Use(func(c *gin.Context) {
+		c.Set(jwt.GoldenClaims, jwtgo.MapClaims{"name": "user"})
+	})
+	hs.router()
+
+	for body, code := range map[string]int{
+		`{"id":2,"display_name":"x"}`:      http.StatusBadRequest,
+		`{"auth_module":"ldap"}`:           http.StatusBadRequest,
+		`{"email":"not an email"}`:         http.StatusBadRequest,
+		`{"display_name":"x"}`:             http.StatusBadRequest,
+		`{"role":"Admin","version":1}`:     http.StatusForbidden,
+		`{"super_admin":true,"version":1}`: http.StatusForbidden,
+	} {
+		w := httptest.NewRecorder()
+		hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/api/golden-go/v1/user/1", strings.NewReader(body)))
+		if w.Code != code {
+			t.Errorf("%s: expected status %d, got %d %s", body, code, w.Code, w.Body)
+		}
+	}
+
+	// PUT 也需要传入版本号
+	w := httptest.NewRecorder()
+	hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/golden-go/v1/user", strings.NewReader(`{"id":1,"display_name":"x"}`)))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "version") {
+		t.Errorf("expected status 400 without a version, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestCreateUsersValidation(t *testing.T) {
+	hs := NewHttpServer("test", "")
+	hs.router()
+
+	for body, want := range map[string]string{
+		`[]`: `"code":40000`,
+		`[{"name":"a","password":"password"},{"name":"b","password":"short"},{"name":"A","password":"password"}]`:                 `"data":[{"index":1,"name":"b","success":false,"error":`,
+		`[{"name":"a","password":"password","email":"a@example.com"},{"name":"b","password":"password","email":"A@example.com"}]`: `"error":"邮箱和第 0 个用户重复"`,
+	} {
+		w := httptest.NewRecorder()
+		hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/golden-go/v1/user/batch", strings.NewReader(body)))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("%s: expected status 400 with %s, got %d %s", body, want, w.Code, w.Body)
+		}
+	}
+
+	// 所有不合法的用户都会返回
+	w := httptest.NewRecorder()
+	body := `[{"name":"a","password":"password"},{"name":"b","password":"short"},{"name":"A","password":"password"}]`
+	hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/golden-go/v1/user/batch", strings.NewReader(body)))
+	for _, want := range []string{`"fields":{"password":`, `"index":2,"name":"A","success":false,"error":"用户名和第 0 个用户重复"`} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("expected %s in %s", want, w.Body)
+		}
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	for _, legacy := range []bool{true, false} {
+		hs := NewHttpServer("test", "")
+		hs.BasePath = "/gateway"
+		hs.LegacyRoutes = legacy
+		hs.g.Use(func(c *gin.Context) {
+			c.Set(jwt.GoldenClaims, jwtgo.MapClaims{"sub": "jdoe"})
+		})
+		hs.router()
+
+		for path, want := range map[string]int{
+			"/gateway/v1/whoami":        http.StatusOK,
+			"/api/golden-go/v1/whoami":  http.StatusNotFound,
+			"/api/goldden-go/v1/whoami": http.StatusNotFound,
+		} {
+			if legacy && strings.HasPrefix(path, LegacyBasePath) {
+				want = http.StatusOK
+			}
+			w := httptest.NewRecorder()
+			hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			if w.Code != want {
+				t.Errorf("legacy %v %s: expected status %d, got %d", legacy, path, want, w.Code)
+			}
+			if deprecated := w.Header().Get("Deprecation") == "true"; deprecated != (want == http.StatusOK && path != "/gateway/v1/whoami") {
+				t.Errorf("legacy %v %s: unexpected Deprecation header %q", legacy, path, w.Header().Get("Deprecation"))
+			} else if deprecated && w.Header().Get("Link") != `</gateway/v1/whoami>; rel="successor-version"` {
+				t.Errorf("expected the successor link, got %q", w.Header().Get("Link"))
+			}
+		}
+	}
+}
+
+func TestSwaggerRouter(t *testing.T) {
+	for _, enable := range []bool{false, true} {
+		hs := NewHttpServer("test", "")
+		hs.BasePath = "/gateway"
+		hs.EnableSwagger = enable
+		hs.router()
+
+		w := httptest.NewRecorder()
+		hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/swagger/doc.json", nil))
+		want := http.StatusNotFound
+		if enable {
+			want = http.StatusOK
+		}
+		if w.Code != want {
+			t.Fatalf("swagger %v: expected status %d, got %d", enable, want, w.Code)
+		}
+		if !enable {
+			continue
+		}
+		for _, s := range []string{`"basePath": "/gateway"`, `"BearerAuth"`, `"/v1/whoami"`} {
+			if !strings.Contains(w.Body.String(), s) {
+				t.Errorf("expected %s in the swagger doc", s)
+			}
+		}
+	}
+}
+
+func TestWhoAmINegotiatesMsgPack(t *testing.T) {
+	hs := NewHttpServer("test", "")
+	hs.g.Use(func(c *gin.Context) {
+		c.Set(jwt.GoldenClaims, jwtgo.MapClaims{"sub": "jdoe"})
+	})
+	hs.router()
+
+	for accept, want := range map[string]string{
+		"application/x-msgpack": "application/msgpack; charset=utf-8",
+		"application/msgpack":   "application/msgpack; charset=utf-8",
+		"application/json":      "application/json; charset=utf-8",
+		"text/unknown":          "application/json; charset=utf-8",
+		"":                      "application/json; charset=utf-8",
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/golden-go/v1/whoami", nil)
+		req.Header.Set("Accept", accept)
+		hs.g.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != want {
+			t.Errorf("Accept %q: expected %s, got %d %s", accept, want, w.Code, w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestReloadSignalKeepsServing(t *testing.T) {
+	defer viper.Reset()
+	file := filepath.Join(t.TempDir(), "golden_go.yaml")
+	if err := os.WriteFile(file, []byte("log:\n  level: info\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(file)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := make(chan struct{}, 1)
+	config.OnReload(func() {
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+	})
+
+	sock := filepath.Join(t.TempDir(), "golden.sock")
+	hs := NewHttpServer("test", "unix:"+sock)
+	hs.g.GET("/", func(ctx *gin.Context) { ctx.String(http.StatusOK, "ok") })
+	done := make(chan error, 1)
+	go func() { done <- hs.listenAndServe() }()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	get := func() error {
+		resp, err := client.Get("http://unix/")
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	// the signals are registered before the first request is served
+	for get() != nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reloaded:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected SIGHUP to reload the config")
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("expected SIGHUP not to shut the server down, got %v", err)
+	default:
+	}
+	if err := get(); err != nil {
+		t.Errorf("expected the server to keep serving after SIGHUP, got %v", err)
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected graceful shutdown, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected SIGTERM to shut the server down")
+	}
+}
+
+func TestUpdateUserOnlySelf(t *testing.T) {
+	for _, tc := range []struct {
+		claims       jwtgo.MapClaims
+		method, path string
+		body         string
+		forbidden    bool
+	}{
+		// 非超级管理员不能修改其他用户，包括密码
+		{jwtgo.MapClaims{"id": float64(2), "name": "user"}, http.MethodPatch, "/api/golden-go/v1/user/1", `{"password":"new-password","version":1}`, true},
+		{jwtgo.MapClaims{"id": float64(2), "name": "user"}, http.MethodPut, "/api/golden-go/v1/user", `{"id":1,"password":"new-password","version":1}`, true},
+		{jwtgo.MapClaims{"name": "user"}, http.MethodPatch, "/api/golden-go/v1/user/1", `{"display_name":"x","version":1}`, true},
+		// 可以修改自己，超级管理员可以修改其他用户
+		{jwtgo.MapClaims{"id": float64(2), "name": "user"}, http.MethodPatch, "/api/golden-go/v1/user/2", `{"password":"new-password","version":1}`, false},
+		{jwtgo.MapClaims{"id": float64(2), "name": "user"}, http.MethodPut, "/api/golden-go/v1/user", `{"id":2,"password":"new-password","version":1}`, false},
+		{jwtgo.MapClaims{"id": float64(3), "name": "admin", "super_admin": true}, http.MethodPatch, "/api/golden-go/v1/user/1", `{"password":"new-password","version":1}`, false},
+	} {
+		hs := NewHttpServer("test", "")
+		claims := tc.claims
+		hs.g.Use(func(c *gin.Context) {
+			c.Set(jwt.GoldenClaims, claims)
+		})
+		// 通过权限校验后调用服务，测试中没有数据库，返回 500
+		hs.g.Use(gin.CustomRecovery(func(c *gin.Context, _ interface{}) { c.AbortWithStatus(http.StatusInternalServerError) }))
+		hs.router()
+
+		w := httptest.NewRecorder()
+		hs.g.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body)))
+		if tc.forbidden != (w.Code == http.StatusForbidden) {
+			t.Errorf("%v %s %s %s: expected forbidden %v, got %d %s", claims, tc.method, tc.path, tc.body, tc.forbidden, w.Code, w.Body)
+		}
+	}
+}
+
+// auditRecorder 记录写入的审计日志
+type auditRecorder struct {
+	logs []*models.AuditLog
+}
+
+func (r *auditRecorder) Write(l *models.AuditLog) error {
+	r.logs = append(r.logs, l)
+	return nil
+}
+
+func TestCreateUserPrivilegedRejected(t *testing.T) {
+	rec := &auditRecorder{}
+	service.Audit.Sink = rec
+	defer func() { service.Audit.Sink = nil }()
+	for _, tc := range []struct {
+		superAdmin bool
+		path, body string
+		forbidden  bool
+	}{
+		{false, "/api/golden-go/v1/user", `{"name":"root2","password":"password","super_admin":true}`, true},
+		{false, "/api/golden-go/v1/user", `{"name":"jdoe","password":"password","role":"Admin"}`, true},
+		{false, "/api/golden-go/v1/user/batch", `[{"name":"a","password":"password"},{"name":"b","password":"password","role":"Admin"}]`, true},
+		// 超级管理员可以设置，测试中没有数据库，通过权限校验后返回 500
+		{true, "/api/golden-go/v1/user", `{"name":"root2","password":"password","super_admin":true}`, false},
+		{true, "/api/golden-go/v1/user/batch", `[{"name":"b","password":"password","role":"Admin"}]`, false},
+		{false, "/api/golden-go/v1/user", `{"name":"jdoe","password":"password"}`, false},
+	} {
+		rec.logs = nil
+		hs := NewHttpServer("test", "")
+		claims := jwtgo.MapClaims{"sub": "user", "name": "user", "super_admin": tc.superAdmin}
+		hs.g.Use(func(c *gin.Context) {
+			c.Set(jwt.GoldenClaims, claims)
+		})
+		hs.g.Use(gin.CustomRecovery(func(c *gin.Context, _ interface{}) { c.AbortWithStatus(http.StatusInternalServerError) }))
+		hs.router()
+
+		w := httptest.NewRecorder()
+		hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body)))
+		if tc.forbidden != (w.Code == http.StatusForbidden) {
+			t.Errorf("%s %s: expected forbidden %v, got %d %s", tc.path, tc.body, tc.forbidden, w.Code, w.Body)
+		}
+		if tc.forbidden && (len(rec.logs) != 1 || rec.logs[0].Success || rec.logs[0].Action != models.AuditUserCreate) {
+			t.Errorf("%s %s: expected the rejection to be audited, got %+v", tc.path, tc.body, rec.logs)
+		}
+	}
+}
+
+// newDryRunDB 不连接数据库的 gorm.DB，记录查询的 SQL，user 不为空时查询用户返回 user
+func newDryRunDB(t *testing.T, sqls *[]string, user *models.User) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "golden_go:golden_go@tcp(127.0.0.1:3306)/golden_go",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Callback().Query().After("gorm:query").Register("test:user", func(tx *gorm.DB) {
+		*sqls = append(*sqls, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+		if u, ok := tx.Statement.Dest.(*models.User); ok && user != nil {
+			*u = *user
+			tx.RowsAffected = 1
+		}
+	})
+	return db
+}
+
+// newTestJwt 使用 HS256 签名的 GoldenJwt
+func newTestJwt(t *testing.T) *jwt.GoldenJwt {
+	gj, err := jwt.NewGoldenJwtWithAlg("HS256", 60, "", strings.Repeat("k", 32), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gj
+}
+
+// fakeLDAP LoginContext 返回 user
+type fakeLDAP struct {
+	ldap.IMultiLDAP
+	user *models.User
+}
+
+func (f *fakeLDAP) LoginContext(ctx context.Context, query *types.LoginData) (*models.User, error) {
+	return f.user, nil
+}
+
+func TestLoginLdapClaims(t *testing.T) {
+	viper.Set("auth.ldap.enable", true)
+	defer viper.Set("auth.ldap.enable", false)
+	var sqls []string
+	db := newDryRunDB(t, &sqls, nil)
+	gj := newTestJwt(t)
+	hs := NewHttpServer("test", "")
+	hs.g.Use(func(c *gin.Context) {
+		c.Set("DB", db)
+		c.Set("golden_jwt", gj)
+		c.Set("IML", ldap.IMultiLDAP(&fakeLDAP{user: &models.User{AuthModule: models.AuthModuleLDAP, Name: "John Doe", Login: "jdoe", Email: "jdoe@example.com"}}))
+	})
+	hs.router()
+
+	captchaStr, err := gj.CreateToken(jwtgo.MapClaims{"captcha_id": "c1", "c1": "1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/golden-go/v1/login/local", strings.NewReader(`{"name":"jdoe","password":"password","verify":"1234"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "captchaid", Value: "c1"})
+	req.AddCookie(&http.Cookie{Name: "golden_captcha", Value: captchaStr})
+	w := httptest.NewRecorder()
+	hs.g.ServeHTTP(w, req)
+
+	r := &ghttp.HttpResult{}
+	if err := json.Unmarshal(w.Body.Bytes(), r); err != nil {
+		t.Fatal(err)
+	}
+	tokenStr, _ := r.Data.(string)
+	claims, err := gj.GetClaimsFromToken(tokenStr)
+	if err != nil {
+		t.Fatalf("expected a token, got %d %s: %v", w.Code, w.Body, err)
+	}
+	// sub 和 name 为登录名，显示名称在 display_name
+	if claims["sub"] != "jdoe" || claims["name"] != "jdoe" || claims["display_name"] != "John Doe" {
+		t.Errorf("unexpected claims %v", claims)
+	}
+}
+
+func TestRefreshTokenDisabledUser(t *testing.T) {
+	gj := newTestJwt(t)
+	for _, tc := range []struct {
+		name      string
+		claims    jwtgo.MapClaims
+		disabled  bool
+		query     string
+		forbidden bool
+	}{
+		// LDAP 用户没有本地 id，按登录名查询，之前签发的 token 中 name 是显示名称
+		{"disabled ldap user", jwtgo.MapClaims{"sub": "jdoe", "name": "John Doe", "auth_module": "ldap"}, true, "name='jdoe'", true},
+		{"disabled local user", jwtgo.MapClaims{"sub": "jdoe", "id": float64(2), "name": "jdoe"}, true, "id=2", true},
+		{"enabled ldap user", jwtgo.MapClaims{"sub": "jdoe", "name": "jdoe", "display_name": "John Doe", "auth_module": "ldap"}, false, "name='jdoe'", false},
+	} {
+		var sqls []string
+		db := newDryRunDB(t, &sqls, &models.User{ID: 2, Name: "jdoe", Disabled: tc.disabled})
+		hs := NewHttpServer("test", "")
+		hs.g.Use(func(c *gin.Context) {
+			c.Set("DB", db)
+			c.Set("golden_jwt", gj)
+		})
+		hs.router()
+
+		refreshStr, err := gj.CreateRefreshToken(tc.claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/golden-go/v1/login/refresh", strings.NewReader(`{"refresh_token":"`+refreshStr+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		hs.g.ServeHTTP(w, req)
+		if tc.forbidden != (w.Code == http.StatusForbidden) {
+			t.Errorf("%s: expected forbidden %v, got %d %s", tc.name, tc.forbidden, w.Code, w.Body)
+		}
+		if len(sqls) != 1 || !strings.Contains(sqls[0], tc.query) {
+			t.Errorf("%s: expected the user to be looked up by %s, got %v", tc.name, tc.query, sqls)
+		}
+	}
+}
+
+func TestDeleteUserRequiresSuperAdmin(t *testing.T) {
+	rec := &auditRecorder{}
+	service.Audit.Sink = rec
+	defer func() { service.Audit.Sink = nil }()
+	for _, tc := range []struct {
+		claims    jwtgo.MapClaims
+		path      string
+		forbidden bool
+	}{
+		{jwtgo.MapClaims{"id": float64(2), "name": "user"}, "/api/golden-go/v1/user?ids=1&ids=3", true},
+		{jwtgo.MapClaims{"id": float64(2), "name": "user"}, "/api/golden-go/v1/user?ids=1&hard=true", true},
+		// 超级管理员可以删除，测试中没有数据库，通过权限校验后返回 500
+		{jwtgo.MapClaims{"id": float64(3), "name": "admin", "super_admin": true}, "/api/golden-go/v1/user?ids=1", false},
+	} {
+		rec.logs = nil
+		hs := NewHttpServer("test", "")
+		claims := tc.claims
+		hs.g.Use(func(c *gin.Context) {
+			c.Set(jwt.GoldenClaims, claims)
+		})
+		hs.g.Use(gin.CustomRecovery(func(c *gin.Context, _ interface{}) { c.AbortWithStatus(http.StatusInternalServerError) }))
+		hs.router()
+
+		w := httptest.NewRecorder()
+		hs.g.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, tc.path, nil))
+		if tc.forbidden != (w.Code == http.StatusForbidden) {
+			t.Errorf("%v %s: expected forbidden %v, got %d %s", claims, tc.path, tc.forbidden, w.Code, w.Body)
+		}
+		if tc.forbidden && (len(rec.logs) == 0 || rec.logs[0].Success || rec.logs[0].Action != models.AuditUserDelete) {
+			t.Errorf("%v %s: expected the rejection to be audited, got %+v", claims, tc.path, rec.logs)
+		}
+	}
+}
+
+func TestUpdateUserValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+		code int
+	}{
+		{"short password", `{"id":2,"password":"short","version":1}`, http.StatusBadRequest},
+		{"invalid email", `{"id":2,"email":"not-an-email","version":1}`, http.StatusBadRequest},
+		{"immutable name", `{"id":2,"name":"other","version":1}`, http.StatusBadRequest},
+		{"immutable auth_module", `{"id":2,"auth_module":"ldap","version":1}`, http.StatusBadRequest},
+		{"privileged field", `{"id":2,"super_admin":true,"version":1}`, http.StatusForbidden},
+		{"duplicate email", `{"id":2,"email":"taken@example.com","version":1}`, http.StatusConflict},
+		// deleted_at 不是可修改的字段，直接忽略
+		{"deleted_at ignored", `{"id":2,"deleted_at":"2021-01-01T00:00:00Z","version":1}`, http.StatusOK},
+	} {
+		var sqls []string
+		db := newDryRunDB(t, &sqls, nil)
+		// 邮箱重复检查的 Count 返回 1
+		db.Callback().Query().After("test:user").Register("test:count", func(tx *gorm.DB) {
+			if count, ok := tx.Statement.Dest.(*int64); ok {
+				*count = 1
+				tx.RowsAffected = 1
+			}
+		})
+		hs := NewHttpServer("test", "")
+		hs.g.Use(func(c *gin.Context) {
+			c.Set("DB", db)
+			c.Set(jwt.GoldenClaims, jwtgo.MapClaims{"id": float64(2), "name": "user"})
+		})
+		hs.router()
+
+		req := httptest.NewRequest(http.MethodPut, "/api/golden-go/v1/user", strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		hs.g.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d %s", tc.name, tc.code, w.Code, w.Body)
+		}
+		if tc.code == http.StatusConflict && !strings.Contains(w.Body.String(), service.ErrDuplicateEmail.Error()) {
+			t.Errorf("%s: expected %q, got %s", tc.name, service.ErrDuplicateEmail, w.Body)
+		}
+	}
+}
+
+func TestImportLdapUsersLimit(t *testing.T) {
+	hs := NewHttpServer("test", "")
+	hs.g.Use(func(c *gin.Context) {
+		c.Set(jwt.GoldenClaims, jwtgo.MapClaims{"id": float64(1), "name": "admin", "super_admin": true})
+	})
+	hs.router()
+
+	logins := make([]string, 1001)
+	for i := range logins {
+		logins[i] = fmt.Sprintf("user%d", i)
+	}
+	body, _ := json.Marshal(types.ImportData{Logins: logins})
+	req := httptest.NewRequest(http.MethodPost, "/api/golden-go/v1/user/import/ldap", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	hs.g.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected too many logins to be rejected, got %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,15 @@
+package http_server
+
+//go:generate sh -c "cd ../../.. && swag init -g pkg/server/http_server/server.go -o pkg/server/http_server/docs"
+
+import (
+	"gitee.com/golden-go/golden-go/pkg/server/http_server/docs"
+	swaggerFiles "github.com/swaggo/files"
+	ginSwagger "github.com/swaggo/gin-swagger"
+)
+
+// swaggerRouter 注册 /swagger/*any 接口文档，文档由 go generate 根据 handlers 的注释生成
+func (hs *HttpServer) swaggerRouter() {
+	docs.SwaggerInfo.BasePath = hs.BasePath
+	hs.g.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+}
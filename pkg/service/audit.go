@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+	"gitee.com/golden-go/golden-go/pkg/utils/log_writer"
+	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// 审计日志的存储方式
+const (
+	AuditSinkDB   = "db"   //写入 audit_logs 表
+	AuditSinkFile = "file" //按行写入 JSON 文件
+	AuditSinkLog  = "log"  //写入服务日志，开启 log.sampling 时可能被丢弃
+)
+
+// AuditSink 审计日志的存储
+type AuditSink interface {
+	Write(l *models.AuditLog) error
+}
+
+// Auditor 记录审计日志，写入失败不影响请求，只记录错误日志。Sink 为空时不记录
+type Auditor struct {
+	Sink AuditSink
+}
+
+// Audit 用户操作和登录的审计日志
+var Audit = &Auditor{}
+
+// Record 记录一条审计日志，没有设置时间时使用当前时间
+func (a *Auditor) Record(l *models.AuditLog) {
+	if a.Sink == nil {
+		return
+	}
+	if l.Time.IsZero() {
+		l.Time = time.Now()
+	}
+	if err := a.Sink.Write(l); err != nil {
+		logger.Error("写入审计日志失败!!!", zap.Reflect("audit", l), zap.Error(err))
+	}
+}
+
+// DBAuditSink 审计日志写入 audit_logs 表
+type DBAuditSink struct {
+	DB *gorm.DB
+}
+
+func (s *DBAuditSink) Write(l *models.AuditLog) error {
+	return s.DB.Create(l).Error
+}
+
+// WriterAuditSink 审计日志按行写入 JSON
+type WriterAuditSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterAuditSink(w io.Writer) *WriterAuditSink {
+	return &WriterAuditSink{w: w}
+}
+
+// NewFileAuditSink 审计日志写入目录 dir 下的 audit.log，文件按 when 切分，H 每小时 D 每天
+func NewFileAuditSink(dir, when string) (*WriterAuditSink, error) {
+	lw, err := log_writer.NewLogWriter("audit", dir, when)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterAuditSink(lw), nil
+}
+
+func (s *WriterAuditSink) Write(l *models.AuditLog) error {
+	bs, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(bs, '\n'))
+	return err
+}
+
+// LoggerAuditSink 审计日志写入 zap logger
+type LoggerAuditSink struct {
+	Logger *zap.Logger
+}
+
+func (s *LoggerAuditSink) Write(l *models.AuditLog) error {
+	s.Logger.Info("audit",
+		zap.Time("time", l.Time),
+		zap.String("actor", l.Actor),
+		zap.String("action", l.Action),
+		zap.Int64("target_id", l.TargetID),
+		zap.String("target_name", l.TargetName),
+		zap.String("ip", l.IP),
+		zap.Bool("success", l.Success),
+		zap.String("error", l.Error),
+	)
+	return nil
+}
+
+// AuditConfig 审计日志配置
+type AuditConfig struct {
+	Sink string `mapstructure:"sink"` //存储方式 db file log，为空时不记录
+	File struct {
+		Dir  string `mapstructure:"dir"`  //file 方式的目录
+		When string `mapstructure:"when"` //file 方式的文件切分 H D
+	} `mapstructure:"file"`
+}
+
+// NewAuditSink 按配置创建审计日志的存储，ac.Sink 为空时返回 nil
+func NewAuditSink(ac AuditConfig, db *gorm.DB) (AuditSink, error) {
+	switch ac.Sink {
+	case "":
+		return nil, nil
+	case AuditSinkDB:
+		return &DBAuditSink{DB: db}, nil
+	case AuditSinkFile:
+		s, err := NewFileAuditSink(ac.File.Dir, ac.File.When)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	case AuditSinkLog:
+		return &LoggerAuditSink{Logger: logger.With(zap.String("logger", "audit"))}, nil
+	}
+	return nil, fmt.Errorf("不支持的审计日志存储方式：%s", ac.Sink)
+}
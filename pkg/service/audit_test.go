@@ -0,0 +1,46 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+)
+
+type failingAuditSink struct{}
+
+func (failingAuditSink) Write(*models.AuditLog) error {
+	return errors.New("disk full")
+}
+
+func TestAuditorRecord(t *testing.T) {
+	var buf bytes.Buffer
+	a := &Auditor{Sink: NewWriterAuditSink(&buf)}
+
+	a.Record(&models.AuditLog{Actor: "admin", Action: models.AuditUserDelete, TargetID: 2, IP: "10.0.0.1", Success: true})
+	l := models.AuditLog{}
+	if err := json.Unmarshal(buf.Bytes(), &l); err != nil {
+		t.Fatal(err)
+	}
+	if l.Actor != "admin" || l.Action != models.AuditUserDelete || l.TargetID != 2 || !l.Success || l.Time.IsZero() {
+		t.Errorf("unexpected audit log %+v", l)
+	}
+
+	// 写入失败不影响调用方
+	(&Auditor{Sink: failingAuditSink{}}).Record(&models.AuditLog{Action: models.AuditLoginLocal})
+	(&Auditor{}).Record(&models.AuditLog{Action: models.AuditLoginLocal})
+}
+
+func TestNewAuditSink(t *testing.T) {
+	for sink, ok := range map[string]bool{"": true, AuditSinkDB: true, AuditSinkLog: true, "kafka": false} {
+		s, err := NewAuditSink(AuditConfig{Sink: sink}, nil)
+		if (err == nil) != ok {
+			t.Errorf("%q: unexpected error %v", sink, err)
+		}
+		if sink == "" && s != nil {
+			t.Errorf("expected no sink, got %T", s)
+		}
+	}
+}
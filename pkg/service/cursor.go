@@ -0,0 +1,140 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	"gitee.com/golden-go/golden-go/pkg/utils/types"
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidCursor 游标不合法，或和请求的排序不一致
+var ErrInvalidCursor = errors.New("不合法的游标")
+
+// userCursor 游标分页上一页最后一个用户的排序字段和 ID，编码后作为不透明的 cursor 参数
+type userCursor struct {
+	Sort  string      `json:"s"`
+	Desc  bool        `json:"d"`
+	Value interface{} `json:"v,omitempty"`
+	ID    int64       `json:"i"`
+}
+
+func (c userCursor) encode() (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeUserCursor(s string) (c userCursor, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err = json.Unmarshal(b, &c); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// userSortValue 用户的排序字段的值，sort 为 id 时不需要
+func userSortValue(u *models.User, sort string) interface{} {
+	switch sort {
+	case "name":
+		return u.Name
+	case "display_name":
+		return u.DisplayName
+	case "email":
+		return u.Email
+	case "auth_module":
+		return u.AuthModule
+	case "create_time":
+		return u.CreatedAt
+	case "update_time":
+		return u.UpdatedAt
+	}
+	return nil
+}
+
+// cursorValue 把游标中 json 解码的排序字段的值还原为查询用的值，时间字段为 time.Time
+func cursorValue(v interface{}, sort string) (interface{}, error) {
+	if sort != "create_time" && sort != "update_time" {
+		return v, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return t, nil
+}
+
+// SearchUserCursor 按游标分页搜索用户，cursor 为上一页返回的 NextCursor，为空时查询第一页。
+// 按 us.Sort 和 ID 排序，使用 WHERE 条件跳过之前的用户，页数很大时性能不会下降，不返回总数
+func (db *UserServiceDB) SearchUserCursor(us UserSearch, cursor string) (cd *types.CursorPageData, err error) {
+	logger.Debug("SearchUserCursor 接受到任务：", zap.Reflect("args", us), zap.String("cursor", cursor))
+	order, err := userOrder(us.Sort, us.Order)
+	if err != nil {
+		return nil, err
+	}
+	if us.PageSize < 1 {
+		us.PageSize = 1
+	}
+	sort := order.Column.Name
+	op := ">"
+	if order.Desc {
+		op = "<"
+	}
+	tx := db.searchQuery(us)
+	if cursor != "" {
+		c, err := decodeUserCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Sort != sort || c.Desc != order.Desc {
+			return nil, ErrInvalidCursor
+		}
+		if c.Value, err = cursorValue(c.Value, sort); err != nil {
+			return nil, err
+		}
+		if sort == "id" {
+			tx = tx.Where(fmt.Sprintf("id %s ?", op), c.ID)
+		} else {
+			// sort 已经按 UserSortColumns 校验
+			tx = tx.Where(fmt.Sprintf("(%[1]s %[2]s ? or (%[1]s = ? and id %[2]s ?))", sort, op), c.Value, c.Value, c.ID)
+		}
+	}
+	orders := []clause.OrderByColumn{order}
+	if sort != "id" {
+		orders = append(orders, clause.OrderByColumn{Column: clause.Column{Name: "id"}, Desc: order.Desc})
+	}
+	ds := []models.User{}
+	// 多查一条判断是否有下一页
+	if err = tx.Clauses(clause.OrderBy{Columns: orders}).Limit(us.PageSize + 1).Find(&ds).Error; err != nil {
+		return nil, err
+	}
+	cd = &types.CursorPageData{PageSize: us.PageSize}
+	if len(ds) > us.PageSize {
+		ds = ds[:us.PageSize]
+		last := &ds[len(ds)-1]
+		c := userCursor{Sort: sort, Desc: order.Desc, Value: userSortValue(last, sort), ID: last.ID}
+		if cd.NextCursor, err = c.encode(); err != nil {
+			return nil, err
+		}
+	}
+	for i := range ds {
+		ds[i].Password = ""
+	}
+	cd.Items = ds
+	return cd, nil
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+)
+
+func TestSearchUserCursor(t *testing.T) {
+	var sqls []string
+	us := GetUserServiceDB(newDryRunDB(t, &sqls))
+
+	cd, err := us.SearchUserCursor(UserSearch{PageSize: 20, AuthModule: "ldap"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cd.PageSize != 20 || cd.NextCursor != "" {
+		t.Errorf("unexpected page %+v", cd)
+	}
+	if want := "WHERE auth_module = 'ldap' AND `users`.`deleted_at` IS NULL ORDER BY `id` LIMIT 21"; len(sqls) != 1 || !strings.Contains(sqls[0], want) {
+		t.Errorf("expected %s without count, got %v", want, sqls)
+	}
+
+	cursor, err := userCursor{Sort: "id", ID: 42}.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = us.SearchUserCursor(UserSearch{PageSize: 20}, cursor); err != nil {
+		t.Fatal(err)
+	}
+	if want := "WHERE id > 42 AND"; !strings.Contains(sqls[1], want) {
+		t.Errorf("expected %s in %s", want, sqls[1])
+	}
+
+	u := &models.User{ID: 7}
+	u.UpdatedAt = time.Date(2021, 7, 1, 8, 0, 0, 0, time.UTC)
+	cursor, err = userCursor{Sort: "update_time", Desc: true, Value: userSortValue(u, "update_time"), ID: u.ID}.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = us.SearchUserCursor(UserSearch{PageSize: 20, Sort: "update_time", Order: "desc"}, cursor); err != nil {
+		t.Fatal(err)
+	}
+	if want := "(update_time < '2021-07-01 08:00:00' or (update_time = '2021-07-01 08:00:00' and id < 7))"; !strings.Contains(sqls[2], want) {
+		t.Errorf("expected %s in %s", want, sqls[2])
+	}
+	if want := "ORDER BY `update_time` DESC,`id` DESC LIMIT 21"; !strings.Contains(sqls[2], want) {
+		t.Errorf("expected %s in %s", want, sqls[2])
+	}
+
+	// 游标和排序不一致
+	for _, c := range []string{cursor, "not a cursor"} {
+		if _, err = us.SearchUserCursor(UserSearch{PageSize: 20, Sort: "name"}, c); err != ErrInvalidCursor {
+			t.Errorf("%s: expected ErrInvalidCursor, got %v", c, err)
+		}
+	}
+}
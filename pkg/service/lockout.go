@@ -0,0 +1,173 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CodeAccountLocked 账号被临时锁定
+const CodeAccountLocked = 42300
+
+// LoginAttemptStore 登录失败记录的存储，多实例部署时使用共享的存储
+type LoginAttemptStore interface {
+	// AddFailure 记录一次登录失败，返回 window 内的失败次数
+	AddFailure(name string, now time.Time, window time.Duration) (int, error)
+	// Lock 锁定账号到 until，并清除失败记录
+	Lock(name string, until time.Time) error
+	// LockedUntil 账号锁定的截止时间，没有锁定时返回零值
+	LockedUntil(name string) (time.Time, error)
+	// Reset 清除失败记录和锁定
+	Reset(name string) error
+}
+
+// AccountLockedError 账号被临时锁定
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return fmt.Sprintf("账号已被临时锁定，请在 %s 后重试", e.Until.Format("2006-01-02 15:04:05"))
+}
+
+// LoginLockout 连续登录失败 MaxAttempts 次后锁定账号 Duration，失败次数只统计 Window 内的，
+// 登录成功后清除。MaxAttempts 为 0 时不锁定
+type LoginLockout struct {
+	MaxAttempts int
+	Window      time.Duration
+	Duration    time.Duration
+	Store       LoginAttemptStore
+}
+
+// Lockout 本地登录的锁定策略
+var Lockout = &LoginLockout{Store: NewMemoryLoginAttemptStore()}
+
+// Check 账号被锁定时返回 *AccountLockedError
+func (l *LoginLockout) Check(name string) error {
+	if l.MaxAttempts <= 0 {
+		return nil
+	}
+	until, err := l.Store.LockedUntil(lockoutKey(name))
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(until) {
+		return &AccountLockedError{Until: until}
+	}
+	return nil
+}
+
+// Fail 记录一次登录失败，达到次数限制时锁定账号并返回 *AccountLockedError
+func (l *LoginLockout) Fail(name string) error {
+	if l.MaxAttempts <= 0 {
+		return nil
+	}
+	now := time.Now()
+	failures, err := l.Store.AddFailure(lockoutKey(name), now, l.Window)
+	if err != nil || failures < l.MaxAttempts {
+		return err
+	}
+	until := now.Add(l.Duration)
+	if err = l.Store.Lock(lockoutKey(name), until); err != nil {
+		return err
+	}
+	return &AccountLockedError{Until: until}
+}
+
+// Success 登录成功，清除失败记录
+func (l *LoginLockout) Success(name string) error {
+	if l.MaxAttempts <= 0 {
+		return nil
+	}
+	return l.Store.Reset(lockoutKey(name))
+}
+
+// lockoutKey 用户名不区分大小写
+func lockoutKey(name string) string {
+	return strings.ToLower(name)
+}
+
+type loginAttempts struct {
+	failures    []time.Time
+	lockedUntil time.Time
+	expires     time.Time
+}
+
+// MemoryLoginAttemptStore 内存登录失败记录，失败记录过期并且锁定结束后自动清理
+type MemoryLoginAttemptStore struct {
+	mu        sync.Mutex
+	items     map[string]*loginAttempts
+	lastSweep time.Time
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{items: map[string]*loginAttempts{}, lastSweep: time.Now()}
+}
+
+func (s *MemoryLoginAttemptStore) AddFailure(name string, now time.Time, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+	a := s.items[name]
+	if a == nil {
+		a = &loginAttempts{}
+		s.items[name] = a
+	}
+	failures := a.failures[:0]
+	for _, t := range a.failures {
+		if now.Sub(t) < window {
+			failures = append(failures, t)
+		}
+	}
+	a.failures = append(failures, now)
+	if expires := now.Add(window); expires.After(a.expires) {
+		a.expires = expires
+	}
+	return len(a.failures), nil
+}
+
+func (s *MemoryLoginAttemptStore) Lock(name string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := s.items[name]
+	if a == nil {
+		a = &loginAttempts{}
+		s.items[name] = a
+	}
+	a.failures = nil
+	a.lockedUntil = until
+	if until.After(a.expires) {
+		a.expires = until
+	}
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) LockedUntil(name string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a := s.items[name]; a != nil {
+		return a.lockedUntil, nil
+	}
+	return time.Time{}, nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, name)
+	return nil
+}
+
+// sweep 每分钟清理一次已经过期的记录
+func (s *MemoryLoginAttemptStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for name, a := range s.items {
+		if !now.Before(a.expires) {
+			delete(s.items, name)
+		}
+	}
+}
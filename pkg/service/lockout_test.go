@@ -0,0 +1,39 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoginLockout(t *testing.T) {
+	l := &LoginLockout{MaxAttempts: 3, Window: time.Minute, Duration: 50 * time.Millisecond, Store: NewMemoryLoginAttemptStore()}
+
+	for i := 0; i < 2; i++ {
+		if err := l.Fail("jdoe"); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+	}
+	var locked *AccountLockedError
+	if err := l.Fail("JDoe"); !errors.As(err, &locked) {
+		t.Fatalf("expected the account to be locked, got %v", err)
+	}
+	if err := l.Check("jdoe"); !errors.As(err, &locked) {
+		t.Errorf("expected Check to report the lock, got %v", err)
+	}
+	if err := l.Check("asmith"); err != nil {
+		t.Errorf("expected other accounts to be unlocked, got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := l.Check("jdoe"); err != nil {
+		t.Errorf("expected the lock to expire, got %v", err)
+	}
+
+	l.Fail("jdoe")
+	l.Fail("jdoe")
+	l.Success("jdoe")
+	if err := l.Fail("jdoe"); err != nil {
+		t.Errorf("expected a successful login to reset the failures, got %v", err)
+	}
+}
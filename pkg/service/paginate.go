@@ -0,0 +1,149 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultPageSize 默认单页条数
+const DefaultPageSize = 20
+
+// ErrInvalidFilter 过滤字段不合法
+var ErrInvalidFilter = errors.New("不支持的过滤字段")
+
+// PageOptions 分页、排序和过滤参数，排序和过滤只能使用 Columns 中的字段，避免拼接 SQL 注入
+type PageOptions struct {
+	Page     int               //页码 从1开始
+	PageSize int               //单页条数
+	Sort     string            //排序字段 Columns 中的参数名，为空时按 id
+	Order    string            //排序方向 asc desc
+	Filters  map[string]string //等值过滤条件 参数名 -> 值
+	// Columns 可以排序和过滤的参数名 -> 数据库字段，由服务设置
+	Columns map[string]string
+}
+
+// PageOptionsFromContext 从查询参数 page page_size sort order 获取分页和排序参数，pageNo pageSize 为旧的参数名，
+// filters 中有值的查询参数作为等值过滤条件，例如 ?auth_module=ldap。maxPageSize 大于 0 时限制单页条数
+func PageOptionsFromContext(ctx *gin.Context, maxPageSize int, filters ...string) PageOptions {
+	opts := PageOptions{Sort: ctx.Query("sort"), Order: ctx.Query("order")}
+	page, err := strconv.Atoi(queryDefault(ctx, "page", "pageNo"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(queryDefault(ctx, "page_size", "pageSize"))
+	if err != nil || pageSize < 1 {
+		pageSize = DefaultPageSize
+	}
+	if maxPageSize > 0 && pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+	opts.Page, opts.PageSize = page, pageSize
+	for _, f := range filters {
+		if v := ctx.Query(f); v != "" {
+			if opts.Filters == nil {
+				opts.Filters = map[string]string{}
+			}
+			opts.Filters[f] = v
+		}
+	}
+	return opts
+}
+
+// queryDefault 获取查询参数，没有时使用旧的参数名
+func queryDefault(ctx *gin.Context, key, oldKey string) string {
+	if v, ok := ctx.GetQuery(key); ok {
+		return v
+	}
+	return ctx.Query(oldKey)
+}
+
+// Paginate 统计 db 按 opts.Filters 过滤后的总数，排序字段或过滤字段不合法时不查询直接返回错误。
+// 之后用 db.Scopes(opts.Scope).Find 查询当前页
+func Paginate(db *gorm.DB, opts PageOptions) (total int64, err error) {
+	if _, err = opts.order(); err != nil {
+		return 0, err
+	}
+	if _, err = opts.where(); err != nil {
+		return 0, err
+	}
+	err = db.Session(&gorm.Session{}).Scopes(opts.filter).Count(&total).Error
+	return
+}
+
+// Scope 按 opts 过滤、排序和分页，用于 db.Scopes
+func (opts PageOptions) Scope(db *gorm.DB) *gorm.DB {
+	order, err := opts.order()
+	if err != nil {
+		db.AddError(err)
+		return db
+	}
+	page, pageSize := opts.pages()
+	return opts.filter(db).Order(order).Limit(pageSize).Offset(pageSize * (page - 1))
+}
+
+// pages 返回页码和单页条数，小于 1 时为 1
+func (opts PageOptions) pages() (page, pageSize int) {
+	page, pageSize = opts.Page, opts.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 1
+	}
+	return
+}
+
+// filter 添加 opts.Filters 的过滤条件
+func (opts PageOptions) filter(db *gorm.DB) *gorm.DB {
+	where, err := opts.where()
+	if err != nil {
+		db.AddError(err)
+		return db
+	}
+	if len(where) == 0 {
+		return db
+	}
+	return db.Where(clause.And(where...))
+}
+
+// where 校验过滤字段，按参数名排序返回过滤条件，使生成的 SQL 固定
+func (opts PageOptions) where() ([]clause.Expression, error) {
+	keys := make([]string, 0, len(opts.Filters))
+	for k := range opts.Filters {
+		if _, ok := opts.Columns[k]; !ok {
+			return nil, ErrInvalidFilter
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	exprs := make([]clause.Expression, 0, len(keys))
+	for _, k := range keys {
+		exprs = append(exprs, clause.Eq{Column: clause.Column{Name: opts.Columns[k]}, Value: opts.Filters[k]})
+	}
+	return exprs, nil
+}
+
+// order 校验排序字段和方向，默认按 id 升序
+func (opts PageOptions) order() (clause.OrderByColumn, error) {
+	sort := opts.Sort
+	if sort == "" {
+		sort = "id"
+	}
+	column, ok := opts.Columns[sort]
+	if !ok {
+		return clause.OrderByColumn{}, ErrInvalidSort
+	}
+	switch strings.ToLower(opts.Order) {
+	case "", "asc":
+		return clause.OrderByColumn{Column: clause.Column{Name: column}}, nil
+	case "desc":
+		return clause.OrderByColumn{Column: clause.Column{Name: column}, Desc: true}, nil
+	}
+	return clause.OrderByColumn{}, ErrInvalidSort
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestPaginate(t *testing.T) {
+	var sqls []string
+	db := newDryRunDB(t, &sqls)
+	opts := PageOptions{
+		Page:     2,
+		PageSize: 10,
+		Sort:     "created",
+		Order:    "desc",
+		Filters:  map[string]string{"module": "ldap", "email": "jdoe@example.com"},
+		Columns:  map[string]string{"id": "id", "created": "create_time", "module": "auth_module", "email": "email"},
+	}
+	tx := db.Model(&models.User{})
+	if _, err := Paginate(tx, opts); err != nil {
+		t.Fatal(err)
+	}
+	var users []models.User
+	if err := tx.Scopes(opts.Scope).Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(sqls) != 2 {
+		t.Fatalf("expected count and find queries, got %v", sqls)
+	}
+	where := "`email` = 'jdoe@example.com' AND `auth_module` = 'ldap'"
+	if !strings.Contains(sqls[0], "count(*)") || !strings.Contains(sqls[0], where) || strings.Contains(sqls[0], "LIMIT") {
+		t.Errorf("unexpected count query %s", sqls[0])
+	}
+	if !strings.Contains(sqls[1], where) || !strings.Contains(sqls[1], "ORDER BY `create_time` DESC LIMIT 10 OFFSET 10") {
+		t.Errorf("unexpected query %s", sqls[1])
+	}
+
+	sqls = nil
+	for _, o := range []PageOptions{
+		{Sort: "password", Columns: opts.Columns},
+		{Filters: map[string]string{"password": "x"}, Columns: opts.Columns},
+	} {
+		if _, err := Paginate(tx, o); err != ErrInvalidSort && err != ErrInvalidFilter {
+			t.Errorf("%+v: expected the column to be refused, got %v", o, err)
+		}
+	}
+	if len(sqls) != 0 {
+		t.Errorf("expected no query, got %v", sqls)
+	}
+}
+
+func TestPageOptionsFromContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/?pageNo=3&page_size=500&sort=name&order=desc&auth_module=ldap&email=", nil)
+
+	opts := PageOptionsFromContext(c, 100, "auth_module", "email")
+	if opts.Page != 3 || opts.PageSize != 100 || opts.Sort != "name" || opts.Order != "desc" {
+		t.Errorf("unexpected options %+v", opts)
+	}
+	if len(opts.Filters) != 1 || opts.Filters["auth_module"] != "ldap" {
+		t.Errorf("unexpected filters %v", opts.Filters)
+	}
+}
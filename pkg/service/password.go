@@ -0,0 +1,145 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gitee.com/golden-go/golden-go/pkg/utils/crypto"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordBcrypt   = "bcrypt"
+	PasswordArgon2id = "argon2id"
+)
+
+// PasswordPolicy 密码哈希算法和参数
+type PasswordPolicy struct {
+	Algorithm  string       `mapstructure:"algorithm"`   //bcrypt argon2id
+	BcryptCost int          `mapstructure:"bcrypt_cost"` //bcrypt 的 cost
+	Argon2     Argon2Params `mapstructure:"argon2"`
+}
+
+// Argon2Params argon2id 的参数
+type Argon2Params struct {
+	Time    uint32 `mapstructure:"time"`     //迭代次数
+	Memory  uint32 `mapstructure:"memory"`   //内存 单位KiB
+	Threads uint8  `mapstructure:"threads"`  //并行度
+	KeyLen  uint32 `mapstructure:"key_len"`  //哈希长度
+	SaltLen uint32 `mapstructure:"salt_len"` //盐长度
+}
+
+// valid argon2.IDKey 在 time 或 threads 为 0 时会 panic，长度为 0 的盐和哈希也没有意义
+func (p Argon2Params) valid() bool {
+	return p.Time > 0 && p.Threads > 0 && p.KeyLen > 0 && p.SaltLen > 0
+}
+
+// DefaultPasswordPolicy 默认使用 bcrypt
+var DefaultPasswordPolicy = PasswordPolicy{
+	Algorithm:  PasswordBcrypt,
+	BcryptCost: bcrypt.DefaultCost,
+	Argon2: Argon2Params{
+		Time:    1,
+		Memory:  64 * 1024,
+		Threads: 4,
+		KeyLen:  32,
+		SaltLen: 16,
+	},
+}
+
+// Password 当前的密码策略，HashPassword 使用这个策略，VerifyPassword 据此判断是否需要重新哈希
+var Password = DefaultPasswordPolicy
+
+var (
+	ErrUnknownPasswordAlgorithm = errors.New("不支持的密码哈希算法")
+	ErrInvalidPasswordHash      = errors.New("密码哈希格式错误")
+	ErrInvalidArgon2Params      = errors.New("argon2id 的 time threads key_len salt_len 必须大于 0")
+)
+
+// HashPassword 按当前的密码策略哈希密码
+func HashPassword(password string) (string, error) {
+	switch Password.Algorithm {
+	case PasswordBcrypt:
+		h, err := bcrypt.GenerateFromPassword([]byte(password), Password.BcryptCost)
+		return string(h), err
+	case PasswordArgon2id:
+		p := Password.Argon2
+		if !p.valid() {
+			return "", ErrInvalidArgon2Params
+		}
+		salt := make([]byte, p.SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Time, p.Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+	return "", ErrUnknownPasswordAlgorithm
+}
+
+// VerifyPassword 校验密码，rehash 为 true 表示哈希的算法或参数和当前的密码策略不同，应该重新哈希。
+// 兼容旧的 AES 加密的密码
+func VerifyPassword(hash, password string) (ok, rehash bool, err error) {
+	switch {
+	case hash == "":
+		return false, false, nil
+	case strings.HasPrefix(hash, "$2"):
+		if err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			if err == bcrypt.ErrMismatchedHashAndPassword {
+				err = nil
+			}
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return true, Password.Algorithm != PasswordBcrypt || cost != Password.BcryptCost, err
+	case strings.HasPrefix(hash, "$argon2id$"):
+		p, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, false, nil
+		}
+		current := Password.Argon2
+		rehash = Password.Algorithm != PasswordArgon2id ||
+			p.Time != current.Time || p.Memory != current.Memory || p.Threads != current.Threads ||
+			p.KeyLen != current.KeyLen || p.SaltLen != current.SaltLen
+		return true, rehash, nil
+	}
+	ok = subtle.ConstantTimeCompare([]byte(hash), []byte(crypto.GetPassword(password))) == 1
+	return ok, ok, nil
+}
+
+// decodeArgon2id 解析 $argon2id$v=19$m=65536,t=1,p=4$salt$key 格式的哈希
+func decodeArgon2id(hash string) (p Argon2Params, salt, key []byte, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	var version int
+	if _, err = fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	if _, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	p.SaltLen = uint32(len(salt))
+	p.KeyLen = uint32(len(key))
+	if !p.valid() {
+		return p, nil, nil, ErrInvalidPasswordHash
+	}
+	return p, salt, key, nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"testing"
+
+	"gitee.com/golden-go/golden-go/pkg/utils/crypto"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	defer func() { Password = DefaultPasswordPolicy }()
+	Password.BcryptCost = 4
+
+	bcryptHash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	Password.Algorithm = PasswordArgon2id
+	Password.Argon2.Memory = 1024
+	argonHash, err := HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		hash   string
+		ok     bool
+		rehash bool
+	}{
+		{"argon2id", argonHash, true, false},
+		{"bcrypt", bcryptHash, true, true},
+		{"legacy aes", crypto.GetPassword("secret"), true, true},
+		{"empty", "", false, false},
+	}
+	for _, test := range tests {
+		ok, rehash, err := VerifyPassword(test.hash, "secret")
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if ok != test.ok || rehash != test.rehash {
+			t.Errorf("%s: expected ok %v rehash %v, got %v %v", test.name, test.ok, test.rehash, ok, rehash)
+		}
+		if ok, _, _ := VerifyPassword(test.hash, "wrong"); ok {
+			t.Errorf("%s: expected a wrong password to fail", test.name)
+		}
+	}
+
+	Password.Argon2.Time = 2
+	if _, rehash, _ := VerifyPassword(argonHash, "secret"); !rehash {
+		t.Error("expected a rehash after the argon2 parameters changed")
+	}
+}
+
+func TestInvalidArgon2Params(t *testing.T) {
+	defer func() { Password = DefaultPasswordPolicy }()
+	Password.Algorithm = PasswordArgon2id
+	Password.Argon2.Threads = 0
+	if _, err := HashPassword("secret"); err != ErrInvalidArgon2Params {
+		t.Errorf("expected %v, got %v", ErrInvalidArgon2Params, err)
+	}
+
+	// 哈希中的参数不可信，t=0 p=0 不能传给 argon2.IDKey
+	for _, hash := range []string{
+		"$argon2id$v=19$m=1024,t=0,p=4$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U",
+		"$argon2id$v=19$m=1024,t=1,p=0$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U",
+		"$argon2id$v=19$m=1024,t=1,p=4$$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U",
+		"$argon2id$v=19$m=1024,t=1,p=4$c2FsdHNhbHRzYWx0c2FsdA$",
+	} {
+		if ok, _, err := VerifyPassword(hash, "secret"); ok || err != ErrInvalidPasswordHash {
+			t.Errorf("%s: expected %v, got %v %v", hash, ErrInvalidPasswordHash, ok, err)
+		}
+	}
+}
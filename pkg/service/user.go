@@ -1,28 +1,68 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+
 	"gitee.com/golden-go/golden-go/pkg/models"
-	"gitee.com/golden-go/golden-go/pkg/utils/crypto"
-	"gitee.com/golden-go/golden-go/pkg/utils/http"
 	"gitee.com/golden-go/golden-go/pkg/utils/logger"
 	"gitee.com/golden-go/golden-go/pkg/utils/types"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserService interface {
 	GetUser(id int) (d models.User, err error)
 	GetUserWithName(name string) (d models.User, err error)
+	GetUserWithExternalID(id string) (d models.User, err error)
 	GetUserWithGroup(g int) (ds []models.User, err error)
+	GetUsersInGroup(group string, nested bool, page, pageSize int) (pd *types.PageData, err error)
+	SetUserGroups(name string, direct, all []string) (err error)
 	CheckPassword(name, password string) (ok bool, err error)
 	CreateUser(d *models.User) (err error)
+	CreateUsers(ds []*models.User) (err error)
 	UpdateUser(d *models.User) (err error)
-	DelUser(ids []int) (err error)
-	InitSuperAdmin() (err error)
-	SearchUser(filter string, pageNo, pageSize int) (td *types.TableData, err error)
+	PatchUser(id int, p *models.UserPatch) (err error)
+	UpsertUser(d *models.User) (err error)
+	UpsertOIDCUser(d *models.User) (err error)
+	DelUser(ids []int, hard bool) (err error)
+	RestoreUser(ids []int) (err error)
+	Unscoped() UserService
+	InitSuperAdmin(ac SuperAdminConfig) (err error)
+	SearchUser(us UserSearch) (pd *types.PageData, err error)
+	SearchUserCursor(us UserSearch, cursor string) (cd *types.CursorPageData, err error)
+}
+
+// UserSearch 用户搜索条件
+type UserSearch struct {
+	Filter     string //过滤关键词 匹配用户名、显示名称、邮箱、手机号
+	Q          string //模糊搜索 不区分大小写匹配用户名和邮箱
+	Email      string //邮箱
+	AuthModule string //认证方式
+	Disabled   *bool  //是否禁用
+	Page       int    //页码 从1开始
+	PageSize   int    //单页条数
+	Sort       string //排序字段 只能是 UserSortColumns 中的字段
+	Order      string //排序方向 asc desc
+}
+
+// UserSortColumns 可以排序的字段
+var UserSortColumns = map[string]bool{
+	"id":           true,
+	"name":         true,
+	"display_name": true,
+	"email":        true,
+	"auth_module":  true,
+	"create_time":  true,
+	"update_time":  true,
 }
 
+// ErrInvalidSort 排序字段或方向不合法
+var ErrInvalidSort = errors.New("不支持的排序字段或方向")
+
 type UserServiceDB struct {
 	DB *gorm.DB
 }
@@ -39,19 +79,53 @@ func GetUserServiceDBWithContext(c *gin.Context) UserService {
 	return &UserServiceDB{db.(*gorm.DB)}
 }
 
-func (db *UserServiceDB) InitSuperAdmin() (err error) {
-	logger.Debug("InitSuperAdmin 接受到任务")
-	admin, _ := db.GetUserWithName("admin")
-	if admin.Name == "admin" {
-		return nil
+// SuperAdminConfig 启动时创建的超级管理员
+type SuperAdminConfig struct {
+	Username    string `mapstructure:"username"`     //用户名
+	Password    string `mapstructure:"password"`     //初始密码 只在创建时使用
+	DisplayName string `mapstructure:"display_name"` //显示名称
+	Role        string `mapstructure:"role"`         //角色
+	UpdateRole  bool   `mapstructure:"update_role"`  //已存在时是否更新角色
+}
+
+// InitSuperAdmin 超级管理员不存在时创建，已存在时不修改密码，UpdateRole 为 true 时更新角色
+func (db *UserServiceDB) InitSuperAdmin(ac SuperAdminConfig) (err error) {
+	logger.Debug("InitSuperAdmin 接受到任务", zap.String("name", ac.Username))
+	if ac.Username == "" {
+		return errors.New("超级管理员用户名不能为空")
 	}
-	return db.CreateUser(&models.User{
-		Name:        "admin",
-		DisplayName: "Admin",
-		Password:    "Gold@admin123",
+	admin, err := db.Unscoped().GetUserWithName(ac.Username)
+	if err == nil && admin.ID > 0 {
+		if admin.DeletedAt.Valid {
+			logger.Warn("超级管理员已被删除，不再创建", zap.String("name", ac.Username))
+			return nil
+		}
+		if !ac.UpdateRole {
+			logger.Info("超级管理员已存在", zap.String("name", ac.Username))
+			return nil
+		}
+		logger.Info("超级管理员已存在，更新角色", zap.String("name", ac.Username), zap.String("role", ac.Role))
+		return db.DB.Model(&models.User{ID: admin.ID}).
+			Updates(map[string]interface{}{"super_admin": true, "role": ac.Role, "version": gorm.Expr("version + 1")}).Error
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if ac.Password == "" {
+		return errors.New("超级管理员初始密码不能为空，请配置 admin.password 或环境变量 GOLDENGO_ADMIN_PASSWORD")
+	}
+	if err = db.CreateUser(&models.User{
+		Name:        ac.Username,
+		DisplayName: ac.DisplayName,
+		Password:    ac.Password,
+		Role:        ac.Role,
 		SuperAdmin:  true,
 		Group:       1,
-	})
+	}); err != nil {
+		return err
+	}
+	logger.Info("超级管理员已创建", zap.String("name", ac.Username))
+	return nil
 }
 
 func (db *UserServiceDB) GetUser(id int) (d models.User, err error) {
@@ -72,6 +146,16 @@ func (db *UserServiceDB) GetUserWithName(name string) (d models.User, err error)
 	return
 }
 
+// GetUserWithExternalID 按外部身份的唯一标识查询用户，如 OIDC 用户的 issuer 和 sub
+func (db *UserServiceDB) GetUserWithExternalID(id string) (d models.User, err error) {
+	logger.Debug("GetUserWithExternalID 接受到任务：", zap.String("external_id", id))
+	tx := db.DB.Model(&d).
+		Where(" external_id=?", id)
+	err = tx.Last(&d).Error
+	d.Password = ""
+	return
+}
+
 func (db *UserServiceDB) GetUserWithGroup(g int) (ds []models.User, err error) {
 	logger.Debug("GetUser 接受到任务：", zap.Int("group", g))
 	tx := db.DB.Model(&models.User{}).
@@ -87,67 +171,380 @@ func (db *UserServiceDB) GetUserWithGroup(g int) (ds []models.User, err error) {
 	return
 }
 
+// GetUsersInGroup 分页查询 user_groups 中属于组 group 的用户，nested 为 false 时只查询直接所属的用户
+func (db *UserServiceDB) GetUsersInGroup(group string, nested bool, page, pageSize int) (pd *types.PageData, err error) {
+	logger.Debug("GetUsersInGroup 接受到任务：", zap.String("group", group), zap.Bool("nested", nested))
+	opts := PageOptions{Page: page, PageSize: pageSize, Columns: map[string]string{"id": "users.id"}}
+	page, pageSize = opts.pages()
+	tx := db.DB.Model(&models.User{}).
+		Joins("JOIN user_groups ON user_groups.user_id = users.id").
+		Where("user_groups.group_name = ?", group)
+	if !nested {
+		tx = tx.Where("user_groups.direct = ?", true)
+	}
+	count, err := Paginate(tx, opts)
+	if err != nil {
+		return nil, err
+	}
+	ds := []models.User{}
+	if err = tx.Scopes(opts.Scope).Find(&ds).Error; err != nil {
+		return nil, err
+	}
+	for i := range ds {
+		ds[i].Password = ""
+	}
+	return &types.PageData{Items: ds, Total: count, Page: page, PageSize: pageSize}, nil
+}
+
+// SetUserGroups 替换用户名为 name 的用户所属的组，all 为所有的组，其中在 direct 中的为直接所属
+func (db *UserServiceDB) SetUserGroups(name string, direct, all []string) (err error) {
+	logger.Debug("SetUserGroups 接受到任务：", zap.String("name", name), zap.Strings("groups", all))
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var u models.User
+		if err := tx.Select("id").Where("name = ?", name).Last(&u).Error; err != nil {
+			return err
+		}
+		return replaceUserGroups(tx, u.ID, userGroups(u.ID, direct, all), nil)
+	})
+}
+
+// userGroups 用户 id 所属的组，all 中在 direct 中的为直接所属，direct 中不在 all 中的也加入
+func userGroups(id int64, direct, all []string) []models.UserGroup {
+	isDirect := make(map[string]bool, len(direct))
+	for _, g := range direct {
+		isDirect[g] = true
+	}
+	seen := map[string]bool{}
+	ugs := []models.UserGroup{}
+	for _, g := range append(append([]string{}, direct...), all...) {
+		if g == "" || seen[g] {
+			continue
+		}
+		seen[g] = true
+		ugs = append(ugs, models.UserGroup{UserID: id, Group: g, Direct: isDirect[g]})
+	}
+	return ugs
+}
+
+// replaceUserGroups 删除用户 id 所属的组后写入 ugs，direct 不为空时只删除直接或间接所属的组
+func replaceUserGroups(tx *gorm.DB, id int64, ugs []models.UserGroup, direct *bool) error {
+	del := tx.Where("user_id = ?", id)
+	if direct != nil {
+		del = del.Where("direct = ?", *direct)
+	}
+	if err := del.Delete(&models.UserGroup{}).Error; err != nil {
+		return err
+	}
+	if len(ugs) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "group_name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"direct"}),
+	}).Create(&ugs).Error
+}
+
+// CheckPassword 校验用户密码，密码的哈希不符合当前的密码策略时重新哈希，
+// 密码正确但用户已被禁用时返回 ErrUserDisabled
 func (db *UserServiceDB) CheckPassword(name, password string) (ok bool, err error) {
 	logger.Debug("CheckPassword 接受到任务：", zap.String("name", name))
 	d := &models.User{}
-	password = crypto.GetPassword(password)
 	tx := db.DB.Model(d).
-		Where(" name=? and password = ?", name, password)
-	err = tx.Last(d).Error
-	if err != nil {
+		Where(" name=?", name)
+	if err = tx.Last(d).Error; err != nil {
+		return false, err
+	}
+	ok, rehash, err := VerifyPassword(d.Password, password)
+	if err != nil || !ok {
 		return false, err
 	}
-	if d.ID > 0 {
-		return true, nil
-	} else {
-		return false, nil
+	if d.Disabled {
+		return false, ErrUserDisabled
+	}
+	if rehash {
+		if h, err := HashPassword(password); err != nil {
+			logger.Warn("重新哈希密码失败", zap.String("name", name), zap.Error(err))
+		} else if err = db.DB.Model(&models.User{ID: d.ID}).Update("password", h).Error; err != nil {
+			logger.Warn("更新密码哈希失败", zap.String("name", name), zap.Error(err))
+		}
 	}
+	return true, nil
 }
 
+var (
+	ErrDuplicateName  = errors.New("用户名已存在")
+	ErrDuplicateEmail = errors.New("邮箱已存在")
+	// ErrVersionConflict 更新时传入的版本号不是当前版本号，用户已被其它请求修改
+	ErrVersionConflict = errors.New("用户已被修改，请重新获取后再更新")
+	// ErrUserDisabled 用户已被禁用，不能登录和刷新 token
+	ErrUserDisabled = errors.New("用户已被禁用")
+	// ErrUsernameTaken 用户名已被其它认证方式的用户或其它外部身份的 OIDC 用户使用
+	ErrUsernameTaken = errors.New("用户名已被其它用户使用")
+)
+
+// CreateUser 创建用户，用户名或邮箱已存在时返回 ErrDuplicateName ErrDuplicateEmail
 func (db *UserServiceDB) CreateUser(d *models.User) (err error) {
 	logger.Debug("CreateUser 接受到任务：", zap.Reflect("args", *d))
-	d.Password = crypto.GetPassword(d.Password)
+	if err = db.checkDuplicate(d); err != nil {
+		return err
+	}
+	if d.Password, err = HashPassword(d.Password); err != nil {
+		return err
+	}
 	return db.DB.Create(d).Error
 }
 
+// BatchError 批量创建用户时请求中第 Index 个用户的错误
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("第 %d 个用户创建失败：%v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// CreateUsers 在一个事务中创建 ds，任何一个用户创建失败时全部回滚，返回 *BatchError。
+// 前面的用户已在事务中创建，所以 ds 中重复的用户名或邮箱同样返回 ErrDuplicateName ErrDuplicateEmail
+func (db *UserServiceDB) CreateUsers(ds []*models.User) (err error) {
+	logger.Debug("CreateUsers 接受到任务：", zap.Int("count", len(ds)))
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		us := &UserServiceDB{tx}
+		for i, d := range ds {
+			if err := us.CreateUser(d); err != nil {
+				return &BatchError{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+}
+
+// checkDuplicate 检查用户名和邮箱是否已存在，用户名的唯一索引包括已删除的用户
+func (db *UserServiceDB) checkDuplicate(d *models.User) error {
+	var count int64
+	if err := db.DB.Unscoped().Model(&models.User{}).Where("name = ?", d.Name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDuplicateName
+	}
+	if d.Email == "" {
+		return nil
+	}
+	if err := db.DB.Model(&models.User{}).Where("email = ?", d.Email).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDuplicateEmail
+	}
+	return nil
+}
+
+// UpdateUser 更新 d 中非零值的字段，d.Version 不是当前版本号时返回 ErrVersionConflict
 func (db *UserServiceDB) UpdateUser(d *models.User) (err error) {
 	logger.Debug("UpdateUser 接受到任务：", zap.Reflect("args", *d))
 	if d.Password != "" {
-		d.Password = crypto.GetPassword(d.Password)
+		if d.Password, err = HashPassword(d.Password); err != nil {
+			return err
+		}
 	}
 	d.Name = ""
-	return db.DB.Model(&models.User{ID: d.ID}).Updates(d).Error
+	version := d.Version
+	d.Version++
+	if err = versionConflict(db.DB.Model(&models.User{ID: d.ID}).Where("version = ?", version).Updates(d)); err != nil {
+		d.Version = version
+	}
+	return err
 }
 
-func (db *UserServiceDB) DelUser(ids []int) (err error) {
-	logger.Debug("DelUser 接受到任务：", zap.Any("ids", ids))
-	tx := db.DB.Begin()
-	if err := tx.Where("id in ?", ids).Delete(&models.User{}).Error; err != nil {
-		tx.Rollback()
-		return err
+// versionConflict 按版本号更新没有更新到记录时返回 ErrVersionConflict
+func versionConflict(tx *gorm.DB) error {
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return ErrVersionConflict
 	}
-	tx.Commit()
 	return nil
 }
 
-func (db *UserServiceDB) SearchUser(filter string, pageNo, pageSize int) (td *types.TableData, err error) {
-	logger.Debug("SearchAlert接受到任务：", zap.String("filter", filter), zap.Int("pageno", pageNo), zap.Int("pagesize", pageSize))
-	tx := db.DB.Model(&models.User{})
-	if filter != "" {
-		fk := "%" + filter + "%"
-		tx = tx.Where("name like ? or display_name like ? or email like ? or mobile  like ? ", fk, fk, fk, fk)
+// PatchUser 只更新 p 中有的字段，邮箱已被其它用户使用时返回 ErrDuplicateEmail，
+// p.Version 不是当前版本号时返回 ErrVersionConflict
+func (db *UserServiceDB) PatchUser(id int, p *models.UserPatch) (err error) {
+	logger.Debug("PatchUser 接受到任务：", zap.Int("id", id))
+	updates := p.Updates()
+	if len(updates) == 0 && p.Groups == nil {
+		return nil
 	}
-	var count int64
-	if err = tx.Count(&count).Error; err != nil {
+	if email, ok := updates["email"].(string); ok && email != "" {
+		var count int64
+		if err = db.DB.Model(&models.User{}).Where("email = ? AND id <> ?", email, id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrDuplicateEmail
+		}
+	}
+	if password, ok := updates["password"].(string); ok {
+		if updates["password"], err = HashPassword(password); err != nil {
+			return err
+		}
+	}
+	var version int64
+	if p.Version != nil {
+		version = *p.Version
+	}
+	// 只修改组时也增加版本号
+	updates["version"] = gorm.Expr("version + 1")
+	if p.Groups == nil {
+		return versionConflict(db.DB.Model(&models.User{}).Where("id = ? AND version = ?", id, version).Updates(updates))
+	}
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := versionConflict(tx.Model(&models.User{}).Where("id = ? AND version = ?", id, version).Updates(updates)); err != nil {
+			return err
+		}
+		direct := true
+		return replaceUserGroups(tx, int64(id), userGroups(int64(id), *p.Groups, nil), &direct)
+	})
+}
+
+// upsertUserColumns 用户已存在时 UpsertUser 更新的字段，不修改密码
+var upsertUserColumns = []string{"auth_module", "super_admin", "display_name", "role", "email", "update_time"}
+
+// oidcUpsertColumns 用户已存在时 UpsertOIDCUser 更新的字段，只同步身份提供方的用户信息，
+// 不修改本地管理的 super_admin role 等权限。external_id 只在还没有绑定时写入，
+// 调用方需要先确认已存在的用户没有绑定其它的 external_id
+var oidcUpsertColumns = []string{"auth_module", "external_id", "display_name", "email", "update_time"}
+
+// UpsertUser 按用户名创建用户，用户已存在时更新用户信息
+func (db *UserServiceDB) UpsertUser(d *models.User) (err error) {
+	logger.Debug("UpsertUser 接受到任务：", zap.Reflect("args", *d))
+	return db.upsertUser(d, upsertUserColumns)
+}
+
+// UpsertOIDCUser 保存 OIDC 登录的用户，按 ExternalID（issuer 和 sub）查找登录过的用户并使用它的用户名，
+// 用户已存在时只更新 oidcUpsertColumns。第一次登录时用户名已被本地、LDAP 用户
+// 或其它 ExternalID 的 OIDC 用户使用返回 ErrUsernameTaken，用户名规范化后可能重复
+func (db *UserServiceDB) UpsertOIDCUser(d *models.User) (err error) {
+	logger.Debug("UpsertOIDCUser 接受到任务：", zap.Reflect("args", *d))
+	if d.ExternalID == "" {
+		return errors.New("OIDC 用户的 external_id 不能为空")
+	}
+	existing, err := db.GetUserWithExternalID(d.ExternalID)
+	switch {
+	case err == nil:
+		d.Name = existing.Name
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	default:
+		existing, err = db.GetUserWithName(d.Name)
+		if err == nil && (existing.AuthModule != models.AuthModuleOIDC || existing.ExternalID != "") {
+			return ErrUsernameTaken
+		}
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+	return db.upsertUser(d, oidcUpsertColumns)
+}
+
+func (db *UserServiceDB) upsertUser(d *models.User, columns []string) error {
+	return db.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: append(clause.AssignmentColumns(columns), clause.Assignment{Column: clause.Column{Name: "version"}, Value: gorm.Expr("version + 1")}),
+	}).Create(d).Error
+}
+
+// Unscoped 返回查询包括已删除用户的 UserService
+func (db *UserServiceDB) Unscoped() UserService {
+	return &UserServiceDB{db.DB.Unscoped()}
+}
+
+// DelUser 删除用户，默认软删除只设置 deleted_at，hard 为 true 时从数据库删除
+func (db *UserServiceDB) DelUser(ids []int, hard bool) (err error) {
+	logger.Debug("DelUser 接受到任务：", zap.Any("ids", ids), zap.Bool("hard", hard))
+	// 已经在事务中时使用 SavePoint
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if hard {
+			tx = tx.Unscoped()
+		}
+		return tx.Where("id in ?", ids).Delete(&models.User{}).Error
+	})
+}
+
+// RestoreUser 恢复软删除的用户
+func (db *UserServiceDB) RestoreUser(ids []int) (err error) {
+	logger.Debug("RestoreUser 接受到任务：", zap.Any("ids", ids))
+	return db.DB.Unscoped().Model(&models.User{}).
+		Where("id in ? and deleted_at is not null", ids).
+		Update("deleted_at", nil).Error
+}
+
+func (db *UserServiceDB) SearchUser(us UserSearch) (pd *types.PageData, err error) {
+	logger.Debug("SearchUser 接受到任务：", zap.Reflect("args", us))
+	opts := us.pageOptions()
+	page, pageSize := opts.pages()
+	tx := db.searchQuery(us)
+	count, err := Paginate(tx, opts)
+	if err != nil {
 		return nil, err
 	}
-	tx.Limit(pageSize).Offset(pageSize * (pageNo - 1))
 	ds := []models.User{}
-	if err = tx.Find(&ds).Error; err != nil {
+	if err = tx.Scopes(opts.Scope).Find(&ds).Error; err != nil {
 		return nil, err
 	}
 	for i := range ds {
 		ds[i].Password = ""
 	}
-	return http.NewTableData(ds, pageNo, pageSize, int(count)), nil
+	return &types.PageData{Items: ds, Total: count, Page: page, PageSize: pageSize}, nil
+}
+
+// searchQuery 按 us 的过滤条件查询用户，不包括分页和排序
+func (db *UserServiceDB) searchQuery(us UserSearch) *gorm.DB {
+	tx := db.DB.Model(&models.User{})
+	if us.Filter != "" {
+		fk := "%" + escapeLike(us.Filter) + "%"
+		tx = tx.Where("name like ? or display_name like ? or email like ? or mobile  like ? ", fk, fk, fk, fk)
+	}
+	if us.Q != "" {
+		q := "%" + strings.ToLower(escapeLike(us.Q)) + "%"
+		tx = tx.Where("LOWER(name) like ? or LOWER(email) like ?", q, q)
+	}
+	if us.Email != "" {
+		tx = tx.Where("email = ?", us.Email)
+	}
+	if us.AuthModule != "" {
+		tx = tx.Where("auth_module = ?", us.AuthModule)
+	}
+	if us.Disabled != nil {
+		tx = tx.Where("disabled = ?", *us.Disabled)
+	}
+	return tx
+}
+
+// likeEscaper 转义 like 的通配符，使用户输入按字面匹配
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// pageOptions us 的分页和排序参数，可以按 UserSortColumns 中的字段排序
+func (us UserSearch) pageOptions() PageOptions {
+	columns := make(map[string]string, len(UserSortColumns))
+	for c, ok := range UserSortColumns {
+		if ok {
+			columns[c] = c
+		}
+	}
+	return PageOptions{Page: us.Page, PageSize: us.PageSize, Sort: us.Sort, Order: us.Order, Columns: columns}
+}
+
+// userOrder 校验排序字段和方向，默认按 id 升序
+func userOrder(sort, order string) (clause.OrderByColumn, error) {
+	return UserSearch{Sort: sort, Order: order}.pageOptions().order()
 }
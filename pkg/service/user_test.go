@@ -0,0 +1,322 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// newDryRunDB 创建不连接数据库的 gorm.DB，执行的 SQL 记录到 sqls
+func newDryRunDB(t *testing.T, sqls *[]string) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "golden_go:golden_go@tcp(127.0.0.1:3306)/golden_go",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := func(tx *gorm.DB) {
+		*sqls = append(*sqls, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	}
+	db.Callback().Query().After("gorm:query").Register("test:record", record)
+	return db
+}
+
+func TestSearchUserPagination(t *testing.T) {
+	var sqls []string
+	us := GetUserServiceDB(newDryRunDB(t, &sqls))
+
+	pd, err := us.SearchUser(UserSearch{Page: 3, PageSize: 20, Sort: "create_time", Order: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pd.Page != 3 || pd.PageSize != 20 {
+		t.Errorf("unexpected page %d size %d", pd.Page, pd.PageSize)
+	}
+	if len(sqls) != 2 {
+		t.Fatalf("expected count and find queries, got %v", sqls)
+	}
+	if !strings.Contains(sqls[1], "ORDER BY `create_time` DESC LIMIT 20 OFFSET 40") {
+		t.Errorf("unexpected query %s", sqls[1])
+	}
+}
+
+func TestSearchUserInvalidSort(t *testing.T) {
+	var sqls []string
+	us := GetUserServiceDB(newDryRunDB(t, &sqls))
+
+	for _, s := range []UserSearch{{Sort: "password"}, {Sort: "id;drop table users"}, {Order: "sideways"}} {
+		if _, err := us.SearchUser(s); err != ErrInvalidSort {
+			t.Errorf("%+v: expected ErrInvalidSort, got %v", s, err)
+		}
+	}
+	if len(sqls) != 0 {
+		t.Errorf("expected no query, got %v", sqls)
+	}
+}
+
+func TestSearchUserFilters(t *testing.T) {
+	var sqls []string
+	us := GetUserServiceDB(newDryRunDB(t, &sqls))
+
+	disabled := true
+	if _, err := us.SearchUser(UserSearch{Q: "100%_Off", AuthModule: "ldap", Disabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	want := "WHERE (LOWER(name) like '%100\\%\\_off%' or LOWER(email) like '%100\\%\\_off%') AND auth_module = 'ldap' AND disabled = true"
+	if !strings.Contains(sqls[1], want) {
+		t.Errorf("expected %s in query %s", want, sqls[1])
+	}
+}
+
+func TestUpsertUser(t *testing.T) {
+	var sqls []string
+	db := newDryRunDB(t, &sqls)
+	db.Callback().Create().After("gorm:create").Register("test:record", func(tx *gorm.DB) {
+		sqls = append(sqls, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	})
+	// 事务会连接数据库
+	us := GetUserServiceDB(db.Session(&gorm.Session{SkipDefaultTransaction: true}))
+
+	if err := us.UpsertUser(&models.User{Name: "jdoe", AuthModule: models.AuthModuleLDAP}); err != nil {
+		t.Fatal(err)
+	}
+	want := "ON DUPLICATE KEY UPDATE `auth_module`=VALUES(`auth_module`),`super_admin`=VALUES(`super_admin`),`display_name`=VALUES(`display_name`),`role`=VALUES(`role`),`email`=VALUES(`email`),`update_time`=VALUES(`update_time`)"
+	if len(sqls) != 1 || !strings.Contains(sqls[0], want) {
+		t.Errorf("expected upsert on name, got %v", sqls)
+	}
+
+	// OIDC 登录不修改本地管理的权限
+	var byExternalID, byName *models.User
+	db.Callback().Query().After("gorm:query").Register("test:user", func(tx *gorm.DB) {
+		// 模拟按 external_id 或用户名查询到的用户，没有时返回 ErrRecordNotFound
+		found := byName
+		if strings.Contains(tx.Statement.SQL.String(), "external_id") {
+			found = byExternalID
+		}
+		if u, ok := tx.Statement.Dest.(*models.User); ok {
+			if found == nil {
+				tx.AddError(gorm.ErrRecordNotFound)
+				return
+			}
+			*u = *found
+			tx.RowsAffected = 1
+		}
+	})
+	upsertOIDC := func(name string) (*models.User, error) {
+		sqls = nil
+		d := &models.User{Name: name, AuthModule: models.AuthModuleOIDC, ExternalID: "https://idp.example.com#1"}
+		return d, us.UpsertOIDCUser(d)
+	}
+	if _, err := upsertOIDC("jdoe"); err != nil {
+		t.Fatal(err)
+	}
+	want = "ON DUPLICATE KEY UPDATE `auth_module`=VALUES(`auth_module`),`external_id`=VALUES(`external_id`),`display_name`=VALUES(`display_name`),`email`=VALUES(`email`),`update_time`=VALUES(`update_time`),`version`=version + 1"
+	if n := len(sqls); n == 0 || !strings.Contains(sqls[n-1], want) {
+		t.Errorf("expected the OIDC upsert to keep super_admin and role, got %v", sqls)
+	}
+
+	// 用户名已被 LDAP 用户或其它 sub 的 OIDC 用户使用
+	byName = &models.User{ID: 2, Name: "jdoe", AuthModule: models.AuthModuleLDAP}
+	if _, err := upsertOIDC("jdoe"); err != ErrUsernameTaken {
+		t.Errorf("expected ErrUsernameTaken for an LDAP user, got %v", err)
+	}
+	byName = &models.User{ID: 2, Name: "jdoe", AuthModule: models.AuthModuleOIDC, ExternalID: "https://idp.example.com#2"}
+	if _, err := upsertOIDC("jdoe"); err != ErrUsernameTaken {
+		t.Errorf("expected ErrUsernameTaken for another subject, got %v", err)
+	}
+	// 还没有绑定 sub 的 OIDC 用户在登录时绑定
+	byName = &models.User{ID: 2, Name: "jdoe", AuthModule: models.AuthModuleOIDC}
+	if _, err := upsertOIDC("jdoe"); err != nil {
+		t.Errorf("expected an unbound OIDC user to be bound, got %v", err)
+	}
+	// 登录过的用户按 sub 找到，使用已有的用户名
+	byExternalID = &models.User{ID: 3, Name: "alice", AuthModule: models.AuthModuleOIDC, ExternalID: "https://idp.example.com#1"}
+	if d, err := upsertOIDC("alice.renamed"); err != nil || d.Name != "alice" {
+		t.Errorf("expected the user bound to the subject, got %v %v", d.Name, err)
+	}
+}
+
+func TestSearchUserUnscoped(t *testing.T) {
+	var sqls []string
+	us := GetUserServiceDB(newDryRunDB(t, &sqls))
+
+	if _, err := us.SearchUser(UserSearch{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := us.Unscoped().SearchUser(UserSearch{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sqls[1], "`users`.`deleted_at` IS NULL") {
+		t.Errorf("expected deleted users to be excluded in %s", sqls[1])
+	}
+	if strings.Contains(sqls[3], "deleted_at") {
+		t.Errorf("expected deleted users to be included in %s", sqls[3])
+	}
+}
+
+func TestInitSuperAdmin(t *testing.T) {
+	var sqls []string
+	db := newDryRunDB(t, &sqls)
+	db.Callback().Create().After("gorm:create").Register("test:record", func(tx *gorm.DB) {
+		sqls = append(sqls, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	})
+	us := GetUserServiceDB(db.Session(&gorm.Session{SkipDefaultTransaction: true}))
+
+	if err := us.InitSuperAdmin(SuperAdminConfig{Username: "root"}); err == nil {
+		t.Error("expected an error without the initial password")
+	}
+	sqls = nil
+	if err := us.InitSuperAdmin(SuperAdminConfig{Username: "root", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	insert := sqls[len(sqls)-1]
+	if !strings.HasPrefix(insert, "INSERT INTO `users`") {
+		t.Fatalf("expected the admin to be created, got %v", sqls)
+	}
+	if !strings.Contains(insert, "'root'") || !strings.Contains(insert, "'$2a$") || strings.Contains(insert, "'secret'") {
+		t.Errorf("expected a bcrypt hashed password, got %s", insert)
+	}
+}
+
+func TestCreateUserChecksDuplicates(t *testing.T) {
+	var sqls []string
+	db := newDryRunDB(t, &sqls)
+	db.Callback().Create().After("gorm:create").Register("test:record", func(tx *gorm.DB) {
+		sqls = append(sqls, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	})
+	us := GetUserServiceDB(db.Session(&gorm.Session{SkipDefaultTransaction: true}))
+
+	if err := us.CreateUser(&models.User{Name: "jdoe", Email: "jdoe@example.com", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(sqls) != 3 {
+		t.Fatalf("expected name and email checks before the insert, got %v", sqls)
+	}
+	if want := "SELECT count(*) FROM `users` WHERE name = 'jdoe'"; sqls[0] != want {
+		t.Errorf("expected %s, got %s", want, sqls[0])
+	}
+	if want := "SELECT count(*) FROM `users` WHERE email = 'jdoe@example.com' AND `users`.`deleted_at` IS NULL"; sqls[1] != want {
+		t.Errorf("expected %s, got %s", want, sqls[1])
+	}
+}
+
+func TestPatchUser(t *testing.T) {
+	var sqls []string
+	db := newDryRunDB(t, &sqls)
+	db.Callback().Update().After("gorm:update").Register("test:record", func(tx *gorm.DB) {
+		sqls = append(sqls, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+		// 模拟版本号匹配，更新到一条记录
+		tx.RowsAffected = 1
+	})
+	us := GetUserServiceDB(db.Session(&gorm.Session{SkipDefaultTransaction: true}))
+
+	displayName := "John Doe"
+	version := int64(3)
+	if err := us.PatchUser(1, &models.UserPatch{DisplayName: &displayName, Version: &version}); err != nil {
+		t.Fatal(err)
+	}
+	if len(sqls) != 1 || !strings.Contains(sqls[0], "`display_name`='John Doe'") || !strings.Contains(sqls[0], "WHERE (id = 1 AND version = 3)") {
+		t.Fatalf("expected display_name to be updated, got %v", sqls)
+	}
+	if !strings.Contains(sqls[0], "`version`=version + 1") {
+		t.Errorf("expected version to be increased, got %s", sqls[0])
+	}
+	// 请求中没有的字段保持不变
+	for _, column := range []string{"email", "password", "role", "super_admin"} {
+		if strings.Contains(sqls[0], "`"+column+"`") {
+			t.Errorf("expected %s to be preserved, got %s", column, sqls[0])
+		}
+	}
+
+	sqls = nil
+	if err := us.PatchUser(1, &models.UserPatch{Version: &version}); err != nil || len(sqls) != 0 {
+		t.Errorf("expected an empty patch to do nothing, got %v %v", err, sqls)
+	}
+}
+
+func TestUpdateUserVersionConflict(t *testing.T) {
+	var sqls []string
+	db := newDryRunDB(t, &sqls)
+	db.Callback().Update().After("gorm:update").Register("test:record", func(tx *gorm.DB) {
+		sqls = append(sqls, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	})
+	us := GetUserServiceDB(db.Session(&gorm.Session{SkipDefaultTransaction: true}))
+
+	// 版本号不匹配时没有更新到记录
+	err := us.UpdateUser(&models.User{ID: 1, DisplayName: "John Doe", Version: 2})
+	if err != ErrVersionConflict {
+		t.Fatalf("expected ErrVersionConflict, got %v", err)
+	}
+	if len(sqls) != 1 || !strings.Contains(sqls[0], "`version`=3") || !strings.Contains(sqls[0], "version = 2") {
+		t.Errorf("expected the update to check and increase the version, got %v", sqls)
+	}
+}
+
+func TestGetUsersInGroup(t *testing.T) {
+	var sqls []string
+	us := GetUserServiceDB(newDryRunDB(t, &sqls))
+
+	pd, err := us.GetUsersInGroup("cn=devs,dc=example,dc=com", false, 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pd.Page != 2 || pd.PageSize != 10 {
+		t.Errorf("unexpected page %d size %d", pd.Page, pd.PageSize)
+	}
+	want := "JOIN user_groups ON user_groups.user_id = users.id WHERE user_groups.group_name = 'cn=devs,dc=example,dc=com' AND user_groups.direct = true"
+	if len(sqls) != 2 || !strings.Contains(sqls[1], want) || !strings.Contains(sqls[1], "LIMIT 10 OFFSET 10") {
+		t.Fatalf("expected %s in query %v", want, sqls)
+	}
+
+	sqls = nil
+	if _, err := us.GetUsersInGroup("devs", true, 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sqls[1], "direct") {
+		t.Errorf("expected nested members to be included, got %s", sqls[1])
+	}
+}
+
+func TestUserGroups(t *testing.T) {
+	ugs := userGroups(1, []string{"devs", "devs"}, []string{"devs", "staff", ""})
+	want := []models.UserGroup{{UserID: 1, Group: "devs", Direct: true}, {UserID: 1, Group: "staff"}}
+	if !reflect.DeepEqual(ugs, want) {
+		t.Errorf("expected %v, got %v", want, ugs)
+	}
+}
+
+func TestCheckPasswordDisabled(t *testing.T) {
+	var sqls []string
+	db := newDryRunDB(t, &sqls)
+	hash, err := HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabled := false
+	db.Callback().Query().After("gorm:query").Register("test:user", func(tx *gorm.DB) {
+		// 模拟查询到用户
+		if u, ok := tx.Statement.Dest.(*models.User); ok {
+			*u = models.User{ID: 2, Name: "jdoe", Password: hash, Disabled: disabled}
+			tx.RowsAffected = 1
+		}
+	})
+	us := GetUserServiceDB(db)
+
+	if ok, err := us.CheckPassword("jdoe", "password"); !ok || err != nil {
+		t.Errorf("expected the password to be accepted, got %v %v", ok, err)
+	}
+	disabled = true
+	if ok, err := us.CheckPassword("jdoe", "password"); ok || !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("expected ErrUserDisabled, got %v %v", ok, err)
+	}
+	// 密码错误时不返回用户是否被禁用
+	if ok, err := us.CheckPassword("jdoe", "wrong-password"); ok || err != nil {
+		t.Errorf("expected the wrong password to be rejected without an error, got %v %v", ok, err)
+	}
+}
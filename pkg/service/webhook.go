@@ -0,0 +1,233 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	"go.uber.org/zap"
+)
+
+// webhook 请求头
+const (
+	// WebhookEventHeader 事件类型
+	WebhookEventHeader = "X-Golden-Event"
+	// WebhookSignatureHeader 请求体的 HMAC-SHA256 签名，格式为 sha256=<hex>，接收方用共享密钥计算后比较
+	WebhookSignatureHeader = "X-Golden-Signature"
+)
+
+// maxWebhookInterval 重试间隔翻倍的上限
+const maxWebhookInterval = time.Minute
+
+// WebhookEvents 发送 webhook 的事件，和审计日志的操作相同，只发送成功的操作
+var WebhookEvents = map[string]bool{
+	models.AuditUserCreate:  true,
+	models.AuditUserUpdate:  true,
+	models.AuditUserDelete:  true,
+	models.AuditUserRestore: true,
+	models.AuditUserImport:  true,
+	models.AuditLoginLocal:  true,
+	models.AuditLoginLDAP:   true,
+	models.AuditLoginOIDC:   true,
+}
+
+// WebhookEvent 发送给 webhook 的用户事件，JSON 格式
+type WebhookEvent struct {
+	Type     string    `json:"type"`      //事件类型 user.create login.local 等
+	UserID   int64     `json:"user_id"`   //用户ID，未知时为0
+	UserName string    `json:"user_name"` //用户名，未知时为空
+	Actor    string    `json:"actor"`     //操作人，token 的 sub，登录时为登录的用户名
+	Time     time.Time `json:"timestamp"` //事件时间
+}
+
+// WebhookConfig webhook 配置，URLs 为空时不发送
+type WebhookConfig struct {
+	URLs          []string      `mapstructure:"urls"`           //接收事件的地址，每个事件发送给所有地址
+	Secret        string        `mapstructure:"secret"`         //签名的共享密钥
+	Timeout       time.Duration `mapstructure:"timeout"`        //单次请求的超时时间
+	Retries       int           `mapstructure:"retries"`        //失败后的重试次数
+	RetryInterval time.Duration `mapstructure:"retry_interval"` //第一次重试的间隔，之后逐次翻倍
+	QueueSize     int           `mapstructure:"queue_size"`     //等待发送的事件数，队列满时丢弃并写入死信日志
+}
+
+// WebhookDispatcher 在后台按顺序发送用户事件，失败时重试，重试后仍然失败的事件写入死信日志。
+// 发送失败不影响请求
+type WebhookDispatcher struct {
+	Client *http.Client
+	config WebhookConfig
+	// deadLetter 重试后仍然失败或队列满时丢弃的事件
+	deadLetter *zap.Logger
+
+	mu     sync.RWMutex
+	queue  chan *WebhookEvent
+	closed bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Webhook 用户事件的 webhook，Start 之前不发送
+var Webhook = &WebhookDispatcher{}
+
+// NewWebhookDispatcher 按配置创建 webhook，需要 Start 后才会发送
+func NewWebhookDispatcher(wc WebhookConfig) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		Client:     &http.Client{Timeout: wc.Timeout},
+		config:     wc,
+		deadLetter: logger.With(zap.String("logger", "webhook_dead_letter")),
+	}
+}
+
+// Start 开始后台发送，没有配置 URLs 时不发送
+func (d *WebhookDispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.config.URLs) == 0 || d.queue != nil {
+		return
+	}
+	size := d.config.QueueSize
+	if size < 1 {
+		size = 1
+	}
+	d.queue = make(chan *WebhookEvent, size)
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	d.done = make(chan struct{})
+	go d.run()
+}
+
+// Send 异步发送事件，不阻塞，没有设置时间时使用当前时间
+func (d *WebhookDispatcher) Send(e *WebhookEvent) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.queue == nil || d.closed {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	select {
+	case d.queue <- e:
+	default:
+		d.dead(e, "", fmt.Errorf("webhook 队列已满"))
+	}
+}
+
+// Close 停止接受事件，等待队列中的事件发送完成，ctx 结束时取消正在进行的发送和重试，
+// 没有发送的事件写入死信日志
+func (d *WebhookDispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if d.queue == nil || d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	close(d.queue)
+	d.mu.Unlock()
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-d.done
+		return ctx.Err()
+	}
+}
+
+func (d *WebhookDispatcher) run() {
+	defer close(d.done)
+	defer d.cancel()
+	for e := range d.queue {
+		body, err := json.Marshal(e)
+		if err != nil {
+			d.dead(e, "", err)
+			continue
+		}
+		var wg sync.WaitGroup
+		for _, url := range d.config.URLs {
+			wg.Add(1)
+			go func(url string) {
+				defer wg.Done()
+				d.deliver(url, e, body)
+			}(url)
+		}
+		wg.Wait()
+	}
+}
+
+// deliver 发送事件到 url，失败时按 RetryInterval 逐次翻倍的间隔重试 Retries 次
+func (d *WebhookDispatcher) deliver(url string, e *WebhookEvent, body []byte) {
+	interval := d.config.RetryInterval
+	var err error
+	for i := 0; ; i++ {
+		if err = d.post(url, e.Type, body); err == nil {
+			return
+		}
+		if i >= d.config.Retries {
+			break
+		}
+		logger.Warn("发送 webhook 失败，稍后重试", zap.String("url", url), zap.String("event", e.Type), zap.Int("attempt", i+1), zap.Error(err))
+		select {
+		case <-time.After(interval):
+		case <-d.ctx.Done():
+			d.dead(e, url, d.ctx.Err())
+			return
+		}
+		if interval *= 2; interval > maxWebhookInterval {
+			interval = maxWebhookInterval
+		}
+	}
+	d.dead(e, url, err)
+}
+
+// post 发送一次请求，响应状态码不是 2xx 时返回错误
+func (d *WebhookDispatcher) post(url, event string, body []byte) error {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, event)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(d.config.Secret, body))
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// 读完响应体以复用连接
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook 响应状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// dead 写入死信日志，url 为空时表示没有发送
+func (d *WebhookDispatcher) dead(e *WebhookEvent, url string, err error) {
+	d.deadLetter.Error("webhook",
+		zap.String("url", url),
+		zap.String("type", e.Type),
+		zap.Int64("user_id", e.UserID),
+		zap.String("user_name", e.UserName),
+		zap.String("actor", e.Actor),
+		zap.Time("timestamp", e.Time),
+		zap.Error(err),
+	)
+}
+
+// SignWebhook 用 secret 计算 body 的 HMAC-SHA256 签名，格式为 sha256=<hex>
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
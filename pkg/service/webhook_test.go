@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWebhookDispatcher(t *testing.T) {
+	var calls int32
+	received := make(chan WebhookEvent, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 第一次失败，重试后成功
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if got, want := r.Header.Get(WebhookSignatureHeader), SignWebhook("secret", body); got != want {
+			t.Errorf("expected signature %s, got %s", want, got)
+		}
+		if r.Header.Get(WebhookEventHeader) != models.AuditUserCreate {
+			t.Errorf("unexpected event header %s", r.Header.Get(WebhookEventHeader))
+		}
+		e := WebhookEvent{}
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Error(err)
+		}
+		received <- e
+	}))
+	defer srv.Close()
+
+	d := NewWebhookDispatcher(WebhookConfig{URLs: []string{srv.URL}, Secret: "secret", Timeout: time.Second, Retries: 2, RetryInterval: time.Millisecond, QueueSize: 10})
+	d.Start()
+	d.Send(&WebhookEvent{Type: models.AuditUserCreate, UserID: 2, UserName: "jdoe", Actor: "admin"})
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-received:
+		if e.Type != models.AuditUserCreate || e.UserID != 2 || e.UserName != "jdoe" || e.Actor != "admin" || e.Time.IsZero() {
+			t.Errorf("unexpected event %+v", e)
+		}
+	default:
+		t.Fatal("expected the event to be delivered after a retry")
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls)
+	}
+
+	// 关闭后不再发送
+	d.Send(&WebhookEvent{Type: models.AuditUserDelete})
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	core, logs := observer.New(zapcore.ErrorLevel)
+	d := NewWebhookDispatcher(WebhookConfig{URLs: []string{srv.URL}, Secret: "secret", Timeout: time.Second, Retries: 2, RetryInterval: time.Millisecond, QueueSize: 10})
+	d.deadLetter = zap.New(core)
+	d.Start()
+	d.Send(&WebhookEvent{Type: models.AuditLoginLocal, UserID: 3, Actor: "jdoe"})
+	if err := d.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 1 attempt and 2 retries, got %d", calls)
+	}
+	if logs.Len() != 1 || logs.All()[0].ContextMap()["actor"] != "jdoe" {
+		t.Errorf("expected the event in the dead letter log, got %v", logs.All())
+	}
+
+	// 没有配置地址时不发送
+	disabled := NewWebhookDispatcher(WebhookConfig{})
+	disabled.Start()
+	disabled.Send(&WebhookEvent{Type: models.AuditUserCreate})
+	if err := disabled.Close(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,26 +1,131 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
 	"path"
 	"strings"
 
 	"gitee.com/golden-go/golden-go/pkg/utils/base_dir"
 	"gitee.com/golden-go/golden-go/pkg/utils/ldap"
 	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	"gitee.com/golden-go/golden-go/pkg/utils/oidc"
 	"github.com/mitchellh/go-homedir"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
 func init() {
+	setDefaults()
+}
+
+// setDefaults 设置所有配置的默认值
+func setDefaults() {
+	//日志级别 debug info warn error，为空时按环境设置，修改配置文件后立即生效
+	viper.SetDefault("log.level", "")
+	//日志采样 每秒内相同的日志先输出 initial 条，之后每 thereafter 条输出一条，initial 为 0 时不采样，error 日志不采样
+	viper.SetDefault("log.sampling.initial", 0)
+	viper.SetDefault("log.sampling.thereafter", 100)
+	//启动时在 debug 级别输出生效的配置，匹配其中任意一个的配置值会被隐藏，不区分大小写，
+	//没有 "." 时匹配包含它的最后一级配置名，有 "." 时匹配以它结尾的完整配置名，DSN 和 URL 中的密码总是隐藏
+	viper.SetDefault("log.redact_keys", []string{"password", "secret", "privatekey", "private_key", "client_key", "token", "credential", "goldengo.password.key"})
 	// 16为密码加密
 	viper.SetDefault("goldengo.password.key", "KY9ciRr1Q7sOgjVV")
+	//密码哈希算法 bcrypt argon2id，登录时旧的哈希会按新的算法和参数重新哈希
+	viper.SetDefault("password.algorithm", "bcrypt")
+	viper.SetDefault("password.bcrypt_cost", 10)
+	//argon2id 参数 memory 单位KiB
+	viper.SetDefault("password.argon2.time", 1)
+	viper.SetDefault("password.argon2.memory", 64*1024)
+	viper.SetDefault("password.argon2.threads", 4)
+	viper.SetDefault("password.argon2.key_len", 32)
+	viper.SetDefault("password.argon2.salt_len", 16)
+	//超级管理员 不存在时创建，已存在时不修改密码，update_role 为 true 时更新角色
+	viper.SetDefault("admin.username", "admin")
+	viper.SetDefault("admin.display_name", "Admin")
+	viper.SetDefault("admin.role", "")
+	viper.SetDefault("admin.update_role", false)
+	//超级管理员初始密码 可以使用环境变量 GOLDENGO_ADMIN_PASSWORD 设置，没有默认值，
+	//超级管理员不存在时必须配置，否则拒绝启动
+	viper.SetDefault("admin.password", "")
+	//登录用户名规范化 总是去掉前后空白，lowercase:转换为小写 strip_domain:去掉 UPN 后缀 @domain
+	viper.SetDefault("auth.normalize.lowercase", false)
+	viper.SetDefault("auth.normalize.strip_domain", false)
+	//本地登录连续失败 max_attempts 次后锁定账号 duration，只统计 window 内的失败，max_attempts 为 0 时不锁定
+	viper.SetDefault("auth.lockout.max_attempts", 5)
+	viper.SetDefault("auth.lockout.window", "15m")
+	viper.SetDefault("auth.lockout.duration", "15m")
+	//审计日志 记录用户的创建、修改、删除和登录，sink 为 db file log，为空时不记录，db 需要执行迁移创建 audit_logs 表
+	viper.SetDefault("audit.sink", "")
+	//sink 为 file 时写入 dir 下的 audit.log，when 为文件切分 H 每小时 D 每天
+	viper.SetDefault("audit.file.dir", "./logs")
+	viper.SetDefault("audit.file.when", "D")
+	//用户创建、修改、删除和登录成功后异步发送 webhook，urls 为空时不发送，请求体用 secret 做 HMAC-SHA256 签名
+	viper.SetDefault("webhook.urls", []string{})
+	viper.SetDefault("webhook.secret", "")
+	//单次请求的超时时间，失败后重试 retries 次，间隔从 retry_interval 开始逐次翻倍，仍然失败时写入死信日志
+	viper.SetDefault("webhook.timeout", "5s")
+	viper.SetDefault("webhook.retries", 3)
+	viper.SetDefault("webhook.retry_interval", "1s")
+	//等待发送的事件数，队列满时丢弃并写入死信日志
+	viper.SetDefault("webhook.queue_size", 1000)
 	// mysql连接url
 	viper.SetDefault("mysql.dsn", "golden_go:golden_go123@tcp(127.0.0.1:3306)/golden_go?charset=utf8&parseTime=True&loc=Local")
+	//mysql从库连接url 配置后查询使用从库
+	viper.SetDefault("mysql.replicas", []string{})
+	//mysql连接池 最大连接数、最大空闲连接数、连接最长使用时间
+	viper.SetDefault("mysql.max_open_conns", 100)
+	viper.SetDefault("mysql.max_idle_conns", 10)
+	viper.SetDefault("mysql.conn_max_lifetime", "30m")
+	//启动时mysql连接失败的重试次数和间隔
+	viper.SetDefault("mysql.ping_retries", 10)
+	viper.SetDefault("mysql.ping_interval", "3s")
+	//一个请求中数据库操作的超时时间，超时后取消查询，0 表示不超时
+	viper.SetDefault("mysql.query_timeout", "30s")
 	//监听地址
-	viper.SetDefault("listen", ":8080")
+	viper.SetDefault("listen.addr", ":8080")
+	//优雅关闭时等待请求处理完成的时间
+	viper.SetDefault("listen.shutdown_timeout", "5s")
+	//HTTP 服务的超时时间，0 表示不超时
+	viper.SetDefault("listen.timeouts.read", "0s")
+	viper.SetDefault("listen.timeouts.read_header", "10s")
+	viper.SetDefault("listen.timeouts.write", "0s")
+	viper.SetDefault("listen.timeouts.idle", "120s")
+	//HTTPS 证书和私钥文件，都配置时使用 HTTPS 监听
+	viper.SetDefault("listen.tls.cert_file", "")
+	viper.SetDefault("listen.tls.key_file", "")
+	//校验客户端证书（mTLS）的 CA 证书文件，client_auth 为 verify_if_given:提供证书时校验 require:必须提供证书
+	viper.SetDefault("listen.tls.client_ca_file", "")
+	viper.SetDefault("listen.tls.client_auth", "")
+	//同时监听的多个地址，每个可以单独配置证书：[{addr, cert_file, key_file, client_ca_file, client_auth}]，
+	//配置后忽略 listen.addr 和 listen.tls
+	viper.SetDefault("listen.listeners", []map[string]interface{}{})
 	//jwt token失效时间 单位分钟
 	viper.SetDefault("jwt.exp", 60)
+	//refresh token失效时间 单位分钟
+	viper.SetDefault("jwt.refresh_exp", 7*24*60)
+	//jwt 签名算法 RS256/RS384/RS512 EdDSA HS256/HS384/HS512
+	viper.SetDefault("jwt.alg", "RS512")
+	//HS256/HS384/HS512 使用的密钥
+	viper.SetDefault("jwt.secret", "")
+	//签发 token 的 iss，配置后只接受 iss 相同的 token
+	viper.SetDefault("jwt.issuer", "")
+	//接受的 aud 列表，token 的 aud 包含其中任意一个即可，签发的 token 的 aud 为全部，为空时不校验
+	viper.SetDefault("jwt.audience", []string{})
+	//校验 exp nbf iat 时允许的时钟偏差
+	viper.SetDefault("jwt.leeway", "60s")
+	//登录后把 token 设置到 HttpOnly cookie，请求头和 cookie 都有 token 时以请求头为准，
+	//默认开启，只使用 Authorization 请求头的部署可以关闭
+	viper.SetDefault("jwt.cookie.enable", true)
+	viper.SetDefault("jwt.cookie.name", "golden_key")
+	viper.SetDefault("jwt.cookie.domain", "")
+	viper.SetDefault("jwt.cookie.path", "/")
+	//只在 HTTPS 下发送 cookie，默认开启，本地使用 HTTP 开发调试时需要显式设置为 false
+	viper.SetDefault("jwt.cookie.secure", true)
+	//lax strict none，none 需要开启 secure
+	viper.SetDefault("jwt.cookie.same_site", "lax")
 	//默认公钥
 	viper.SetDefault("jwt.publicKey", `-----BEGIN PUBLIC KEY-----
 MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAsTlzGXqZPhXiVaDnq4ks
@@ -61,10 +166,129 @@ e2gKBcM0f+h06uDwbveyUlxgnd6p4i0D69Kg6IiPcgZJWSZ0BvoZ7+MI/ZGLPdx5
 qdxS6V5MFi8tWrhRHCo0jGA=
 -----END PRIVATE KEY-----
 `)
+	//接口的前缀，legacy_routes:同时注册拼写错误的旧前缀 /api/goldden-go 下的接口，已废弃，请求时输出警告日志
+	viper.SetDefault("http.base_path", "/api/golden-go")
+	viper.SetDefault("http.legacy_routes", true)
+	//请求体最大字节数，超过时返回 413，0 为不限制
+	viper.SetDefault("http.max_body_bytes", 1<<20)
+	//可信代理的 CIDR 或 IP，直接连接的地址是可信代理时从 X-Forwarded-For X-Real-IP 获取客户端 IP，默认不信任任何代理
+	viper.SetDefault("http.trusted_proxies", []string{})
+	//安全响应头，值为空时不设置对应的响应头，hsts 只在 HTTPS 请求中设置
+	viper.SetDefault("http.security_headers.enable", true)
+	viper.SetDefault("http.security_headers.content_type_options", "nosniff")
+	viper.SetDefault("http.security_headers.frame_options", "DENY")
+	viper.SetDefault("http.security_headers.referrer_policy", "no-referrer")
+	viper.SetDefault("http.security_headers.content_security_policy", "default-src 'none'; frame-ancestors 'none'")
+	viper.SetDefault("http.security_headers.swagger_content_security_policy", "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:")
+	viper.SetDefault("http.security_headers.hsts.enable", true)
+	viper.SetDefault("http.security_headers.hsts.max_age", "8760h")
+	viper.SetDefault("http.security_headers.hsts.include_subdomains", false)
+	viper.SetDefault("http.security_headers.hsts.preload", false)
+	//跨域配置
+	viper.SetDefault("http.cors.enable", false)
+	viper.SetDefault("http.cors.allow_origins", []string{"*"})
+	viper.SetDefault("http.cors.max_age", "12h")
+	//限流配置 rate:每秒请求数 burst:突发请求数
+	viper.SetDefault("http.ratelimit.enable", false)
+	viper.SetDefault("http.ratelimit.rate", 10)
+	viper.SetDefault("http.ratelimit.burst", 20)
+	//并发限制 max_concurrent:同时处理的最大请求数，0 表示不限制 max_queued:最多等待的请求数
+	//queue_timeout:最长等待时间，等待队列满或超时返回 503
+	viper.SetDefault("http.max_concurrent", 0)
+	viper.SetDefault("http.max_queued", 100)
+	viper.SetDefault("http.queue_timeout", "5s")
+	//开启 Prometheus 指标和 /metrics 接口
+	viper.SetDefault("http.metrics.enable", false)
+	//开启 /swagger/*any 接口文档，生产环境不要开启
+	viper.SetDefault("http.swagger.enable", false)
+	//开启 /debug/pprof/* 性能分析接口，仅超级管理员可用
+	viper.SetDefault("debug.pprof", false)
+	//用户搜索单页最大条数
+	viper.SetDefault("user.search.max_page_size", 100)
 	viper.SetDefault("auth.ldap.enable", false)
 	viper.SetDefault("auth.ldap.servers", []*ldap.ServerConfig{})
+	//LDAP服务不可用时是否拒绝启动，false 时以降级模式启动，本地登录照常使用
+	viper.SetDefault("auth.ldap.required", true)
+	//多个LDAP服务的尝试顺序 sequential:按配置顺序 round_robin:轮询
+	viper.SetDefault("auth.ldap.order", string(ldap.OrderSequential))
+	//创建LDAP服务时连接失败的重试次数和初始间隔，间隔每次翻倍，最长 30s
+	viper.SetDefault("auth.ldap.ping_retries", 5)
+	viper.SetDefault("auth.ldap.ping_interval", "1s")
+	//OIDC登录 issuer_url:身份提供方地址 redirect_url:回调接口 /login/oidc/callback 的完整地址
+	viper.SetDefault("auth.oidc.enable", false)
+	viper.SetDefault("auth.oidc.issuer_url", "")
+	viper.SetDefault("auth.oidc.client_id", "")
+	viper.SetDefault("auth.oidc.client_secret", "")
+	viper.SetDefault("auth.oidc.redirect_url", "")
+	viper.SetDefault("auth.oidc.scopes", oidc.DefaultScopes)
+	//作为用户名和用户组的 claim
+	viper.SetDefault("auth.oidc.username_claim", oidc.DefaultUsernameClaim)
+	viper.SetDefault("auth.oidc.groups_claim", oidc.DefaultGroupsClaim)
+	//客户端证书对应的身份 [{subject, name, roles, super_admin}]，subject 匹配证书的 CN 或完整 Subject，
+	//携带匹配的证书的请求不校验 token
+	viper.SetDefault("auth.mtls.identities", []map[string]interface{}{})
+}
+
+// ListenAddr 返回监听地址，兼容旧的 listen: ":8080" 写法
+func ListenAddr() string {
+	if addr, ok := viper.Get("listen").(string); ok && addr != "" {
+		return addr
+	}
+	return viper.GetString("listen.addr")
+}
+
+// EnvPrefix 环境变量前缀，配置 mysql.dsn 对应环境变量 GOLDENGO_MYSQL_DSN
+const EnvPrefix = "GOLDENGO"
+
+// setupEnv 所有配置都可以使用环境变量覆盖，优先级：命令行参数 > 环境变量 > 配置文件 > 默认值
+func setupEnv() {
+	viper.SetEnvPrefix(EnvPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+}
+
+// UnmarshalKey 和 viper.UnmarshalKey 一样，但子配置也会被环境变量覆盖。
+// 值是 JSON 字符串时按 JSON 解析，例如 GOLDENGO_AUTH_LDAP_SERVERS='[{"host":"ldap.example.com"}]'
+func UnmarshalKey(key string, rawVal interface{}, opts ...viper.DecoderConfigOption) error {
+	if s, ok := viper.Get(key).(string); ok {
+		if s = strings.TrimSpace(s); strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{") {
+			return json.Unmarshal([]byte(s), rawVal)
+		}
+	}
+	sub := viper.New()
+	prefix := key + "."
+	for _, k := range viper.AllKeys() {
+		if strings.HasPrefix(k, prefix) {
+			sub.Set(strings.TrimPrefix(k, prefix), viper.Get(k))
+		}
+	}
+	if len(sub.AllKeys()) == 0 {
+		return viper.UnmarshalKey(key, rawVal, opts...)
+	}
+	return sub.Unmarshal(rawVal, opts...)
+}
+
+// jsonTags 按 json 标签解析，ldap.ServerConfig 只有 json 标签
+func jsonTags(dc *mapstructure.DecoderConfig) {
+	dc.TagName = "json"
 }
 
+// LDAPServers 返回 auth.ldap.servers 配置的 LDAP 服务，
+// 绑定密码可以单独用环境变量设置，例如 GOLDENGO_AUTH_LDAP_SERVERS_0_BIND_PASSWORD
+func LDAPServers() ([]*ldap.ServerConfig, error) {
+	sc := []*ldap.ServerConfig{}
+	if err := UnmarshalKey("auth.ldap.servers", &sc, jsonTags); err != nil {
+		return nil, err
+	}
+	for i, c := range sc {
+		if pw, ok := os.LookupEnv(fmt.Sprintf("%s_AUTH_LDAP_SERVERS_%d_BIND_PASSWORD", EnvPrefix, i)); ok {
+			c.BindPassword = pw
+		}
+	}
+	return sc, nil
+}
+
+// InitConfig 读取配置文件，配置文件不存在时只使用环境变量和默认值
 func InitConfig(cfgFile, configNmae string) error {
 	if cfgFile != "" {
 		viper.SetConfigFile(cfgFile)
@@ -88,11 +312,13 @@ func InitConfig(cfgFile, configNmae string) error {
 
 	}
 
-	viper.AutomaticEnv()
+	setupEnv()
 	if err := viper.ReadInConfig(); err == nil {
 		logger.Info("Using config file:" + viper.ConfigFileUsed())
+		watchConfig()
 	} else {
 		logger.Warn("read in config", zap.Error(err))
 	}
+	applyLogLevel()
 	return nil
 }
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestUnmarshalKeyEnv(t *testing.T) {
+	defer viper.Reset()
+	setupEnv()
+	viper.SetDefault("mysql.dsn", "file")
+	viper.SetDefault("mysql.conn_max_lifetime", "30m")
+	os.Setenv("GOLDENGO_MYSQL_DSN", "env")
+	os.Setenv("GOLDENGO_MYSQL_CONN_MAX_LIFETIME", "1h")
+	defer os.Unsetenv("GOLDENGO_MYSQL_DSN")
+	defer os.Unsetenv("GOLDENGO_MYSQL_CONN_MAX_LIFETIME")
+
+	var c struct {
+		DSN             string        `mapstructure:"dsn"`
+		ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	}
+	if err := UnmarshalKey("mysql", &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.DSN != "env" || c.ConnMaxLifetime != time.Hour {
+		t.Errorf("expected the env values, got %+v", c)
+	}
+}
+
+func TestUnmarshalKeyJSON(t *testing.T) {
+	defer viper.Reset()
+	setupEnv()
+	viper.SetDefault("auth.ldap.servers", []interface{}{})
+	os.Setenv("GOLDENGO_AUTH_LDAP_SERVERS", `[{"host":"ldap.example.com","bind_password":"secret"}]`)
+	defer os.Unsetenv("GOLDENGO_AUTH_LDAP_SERVERS")
+
+	var servers []struct {
+		Host         string `json:"host"`
+		BindPassword string `json:"bind_password"`
+	}
+	if err := UnmarshalKey("auth.ldap.servers", &servers); err != nil {
+		t.Fatal(err)
+	}
+	if len(servers) != 1 || servers[0].Host != "ldap.example.com" || servers[0].BindPassword != "secret" {
+		t.Errorf("unexpected servers %+v", servers)
+	}
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Redacted 隐藏后的配置值
+const Redacted = "******"
+
+// dsnCredentials 匹配 DSN 和 URL 中的 user:password@，只隐藏密码
+var dsnCredentials = regexp.MustCompile(`([^\s:/@]+):[^\s@/]*@`)
+
+// DumpEffective 在 debug 级别输出合并命令行参数、环境变量、配置文件和默认值之后生效的配置，
+// 按 log.redact_keys 隐藏密钥等配置的值，DSN 和 URL 中的密码也会被隐藏
+func DumpEffective() {
+	logger.Debug("生效的配置", zap.Any("config", Effective(viper.GetStringSlice("log.redact_keys"))))
+}
+
+// Effective 返回生效的配置，匹配 patterns 中任意一个的配置值替换为 Redacted。
+// 不区分大小写，没有 "." 的 pattern 匹配包含它的最后一级配置名，例如 password 匹配 admin.password
+// 和 auth.ldap.servers 中的 bind_password，但不匹配 password.algorithm；
+// 有 "." 的 pattern 匹配以它结尾的完整配置名，例如 goldengo.password.key
+func Effective(patterns []string) map[string]interface{} {
+	lower := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			lower = append(lower, p)
+		}
+	}
+	return redactMap(viper.AllSettings(), "", lower)
+}
+
+func redactMap(m map[string]interface{}, prefix string, patterns []string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		key := prefix + k
+		switch v.(type) {
+		case map[string]interface{}, map[interface{}]interface{}:
+		default:
+			if secretKey(key, patterns) {
+				out[k] = Redacted
+				continue
+			}
+		}
+		out[k] = redactValue(v, key+".", patterns)
+	}
+	return out
+}
+
+// redactValue 隐藏嵌套的配置，例如 auth.ldap.servers 中每个服务的 bind_password
+func redactValue(v interface{}, prefix string, patterns []string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return redactMap(v, prefix, patterns)
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = e
+		}
+		return redactMap(m, prefix, patterns)
+	case []map[string]interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = redactMap(e, prefix, patterns)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = redactValue(e, prefix, patterns)
+		}
+		return out
+	case []string:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = redactString(e, prefix, patterns)
+		}
+		return out
+	case string:
+		return redactString(v, prefix, patterns)
+	}
+	return v
+}
+
+// redactString 隐藏 DSN 和 URL 中的密码，环境变量设置的 JSON 配置按解析后的结构隐藏
+func redactString(s, prefix string, patterns []string) interface{} {
+	if t := strings.TrimSpace(s); strings.HasPrefix(t, "[") || strings.HasPrefix(t, "{") {
+		var v interface{}
+		if err := json.Unmarshal([]byte(t), &v); err == nil {
+			return redactValue(v, prefix, patterns)
+		}
+	}
+	return dsnCredentials.ReplaceAllString(s, "${1}:"+Redacted+"@")
+}
+
+// secretKey 完整配置名 key 是否匹配 patterns
+func secretKey(key string, patterns []string) bool {
+	key = strings.ToLower(key)
+	name := key[strings.LastIndex(key, ".")+1:]
+	for _, p := range patterns {
+		if strings.Contains(p, ".") {
+			if key == p || strings.HasSuffix(key, "."+p) {
+				return true
+			}
+		} else if strings.Contains(name, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestEffective(t *testing.T) {
+	defer viper.Reset()
+	setupEnv()
+	setDefaults()
+	viper.Set("admin.password", "hunter2")
+	viper.Set("jwt.secret", "hs-secret")
+	viper.Set("auth.ldap.servers", []interface{}{
+		map[string]interface{}{"host": "ldap.example.com", "bind_password": "ldap-secret"},
+	})
+	os.Setenv("GOLDENGO_MYSQL_DSN", "golden_go:db-secret@tcp(127.0.0.1:3306)/golden_go")
+	defer os.Unsetenv("GOLDENGO_MYSQL_DSN")
+
+	bs, err := json.Marshal(Effective(viper.GetStringSlice("log.redact_keys")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dump := string(bs)
+	for _, secret := range []string{"hunter2", "hs-secret", "ldap-secret", "db-secret", "PRIVATE KEY-----", viper.GetString("goldengo.password.key")} {
+		if strings.Contains(dump, secret) {
+			t.Errorf("expected %s to be redacted in %s", secret, dump)
+		}
+	}
+	// 其它配置照常输出，包括环境变量覆盖的值
+	for _, want := range []string{`"host":"ldap.example.com"`, `"dsn":"golden_go:******@tcp(127.0.0.1:3306)/golden_go"`, `"algorithm":"bcrypt"`, `"addr":":8080"`} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("expected %s in %s", want, dump)
+		}
+	}
+}
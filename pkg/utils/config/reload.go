@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// RestartKeys 修改后需要重启才能生效的配置
+var RestartKeys = []string{
+	"listen",
+	"log.sampling",
+	"mysql",
+	"jwt",
+	"admin",
+	"password",
+	"http.base_path",
+	"http.legacy_routes",
+	"http.max_body_bytes",
+	"http.trusted_proxies",
+	"http.security_headers",
+	"http.cors",
+	"http.metrics.enable",
+	"http.swagger.enable",
+	"debug.pprof",
+	"http.ratelimit.enable",
+	"http.max_concurrent",
+	"http.max_queued",
+	"http.queue_timeout",
+	"auth.ldap.enable",
+	"auth.ldap.required",
+	"auth.oidc",
+	"auth.mtls",
+	"audit",
+	"webhook",
+}
+
+var (
+	reloadMu  sync.Mutex
+	reloadFns []func()
+	// restartValues 启动时 RestartKeys 的值
+	restartValues map[string]interface{}
+)
+
+// OnReload 注册配置文件修改后的回调，回调中重新读取 viper 的配置
+func OnReload(fn func()) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadFns = append(reloadFns, fn)
+}
+
+// watchConfig 监听配置文件，修改后重新加载
+func watchConfig() {
+	restartValues = restartSnapshot()
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		logger.Info("配置文件已修改，重新加载", zap.String("file", e.Name))
+		reload()
+	})
+	viper.WatchConfig()
+}
+
+// ErrNoConfigFile 启动时没有使用配置文件，没有可以重新读取的配置
+var ErrNoConfigFile = errors.New("没有使用配置文件，只使用环境变量和默认值时不能重新加载")
+
+// ReloadResult 重新加载配置的结果
+type ReloadResult struct {
+	Applied         []string `json:"applied"`          //已修改并重新应用的配置
+	RestartRequired []string `json:"restart_required"` //和启动时不同、需要重启才能生效的配置，为 RestartKeys 中的配置
+}
+
+// Reload 重新读取配置文件，重新应用可以热加载的配置并调用 OnReload 注册的回调，
+// 用于配置文件挂载有延迟等监听不到修改的情况
+func Reload() (*ReloadResult, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if viper.ConfigFileUsed() == "" {
+		return nil, ErrNoConfigFile
+	}
+	if restartValues == nil {
+		restartValues = restartSnapshot()
+	}
+	before := settings()
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	after := settings()
+	result := &ReloadResult{Applied: []string{}, RestartRequired: applyReload()}
+	for key := range after {
+		if _, ok := before[key]; !ok {
+			before[key] = nil
+		}
+	}
+	for key, v := range before {
+		if !restartKey(key) && !reflect.DeepEqual(v, after[key]) {
+			result.Applied = append(result.Applied, key)
+		}
+	}
+	sort.Strings(result.Applied)
+	return result, nil
+}
+
+// reload 重新应用可以热加载的配置，并调用 OnReload 注册的回调
+func reload() {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	applyReload()
+}
+
+// applyReload 需要持有 reloadMu，返回和启动时不同、需要重启才能生效的配置
+func applyReload() []string {
+	restart := []string{}
+	for _, key := range RestartKeys {
+		if !reflect.DeepEqual(viper.Get(key), restartValues[key]) {
+			logger.Warn("配置修改后需要重启才能生效", zap.String("key", key))
+			restart = append(restart, key)
+		}
+	}
+	applyLogLevel()
+	for _, fn := range reloadFns {
+		fn()
+	}
+	return restart
+}
+
+// restartSnapshot 返回 RestartKeys 当前的值
+func restartSnapshot() map[string]interface{} {
+	values := map[string]interface{}{}
+	for _, key := range RestartKeys {
+		values[key] = viper.Get(key)
+	}
+	return values
+}
+
+// settings 返回所有配置当前的值
+func settings() map[string]interface{} {
+	values := map[string]interface{}{}
+	for _, key := range viper.AllKeys() {
+		values[key] = viper.Get(key)
+	}
+	return values
+}
+
+// restartKey key 是否是 RestartKeys 中的配置或其子配置
+func restartKey(key string) bool {
+	for _, rk := range RestartKeys {
+		if key == rk || strings.HasPrefix(key, rk+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// applyLogLevel 设置配置的日志级别，没有配置时使用环境的默认级别
+func applyLogLevel() {
+	level := viper.GetString("log.level")
+	if level == "" {
+		return
+	}
+	if err := logger.SetLevel(level); err != nil {
+		logger.Warn("日志级别配置错误", zap.String("level", level), zap.Error(err))
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	zl "gitee.com/golden-go/golden-go/pkg/utils/zap_logger"
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestReload(t *testing.T) {
+	defer viper.Reset()
+	restartValues = map[string]interface{}{}
+	called := 0
+	OnReload(func() { called++ })
+
+	viper.Set("log.level", "warn")
+	reload()
+	if called != 1 {
+		t.Errorf("expected the callback to be called once, got %d", called)
+	}
+	if zl.Level.Level() != zapcore.WarnLevel {
+		t.Errorf("expected level warn, got %s", zl.Level.Level())
+	}
+}
+
+func TestReloadFile(t *testing.T) {
+	defer viper.Reset()
+	restartValues = nil
+	if _, err := Reload(); err != ErrNoConfigFile {
+		t.Errorf("expected ErrNoConfigFile, got %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "golden_go.yaml")
+	if err := ioutil.WriteFile(file, []byte("log:\n  level: info\nmysql:\n  dsn: first\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(file)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte("log:\n  level: error\nmysql:\n  dsn: second\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	result, err := Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Applied, []string{"log.level"}) || !reflect.DeepEqual(result.RestartRequired, []string{"mysql"}) {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if zl.Level.Level() != zapcore.ErrorLevel {
+		t.Errorf("expected level error, got %s", zl.Level.Level())
+	}
+}
@@ -0,0 +1,268 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
+	"gitee.com/golden-go/golden-go/pkg/utils/jwt"
+	"gitee.com/golden-go/golden-go/pkg/utils/ldap"
+	"gitee.com/golden-go/golden-go/pkg/utils/oidc"
+	"github.com/spf13/viper"
+	"go.uber.org/multierr"
+	"go.uber.org/zap/zapcore"
+)
+
+// JwtConfig jwt 配置
+type JwtConfig struct {
+	Alg        string   `mapstructure:"alg"`
+	Exp        int      `mapstructure:"exp"`
+	RefreshExp int      `mapstructure:"refresh_exp"`
+	Secret     string   `mapstructure:"secret"`
+	PublicKey  string   `mapstructure:"publickey"`
+	PrivateKey string   `mapstructure:"privatekey"`
+	Audience   []string `mapstructure:"audience"`
+}
+
+// MysqlConfig mysql 配置，连接池配置见 db.PoolConfig
+type MysqlConfig struct {
+	DSN          string   `mapstructure:"dsn"`
+	Replicas     []string `mapstructure:"replicas"`
+	MaxOpenConns int      `mapstructure:"max_open_conns"`
+	MaxIdleConns int      `mapstructure:"max_idle_conns"`
+	PingRetries  int      `mapstructure:"ping_retries"`
+}
+
+// hmacKeyLen HS256/HS384/HS512 密钥的最小长度，和 jwt 包一致
+const hmacKeyLen = 32
+
+// Validate 检查配置的必填项、取值范围和互斥的选项，返回所有问题合并后的错误
+func Validate() (err error) {
+	fail := func(format string, args ...interface{}) {
+		err = multierr.Append(err, fmt.Errorf(format, args...))
+	}
+
+	jc := JwtConfig{}
+	if e := UnmarshalKey("jwt", &jc); e != nil {
+		fail("jwt: %v", e)
+	}
+	if jc.Exp <= 0 {
+		fail("jwt.exp 必须大于 0")
+	}
+	if jc.RefreshExp <= 0 {
+		fail("jwt.refresh_exp 必须大于 0")
+	}
+	if viper.GetDuration("jwt.leeway") < 0 {
+		fail("jwt.leeway 不能小于 0")
+	}
+	for i, aud := range jc.Audience {
+		if aud == "" {
+			fail("jwt.audience[%d] 不能为空", i)
+		}
+	}
+	switch jc.Alg {
+	case "HS256", "HS384", "HS512":
+		if len(jc.Secret) < hmacKeyLen {
+			fail("jwt.alg 为 %s 时 jwt.secret 至少需要 %d 字节", jc.Alg, hmacKeyLen)
+		}
+	case "", "RS256", "RS384", "RS512", "EdDSA":
+		if strings.TrimSpace(jc.PublicKey) == "" {
+			fail("jwt.publicKey 不能为空")
+		}
+		if strings.TrimSpace(jc.PrivateKey) == "" {
+			fail("jwt.privateKey 不能为空")
+		}
+	default:
+		fail("jwt.alg 不支持的签名算法：%s", jc.Alg)
+	}
+
+	if ss := viper.GetString("jwt.cookie.same_site"); ss != "" {
+		if sameSite, e := jwt.ParseSameSite(ss); e != nil {
+			fail("jwt.cookie.same_site: %v", e)
+		} else if sameSite == http.SameSiteNoneMode && !viper.GetBool("jwt.cookie.secure") {
+			fail("jwt.cookie.same_site 为 none 时需要开启 jwt.cookie.secure")
+		}
+	}
+
+	mc := MysqlConfig{}
+	if e := UnmarshalKey("mysql", &mc); e != nil {
+		fail("mysql: %v", e)
+	}
+	if mc.DSN == "" {
+		fail("mysql.dsn 不能为空")
+	}
+	if mc.MaxOpenConns < 0 || mc.MaxIdleConns < 0 || mc.PingRetries < 0 {
+		fail("mysql.max_open_conns、max_idle_conns、ping_retries 不能小于 0")
+	}
+	if mc.MaxOpenConns > 0 && mc.MaxIdleConns > mc.MaxOpenConns {
+		fail("mysql.max_idle_conns 不能大于 mysql.max_open_conns")
+	}
+	if viper.GetDuration("mysql.query_timeout") < 0 {
+		fail("mysql.query_timeout 不能小于 0")
+	}
+
+	if ListenAddr() == "" {
+		fail("listen.addr 不能为空")
+	}
+	if (viper.GetString("listen.tls.cert_file") == "") != (viper.GetString("listen.tls.key_file") == "") {
+		fail("listen.tls.cert_file 和 listen.tls.key_file 需要同时配置")
+	}
+	// client_auth 的取值见 http_server.ClientAuthType
+	validateClientAuth := func(prefix, certFile, caFile, auth string) {
+		switch auth {
+		case "", "verify_if_given", "require":
+		default:
+			fail("%s.client_auth 不支持 %s，可选值为 verify_if_given require", prefix, auth)
+		}
+		if (caFile == "") != (auth == "") {
+			fail("%s.client_ca_file 和 client_auth 需要同时配置", prefix)
+		}
+		if caFile != "" && certFile == "" {
+			fail("%s.client_ca_file 需要使用 HTTPS，同时配置 cert_file 和 key_file", prefix)
+		}
+	}
+	validateClientAuth("listen.tls", viper.GetString("listen.tls.cert_file"), viper.GetString("listen.tls.client_ca_file"), viper.GetString("listen.tls.client_auth"))
+	var listeners []struct {
+		Addr         string `mapstructure:"addr"`
+		CertFile     string `mapstructure:"cert_file"`
+		KeyFile      string `mapstructure:"key_file"`
+		ClientCAFile string `mapstructure:"client_ca_file"`
+		ClientAuth   string `mapstructure:"client_auth"`
+	}
+	if e := UnmarshalKey("listen.listeners", &listeners); e != nil {
+		fail("listen.listeners: %v", e)
+	}
+	addrs := map[string]bool{}
+	for i, l := range listeners {
+		if l.Addr == "" {
+			fail("listen.listeners[%d].addr 不能为空", i)
+		} else if addrs[l.Addr] {
+			fail("listen.listeners[%d].addr %s 重复", i, l.Addr)
+		}
+		addrs[l.Addr] = true
+		if (l.CertFile == "") != (l.KeyFile == "") {
+			fail("listen.listeners[%d].cert_file 和 key_file 需要同时配置", i)
+		}
+		validateClientAuth(fmt.Sprintf("listen.listeners[%d]", i), l.CertFile, l.ClientCAFile, l.ClientAuth)
+	}
+	if level := viper.GetString("log.level"); level != "" {
+		var l zapcore.Level
+		if e := l.UnmarshalText([]byte(level)); e != nil {
+			fail("log.level: %v", e)
+		}
+	}
+	if viper.GetInt("log.sampling.initial") < 0 || viper.GetInt("log.sampling.thereafter") < 0 {
+		fail("log.sampling.initial 和 log.sampling.thereafter 不能小于 0")
+	}
+	switch a := viper.GetString("password.algorithm"); a {
+	case "bcrypt":
+	case "argon2id":
+		// argon2.IDKey 在 time 或 threads 为 0 时会 panic
+		if viper.GetInt("password.argon2.time") < 1 || viper.GetInt("password.argon2.threads") < 1 {
+			fail("password.argon2.time 和 password.argon2.threads 不能小于 1")
+		}
+		if viper.GetInt("password.argon2.key_len") <= 0 || viper.GetInt("password.argon2.salt_len") <= 0 {
+			fail("password.argon2.key_len 和 password.argon2.salt_len 必须大于 0")
+		}
+	default:
+		fail("password.algorithm 不支持的哈希算法：%s", a)
+	}
+	if viper.GetInt("auth.lockout.max_attempts") < 0 {
+		fail("auth.lockout.max_attempts 不能小于 0")
+	}
+	switch sink := viper.GetString("audit.sink"); sink {
+	case "", "db", "log":
+	case "file":
+		if viper.GetString("audit.file.dir") == "" {
+			fail("audit.sink 为 file 时 audit.file.dir 不能为空")
+		}
+	default:
+		fail("audit.sink 不支持的存储方式：%s", sink)
+	}
+	if urls := viper.GetStringSlice("webhook.urls"); len(urls) > 0 {
+		for _, u := range urls {
+			if pu, e := url.Parse(u); e != nil || (pu.Scheme != "http" && pu.Scheme != "https") || pu.Host == "" {
+				fail("webhook.urls 不是合法的 http(s) 地址：%s", u)
+			}
+		}
+		if viper.GetString("webhook.secret") == "" {
+			fail("配置了 webhook.urls 时 webhook.secret 不能为空")
+		}
+		if viper.GetDuration("webhook.timeout") <= 0 || viper.GetDuration("webhook.retry_interval") < 0 {
+			fail("webhook.timeout 必须大于 0，webhook.retry_interval 不能小于 0")
+		}
+		if viper.GetInt("webhook.retries") < 0 || viper.GetInt("webhook.queue_size") < 1 {
+			fail("webhook.retries 不能小于 0，webhook.queue_size 必须大于 0")
+		}
+	}
+	if bp := viper.GetString("http.base_path"); !strings.HasPrefix(bp, "/") || (bp != "/" && strings.HasSuffix(bp, "/")) {
+		fail("http.base_path 必须以 / 开头，不能以 / 结尾：%s", bp)
+	}
+	if _, e := ghttp.NewClientIPResolver(viper.GetStringSlice("http.trusted_proxies")); e != nil {
+		fail("http.trusted_proxies: %v", e)
+	}
+	if viper.GetInt64("http.max_body_bytes") < 0 {
+		fail("http.max_body_bytes 不能小于 0")
+	}
+	if viper.GetBool("http.ratelimit.enable") && (viper.GetFloat64("http.ratelimit.rate") <= 0 || viper.GetInt("http.ratelimit.burst") <= 0) {
+		fail("http.ratelimit.rate 和 http.ratelimit.burst 必须大于 0")
+	}
+	if viper.GetInt("http.max_concurrent") < 0 || viper.GetInt("http.max_queued") < 0 || viper.GetDuration("http.queue_timeout") < 0 {
+		fail("http.max_concurrent http.max_queued 和 http.queue_timeout 不能小于 0")
+	}
+	// 允许所有来源时携带凭证，任意网站都能以当前用户的身份调用接口
+	if viper.GetBool("http.cors.enable") && viper.GetBool("http.cors.allow_credentials") {
+		for _, o := range viper.GetStringSlice("http.cors.allow_origins") {
+			if o == "*" {
+				fail("http.cors.allow_origins 为 * 时不能开启 http.cors.allow_credentials")
+			}
+		}
+	}
+
+	if viper.GetBool("auth.ldap.enable") {
+		sc, e := LDAPServers()
+		if e != nil {
+			fail("auth.ldap.servers: %v", e)
+		} else if len(sc) == 0 {
+			fail("auth.ldap.servers: %v", errors.New("至少需要配置一个 LDAP 服务"))
+		}
+		for i, c := range sc {
+			for _, e := range multierr.Errors(c.Validate()) {
+				fail("auth.ldap.servers[%d]: %v", i, e)
+			}
+		}
+		switch o := ldap.ServerOrder(viper.GetString("auth.ldap.order")); o {
+		case ldap.OrderSequential, ldap.OrderRoundRobin:
+		default:
+			fail("auth.ldap.order 不支持的顺序：%s", o)
+		}
+		if viper.GetInt("auth.ldap.ping_retries") < 0 || viper.GetDuration("auth.ldap.ping_interval") < 0 {
+			fail("auth.ldap.ping_retries 和 auth.ldap.ping_interval 不能小于 0")
+		}
+	}
+	if viper.GetBool("auth.oidc.enable") {
+		oc := oidc.Config{}
+		if e := UnmarshalKey("auth.oidc", &oc); e != nil {
+			fail("auth.oidc: %v", e)
+		} else if e := oc.Validate(); e != nil {
+			fail("auth.oidc: %v", e)
+		}
+	}
+	var ids []jwt.CertIdentity
+	if e := UnmarshalKey("auth.mtls.identities", &ids); e != nil {
+		fail("auth.mtls.identities: %v", e)
+	}
+	subjects := map[string]bool{}
+	for i, id := range ids {
+		if id.Subject == "" {
+			fail("auth.mtls.identities[%d].subject 不能为空", i)
+		} else if subjects[id.Subject] {
+			fail("auth.mtls.identities[%d].subject %s 重复", i, id.Subject)
+		}
+		subjects[id.Subject] = true
+	}
+	return err
+}
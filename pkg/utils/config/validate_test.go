@@ -0,0 +1,124 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"go.uber.org/multierr"
+)
+
+func TestValidateDefaults(t *testing.T) {
+	defer viper.Reset()
+	setDefaults()
+	if err := Validate(); err != nil {
+		t.Errorf("expected the defaults to be valid, got %v", err)
+	}
+	if !viper.GetBool("jwt.cookie.secure") {
+		t.Error("expected secure cookies by default")
+	}
+	if p := viper.GetString("admin.password"); p != "" {
+		t.Errorf("expected no default admin password, got %q", p)
+	}
+}
+
+func TestValidateAggregatesErrors(t *testing.T) {
+	defer viper.Reset()
+	setDefaults()
+	viper.Set("jwt.exp", -1)
+	viper.Set("jwt.privatekey", "")
+	viper.Set("mysql.dsn", "")
+	viper.Set("auth.ldap.enable", true)
+	viper.Set("auth.ldap.servers", []map[string]interface{}{
+		{"host": "ldap.example.com", "port": 636, "use_ssl": true, "start_tls": true, "search_base_dns": []string{"dc=example,dc=com"}, "search_filter": "(uid=%s)"},
+	})
+
+	err := Validate()
+	errs := multierr.Errors(err)
+	if len(errs) != 4 {
+		t.Fatalf("expected 4 errors, got %v", err)
+	}
+	for _, want := range []string{"jwt.exp", "jwt.privateKey", "mysql.dsn", "auth.ldap.servers[0]: use_ssl and start_tls"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestValidateListeners(t *testing.T) {
+	defer viper.Reset()
+	setDefaults()
+	viper.Set("listen.listeners", []map[string]interface{}{
+		{"addr": ":8080"},
+		{"addr": ":8443", "cert_file": "cert.pem"},
+		{"addr": ":8080"},
+	})
+
+	err := Validate()
+	if n := len(multierr.Errors(err)); n != 2 {
+		t.Fatalf("expected 2 errors, got %v", err)
+	}
+	for _, want := range []string{"listen.listeners[1].cert_file", "listen.listeners[2].addr"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestValidateClientAuth(t *testing.T) {
+	defer viper.Reset()
+	setDefaults()
+	viper.Set("listen.tls.client_ca_file", "ca.pem")
+	viper.Set("listen.tls.client_auth", "require")
+	viper.Set("listen.listeners", []map[string]interface{}{
+		{"addr": ":8443", "cert_file": "cert.pem", "key_file": "key.pem", "client_ca_file": "ca.pem", "client_auth": "always"},
+	})
+	viper.Set("auth.mtls.identities", []map[string]interface{}{{"subject": "billing"}, {"name": "ops"}})
+
+	err := Validate()
+	if n := len(multierr.Errors(err)); n != 3 {
+		t.Fatalf("expected 3 errors, got %v", err)
+	}
+	for _, want := range []string{"listen.tls.client_ca_file", "listen.listeners[0].client_auth", "auth.mtls.identities[1].subject"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestValidateArgon2(t *testing.T) {
+	defer viper.Reset()
+	setDefaults()
+	viper.Set("password.algorithm", "argon2id")
+	if err := Validate(); err != nil {
+		t.Fatalf("expected the default argon2 parameters to be valid, got %v", err)
+	}
+	viper.Set("password.argon2.time", 0)
+	viper.Set("password.argon2.salt_len", 0)
+
+	err := Validate()
+	if n := len(multierr.Errors(err)); n != 2 {
+		t.Fatalf("expected 2 errors, got %v", err)
+	}
+	for _, want := range []string{"password.argon2.time", "password.argon2.salt_len"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %v", want, err)
+		}
+	}
+}
+
+func TestValidateCORSCredentials(t *testing.T) {
+	defer viper.Reset()
+	setDefaults()
+	viper.Set("http.cors.enable", true)
+	viper.Set("http.cors.allow_credentials", true)
+
+	err := Validate()
+	if n := len(multierr.Errors(err)); n != 1 || !strings.Contains(err.Error(), "http.cors.allow_credentials") {
+		t.Fatalf("expected the * origin with credentials to be rejected, got %v", err)
+	}
+	viper.Set("http.cors.allow_origins", []string{"https://app.example.com"})
+	if err := Validate(); err != nil {
+		t.Errorf("expected explicit origins with credentials to be valid, got %v", err)
+	}
+}
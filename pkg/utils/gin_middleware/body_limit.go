@@ -0,0 +1,27 @@
+package gin_middleware
+
+import (
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
+	"github.com/gin-gonic/gin"
+)
+
+// GinMaxBodySize 限制请求体最多 n 字节，超过时返回 413，n 小于等于 0 时不限制。
+// Content-Length 超过限制时直接返回，否则读取超过限制时 handler 的响应改为 413
+func GinMaxBodySize(n int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if n <= 0 {
+			return
+		}
+		if c.Request.ContentLength > n {
+			ghttp.CommonBodyTooLargeResponse(c)
+			c.Abort()
+			return
+		}
+		ghttp.LimitBody(c, n)
+		c.Next()
+		// handler 读取请求体失败后没有响应
+		if ghttp.BodyTooLarge(c) && !c.Writer.Written() {
+			ghttp.CommonBodyTooLargeResponse(c)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package gin_middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGinMaxBodySize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(GinMaxBodySize(16))
+	g.POST("/bind", func(c *gin.Context) {
+		var v map[string]interface{}
+		if err := c.ShouldBindJSON(&v); err != nil {
+			ghttp.CommonValidationFailResponse(c, err)
+			return
+		}
+		ghttp.CommonSuccessResponse(c, v)
+	})
+	g.POST("/silent", func(c *gin.Context) {
+		if _, err := ioutil.ReadAll(c.Request.Body); err != nil {
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	for _, tc := range []struct {
+		path, body    string
+		contentLength bool
+		code          int
+	}{
+		{"/bind", `{"a":"b"}`, true, http.StatusOK},
+		{"/bind", `{"a":"` + strings.Repeat("b", 32) + `"}`, true, http.StatusRequestEntityTooLarge},
+		{"/bind", `{"a":"` + strings.Repeat("b", 32) + `"}`, false, http.StatusRequestEntityTooLarge},
+		{"/silent", strings.Repeat("b", 32), false, http.StatusRequestEntityTooLarge},
+		{"/silent", strings.Repeat("b", 16), false, http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+		if !tc.contentLength {
+			req.ContentLength = -1
+		}
+		g.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%s %d bytes: expected %d, got %d %s", tc.path, len(tc.body), tc.code, w.Code, w.Body)
+		}
+		if tc.code == http.StatusRequestEntityTooLarge && !strings.Contains(w.Body.String(), `"code":41300`) {
+			t.Errorf("%s %d bytes: expected the 413 envelope, got %s", tc.path, len(tc.body), w.Body)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package gin_middleware
+
+import (
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
+	"github.com/gin-gonic/gin"
+)
+
+// GinClientIP 使用 r 解析客户端 IP，之后通过 ghttp.ClientIP 获取，需要在其他使用客户端 IP 的中间件之前
+func GinClientIP(r *ghttp.ClientIPResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ghttp.SetClientIP(c, r.ClientIP(c.Request))
+	}
+}
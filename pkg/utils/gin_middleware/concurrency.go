@@ -0,0 +1,131 @@
+package gin_middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ConcurrencyConfig 并发限制配置，和限流不同，限制的是同时处理的请求数而不是请求频率
+type ConcurrencyConfig struct {
+	// MaxConcurrent 同时处理的最大请求数
+	MaxConcurrent int
+	// MaxQueued 达到 MaxConcurrent 时最多等待的请求数，等待队列满时直接返回 503
+	MaxQueued int
+	// QueueTimeout 请求最长等待时间，超时返回 503，0 表示不等待
+	QueueTimeout time.Duration
+}
+
+// ConcurrencyLimiter 限制同时处理的请求数，避免突发流量耗尽数据库连接和内存
+type ConcurrencyLimiter struct {
+	cc    ConcurrencyConfig
+	slots chan struct{}
+	// retryAfter 返回 503 时的 Retry-After，单位秒
+	retryAfter string
+
+	inflight int64
+	queued   int64
+}
+
+// NewConcurrencyLimiter MaxConcurrent 小于 1 时按 1 处理
+func NewConcurrencyLimiter(cc ConcurrencyConfig) *ConcurrencyLimiter {
+	if cc.MaxConcurrent < 1 {
+		cc.MaxConcurrent = 1
+	}
+	return &ConcurrencyLimiter{
+		cc:         cc,
+		slots:      make(chan struct{}, cc.MaxConcurrent),
+		retryAfter: strconv.Itoa(int(math.Max(1, math.Ceil(cc.QueueTimeout.Seconds())))),
+	}
+}
+
+// GinConcurrencyLimit 并发限制中间件，等待队列满或等待超时时返回 503 和 Retry-After
+func GinConcurrencyLimit(cc ConcurrencyConfig) gin.HandlerFunc {
+	return NewConcurrencyLimiter(cc).Handler()
+}
+
+// InFlight 返回正在处理的请求数
+func (l *ConcurrencyLimiter) InFlight() int64 {
+	return atomic.LoadInt64(&l.inflight)
+}
+
+// Queued 返回正在等待的请求数
+func (l *ConcurrencyLimiter) Queued() int64 {
+	return atomic.LoadInt64(&l.queued)
+}
+
+// Handler 并发限制中间件，等待队列满或等待超时时返回 503 和 Retry-After
+func (l *ConcurrencyLimiter) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			if !l.wait(c) {
+				c.Header("Retry-After", l.retryAfter)
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, ghttp.HttpResult{
+					Code:    50300,
+					Message: "err:服务繁忙，请稍后再试",
+				})
+				return
+			}
+		}
+		atomic.AddInt64(&l.inflight, 1)
+		defer func() {
+			atomic.AddInt64(&l.inflight, -1)
+			<-l.slots
+		}()
+		c.Next()
+	}
+}
+
+// wait 在等待队列中等待空闲，队列满、超时或请求取消时返回 false
+func (l *ConcurrencyLimiter) wait(c *gin.Context) bool {
+	if l.cc.QueueTimeout <= 0 {
+		return false
+	}
+	if atomic.AddInt64(&l.queued, 1) > int64(l.cc.MaxQueued) {
+		atomic.AddInt64(&l.queued, -1)
+		return false
+	}
+	defer atomic.AddInt64(&l.queued, -1)
+	timer := time.NewTimer(l.cc.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-c.Request.Context().Done():
+		return false
+	}
+}
+
+// Register 注册正在处理和等待的请求数指标，已经注册过时替换为 l 的指标
+func (l *ConcurrencyLimiter) Register(reg prometheus.Registerer) error {
+	for _, g := range []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "http_concurrency_in_flight",
+			Help: "Number of HTTP requests being served under the concurrency limit.",
+		}, func() float64 { return float64(l.InFlight()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "http_concurrency_queued",
+			Help: "Number of HTTP requests waiting for the concurrency limit.",
+		}, func() float64 { return float64(l.Queued()) }),
+	} {
+		err := reg.Register(g)
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			reg.Unregister(are.ExistingCollector)
+			err = reg.Register(g)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
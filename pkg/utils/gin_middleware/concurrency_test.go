@@ -0,0 +1,82 @@
+package gin_middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestGinConcurrencyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	l := NewConcurrencyLimiter(ConcurrencyConfig{MaxConcurrent: 1, MaxQueued: 1, QueueTimeout: 100 * time.Millisecond})
+	reg := prometheus.NewRegistry()
+	if err := l.Register(reg); err != nil {
+		t.Fatal(err)
+	}
+	g := gin.New()
+	g.Use(l.Handler())
+	started, release := make(chan struct{}), make(chan struct{})
+	g.GET("/", func(c *gin.Context) {
+		if c.Query("slow") != "" {
+			close(started)
+			<-release
+		}
+		c.Status(http.StatusOK)
+	})
+	request := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	slow := make(chan int, 1)
+	go func() { slow <- request("/?slow=1").Code }()
+	<-started
+	if l.InFlight() != 1 {
+		t.Errorf("expected 1 request in flight, got %d", l.InFlight())
+	}
+
+	// 第二个请求等待超时，等待期间第三个请求因为队列已满直接返回
+	queued := make(chan *httptest.ResponseRecorder, 1)
+	go func() { queued <- request("/") }()
+	for l.Queued() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if w := request("/"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 when the queue is full, got %d", w.Code)
+	}
+	w := <-queued
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected 503 with Retry-After 1 after the queue timeout, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "http_concurrency_in_flight" && mf.GetMetric()[0].GetGauge().GetValue() != 1 {
+			t.Errorf("expected in flight gauge 1, got %v", mf.GetMetric()[0].GetGauge().GetValue())
+		}
+	}
+
+	// 等待中的请求在有空闲时继续处理
+	go func() { queued <- request("/") }()
+	for l.Queued() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	if code := <-slow; code != http.StatusOK {
+		t.Errorf("expected the slow request to complete, got %d", code)
+	}
+	if w := <-queued; w.Code != http.StatusOK {
+		t.Errorf("expected the queued request to be served, got %d", w.Code)
+	}
+	if l.InFlight() != 0 || l.Queued() != 0 {
+		t.Errorf("expected nothing in flight or queued, got %d %d", l.InFlight(), l.Queued())
+	}
+}
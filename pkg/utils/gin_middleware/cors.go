@@ -0,0 +1,104 @@
+package gin_middleware
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSConfig 跨域配置
+type CORSConfig struct {
+	// AllowOrigins 允许的来源，"*" 允许所有来源，"*.example.com" 允许 example.com 的所有子域名（任意端口）。
+	// "*" 不能和 AllowCredentials 一起使用，同时配置时 "*" 不生效
+	AllowOrigins []string `mapstructure:"allow_origins"`
+	// AllowMethods 允许的请求方法，为空时允许常用方法
+	AllowMethods []string `mapstructure:"allow_methods"`
+	// AllowHeaders 允许的请求头，为空时允许预检请求中声明的所有请求头
+	AllowHeaders []string `mapstructure:"allow_headers"`
+	// AllowCredentials 是否允许携带 cookie 等凭证
+	AllowCredentials bool `mapstructure:"allow_credentials"`
+	// MaxAge 预检请求结果的缓存时间
+	MaxAge time.Duration `mapstructure:"max_age"`
+}
+
+var defaultCORSMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodHead, http.MethodOptions,
+}
+
+// allowOrigin 判断 origin 是否在允许的来源中
+func (cc CORSConfig) allowOrigin(origin string) bool {
+	for _, allowed := range cc.AllowOrigins {
+		switch {
+		case allowed == "*":
+			// 允许携带凭证时不能把任意来源原样返回
+			if !cc.AllowCredentials {
+				return true
+			}
+		case strings.HasPrefix(allowed, "*."):
+			// 比较时去掉 scheme 和端口
+			u, err := url.Parse(origin)
+			if err != nil {
+				continue
+			}
+			if strings.HasSuffix(strings.ToLower(u.Hostname()), strings.ToLower(allowed[1:])) {
+				return true
+			}
+		case strings.EqualFold(allowed, origin):
+			return true
+		}
+	}
+	return false
+}
+
+// GinCORS 跨域中间件，OPTIONS 预检请求直接返回 204
+func GinCORS(cc CORSConfig) gin.HandlerFunc {
+	methods := cc.AllowMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(cc.AllowHeaders, ", ")
+	maxAge := strconv.Itoa(int(cc.MaxAge / time.Second))
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		c.Writer.Header().Add("Vary", "Origin")
+		if !cc.allowOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		if cc.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Methods", allowMethods)
+		if allowHeaders != "" {
+			c.Header("Access-Control-Allow-Headers", allowHeaders)
+		} else if headers := c.GetHeader("Access-Control-Request-Headers"); headers != "" {
+			c.Header("Access-Control-Allow-Headers", headers)
+		}
+		if cc.MaxAge > 0 {
+			c.Header("Access-Control-Max-Age", maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,60 @@
+package gin_middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGinCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(GinCORS(CORSConfig{AllowOrigins: []string{"https://app.example.com", "*.example.org"}}))
+	g.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+
+	cases := []struct {
+		method, origin string
+		status         int
+		allowed        bool
+	}{
+		{http.MethodGet, "https://app.example.com", http.StatusOK, true},
+		{http.MethodGet, "https://a.example.org", http.StatusOK, true},
+		{http.MethodGet, "https://a.example.org:8443", http.StatusOK, true},
+		{http.MethodGet, "https://a.example.org.evil.com:8443", http.StatusOK, false},
+		{http.MethodGet, "https://evil.com", http.StatusOK, false},
+		{http.MethodOptions, "https://a.example.org", http.StatusNoContent, true},
+		{http.MethodOptions, "https://evil.com", http.StatusForbidden, false},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, "/ping", nil)
+		req.Header.Set("Origin", tc.origin)
+		if tc.method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		g.ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.origin, tc.status, w.Code)
+		}
+		if allowed := w.Header().Get("Access-Control-Allow-Origin") == tc.origin; allowed != tc.allowed {
+			t.Errorf("%s %s: expected allowed %v", tc.method, tc.origin, tc.allowed)
+		}
+	}
+}
+
+func TestGinCORSWildcardCredentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(GinCORS(CORSConfig{AllowOrigins: []string{"*"}, AllowCredentials: true}))
+	g.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	g.ServeHTTP(w, req)
+	if o := w.Header().Get("Access-Control-Allow-Origin"); o != "" {
+		t.Errorf("expected the origin not to be reflected with credentials, got %q", o)
+	}
+}
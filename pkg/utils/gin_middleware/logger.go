@@ -4,17 +4,21 @@ import (
 	"fmt"
 	"time"
 
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
 	"gitee.com/golden-go/golden-go/pkg/utils/logger"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+// GinZapLogger 打印请求日志，并给请求的日志加上 method 和 path 字段，
+// 请求内通过 Logger(c) 打印的日志都会带上这些字段和 request_id
 func GinZapLogger(log *zap.Logger) gin.HandlerFunc {
 	logger.SetLogger(log)
 	return func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
 		raw := c.Request.URL.RawQuery
+		c.Request = c.Request.WithContext(logger.WithFields(c.Request.Context(), zap.String("method", c.Request.Method), zap.String("path", path)))
 		c.Next()
 		param := gin.LogFormatterParams{
 			Request: c.Request,
@@ -25,7 +29,7 @@ func GinZapLogger(log *zap.Logger) gin.HandlerFunc {
 		param.TimeStamp = time.Now()
 		param.Latency = param.TimeStamp.Sub(start)
 
-		param.ClientIP = c.ClientIP()
+		param.ClientIP = ghttp.ClientIP(c)
 		param.Method = c.Request.Method
 		param.StatusCode = c.Writer.Status()
 		param.ErrorMessage = c.Errors.ByType(gin.ErrorTypePrivate).String()
@@ -39,10 +43,15 @@ func GinZapLogger(log *zap.Logger) gin.HandlerFunc {
 		param.Path = path
 		message := defaultLogFormatter(param)
 
-		logger.Info(message)
+		logger.FromContext(c.Request.Context()).Info(message)
 	}
 }
 
+// Logger 返回带有当前请求日志字段的 logger
+func Logger(c *gin.Context) *zap.Logger {
+	return logger.FromContext(c.Request.Context())
+}
+
 var defaultLogFormatter = func(param gin.LogFormatterParams) string {
 	var statusColor, methodColor, resetColor string
 	if param.IsOutputColor() {
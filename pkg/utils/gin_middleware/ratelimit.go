@@ -0,0 +1,153 @@
+package gin_middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
+	"gitee.com/golden-go/golden-go/pkg/utils/jwt"
+	"github.com/gin-gonic/gin"
+	jwtgo "github.com/golang-jwt/jwt"
+)
+
+// RateLimitStore 限流令牌桶的存储，默认使用内存存储，多副本部署时可以实现基于 redis 的存储
+type RateLimitStore interface {
+	// Allow 从 key 对应的令牌桶（每秒补充 rate 个令牌，容量 burst）中取出一个令牌，
+	// 没有令牌时返回 false 和需要等待的时间
+	Allow(key string, rate float64, burst int) (bool, time.Duration)
+}
+
+// RateLimitConfig 限流配置
+type RateLimitConfig struct {
+	// Rate 每秒允许的请求数
+	Rate float64
+	// Burst 允许的突发请求数
+	Burst int
+	// Store 令牌桶存储，为空时使用内存存储
+	Store RateLimitStore
+	// KeyFunc 限流的维度，为空时已登录用户按 JWT 用户，未登录按客户端 IP
+	KeyFunc func(c *gin.Context) string
+}
+
+// GinRateLimit 令牌桶限流中间件，超过限制时返回 429 和 Retry-After
+func GinRateLimit(rlc RateLimitConfig) gin.HandlerFunc {
+	return NewRateLimiter(rlc).Handler()
+}
+
+// RateLimiter 可以在运行时修改限流阈值的令牌桶限流
+type RateLimiter struct {
+	mu  sync.RWMutex
+	rlc RateLimitConfig
+}
+
+func NewRateLimiter(rlc RateLimitConfig) *RateLimiter {
+	if rlc.Store == nil {
+		rlc.Store = NewMemoryRateLimitStore()
+	}
+	if rlc.KeyFunc == nil {
+		rlc.KeyFunc = RateLimitKey
+	}
+	l := &RateLimiter{rlc: rlc}
+	l.SetLimit(rlc.Rate, rlc.Burst)
+	return l
+}
+
+// SetLimit 修改每秒允许的请求数和突发请求数
+func (l *RateLimiter) SetLimit(rate float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rlc.Rate = rate
+	l.rlc.Burst = burst
+}
+
+// Handler 限流中间件，超过限制时返回 429 和 Retry-After
+func (l *RateLimiter) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		l.mu.RLock()
+		rlc := l.rlc
+		l.mu.RUnlock()
+		ok, retryAfter := rlc.Store.Allow(rlc.KeyFunc(c), rlc.Rate, rlc.Burst)
+		if ok {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, ghttp.HttpResult{
+			Code:    42900,
+			Message: "err:请求过于频繁，请稍后再试",
+		})
+	}
+}
+
+// RateLimitKey 默认的限流维度，已登录时为 JWT 的用户，否则为客户端 IP
+func RateLimitKey(c *gin.Context) string {
+	if claims, err := jwt.GetGoldenClaims(c); err == nil {
+		if mc, ok := claims.(jwtgo.MapClaims); ok {
+			for _, k := range []string{"sub", "name"} {
+				if v, ok := mc[k].(string); ok && v != "" {
+					return "user:" + v
+				}
+			}
+		}
+	}
+	return "ip:" + ghttp.ClientIP(c)
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryRateLimitStore 内存令牌桶存储
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*tokenBucket{}, lastSweep: time.Now()}
+}
+
+func (s *MemoryRateLimitStore) Allow(key string, rate float64, burst int) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now, rate, burst)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if rate <= 0 {
+		return false, time.Minute
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// sweep 每分钟清理一次已经补满的令牌桶，避免内存无限增长
+func (s *MemoryRateLimitStore) sweep(now time.Time, rate float64, burst int) {
+	if now.Sub(s.lastSweep) < time.Minute || rate <= 0 {
+		return
+	}
+	s.lastSweep = now
+	full := time.Duration(float64(burst) / rate * float64(time.Second))
+	for key, b := range s.buckets {
+		if now.Sub(b.last) > full {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package gin_middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	ghttp "gitee.com/golden-go/golden-go/pkg/utils/http"
+	"github.com/gin-gonic/gin"
+)
+
+func TestGinRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(GinRateLimit(RateLimitConfig{Rate: 1, Burst: 2}))
+	g.POST("/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(ip string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = ip + ":1234"
+		g.ServeHTTP(w, req)
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		if w := request("10.0.0.1"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d", i, w.Code)
+		}
+	}
+	w := request("10.0.0.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After 1, got %q", w.Header().Get("Retry-After"))
+	}
+	if w := request("10.0.0.2"); w.Code != http.StatusOK {
+		t.Errorf("expected another client to pass, got %d", w.Code)
+	}
+}
+
+func TestGinRateLimitBehindProxy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resolver, err := ghttp.NewClientIPResolver([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := gin.New()
+	g.Use(GinClientIP(resolver), GinRateLimit(RateLimitConfig{Rate: 1, Burst: 1}))
+	g.POST("/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(remoteAddr, xff string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", xff)
+		g.ServeHTTP(w, req)
+		return w.Code
+	}
+	// 经过可信代理的不同客户端分别限流
+	for _, xff := range []string{"1.1.1.1", "2.2.2.2"} {
+		if code := request("10.0.0.1:1234", xff); code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", xff, code)
+		}
+	}
+	// 不可信的地址伪造的请求头被忽略
+	for i, code := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		if got := request("8.8.8.8:1234", "3.3.3."+strconv.Itoa(i)); got != code {
+			t.Errorf("spoofed request %d: expected %d, got %d", i, code, got)
+		}
+	}
+}
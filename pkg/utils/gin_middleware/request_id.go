@@ -0,0 +1,51 @@
+package gin_middleware
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// RequestIDHeader 请求 ID 的请求头和响应头
+	RequestIDHeader = "X-Request-ID"
+	// RequestIDKey 请求 ID 在 gin context 中的 key
+	RequestIDKey = "request_id"
+	// maxRequestIDLen 传入的请求 ID 超过这个长度时重新生成，避免日志被塞入超长内容
+	maxRequestIDLen = 128
+)
+
+// GinRequestID 读取请求头中的 X-Request-ID，没有时生成一个 UUID，
+// 并设置到 gin context、响应头和请求的日志字段中，
+// 这个请求通过 logger.FromContext 打印的日志都会带上 request_id
+func GinRequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLen {
+			id = newRequestID()
+		}
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logger.WithFields(c.Request.Context(), zap.String(RequestIDKey, id)))
+		c.Next()
+	}
+}
+
+// RequestIDFromContext 获取当前请求的 ID
+func RequestIDFromContext(c *gin.Context) string {
+	return c.GetString(RequestIDKey)
+}
+
+// newRequestID 生成一个随机的 UUID v4
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		logger.Warn("生成请求ID失败", zap.Error(err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
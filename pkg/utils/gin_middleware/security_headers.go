@@ -0,0 +1,73 @@
+package gin_middleware
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SecurityHeadersConfig 安全响应头配置，值为空时不设置对应的响应头
+type SecurityHeadersConfig struct {
+	// ContentTypeOptions X-Content-Type-Options
+	ContentTypeOptions string `mapstructure:"content_type_options"`
+	// FrameOptions X-Frame-Options
+	FrameOptions string `mapstructure:"frame_options"`
+	// ReferrerPolicy Referrer-Policy
+	ReferrerPolicy string `mapstructure:"referrer_policy"`
+	// ContentSecurityPolicy Content-Security-Policy
+	ContentSecurityPolicy string `mapstructure:"content_security_policy"`
+	// SwaggerContentSecurityPolicy /swagger/ 下接口文档页面的 Content-Security-Policy，
+	// 页面需要加载脚本和样式，不能使用 ContentSecurityPolicy
+	SwaggerContentSecurityPolicy string `mapstructure:"swagger_content_security_policy"`
+	// HSTS Strict-Transport-Security，只在 HTTPS 请求中设置
+	HSTS HSTSConfig `mapstructure:"hsts"`
+}
+
+// HSTSConfig Strict-Transport-Security 配置
+type HSTSConfig struct {
+	Enable            bool          `mapstructure:"enable"`
+	MaxAge            time.Duration `mapstructure:"max_age"`
+	IncludeSubdomains bool          `mapstructure:"include_subdomains"`
+	Preload           bool          `mapstructure:"preload"`
+}
+
+// value Strict-Transport-Security 的值，没有开启时为空
+func (hc HSTSConfig) value() string {
+	if !hc.Enable {
+		return ""
+	}
+	v := "max-age=" + strconv.Itoa(int(hc.MaxAge/time.Second))
+	if hc.IncludeSubdomains {
+		v += "; includeSubDomains"
+	}
+	if hc.Preload {
+		v += "; preload"
+	}
+	return v
+}
+
+// GinSecurityHeaders 设置安全响应头的中间件
+func GinSecurityHeaders(sc SecurityHeadersConfig) gin.HandlerFunc {
+	hsts := sc.HSTS.value()
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		set := func(key, value string) {
+			if value != "" {
+				h.Set(key, value)
+			}
+		}
+		set("X-Content-Type-Options", sc.ContentTypeOptions)
+		set("X-Frame-Options", sc.FrameOptions)
+		set("Referrer-Policy", sc.ReferrerPolicy)
+		if strings.HasPrefix(c.Request.URL.Path, "/swagger/") {
+			set("Content-Security-Policy", sc.SwaggerContentSecurityPolicy)
+		} else {
+			set("Content-Security-Policy", sc.ContentSecurityPolicy)
+		}
+		if c.Request.TLS != nil {
+			set("Strict-Transport-Security", hsts)
+		}
+	}
+}
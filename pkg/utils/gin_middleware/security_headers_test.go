@@ -0,0 +1,56 @@
+package gin_middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGinSecurityHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	g := gin.New()
+	g.Use(GinSecurityHeaders(SecurityHeadersConfig{
+		ContentTypeOptions:           "nosniff",
+		ReferrerPolicy:               "no-referrer",
+		ContentSecurityPolicy:        "default-src 'none'",
+		SwaggerContentSecurityPolicy: "default-src 'self'",
+		HSTS:                         HSTSConfig{Enable: true, MaxAge: 24 * time.Hour, IncludeSubdomains: true},
+	}))
+	handler := func(c *gin.Context) { c.Status(http.StatusOK) }
+	g.GET("/metrics", handler)
+	g.GET("/swagger/*any", handler)
+
+	for _, tc := range []struct {
+		path  string
+		https bool
+		want  map[string]string
+	}{
+		{"/metrics", false, map[string]string{
+			"X-Content-Type-Options":    "nosniff",
+			"X-Frame-Options":           "",
+			"Referrer-Policy":           "no-referrer",
+			"Content-Security-Policy":   "default-src 'none'",
+			"Strict-Transport-Security": "",
+		}},
+		{"/swagger/index.html", true, map[string]string{
+			"Content-Security-Policy":   "default-src 'self'",
+			"Strict-Transport-Security": "max-age=86400; includeSubDomains",
+		}},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		if tc.https {
+			req.TLS = &tls.ConnectionState{}
+		}
+		g.ServeHTTP(w, req)
+		for k, v := range tc.want {
+			if got := w.Header().Get(k); got != v {
+				t.Errorf("%s %s: expected %q, got %q", tc.path, k, v, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrBodyTooLarge 请求体超过了 LimitBody 的限制
+var ErrBodyTooLarge = errors.New("请求体过大")
+
+// bodyTooLargeKey 请求体超过限制时在 gin context 中设置为 true
+const bodyTooLargeKey = "golden_body_too_large"
+
+// maxBytesReader 同 http.MaxBytesReader，超过限制时返回 ErrBodyTooLarge 并记录到 gin context
+type maxBytesReader struct {
+	c *gin.Context
+	r io.ReadCloser
+	n int64
+}
+
+func (r *maxBytesReader) Read(p []byte) (int, error) {
+	if r.n < 0 {
+		return 0, ErrBodyTooLarge
+	}
+	// 多读一个字节判断是否超过限制
+	if int64(len(p)) > r.n+1 {
+		p = p[:r.n+1]
+	}
+	n, err := r.r.Read(p)
+	if int64(n) <= r.n {
+		r.n -= int64(n)
+		return n, err
+	}
+	n = int(r.n)
+	r.n = -1
+	r.c.Set(bodyTooLargeKey, true)
+	// 不再读取剩余的请求体，响应后关闭连接
+	r.c.Header("Connection", "close")
+	return n, ErrBodyTooLarge
+}
+
+func (r *maxBytesReader) Close() error {
+	return r.r.Close()
+}
+
+// LimitBody 限制请求体最多读取 n 字节，超过时读取返回 ErrBodyTooLarge，
+// 之后通过 Render 输出的响应都改为 413
+func LimitBody(c *gin.Context, n int64) {
+	if c.Request.Body != nil {
+		c.Request.Body = &maxBytesReader{c: c, r: c.Request.Body, n: n}
+	}
+}
+
+// BodyTooLarge 读取请求体时是否超过了 LimitBody 的限制
+func BodyTooLarge(c *gin.Context) bool {
+	return c.GetBool(bodyTooLargeKey)
+}
+
+// CommonBodyTooLargeResponse 请求体过大返回 413
+func CommonBodyTooLargeResponse(c *gin.Context) {
+	c.Set(bodyTooLargeKey, true)
+	Render(c, http.StatusRequestEntityTooLarge, bodyTooLargeResult())
+}
+
+func bodyTooLargeResult() HttpResult {
+	r := CommonErrResult(ErrBodyTooLarge)
+	r.Code = 41300
+	return r
+}
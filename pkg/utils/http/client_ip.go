@@ -0,0 +1,100 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientIPKey 解析的客户端 IP 在 gin context 中的 key
+const clientIPKey = "golden_client_ip"
+
+// ClientIPResolver 解析请求的真实客户端 IP，只有直接连接的地址是可信的代理时才使用
+// X-Forwarded-For 和 X-Real-IP，没有可信的代理时使用 RemoteAddr
+type ClientIPResolver struct {
+	trusted []*net.IPNet
+}
+
+// NewClientIPResolver 创建 ClientIPResolver，trustedProxies 为可信代理的 CIDR 或 IP
+func NewClientIPResolver(trustedProxies []string) (*ClientIPResolver, error) {
+	r := &ClientIPResolver{}
+	for _, p := range trustedProxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("不合法的可信代理：%s", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				bits = 8 * net.IPv4len
+			}
+			p = fmt.Sprintf("%s/%d", p, bits)
+		}
+		_, cidr, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("不合法的可信代理：%s", p)
+		}
+		r.trusted = append(r.trusted, cidr)
+	}
+	return r, nil
+}
+
+func (r *ClientIPResolver) isTrusted(ip net.IP) bool {
+	for _, cidr := range r.trusted {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP 返回 req 的客户端 IP。直接连接的地址是可信的代理时，从右向左跳过
+// X-Forwarded-For 中可信的代理，返回第一个不可信的地址，没有 X-Forwarded-For 时使用 X-Real-IP
+func (r *ClientIPResolver) ClientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(req.RemoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(req.RemoteAddr)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if !r.isTrusted(ip) {
+		return ip.String()
+	}
+	if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				// 不合法的地址之前的内容都不可信
+				break
+			}
+			ip = hop
+			if !r.isTrusted(hop) {
+				break
+			}
+		}
+		return ip.String()
+	}
+	if xri := net.ParseIP(strings.TrimSpace(req.Header.Get("X-Real-IP"))); xri != nil {
+		return xri.String()
+	}
+	return ip.String()
+}
+
+// SetClientIP 记录解析的客户端 IP，由 GinClientIP 中间件调用
+func SetClientIP(c *gin.Context, ip string) {
+	c.Set(clientIPKey, ip)
+}
+
+// ClientIP 返回 GinClientIP 中间件解析的客户端 IP，没有使用中间件时为 RemoteAddr
+func ClientIP(c *gin.Context) string {
+	if ip := c.GetString(clientIPKey); ip != "" {
+		return ip
+	}
+	return c.ClientIP()
+}
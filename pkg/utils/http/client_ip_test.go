@@ -0,0 +1,49 @@
+package http
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	if _, err := NewClientIPResolver([]string{"10.0.0.0/8", "not an ip"}); err == nil {
+		t.Error("expected an error for an invalid proxy")
+	}
+	r, err := NewClientIPResolver([]string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	none, _ := NewClientIPResolver(nil)
+
+	for _, tc := range []struct {
+		resolver          *ClientIPResolver
+		remoteAddr, xff   string
+		xRealIP, clientIP string
+	}{
+		// 没有可信的代理时忽略请求头
+		{none, "10.0.0.1:1234", "1.1.1.1", "", "10.0.0.1"},
+		// 直接连接的地址不是可信的代理
+		{r, "8.8.8.8:1234", "1.1.1.1", "2.2.2.2", "8.8.8.8"},
+		{r, "10.0.0.1:1234", "1.1.1.1", "", "1.1.1.1"},
+		// 客户端伪造的地址在最左边
+		{r, "10.0.0.1:1234", "6.6.6.6, 1.1.1.1, 192.168.1.1", "", "1.1.1.1"},
+		{r, "10.0.0.1:1234", "10.0.0.2, 10.0.0.3", "", "10.0.0.2"},
+		{r, "10.0.0.1:1234", "garbage, 1.1.1.1", "", "1.1.1.1"},
+		{r, "10.0.0.1:1234", "1.1.1.1, garbage", "", "10.0.0.1"},
+		{r, "192.168.1.1:1234", "", "2.2.2.2", "2.2.2.2"},
+		{r, "192.168.1.2:1234", "", "2.2.2.2", "192.168.1.2"},
+		{r, "[fd00::1]:1234", "2001:db8::1", "", "2001:db8::1"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		if tc.xff != "" {
+			req.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		if tc.xRealIP != "" {
+			req.Header.Set("X-Real-IP", tc.xRealIP)
+		}
+		if ip := tc.resolver.ClientIP(req); ip != tc.clientIP {
+			t.Errorf("%s %q %q: expected %s, got %s", tc.remoteAddr, tc.xff, tc.xRealIP, tc.clientIP, ip)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNotModified(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	etag, err := ETag(map[string]interface{}{"id": 1, "update_time": "2021-07-01T00:00:00Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other, _ := ETag(map[string]interface{}{"id": 1, "update_time": "2021-07-02T00:00:00Z"}); other == etag {
+		t.Fatal("expected the ETag to change with the content")
+	}
+
+	for _, tc := range []struct {
+		method, ifNoneMatch string
+		notModified         bool
+	}{
+		{http.MethodGet, "", false},
+		{http.MethodGet, etag, true},
+		{http.MethodGet, `"other", ` + etag[2:], true},
+		{http.MethodHead, "*", true},
+		{http.MethodGet, `W/"other"`, false},
+		{http.MethodPatch, etag, false},
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(tc.method, "/user/1", nil)
+		c.Request.Header.Set("If-None-Match", tc.ifNoneMatch)
+		if got := NotModified(c, etag); got != tc.notModified {
+			t.Errorf("%s %q: expected %v, got %v", tc.method, tc.ifNoneMatch, tc.notModified, got)
+		}
+		if c.Writer.Header().Get("ETag") != etag {
+			t.Errorf("%s %q: expected the ETag header", tc.method, tc.ifNoneMatch)
+		}
+		if tc.notModified && c.Writer.Status() != http.StatusNotModified {
+			t.Errorf("%s %q: expected status 304, got %d", tc.method, tc.ifNoneMatch, c.Writer.Status())
+		}
+	}
+}
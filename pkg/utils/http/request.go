@@ -9,8 +9,11 @@ import (
 )
 
 func GetBody(ctx *gin.Context, v interface{}) error {
-	req_data, _ := ioutil.ReadAll(ctx.Request.Body)
+	req_data, err := ioutil.ReadAll(ctx.Request.Body)
 	ctx.Request.Body.Close()
+	if err != nil {
+		return err
+	}
 	if err := json.Unmarshal(req_data, v); err != nil {
 		logger.Warn("json.Unmarshal Fail！！！data:" + string(req_data))
 		// CommonFailResponse(ctx, err.Error())
@@ -5,6 +5,8 @@ import (
 
 	"gitee.com/golden-go/golden-go/pkg/utils/types"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
 )
 
 type HttpResult struct {
@@ -43,32 +45,67 @@ func CommonErrResult(err error) HttpResult {
 	}
 }
 
+// CommonResult 成功的响应，和错误的响应一样是 {code, message, data}
+func CommonResult(data interface{}) interface{} {
+	return CommonSuccessResult(data)
+}
+
+// CommonResultWithCode 指定 code 的成功响应
+func CommonResultWithCode(code int, data interface{}) interface{} {
+	r := CommonSuccessResult(data)
+	r.Code = code
+	return r
+}
+
+// CommonListResult 分页的成功响应，data 为 types.PageData
+func CommonListResult(items interface{}, total int64, page, size int) interface{} {
+	return CommonSuccessResult(types.PageData{Items: items, Total: total, Page: page, PageSize: size})
+}
+
+// Render 按请求的 Accept 输出响应，请求 msgpack 时输出 msgpack，其他情况输出 json。
+// 请求体超过 LimitBody 的限制时，不管 handler 如何处理读取的错误都输出 413
+func Render(c *gin.Context, code int, obj interface{}) {
+	if BodyTooLarge(c) {
+		code, obj = http.StatusRequestEntityTooLarge, bodyTooLargeResult()
+	}
+	if c.Request == nil {
+		c.JSON(code, obj)
+		return
+	}
+	switch c.NegotiateFormat(binding.MIMEJSON, binding.MIMEMSGPACK, binding.MIMEMSGPACK2) {
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
+		c.Render(code, render.MsgPack{Data: obj})
+	default:
+		c.JSON(code, obj)
+	}
+}
+
 func CommonSuccessResponse(c *gin.Context, data interface{}) {
-	c.JSON(http.StatusOK, CommonSuccessResult(data))
+	Render(c, http.StatusOK, CommonResult(data))
 }
 
 func CommonSuccessPageResponse(c *gin.Context, total int, items []interface{}) {
-	c.JSON(http.StatusOK, CommonSuccessPageResult(total, items))
+	Render(c, http.StatusOK, CommonSuccessPageResult(total, items))
 }
 
 func CommonFailResponse(c *gin.Context, err string) {
-	c.JSON(http.StatusOK, CommonFailResult(err))
+	Render(c, http.StatusOK, CommonFailResult(err))
 }
 
 func CommonErrorResponse(c *gin.Context, err error) {
-	c.JSON(http.StatusOK, CommonErrResult(err))
+	Render(c, http.StatusOK, CommonErrResult(err))
 }
 
 func CommonFailCodeResponse(c *gin.Context, code int, err string) {
 	r := CommonFailResult(err)
 	r.Code = code
-	c.JSON(http.StatusOK, CommonFailResult(err))
+	Render(c, http.StatusOK, r)
 }
 
 func CommonErrorCodeResponse(c *gin.Context, code int, err error) {
 	r := CommonErrResult(err)
 	r.Code = code
-	c.JSON(http.StatusOK, CommonErrResult(err))
+	Render(c, http.StatusOK, r)
 }
 
 func NewTableData(data interface{}, pageNo, pageSize, count int) (td *types.TableData) {
@@ -0,0 +1,26 @@
+package http
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCommonFailCodeResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	CommonFailCodeResponse(c, 50003, "用户名密码验证失败!!!")
+	if want := `{"code":50003,"data":null,"message":"err:用户名密码验证失败!!!"}`; w.Body.String() != want {
+		t.Errorf("expected %s, got %s", want, w.Body.String())
+	}
+}
+
+func TestCommonListResult(t *testing.T) {
+	r := CommonListResult([]int{1, 2}, 12, 2, 2).(HttpResult)
+	if r.Code != 20000 || r.Message != "OK" {
+		t.Errorf("unexpected envelope %+v", r)
+	}
+}
@@ -0,0 +1,64 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// 校验错误使用 json 字段名
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// ValidationErrors 校验失败的字段和原因，err 不是校验错误时返回 nil
+func ValidationErrors(err error) map[string]string {
+	var ves validator.ValidationErrors
+	if !errors.As(err, &ves) {
+		return nil
+	}
+	fields := make(map[string]string, len(ves))
+	for _, fe := range ves {
+		fields[fe.Field()] = validationMessage(fe)
+	}
+	return fields
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "不能为空"
+	case "email":
+		return "邮箱格式错误"
+	case "min":
+		return fmt.Sprintf("长度不能小于%s", fe.Param())
+	case "max":
+		return fmt.Sprintf("长度不能大于%s", fe.Param())
+	}
+	return fmt.Sprintf("校验失败：%s", fe.Tag())
+}
+
+// CommonValidationFailResponse 参数错误返回 400，校验失败时 data 为每个字段的错误原因
+func CommonValidationFailResponse(c *gin.Context, err error) {
+	r := CommonErrResult(err)
+	r.Code = 40000
+	if fields := ValidationErrors(err); fields != nil {
+		r.Message = "err:参数校验失败"
+		r.Data = fields
+	}
+	Render(c, http.StatusBadRequest, r)
+}
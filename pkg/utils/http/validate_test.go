@@ -0,0 +1,45 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCommonValidationFailResponse(t *testing.T) {
+	var args struct {
+		Name  string `json:"name" binding:"required"`
+		Email string `json:"email" binding:"omitempty,email"`
+	}
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email":"bad"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	err := c.ShouldBindJSON(&args)
+	if err == nil {
+		t.Fatal("expected a validation error")
+	}
+	CommonValidationFailResponse(c, err)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+	var r struct {
+		Code int               `json:"code"`
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"name": "不能为空", "email": "邮箱格式错误"}
+	if r.Code != 40000 || !reflect.DeepEqual(r.Data, want) {
+		t.Errorf("unexpected response %s", w.Body.String())
+	}
+}
@@ -0,0 +1,76 @@
+package jwt
+
+import (
+	"errors"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/utils/types"
+	"github.com/gin-gonic/gin"
+	jwtgo "github.com/golang-jwt/jwt"
+)
+
+// Claims 登录用户的 claims，下游服务可以直接根据角色和组授权，不需要查询数据库
+type Claims struct {
+	Subject     string   `json:"sub,omitempty"`
+	ID          int64    `json:"id,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	DisplayName string   `json:"display_name,omitempty"`
+	Email       string   `json:"email,omitempty"`
+	SuperAdmin  bool     `json:"super_admin,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Groups      []string `json:"groups,omitempty"`
+	OrgId       int64    `json:"org_id,omitempty"`
+	// Extra 其它的 claims，原样保留
+	Extra map[string]interface{} `json:"-"`
+}
+
+// claimKeys Claims 中有对应字段的 claim
+var claimKeys = []string{"sub", "id", "name", "display_name", "email", "super_admin", "roles", "groups", "org_id"}
+
+// MapClaims 转换为签发 token 使用的 claims，Extra 中的 claims 一并带上
+func (c *Claims) MapClaims() jwtgo.MapClaims {
+	mc := jwtgo.MapClaims{}
+	for k, v := range c.Extra {
+		mc[k] = v
+	}
+	typed := jwtgo.MapClaims{}
+	types.JsonStruct(c, &typed)
+	for k, v := range typed {
+		mc[k] = v
+	}
+	return mc
+}
+
+// ExpiresAt token 的过期时间，没有 exp 时为零值
+func (c *Claims) ExpiresAt() time.Time {
+	return claimTime(c.Extra["exp"])
+}
+
+// NewClaims 从 MapClaims 转换，没有对应字段的 claims 保存在 Extra 中
+func NewClaims(mc jwtgo.MapClaims) (*Claims, error) {
+	c := &Claims{}
+	if err := types.JsonStruct(mc, c); err != nil {
+		return nil, err
+	}
+	c.Extra = map[string]interface{}{}
+	for k, v := range mc {
+		c.Extra[k] = v
+	}
+	for _, k := range claimKeys {
+		delete(c.Extra, k)
+	}
+	return c, nil
+}
+
+// ClaimsFromContext 获取 GinJwtMiddleware 解析出的当前用户的 claims
+func ClaimsFromContext(ctx *gin.Context) (*Claims, error) {
+	gc, err := GetGoldenClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mc, ok := gc.(jwtgo.MapClaims)
+	if !ok {
+		return nil, errors.New("GoldenClaims 不是 MapClaims！！！")
+	}
+	return NewClaims(mc)
+}
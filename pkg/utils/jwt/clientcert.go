@@ -0,0 +1,66 @@
+package jwt
+
+import (
+	"crypto/x509"
+
+	"github.com/gin-gonic/gin"
+	jwtgo "github.com/golang-jwt/jwt"
+)
+
+// AuthMethodClientCert 客户端证书认证时 claims 中 auth 的值
+const AuthMethodClientCert = "mtls"
+
+// CertIdentity 客户端证书对应的身份，内部服务用证书代替 token 调用接口
+type CertIdentity struct {
+	// Subject 匹配证书 Subject 的 CN，或完整的 Subject 如 CN=billing,OU=services,O=example
+	Subject    string   `mapstructure:"subject"`
+	Name       string   `mapstructure:"name"`
+	Roles      []string `mapstructure:"roles"`
+	SuperAdmin bool     `mapstructure:"super_admin"`
+}
+
+// claims 转换为放到 gin context 中的 claims，没有配置 Name 时使用 Subject
+func (ci *CertIdentity) claims() jwtgo.MapClaims {
+	name := ci.Name
+	if name == "" {
+		name = ci.Subject
+	}
+	c := &Claims{Subject: name, Name: name, Roles: ci.Roles, SuperAdmin: ci.SuperAdmin}
+	mc := c.MapClaims()
+	mc["auth"] = AuthMethodClientCert
+	return mc
+}
+
+// GinClientCertMiddleware 请求携带了校验通过的客户端证书且证书 Subject 匹配 ids 中的身份时，
+// 把身份作为 claims 放到 gin context 中，之后的 GinJwtMiddleware 不再校验 token。
+// 只使用 TLS 握手时校验过的证书（VerifiedChains），需要监听配置 client_ca_file；
+// 没有证书或不匹配时继续使用 token 认证
+func GinClientCertMiddleware(ids []CertIdentity) gin.HandlerFunc {
+	bySubject := make(map[string]*CertIdentity, len(ids))
+	for i := range ids {
+		bySubject[ids[i].Subject] = &ids[i]
+	}
+	return func(ctx *gin.Context) {
+		cert := verifiedClientCert(ctx)
+		if cert == nil {
+			return
+		}
+		id, ok := bySubject[cert.Subject.String()]
+		if !ok {
+			id, ok = bySubject[cert.Subject.CommonName]
+		}
+		if !ok {
+			return
+		}
+		ctx.Set(GoldenClaims, id.claims())
+	}
+}
+
+// verifiedClientCert 返回请求校验通过的客户端证书，没有时返回 nil
+func verifiedClientCert(ctx *gin.Context) *x509.Certificate {
+	tls := ctx.Request.TLS
+	if tls == nil || len(tls.VerifiedChains) == 0 || len(tls.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return tls.VerifiedChains[0][0]
+}
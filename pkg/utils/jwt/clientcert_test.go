@@ -0,0 +1,58 @@
+package jwt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGinClientCertMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gj := newTestJwt(t)
+	g := gin.New()
+	g.Use(GinClientCertMiddleware([]CertIdentity{
+		{Subject: "billing", Roles: []string{"reader"}},
+		{Subject: "CN=ops,OU=services", Name: "ops", SuperAdmin: true},
+	}), gj.GinJwtMiddleware)
+	g.GET("/userinfo", func(c *gin.Context) {
+		claims, err := ClaimsFromContext(c)
+		if err != nil {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		c.String(http.StatusOK, "%s %v %v %v", claims.Subject, claims.Roles, claims.SuperAdmin, claims.Extra["auth"])
+	})
+
+	verified := func(cn, ou string) *tls.ConnectionState {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+		if ou != "" {
+			cert.Subject.OrganizationalUnit = []string{ou}
+		}
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	for _, tc := range []struct {
+		name string
+		tls  *tls.ConnectionState
+		code int
+		body string
+	}{
+		{"common name", verified("billing", "services"), http.StatusOK, "billing [reader] false mtls"},
+		{"full subject", verified("ops", "services"), http.StatusOK, "ops [] true mtls"},
+		{"unknown subject", verified("other", ""), http.StatusUnauthorized, ""},
+		{"unverified certificate", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "billing"}}}}, http.StatusUnauthorized, ""},
+		{"no tls", nil, http.StatusUnauthorized, ""},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		req.TLS = tc.tls
+		g.ServeHTTP(w, req)
+		if w.Code != tc.code || (tc.body != "" && w.Body.String() != tc.body) {
+			t.Errorf("%s: expected %d %q, got %d %q", tc.name, tc.code, tc.body, w.Code, w.Body.String())
+		}
+	}
+}
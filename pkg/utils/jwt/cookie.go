@@ -0,0 +1,79 @@
+package jwt
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultCookieName 默认 access token 的 cookie 名称
+const DefaultCookieName = "golden_key"
+
+// CookieConfig 登录后设置 token cookie 的配置，浏览器使用 HttpOnly cookie 保存 token 可以避免 XSS 窃取，
+// API 客户端使用响应中的 token 和 Authorization 请求头，两者同时携带时以请求头为准
+type CookieConfig struct {
+	// Enable 登录和刷新 token 时设置 cookie
+	Enable bool `mapstructure:"enable"`
+	// Name access token 的 cookie 名称，默认为 golden_key，refresh token 的 cookie 固定为 golden_refresh
+	Name   string `mapstructure:"name"`
+	Domain string `mapstructure:"domain"`
+	Path   string `mapstructure:"path"`
+	// Secure 只在 HTTPS 下发送，默认开启，使用 HTTP 开发调试时需要显式关闭
+	Secure bool `mapstructure:"secure"`
+	// SameSite lax strict none，默认为 lax，none 需要同时开启 Secure
+	SameSite string `mapstructure:"same_site"`
+}
+
+// DefaultCookieConfig 默认开启 cookie，cookie 只在 HTTPS 下发送
+func DefaultCookieConfig() CookieConfig {
+	return CookieConfig{Enable: true, Name: DefaultCookieName, Path: "/", Secure: true, SameSite: "lax"}
+}
+
+// ParseSameSite 转换 SameSite 配置，为空时为 lax
+func ParseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(s) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return http.SameSiteDefaultMode, fmt.Errorf("不支持的 SameSite：%s", s)
+	}
+}
+
+// CookieName access token 的 cookie 名称
+func (gj *GoldenJwt) CookieName() string {
+	if gj.Cookie.Name == "" {
+		return DefaultCookieName
+	}
+	return gj.Cookie.Name
+}
+
+// setCookie 按 gj.Cookie 的配置设置 HttpOnly cookie，maxAge 小于 0 时删除
+func (gj *GoldenJwt) setCookie(ctx *gin.Context, name, value string, maxAge int) {
+	sameSite, err := ParseSameSite(gj.Cookie.SameSite)
+	if err != nil {
+		sameSite = http.SameSiteLaxMode
+	}
+	ctx.SetSameSite(sameSite)
+	ctx.SetCookie(name, value, maxAge, gj.Cookie.Path, gj.Cookie.Domain, gj.Cookie.Secure, true)
+}
+
+// SetCookie 设置 access token 和 refresh token 的 cookie，gj.Cookie.Enable 为 false 时不设置
+func (gj *GoldenJwt) SetCookie(ctx *gin.Context, tokenStr, refreshStr string) {
+	if !gj.Cookie.Enable {
+		return
+	}
+	gj.setCookie(ctx, gj.CookieName(), tokenStr, gj.Exp*60)
+	gj.setCookie(ctx, RefreshCookie, refreshStr, gj.RefreshExp*60)
+}
+
+// ClearCookie 删除 access token 和 refresh token 的 cookie
+func (gj *GoldenJwt) ClearCookie(ctx *gin.Context) {
+	gj.setCookie(ctx, gj.CookieName(), "", -1)
+	gj.setCookie(ctx, RefreshCookie, "", -1)
+}
@@ -0,0 +1,86 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	jwtgo "github.com/golang-jwt/jwt"
+)
+
+func TestCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gj := newTestJwt(t)
+	gj.Cookie = CookieConfig{Enable: true, Name: "session", Path: "/", Secure: true, SameSite: "strict"}
+
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+	tokenStr, err := gj.CreateTokenAndSetCookie(jwtgo.MapClaims{"name": "jdoe"}, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 2 || cookies[0].Name != "session" || cookies[0].Value != tokenStr {
+		t.Fatalf("unexpected cookies %v", cookies)
+	}
+	if c := cookies[0]; !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteStrictMode {
+		t.Errorf("expected an HttpOnly Secure SameSite=Strict cookie, got %v", c)
+	}
+
+	g := gin.New()
+	g.Use(gj.GinJwtMiddleware)
+	g.GET("/userinfo", func(c *gin.Context) {
+		claims, _ := ClaimsFromContext(c)
+		if claims == nil {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		c.String(http.StatusOK, claims.Name)
+	})
+	request := func(header, cookie string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		if header != "" {
+			req.Header.Set("Authorization", "Bearer "+header)
+		}
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "session", Value: cookie})
+		}
+		g.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request("", tokenStr); w.Code != http.StatusOK || w.Body.String() != "jdoe" {
+		t.Errorf("expected the cookie to be accepted, got %d %s", w.Code, w.Body)
+	}
+	other, err := gj.CreateToken(jwtgo.MapClaims{"name": "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := request(other, tokenStr); w.Body.String() != "other" {
+		t.Errorf("expected the header to take precedence, got %s", w.Body)
+	}
+	if w := request("", "invalid"); w.Code != http.StatusUnauthorized || !strings.Contains(w.Header().Get("Set-Cookie"), "session=;") {
+		t.Errorf("expected an invalid cookie to be cleared, got %d %v", w.Code, w.Header())
+	}
+
+	gj.Cookie.Enable = false
+	w = httptest.NewRecorder()
+	ctx, _ = gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodPost, "/login", nil)
+	if _, err := gj.CreateTokenAndSetCookie(jwtgo.MapClaims{"name": "jdoe"}, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("expected no cookie when disabled, got %v", cookies)
+	}
+}
+
+func TestDefaultCookieConfigSecure(t *testing.T) {
+	if c := DefaultCookieConfig(); !c.Enable || !c.Secure {
+		t.Errorf("expected secure cookies enabled by default, got %+v", c)
+	}
+}
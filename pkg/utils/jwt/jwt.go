@@ -1,21 +1,123 @@
 package jwt
 
 import (
+	"crypto/ed25519"
 	"crypto/rsa"
 	"errors"
+	"fmt"
+	"net/http"
 	"reflect"
+	"sync"
 	"time"
 
 	"gitee.com/golden-go/golden-go/pkg/utils/logger"
 	"github.com/gin-gonic/gin"
 	jwtgo "github.com/golang-jwt/jwt"
 	"github.com/golang-jwt/jwt/request"
+	"go.uber.org/zap"
 )
 
 type GoldenJwt struct {
-	Exp        int
-	publicKey  *rsa.PublicKey
-	privateKey *rsa.PrivateKey
+	Exp int
+	// RefreshExp refresh token 失效时间 单位分钟
+	RefreshExp int
+	// Alg 签名算法，默认为 RS512
+	Alg       string
+	method    jwtgo.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	// UnauthorizedHandler token 无效时的响应，为空时使用 DefaultUnauthorizedHandler
+	UnauthorizedHandler UnauthorizedHandler
+	// RevocationStore 已吊销 token 的存储，默认为内存存储
+	RevocationStore RevocationStore
+	// Cookie token cookie 的配置，默认开启
+	Cookie CookieConfig
+	// Issuer 签发 token 的 iss，不为空时只接受 iss 相同的 token
+	Issuer string
+	// Audience 接受的 aud，token 的 aud 包含其中任意一个即可，签发的 token 的 aud 为全部。
+	// 为空时不校验 aud
+	Audience []string
+	// Leeway 校验 exp nbf iat 时允许的时钟偏差，默认为 DefaultLeeway
+	Leeway time.Duration
+
+	refreshMu sync.Mutex
+}
+
+// 认证失败的错误码
+const (
+	CodeTokenMissing   = 40100
+	CodeTokenExpired   = 40101
+	CodeTokenMalformed = 40102
+	CodeTokenInvalid   = 40103
+	CodeTokenRevoked   = 40104
+	// CodeTokenNotValidYet token 还未生效（nbf）
+	CodeTokenNotValidYet = 40105
+	// CodeTokenIssuer token 不是由 Issuer 签发的
+	CodeTokenIssuer = 40106
+	// CodeTokenAudience token 不是签发给 Audience 的
+	CodeTokenAudience = 40107
+)
+
+var (
+	ErrTokenMissing     = errors.New("token不存在")
+	ErrTokenExpired     = errors.New("token已过期")
+	ErrTokenMalformed   = errors.New("token格式错误")
+	ErrTokenInvalid     = errors.New("token无效")
+	ErrTokenRevoked     = errors.New("token已注销")
+	ErrTokenNotValidYet = errors.New("token还未生效")
+	ErrTokenIssuer      = errors.New("token签发者不匹配")
+	ErrTokenAudience    = errors.New("token受众不匹配")
+)
+
+// UnauthorizedHandler 认证失败时的响应，code 为认证失败的错误码，需要调用 ctx.Abort
+type UnauthorizedHandler func(ctx *gin.Context, code int, err error)
+
+// DefaultUnauthorizedHandler 默认返回 401
+func DefaultUnauthorizedHandler(ctx *gin.Context, code int, err error) {
+	ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": code, "message": err.Error()})
+}
+
+// ErrorCode 返回认证错误对应的错误码
+func ErrorCode(err error) int {
+	switch {
+	case errors.Is(err, ErrTokenMissing):
+		return CodeTokenMissing
+	case errors.Is(err, ErrTokenExpired):
+		return CodeTokenExpired
+	case errors.Is(err, ErrTokenMalformed):
+		return CodeTokenMalformed
+	case errors.Is(err, ErrTokenRevoked):
+		return CodeTokenRevoked
+	case errors.Is(err, ErrTokenNotValidYet):
+		return CodeTokenNotValidYet
+	case errors.Is(err, ErrTokenIssuer):
+		return CodeTokenIssuer
+	case errors.Is(err, ErrTokenAudience):
+		return CodeTokenAudience
+	default:
+		return CodeTokenInvalid
+	}
+}
+
+// tokenError 把 jwt-go 的校验错误转换为过期、格式错误或无效
+func tokenError(err error) error {
+	for _, e := range []error{ErrTokenMissing, ErrTokenExpired, ErrTokenMalformed, ErrTokenInvalid, ErrTokenRevoked, ErrTokenReused, ErrTokenNotValidYet, ErrTokenIssuer, ErrTokenAudience} {
+		if errors.Is(err, e) {
+			return err
+		}
+	}
+	var ve *jwtgo.ValidationError
+	if errors.As(err, &ve) {
+		switch {
+		case ve.Errors&jwtgo.ValidationErrorMalformed != 0:
+			return ErrTokenMalformed
+		case ve.Errors&jwtgo.ValidationErrorExpired != 0:
+			return ErrTokenExpired
+		case ve.Errors&jwtgo.ValidationErrorNotValidYet != 0:
+			return ErrTokenNotValidYet
+		}
+	}
+	return ErrTokenInvalid
 }
 
 //func init() {
@@ -31,36 +133,140 @@ type GoldenJwt struct {
 //	privateKey, _ = jwtgo.ParseRSAPrivateKeyFromPEM(privateKeyByte)
 //}
 
-func NewGoldenJwt(exp int, puk, prk string) (gj *GoldenJwt, err error) {
-	gj = &GoldenJwt{Exp: exp}
-	gj.publicKey, err = jwtgo.ParseRSAPublicKeyFromPEM([]byte(puk))
+// DefaultAlg 默认签名算法
+const DefaultAlg = "RS512"
+
+// DefaultLeeway 默认允许的时钟偏差
+const DefaultLeeway = 60 * time.Second
+
+// NewGoldenJwt 创建使用 RS512 签名的 GoldenJwt，issuer audience 见 GoldenJwt.Issuer GoldenJwt.Audience
+func NewGoldenJwt(exp int, puk, prk, issuer string, audience []string) (gj *GoldenJwt, err error) {
+	return NewGoldenJwtWithAlg(DefaultAlg, exp, puk, prk, issuer, audience)
+}
+
+// NewGoldenJwtWithAlg 创建使用 alg 签名的 GoldenJwt，alg 为空时使用 RS512
+// RS256/RS384/RS512 和 EdDSA：puk prk 为 PEM 格式的公钥和私钥
+// HS256/HS384/HS512：prk 为密钥，至少 32 字节，puk 不使用
+func NewGoldenJwtWithAlg(alg string, exp int, puk, prk, issuer string, audience []string) (gj *GoldenJwt, err error) {
+	if alg == "" {
+		alg = DefaultAlg
+	}
+	gj = &GoldenJwt{Exp: exp, RefreshExp: DefaultRefreshExp, RevocationStore: NewMemoryRevocationStore(), Alg: alg, Cookie: DefaultCookieConfig(), Issuer: issuer, Audience: audience, Leeway: DefaultLeeway}
+	gj.method = jwtgo.GetSigningMethod(alg)
+	switch gj.method.(type) {
+	case *jwtgo.SigningMethodRSA:
+		if gj.verifyKey, gj.signKey, err = parseRSAKeys(puk, prk); err != nil {
+			return nil, err
+		}
+	case *jwtgo.SigningMethodEd25519:
+		if gj.verifyKey, gj.signKey, err = parseEdKeys(puk, prk); err != nil {
+			return nil, err
+		}
+	case *jwtgo.SigningMethodHMAC:
+		if len(prk) < minHMACKeyLen {
+			return nil, fmt.Errorf("%s 密钥至少需要 %d 字节", alg, minHMACKeyLen)
+		}
+		gj.signKey, gj.verifyKey = []byte(prk), []byte(prk)
+	default:
+		return nil, fmt.Errorf("不支持的签名算法：%s", alg)
+	}
+	return gj, nil
+}
+
+// minHMACKeyLen HMAC 密钥的最小长度
+const minHMACKeyLen = 32
+
+func parseRSAKeys(puk, prk string) (*rsa.PublicKey, *rsa.PrivateKey, error) {
+	publicKey, err := jwtgo.ParseRSAPublicKeyFromPEM([]byte(puk))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	gj.privateKey, err = jwtgo.ParseRSAPrivateKeyFromPEM([]byte(prk))
+	privateKey, err := jwtgo.ParseRSAPrivateKeyFromPEM([]byte(prk))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return gj, nil
+	if !privateKey.PublicKey.Equal(publicKey) {
+		return nil, nil, errors.New("公钥和私钥不匹配")
+	}
+	return publicKey, privateKey, nil
+}
+
+func parseEdKeys(puk, prk string) (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	pub, err := jwtgo.ParseEdPublicKeyFromPEM([]byte(puk))
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, err := jwtgo.ParseEdPrivateKeyFromPEM([]byte(prk))
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return nil, nil, errors.New("公钥不是 Ed25519 公钥")
+	}
+	privateKey, ok := priv.(ed25519.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("私钥不是 Ed25519 私钥")
+	}
+	if !publicKey.Equal(privateKey.Public()) {
+		return nil, nil, errors.New("公钥和私钥不匹配")
+	}
+	return publicKey, privateKey, nil
 }
 
 const GoldenClaims = "golden_claims"
 
+// GinJwtMiddleware 校验 Authorization 请求头或 cookie（默认为 golden_key）中的 token，
+// 没有 token 或 token 无效时调用 UnauthorizedHandler 中止请求。
+// GinClientCertMiddleware 已经用客户端证书认证的请求不再校验 token
 func (gj *GoldenJwt) GinJwtMiddleware(ctx *gin.Context) {
 	ctx.Set("golden_jwt", gj)
-	claims := jwtgo.MapClaims{}
-	token, err := request.ParseFromRequest(ctx.Request, request.AuthorizationHeaderExtractor, gj.keyFunc, request.WithClaims(&claims))
-	if err == nil && token.Valid {
-		ctx.Set(GoldenClaims, claims)
+	if _, ok := ctx.Get(GoldenClaims); ok {
+		return
+	}
+	tokenStr, fromCookie := gj.tokenFromRequest(ctx)
+	if tokenStr == "" {
+		logger.Info("token不存在")
+		gj.unauthorized(ctx, ErrTokenMissing)
 		return
 	}
-	golden_key, _ := ctx.Cookie("golden_key")
-	claims, err = gj.GetClaimsFromToken(golden_key)
-	if err == nil {
-		ctx.Set(GoldenClaims, claims)
+	claims, err := gj.GetClaimsFromToken(tokenStr)
+	if err == nil && claims["typ"] == TokenTypeRefresh {
+		// refresh token 只能用于刷新，不能用于访问接口
+		err = ErrTokenInvalid
+	}
+	if jti, _ := claims["jti"].(string); err == nil && jti != "" && gj.IsRevoked(jti) {
+		err = ErrTokenRevoked
+	}
+	if err != nil {
+		err = tokenError(err)
+		logger.Info("token验证失败", zap.Error(err))
+		if fromCookie {
+			// 清除无效的 cookie，避免之后的请求（包括重新登录）一直失败
+			gj.setCookie(ctx, gj.CookieName(), "", -1)
+		}
+		gj.unauthorized(ctx, err)
 		return
 	}
-	logger.Info("token不存在")
+	ctx.Set(GoldenClaims, claims)
+}
+
+// tokenFromRequest 优先从 Authorization 请求头获取 token，其次是 cookie
+func (gj *GoldenJwt) tokenFromRequest(ctx *gin.Context) (tokenStr string, fromCookie bool) {
+	if tokenStr, err := request.AuthorizationHeaderExtractor.ExtractToken(ctx.Request); err == nil && tokenStr != "" {
+		return tokenStr, false
+	}
+	tokenStr, _ = ctx.Cookie(gj.CookieName())
+	return tokenStr, tokenStr != ""
+}
+
+func (gj *GoldenJwt) unauthorized(ctx *gin.Context, err error) {
+	handler := gj.UnauthorizedHandler
+	if handler == nil {
+		handler = DefaultUnauthorizedHandler
+	}
+	handler(ctx, ErrorCode(err), err)
+	ctx.Abort()
 }
 
 func GetGoldenClaims(ctx *gin.Context) (jwtgo.Claims, error) {
@@ -86,43 +292,112 @@ func (gj *GoldenJwt) CreateToken(claims jwtgo.MapClaims) (tokenStr string, err e
 	//	//"sub":      "AuthToken", // 主题
 	//	//  "role":     "guest", // 角色（附加）
 	//}
+	return gj.signToken(claims, time.Minute*time.Duration(gj.Exp))
+}
+
+// signToken 设置 iat nbf exp jti，以及配置了的 iss aud 后签名
+func (gj *GoldenJwt) signToken(claims jwtgo.MapClaims, exp time.Duration) (tokenStr string, err error) {
 	now := time.Now()
 	claims["iat"] = now.Unix()
-	claims["exp"] = now.Add(time.Minute * time.Duration(gj.Exp)).Unix()
-	token := jwtgo.NewWithClaims(jwtgo.SigningMethodRS512, claims)
-	return token.SignedString(gj.privateKey)
+	claims["nbf"] = now.Unix()
+	claims["exp"] = now.Add(exp).Unix()
+	if gj.Issuer != "" {
+		claims["iss"] = gj.Issuer
+	}
+	switch len(gj.Audience) {
+	case 0:
+	case 1:
+		claims["aud"] = gj.Audience[0]
+	default:
+		claims["aud"] = gj.Audience
+	}
+	if claims["jti"], err = newJti(); err != nil {
+		return "", err
+	}
+	token := jwtgo.NewWithClaims(gj.method, claims)
+	return token.SignedString(gj.signKey)
 }
 
 // createToken 生成一个RS256验证的Token
 // Token里面包括的值，可以自己根据情况添加，
+// 同时生成 refresh token 并设置到 golden_refresh cookie
 func (gj *GoldenJwt) CreateTokenAndSetCookie(claims jwtgo.MapClaims, ctx *gin.Context) (tokenStr string, err error) {
+	refreshStr, err := gj.CreateRefreshToken(userClaims(claims))
+	if err != nil {
+		return
+	}
 	tokenStr, err = gj.CreateToken(claims)
 	if err != nil {
 		return
 	}
-	ctx.SetCookie("golden_key", tokenStr, gj.Exp*60, "", "", false, true)
+	gj.SetCookie(ctx, tokenStr, refreshStr)
 	return
 }
 
 func (gj *GoldenJwt) keyFunc(token *jwtgo.Token) (interface{}, error) {
 	// 基于JWT的第一部分中的alg字段值进行一次验证
-	if _, ok := token.Method.(*jwtgo.SigningMethodRSA); !ok {
+	// 只接受配置的算法，避免用公钥作为 HMAC 密钥伪造 token 等算法混淆攻击
+	if token.Method.Alg() != gj.method.Alg() {
 		return nil, errors.New("验证Token的加密类型错误")
 	}
-	return gj.publicKey, nil
+	return gj.verifyKey, nil
 }
 
 // getSubFromToken 获取Token的主题（也可以更改获取其他值）
 // 参数tokenStr指的是 从客户端传来的待验证Token
 // 验证Token过程中，如果Token生成过程中，指定了iat与exp参数值，将会自动根据时间戳进行时间验证
 func (gj *GoldenJwt) GetClaimsFromToken(tokenStr string) (claims jwtgo.MapClaims, err error) {
-	// 基于公钥验证Token合法性
-	token, err := jwtgo.Parse(tokenStr, gj.keyFunc)
+	// 基于公钥验证Token合法性，exp nbf iat 由 verifyTime 校验
+	parser := &jwtgo.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(tokenStr, gj.keyFunc)
 	if err != nil {
 		return nil, err
 	}
-	if claims, ok := token.Claims.(jwtgo.MapClaims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(jwtgo.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("Token无效或者无对应值")
+	}
+	if err := gj.verifyTime(claims); err != nil {
+		return nil, err
+	}
+	if err := gj.verifyIssuerAudience(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// verifyTime 校验 exp nbf iat，允许 Leeway 的时钟偏差，避免主机之间时钟不一致时
+// 刚签发或快过期的 token 被误判
+func (gj *GoldenJwt) verifyTime(claims jwtgo.MapClaims) error {
+	now := jwtgo.TimeFunc().Unix()
+	leeway := int64(gj.Leeway / time.Second)
+	if leeway < 0 {
+		leeway = 0
+	}
+	if !claims.VerifyExpiresAt(now-leeway, false) {
+		return ErrTokenExpired
+	}
+	if !claims.VerifyNotBefore(now+leeway, false) {
+		return ErrTokenNotValidYet
+	}
+	if !claims.VerifyIssuedAt(now+leeway, false) {
+		return ErrTokenInvalid
+	}
+	return nil
+}
+
+// verifyIssuerAudience 校验 iss 和 aud，其它服务签发的 token 不能在这里使用
+func (gj *GoldenJwt) verifyIssuerAudience(claims jwtgo.MapClaims) error {
+	if gj.Issuer != "" && !claims.VerifyIssuer(gj.Issuer, true) {
+		return ErrTokenIssuer
+	}
+	if len(gj.Audience) == 0 {
+		return nil
+	}
+	for _, aud := range gj.Audience {
+		if claims.VerifyAudience(aud, true) {
+			return nil
+		}
 	}
-	return nil, errors.New("Token无效或者无对应值")
+	return ErrTokenAudience
 }
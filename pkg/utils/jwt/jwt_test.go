@@ -0,0 +1,245 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	jwtgo "github.com/golang-jwt/jwt"
+)
+
+// newTestJwt 使用随机生成的 RSA 密钥创建 GoldenJwt
+func newTestJwt(t *testing.T) *GoldenJwt {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prk := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	pubBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	puk := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
+	gj, err := NewGoldenJwt(60, string(puk), string(prk), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gj
+}
+
+func TestRefresh(t *testing.T) {
+	gj := newTestJwt(t)
+	refreshStr, err := gj.CreateRefreshToken(jwtgo.MapClaims{"name": "jdoe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	access, newRefresh, err := gj.Refresh(refreshStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := gj.GetClaimsFromToken(access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["name"] != "jdoe" || claims["typ"] != nil {
+		t.Errorf("unexpected access token claims %v", claims)
+	}
+
+	if _, _, err = gj.Refresh(refreshStr); err != ErrTokenReused {
+		t.Errorf("expected ErrTokenReused, got %v", err)
+	}
+	if _, _, err = gj.Refresh(access); err != ErrTokenInvalid {
+		t.Errorf("expected an access token to be refused, got %v", err)
+	}
+	if _, _, err = gj.Refresh(newRefresh); err != nil {
+		t.Errorf("expected the rotated refresh token to work, got %v", err)
+	}
+}
+
+func TestGinJwtMiddlewareRevoked(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gj := newTestJwt(t)
+	tokenStr, err := gj.CreateToken(jwtgo.MapClaims{"name": "jdoe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := gin.New()
+	g.Use(gj.GinJwtMiddleware)
+	g.GET("/userinfo", func(c *gin.Context) { c.Status(http.StatusOK) })
+	request := func() int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+tokenStr)
+		g.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request(); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if err = gj.RevokeToken(tokenStr); err != nil {
+		t.Fatal(err)
+	}
+	if code := request(); code != http.StatusUnauthorized {
+		t.Errorf("expected revoked token to get 401, got %d", code)
+	}
+}
+
+func TestGinJwtMiddlewareMissing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gj := newTestJwt(t)
+	var code int
+	gj.UnauthorizedHandler = func(ctx *gin.Context, c int, err error) {
+		code = c
+		DefaultUnauthorizedHandler(ctx, c, err)
+	}
+	g := gin.New()
+	g.Use(gj.GinJwtMiddleware)
+	g.GET("/userinfo", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/userinfo", nil))
+	if w.Code != http.StatusUnauthorized || code != CodeTokenMissing {
+		t.Errorf("expected 401 with code %d without a token, got %d %d", CodeTokenMissing, w.Code, code)
+	}
+}
+
+func TestAlgConfusion(t *testing.T) {
+	gj := newTestJwt(t)
+	hs, err := NewGoldenJwtWithAlg("HS256", 60, "", "0123456789abcdef0123456789abcdef", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenStr, err := hs.CreateToken(jwtgo.MapClaims{"name": "jdoe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = hs.GetClaimsFromToken(tokenStr); err != nil {
+		t.Errorf("expected HS256 token to be valid, got %v", err)
+	}
+	if _, err = gj.GetClaimsFromToken(tokenStr); err == nil {
+		t.Error("expected HS256 token to be rejected by RS512")
+	}
+
+	if _, err = NewGoldenJwtWithAlg("HS256", 60, "", "short", "", nil); err == nil {
+		t.Error("expected short HMAC secret to be rejected")
+	}
+}
+
+func TestIssuerAudience(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	newJwt := func(issuer string, audience ...string) *GoldenJwt {
+		gj, err := NewGoldenJwtWithAlg("HS256", 60, "", secret, issuer, audience)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return gj
+	}
+	gj := newJwt("golden-go", "golden-go", "portal")
+	for _, tc := range []struct {
+		name   string
+		issuer *GoldenJwt
+		err    error
+	}{
+		{"same service", gj, nil},
+		{"one of the audiences", newJwt("golden-go", "billing", "portal"), nil},
+		{"other issuer", newJwt("service-b", "golden-go"), ErrTokenIssuer},
+		{"other audience", newJwt("golden-go", "billing"), ErrTokenAudience},
+		{"no audience", newJwt("golden-go"), ErrTokenAudience},
+	} {
+		tokenStr, err := tc.issuer.CreateToken(jwtgo.MapClaims{"name": "jdoe"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = gj.GetClaimsFromToken(tokenStr); err != nil {
+			err = tokenError(err)
+		}
+		if err != tc.err {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.err, err)
+		}
+	}
+
+	// nbf in the future
+	tokenStr, err := jwtgo.NewWithClaims(jwtgo.SigningMethodHS256, jwtgo.MapClaims{
+		"iss": "golden-go", "aud": "portal", "nbf": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = gj.GetClaimsFromToken(tokenStr)
+	if err = tokenError(err); err != ErrTokenNotValidYet || ErrorCode(err) != CodeTokenNotValidYet {
+		t.Errorf("expected ErrTokenNotValidYet, got %v", err)
+	}
+}
+
+func TestClaimsRoundTrip(t *testing.T) {
+	gj := newTestJwt(t)
+	c := &Claims{
+		Subject: "jdoe",
+		Email:   "jdoe@example.com",
+		Roles:   []string{"Admin", "Viewer"},
+		OrgId:   2,
+		Extra:   map[string]interface{}{"tenant": "acme"},
+	}
+	tokenStr, err := gj.CreateToken(c.MapClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mc, err := gj.GetClaimsFromToken(tokenStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := NewClaims(mc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Subject != "jdoe" || parsed.Email != "jdoe@example.com" || parsed.OrgId != 2 {
+		t.Errorf("unexpected claims %+v", parsed)
+	}
+	if len(parsed.Roles) != 2 || parsed.Roles[0] != "Admin" {
+		t.Errorf("unexpected roles %v", parsed.Roles)
+	}
+	if parsed.Extra["tenant"] != "acme" {
+		t.Errorf("expected extra claim to round-trip, got %v", parsed.Extra)
+	}
+}
+
+func TestLeeway(t *testing.T) {
+	const secret = "0123456789abcdef0123456789abcdef"
+	gj, err := NewGoldenJwtWithAlg("HS256", 60, "", secret, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(claims jwtgo.MapClaims) string {
+		tokenStr, err := jwtgo.NewWithClaims(jwtgo.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokenStr
+	}
+	now := time.Now()
+	// issued by a host whose clock is 5 seconds ahead
+	ahead := sign(jwtgo.MapClaims{"iat": now.Add(5 * time.Second).Unix(), "nbf": now.Add(5 * time.Second).Unix(), "exp": now.Add(time.Hour).Unix()})
+	expired := sign(jwtgo.MapClaims{"exp": now.Add(-5 * time.Second).Unix()})
+
+	for _, tokenStr := range []string{ahead, expired} {
+		if _, err = gj.GetClaimsFromToken(tokenStr); err != nil {
+			t.Errorf("expected the token to be valid within the leeway, got %v", err)
+		}
+	}
+
+	gj.Leeway = 2 * time.Second
+	if _, err = gj.GetClaimsFromToken(ahead); err != ErrTokenNotValidYet {
+		t.Errorf("expected ErrTokenNotValidYet beyond the leeway, got %v", err)
+	}
+	if _, err = gj.GetClaimsFromToken(expired); err != ErrTokenExpired {
+		t.Errorf("expected ErrTokenExpired beyond the leeway, got %v", err)
+	}
+}
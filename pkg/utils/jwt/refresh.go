@@ -0,0 +1,97 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	jwtgo "github.com/golang-jwt/jwt"
+)
+
+const (
+	// TokenTypeRefresh refresh token 的 typ
+	TokenTypeRefresh = "refresh"
+	// RefreshCookie refresh token 的 cookie 名称
+	RefreshCookie = "golden_refresh"
+	// DefaultRefreshExp 默认 refresh token 失效时间 单位分钟
+	DefaultRefreshExp = 7 * 24 * 60
+)
+
+// ErrTokenReused refresh token 已经被使用过，可能被盗用重放
+var ErrTokenReused = errors.New("refresh token已被使用")
+
+// registeredClaims 签发时生成的 claims，复制用户 claims 时去掉
+var registeredClaims = []string{"iat", "exp", "nbf", "jti", "typ", "iss", "aud"}
+
+// userClaims 复制 claims 中签发时生成的以外的部分
+func userClaims(claims jwtgo.MapClaims) jwtgo.MapClaims {
+	uc := jwtgo.MapClaims{}
+	for k, v := range claims {
+		uc[k] = v
+	}
+	for _, k := range registeredClaims {
+		delete(uc, k)
+	}
+	return uc
+}
+
+// CreateRefreshToken 生成 refresh token，失效时间为 RefreshExp
+func (gj *GoldenJwt) CreateRefreshToken(claims jwtgo.MapClaims) (tokenStr string, err error) {
+	claims["typ"] = TokenTypeRefresh
+	return gj.signToken(claims, time.Minute*time.Duration(gj.RefreshExp))
+}
+
+// Refresh 用 refresh token 换取新的 access token 和 refresh token，
+// 每个 refresh token 只能使用一次，再次使用返回 ErrTokenReused
+func (gj *GoldenJwt) Refresh(refreshToken string) (newAccess, newRefresh string, err error) {
+	claims, err := gj.GetClaimsFromToken(refreshToken)
+	if err != nil {
+		return "", "", tokenError(err)
+	}
+	if claims["typ"] != TokenTypeRefresh {
+		return "", "", ErrTokenInvalid
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", "", ErrTokenInvalid
+	}
+	// 检查和吊销需要原子执行，避免同一个 refresh token 被并发使用
+	gj.refreshMu.Lock()
+	if gj.IsRevoked(jti) {
+		gj.refreshMu.Unlock()
+		return "", "", ErrTokenReused
+	}
+	err = gj.Revoke(jti, claimTime(claims["exp"]))
+	gj.refreshMu.Unlock()
+	if err != nil {
+		return "", "", err
+	}
+	if newAccess, err = gj.CreateToken(userClaims(claims)); err != nil {
+		return "", "", err
+	}
+	if newRefresh, err = gj.CreateRefreshToken(userClaims(claims)); err != nil {
+		return "", "", err
+	}
+	return newAccess, newRefresh, nil
+}
+
+// claimTime 把 exp 等时间 claim 转换为时间
+func claimTime(v interface{}) time.Time {
+	switch t := v.(type) {
+	case float64:
+		return time.Unix(int64(t), 0)
+	case int64:
+		return time.Unix(t, 0)
+	}
+	return time.Time{}
+}
+
+// newJti 生成随机的 token id
+func newJti() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
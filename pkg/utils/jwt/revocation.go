@@ -0,0 +1,92 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	jwtgo "github.com/golang-jwt/jwt"
+	"go.uber.org/zap"
+)
+
+// RevocationStore 已吊销 token 的存储，以 jti 为 key，记录保留到 token 原本的过期时间。
+// 默认为内存存储，多副本部署时可以实现基于 redis 的存储
+type RevocationStore interface {
+	Revoke(jti string, exp time.Time) error
+	IsRevoked(jti string) (bool, error)
+}
+
+// Revoke 吊销 jti 对应的 token，exp 为 token 的过期时间
+func (gj *GoldenJwt) Revoke(jti string, exp time.Time) error {
+	return gj.RevocationStore.Revoke(jti, exp)
+}
+
+// IsRevoked 判断 jti 对应的 token 是否已经吊销，存储出错时按已吊销处理
+func (gj *GoldenJwt) IsRevoked(jti string) bool {
+	revoked, err := gj.RevocationStore.IsRevoked(jti)
+	if err != nil {
+		logger.Error("查询token吊销状态失败", zap.Error(err))
+		return true
+	}
+	return revoked
+}
+
+// RevokeClaims 吊销 claims 对应的 token
+func (gj *GoldenJwt) RevokeClaims(claims jwtgo.MapClaims) error {
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil
+	}
+	return gj.Revoke(jti, claimTime(claims["exp"]))
+}
+
+// RevokeToken 吊销 tokenStr，token 无效或已经过期时不需要吊销
+func (gj *GoldenJwt) RevokeToken(tokenStr string) error {
+	claims, err := gj.GetClaimsFromToken(tokenStr)
+	if err != nil {
+		return nil
+	}
+	return gj.RevokeClaims(claims)
+}
+
+// MemoryRevocationStore 内存吊销存储，记录在 token 过期后自动清理
+type MemoryRevocationStore struct {
+	mu        sync.Mutex
+	items     map[string]time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{items: map[string]time.Time{}, lastSweep: time.Now()}
+}
+
+func (s *MemoryRevocationStore) Revoke(jti string, exp time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	if exp.After(now) {
+		s.items[jti] = exp
+	}
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exp, ok := s.items[jti]
+	return ok && time.Now().Before(exp), nil
+}
+
+// sweep 每分钟清理一次已经过期的记录
+func (s *MemoryRevocationStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for jti, exp := range s.items {
+		if !now.Before(exp) {
+			delete(s.items, jti)
+		}
+	}
+}
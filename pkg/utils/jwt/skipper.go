@@ -0,0 +1,63 @@
+package jwt
+
+import (
+	"path"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Skipper 返回 true 时请求不校验 token
+type Skipper func(ctx *gin.Context) bool
+
+// publicAPIPaths 不校验 token 的接口，相对于接口的前缀
+var publicAPIPaths = []string{
+	"/v1/login/local",
+	"/v1/login/refresh",
+	"/v1/login/oidc",
+	"/v1/login/oidc/callback",
+}
+
+// PublicPaths 返回不校验 token 的公开接口，basePaths 为接口的前缀，如 /api/golden-go
+func PublicPaths(basePaths ...string) []string {
+	paths := []string{"/healthz", "/readyz", "/metrics", "/swagger/*any"}
+	for _, bp := range basePaths {
+		for _, p := range publicAPIPaths {
+			paths = append(paths, path.Join(bp, p))
+		}
+	}
+	return paths
+}
+
+// DefaultPublicPaths 默认不校验 token 的公开接口
+var DefaultPublicPaths = PublicPaths("/api/golden-go", "/api/goldden-go")
+
+// PathSkipper 跳过路由为 paths 之一的请求，按注册的路由（ctx.FullPath）匹配
+func PathSkipper(paths ...string) Skipper {
+	set := make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		set[p] = struct{}{}
+	}
+	return func(ctx *gin.Context) bool {
+		_, ok := set[ctx.FullPath()]
+		return ok
+	}
+}
+
+// DefaultSkipper 跳过 DefaultPublicPaths 中的公开接口
+var DefaultSkipper = PathSkipper(DefaultPublicPaths...)
+
+// GinJwtMiddlewareWithSkipper 同 GinJwtMiddleware，skipper 返回 true 的请求不校验 token，
+// 携带过期或无效的 token 也可以访问，其他请求没有 token 时返回 401，skipper 为空时使用 DefaultSkipper
+func (gj *GoldenJwt) GinJwtMiddlewareWithSkipper(skipper Skipper) gin.HandlerFunc {
+	if skipper == nil {
+		skipper = DefaultSkipper
+	}
+	return func(ctx *gin.Context) {
+		if skipper(ctx) {
+			// 登录、刷新 token 的接口需要用 GoldenJwt 签发 token
+			ctx.Set("golden_jwt", gj)
+			return
+		}
+		gj.GinJwtMiddleware(ctx)
+	}
+}
@@ -0,0 +1,66 @@
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGinJwtMiddlewareWithSkipper(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gj := newTestJwt(t)
+	g := gin.New()
+	g.Use(gj.GinJwtMiddlewareWithSkipper(nil))
+	handler := func(c *gin.Context) {
+		if _, ok := c.Get("golden_jwt"); !ok {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+	}
+	g.POST("/api/golden-go/v1/login/local", handler)
+	g.GET("/api/golden-go/v1/userinfo", handler)
+
+	g.DELETE("/api/golden-go/v1/user", handler)
+
+	for _, tc := range []struct {
+		method, path, token string
+		code                int
+	}{
+		{http.MethodPost, "/api/golden-go/v1/login/local", "invalid.token.value", http.StatusOK},
+		{http.MethodPost, "/api/golden-go/v1/login/local", "", http.StatusOK},
+		{http.MethodGet, "/api/golden-go/v1/userinfo", "invalid.token.value", http.StatusUnauthorized},
+		{http.MethodGet, "/api/golden-go/v1/userinfo", "", http.StatusUnauthorized},
+		{http.MethodDelete, "/api/golden-go/v1/user", "", http.StatusUnauthorized},
+		{http.MethodGet, "/api/golden-go/v1/unknown", "", http.StatusUnauthorized},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		g.ServeHTTP(w, req)
+		if w.Code != tc.code {
+			t.Errorf("%s %s token %q: expected %d, got %d", tc.method, tc.path, tc.token, tc.code, w.Code)
+		}
+	}
+}
+
+func TestPublicPaths(t *testing.T) {
+	paths := PublicPaths("/", "/gateway/")
+	for _, want := range []string{"/healthz", "/v1/login/local", "/gateway/v1/login/oidc/callback"} {
+		found := false
+		for _, p := range paths {
+			found = found || p == want
+		}
+		if !found {
+			t.Errorf("expected %s in %v", want, paths)
+		}
+	}
+	if paths := PublicPaths(); !reflect.DeepEqual(paths, []string{"/healthz", "/readyz", "/metrics", "/swagger/*any"}) {
+		t.Errorf("expected only the health, metrics and swagger paths, got %v", paths)
+	}
+}
@@ -0,0 +1,92 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// pemPrefix starts the inline PEM content of RootCACert, ClientCert and ClientKey
+const pemPrefix = "-----BEGIN"
+
+// isInlinePEM reports whether s is PEM content rather than a file path
+func isInlinePEM(s string) bool {
+	return strings.HasPrefix(strings.TrimSpace(s), pemPrefix)
+}
+
+// readPEM returns s when it is inline PEM, otherwise the content of the file at path s
+func readPEM(s string) ([]byte, error) {
+	if isInlinePEM(s) {
+		return []byte(s), nil
+	}
+	// nolint:gosec
+	// We can ignore the gosec G304 warning on this one because the path comes from ldap config.
+	return ioutil.ReadFile(s)
+}
+
+// rootCAs returns the pool of RootCACert, which is either inline PEM holding
+// one or more certificates, or space separated file paths.
+// It returns nil when RootCACert is empty, then the system roots are used.
+func (config *ServerConfig) rootCAs() (*x509.CertPool, error) {
+	if config.RootCACert == "" {
+		return nil, nil
+	}
+	certPool := x509.NewCertPool()
+	if isInlinePEM(config.RootCACert) {
+		if !certPool.AppendCertsFromPEM([]byte(config.RootCACert)) {
+			return nil, errors.New("failed to append the inline CA certificate")
+		}
+		return certPool, nil
+	}
+	for _, caCertFile := range strings.Fields(config.RootCACert) {
+		pem, err := readPEM(caCertFile)
+		if err != nil {
+			return nil, err
+		}
+		if !certPool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("Failed to append CA certificate " + caCertFile)
+		}
+	}
+	return certPool, nil
+}
+
+// clientCertificate returns the key pair of ClientCert and ClientKey, each of
+// them is either inline PEM or a file path. It returns an empty certificate
+// when they are not set.
+func (config *ServerConfig) clientCertificate() (tls.Certificate, error) {
+	if config.ClientCert == "" || config.ClientKey == "" {
+		return tls.Certificate{}, nil
+	}
+	certPEM, err := readPEM(config.ClientCert)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err := readPEM(config.ClientKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("invalid client_cert or client_key: %w", err)
+	}
+	return cert, nil
+}
+
+// validateInlineCerts checks the inline PEM of the config can be used,
+// the certificates given as file paths are only read when dialing
+func (config *ServerConfig) validateInlineCerts() error {
+	if isInlinePEM(config.RootCACert) {
+		if _, err := config.rootCAs(); err != nil {
+			return err
+		}
+	}
+	if isInlinePEM(config.ClientCert) && isInlinePEM(config.ClientKey) {
+		if _, err := config.clientCertificate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package ldap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCert returns a self-signed certificate and its key in PEM
+func newTestCert(t *testing.T) (certPEM, keyPEM string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldap.example.com"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return
+}
+
+func TestInlineCerts(t *testing.T) {
+	certPEM, keyPEM := newTestCert(t)
+	config := &ServerConfig{RootCACert: certPEM, ClientCert: certPEM, ClientKey: "\n" + keyPEM}
+
+	if pool, err := config.rootCAs(); err != nil || pool == nil {
+		t.Errorf("expected the inline CA to be loaded, got %v", err)
+	}
+	if cert, err := config.clientCertificate(); err != nil || len(cert.Certificate) != 1 {
+		t.Errorf("expected the inline key pair to be loaded, got %v", err)
+	}
+	if err := config.validateInlineCerts(); err != nil {
+		t.Error(err)
+	}
+
+	_, otherKey := newTestCert(t)
+	config.ClientKey = otherKey
+	if err := config.validateInlineCerts(); err == nil {
+		t.Error("expected a key of another certificate to be rejected")
+	}
+	config.RootCACert = "-----BEGIN CERTIFICATE-----\nbroken\n-----END CERTIFICATE-----"
+	if err := config.validateInlineCerts(); err == nil || !strings.Contains(err.Error(), "CA") {
+		t.Errorf("expected a broken inline CA to be rejected, got %v", err)
+	}
+}
+
+func TestCertFiles(t *testing.T) {
+	certPEM, keyPEM := newTestCert(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, []byte(certPEM), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, []byte(keyPEM), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := &ServerConfig{RootCACert: certFile + " " + certFile, ClientCert: certFile, ClientKey: keyFile}
+
+	if _, err := config.rootCAs(); err != nil {
+		t.Error(err)
+	}
+	if _, err := config.clientCertificate(); err != nil {
+		t.Error(err)
+	}
+	config.ClientKey = filepath.Join(dir, "missing.pem")
+	if _, err := config.clientCertificate(); err == nil {
+		t.Error("expected a missing key file to be rejected")
+	}
+}
@@ -0,0 +1,132 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// PingMethod is how the health of a server is probed
+type PingMethod string
+
+const (
+	// PingTCPBind dials the server over TCP, it is the default
+	PingTCPBind PingMethod = "tcp_bind"
+	// PingCLDAP sends a connectionless LDAP (UDP) rootDSE netlogon query,
+	// supported by Active Directory domain controllers, and falls back to
+	// PingTCPBind when no answer comes back
+	PingCLDAP PingMethod = "cldap"
+)
+
+// CLDAPPort is the UDP port domain controllers answer CLDAP queries on
+const CLDAPPort = 389
+
+// cldapNtVer asks for the NETLOGON_SAM_LOGON_RESPONSE_EX (version 5) response
+const cldapNtVer = `(NtVer=\06\00\00\00)`
+
+// cldapMessageID is the id of the last CLDAP request
+var cldapMessageID int64
+
+// cldapPing sends a rootDSE netlogon query over UDP to each host of the
+// server and returns nil as soon as one of them answers with a valid
+// LDAP response
+func cldapPing(ctx context.Context, config *ServerConfig) (err error) {
+	hosts, err := parseHosts(config.Host, config.Port)
+	if err != nil {
+		return err
+	}
+	for _, hp := range hosts {
+		// CLDAP is always on the UDP port 389, whatever the port of the host
+		hp.port = CLDAPPort
+		if err = cldapQuery(ctx, hp.address()); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// cldapQuery sends one CLDAP rootDSE query to address and checks the answer
+func cldapQuery(ctx context.Context, address string) error {
+	id := atomic.AddInt64(&cldapMessageID, 1)
+	request, err := cldapRequest(id)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultHealthCheckTimeout)
+	}
+	if err = conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	if _, err = conn.Write(request.Bytes()); err != nil {
+		return err
+	}
+	buf := make([]byte, 64*1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return err
+	}
+	return cldapCheckResponse(buf[:n], id)
+}
+
+// cldapRequest builds the LDAPMessage of the rootDSE search asking for the Netlogon attribute
+func cldapRequest(id int64) (*ber.Packet, error) {
+	filter, err := goldap.CompileFilter(cldapNtVer)
+	if err != nil {
+		return nil, err
+	}
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Request")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	search := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchRequest, nil, "Search Request")
+	search.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Base DN"))
+	search.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(goldap.ScopeBaseObject), "Scope"))
+	search.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, uint64(goldap.NeverDerefAliases), "Deref Aliases"))
+	search.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, uint64(0), "Size Limit"))
+	search.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, uint64(0), "Time Limit"))
+	search.AppendChild(ber.NewBoolean(ber.ClassUniversal, ber.TypePrimitive, ber.TagBoolean, false, "Types Only"))
+	search.AppendChild(filter)
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	attributes.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "Netlogon", "Attribute"))
+	search.AppendChild(attributes)
+	packet.AppendChild(search)
+	return packet, nil
+}
+
+// cldapCheckResponse checks data is the answer to the request with id,
+// either a search result entry or a successful search result done
+func cldapCheckResponse(data []byte, id int64) error {
+	packet, err := ber.DecodePacketErr(data)
+	if err != nil {
+		return err
+	}
+	if len(packet.Children) < 2 {
+		return errors.New("malformed CLDAP response")
+	}
+	if got, ok := packet.Children[0].Value.(int64); !ok || got != id {
+		return fmt.Errorf("unexpected CLDAP message id %v", packet.Children[0].Value)
+	}
+	op := packet.Children[1]
+	switch op.Tag {
+	case goldap.ApplicationSearchResultEntry:
+		return nil
+	case goldap.ApplicationSearchResultDone:
+		return goldap.GetLDAPError(packet)
+	default:
+		return fmt.Errorf("unexpected CLDAP response %d", op.Tag)
+	}
+}
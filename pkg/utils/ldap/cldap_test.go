@@ -0,0 +1,67 @@
+package ldap
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// serveCLDAP answers the CLDAP queries received on a local UDP port with a
+// search result entry and returns the address
+func serveCLDAP(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			request, err := ber.DecodePacketErr(buf[:n])
+			if err != nil || len(request.Children) < 2 || request.Children[1].Tag != goldap.ApplicationSearchRequest {
+				continue
+			}
+			response := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+			response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, request.Children[0].Value, "MessageID"))
+			entry := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+			entry.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "DN"))
+			entry.AppendChild(ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes"))
+			response.AppendChild(entry)
+			conn.WriteTo(response.Bytes(), addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestCLDAPQuery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := cldapQuery(ctx, serveCLDAP(t)); err != nil {
+		t.Errorf("expected the CLDAP ping to succeed, got %v", err)
+	}
+}
+
+func TestCLDAPCheckResponse(t *testing.T) {
+	done := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	done.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, int64(7), "MessageID"))
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultDone, nil, "Search Result Done")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(goldap.LDAPResultUnwillingToPerform), "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "unwilling", "Diagnostic Message"))
+	done.AppendChild(result)
+
+	if err := cldapCheckResponse(done.Bytes(), 7); !goldap.IsErrorWithCode(err, goldap.LDAPResultUnwillingToPerform) {
+		t.Errorf("expected unwilling to perform, got %v", err)
+	}
+	if err := cldapCheckResponse(done.Bytes(), 8); err == nil {
+		t.Error("expected an error for another message id")
+	}
+}
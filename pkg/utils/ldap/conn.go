@@ -0,0 +1,109 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// deadliner is implemented by connections whose network I/O can be bounded
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// conn wraps the goldap connection and keeps the underlying network connection,
+// so that the deadline and cancellation of a context can be applied to it
+type conn struct {
+	*goldap.Conn
+	netConn net.Conn
+}
+
+// SetDeadline sets the read and write deadlines of the underlying network connection
+func (c *conn) SetDeadline(t time.Time) error {
+	return c.netConn.SetDeadline(t)
+}
+
+// dialConn connects to address and returns a started LDAP connection.
+// When tlsCfg is not nil the connection is encrypted, either right away (LDAPS)
+// or with the StartTLS extended operation when startTLS is true.
+// The deadline and cancellation of ctx are honored while connecting, during the
+// TLS handshake and during StartTLS.
+func dialConn(ctx context.Context, dialer *net.Dialer, address string, tlsCfg *tls.Config, startTLS bool) (IConnection, error) {
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, goldap.NewError(goldap.ErrorNetwork, err)
+	}
+
+	if tlsCfg != nil && !startTLS {
+		tlsConn := tls.Client(netConn, tlsCfg)
+		stop := watchContext(ctx, netConn)
+		err = tlsConn.Handshake()
+		stop()
+		if err != nil {
+			netConn.Close()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, goldap.NewError(goldap.ErrorNetwork, err)
+		}
+		lc := goldap.NewConn(tlsConn, true)
+		lc.Start()
+		return &conn{Conn: lc, netConn: netConn}, nil
+	}
+
+	lc := goldap.NewConn(netConn, false)
+	lc.Start()
+	c := &conn{Conn: lc, netConn: netConn}
+	if tlsCfg != nil {
+		if err = runWithContext(ctx, c, func() error { return lc.StartTLS(tlsCfg) }); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// watchContext applies the deadline of ctx to d and aborts any pending I/O on d
+// as soon as ctx is canceled. The returned function stops watching and clears
+// the deadline, it must be called once the guarded operation has finished.
+func watchContext(ctx context.Context, d deadliner) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		d.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			// a deadline in the past makes every blocked read/write return immediately
+			d.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		d.SetDeadline(time.Time{})
+	}
+}
+
+// runWithContext runs fn while the deadline and cancellation of ctx are applied
+// to the connection c. If ctx ends before fn returns, ctx.Err() is returned.
+func runWithContext(ctx context.Context, c IConnection, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d, ok := c.(deadliner); ok {
+		stop := watchContext(ctx, d)
+		defer stop()
+	}
+	err := fn()
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package ldap
+
+import (
+	"errors"
+)
+
+var (
+	// ErrConnection is returned when the LDAP server can't be reached or the connection breaks
+	ErrConnection = errors.New("LDAP connection failed")
+
+	// ErrBindFailed is returned when the admin or unauthenticated bind used to search is rejected
+	ErrBindFailed = errors.New("LDAP bind failed")
+
+	// ErrSearchFailed is returned when the search of the user fails
+	ErrSearchFailed = errors.New("LDAP search failed")
+)
+
+// OpError is an LDAP failure of a Kind (ErrConnection, ErrBindFailed or ErrSearchFailed)
+// wrapping its cause, errors.Is matches both the kind and the cause
+type OpError struct {
+	Kind error
+	Err  error
+}
+
+func (e *OpError) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+func (e *OpError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// newOpError wraps err with kind, a connection failure is always of kind ErrConnection
+func newOpError(kind, err error) error {
+	if isConnectionError(err) {
+		kind = ErrConnection
+	}
+	return &OpError{Kind: kind, Err: err}
+}
+
+// wrapError is like newOpError, but returns as is nil, the errors which
+// already have a kind and the errors about the user, ErrInvalidCredentials
+// and ErrCouldNotFindUser, so they keep being reported to the user
+func wrapError(kind, err error) error {
+	var oe *OpError
+	if err == nil || errors.As(err, &oe) ||
+		errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrCouldNotFindUser) {
+		return err
+	}
+	return newOpError(kind, err)
+}
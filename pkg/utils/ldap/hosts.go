@@ -0,0 +1,67 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// hostPort is one of the space separated entries of ServerConfig.Host
+type hostPort struct {
+	host string
+	port int
+}
+
+// address is the host and port joined for dialing, IPv6 literals are bracketed
+func (hp hostPort) address() string {
+	return net.JoinHostPort(hp.host, strconv.Itoa(hp.port))
+}
+
+// parseHosts parses the space separated entries of hosts, an entry is either
+// host:port or [ipv6]:port, or a host, [ipv6] or a bare IPv6 literal which
+// connect to defaultPort
+func parseHosts(hosts string, defaultPort int) ([]hostPort, error) {
+	var hps []hostPort
+	for _, entry := range strings.Fields(hosts) {
+		hp, err := parseHost(entry, defaultPort)
+		if err != nil {
+			return nil, err
+		}
+		hps = append(hps, hp)
+	}
+	if len(hps) == 0 {
+		return nil, errors.New("host is required")
+	}
+	return hps, nil
+}
+
+// parseHost parses one entry of ServerConfig.Host
+func parseHost(entry string, defaultPort int) (hostPort, error) {
+	host, port := entry, defaultPort
+	switch {
+	case strings.HasPrefix(entry, "[") && strings.HasSuffix(entry, "]"):
+		// [ipv6] without a port, kept for backwards compatibility
+		host = entry[1 : len(entry)-1]
+	case strings.Count(entry, ":") > 1 && !strings.HasPrefix(entry, "["):
+		// a bare IPv6 literal, the port can only be given with brackets
+	case strings.Contains(entry, ":"):
+		h, p, err := net.SplitHostPort(entry)
+		if err != nil {
+			return hostPort{}, fmt.Errorf("invalid host %q: %w", entry, err)
+		}
+		if port, err = strconv.Atoi(p); err != nil {
+			return hostPort{}, fmt.Errorf("invalid port in host %q", entry)
+		}
+		host = h
+	}
+	if host == "" {
+		return hostPort{}, fmt.Errorf("invalid host %q: the host is empty", entry)
+	}
+	if port <= 0 || port > math.MaxUint16 {
+		return hostPort{}, fmt.Errorf("port %d of host %q is out of range", port, host)
+	}
+	return hostPort{host: host, port: port}, nil
+}
@@ -0,0 +1,75 @@
+package ldap
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseHosts(t *testing.T) {
+	tests := []struct {
+		hosts string
+		want  []hostPort
+	}{
+		{"ldap.example.com", []hostPort{{"ldap.example.com", 389}}},
+		{"::1", []hostPort{{"::1", 389}}},
+		{"[2001:db8::1]", []hostPort{{"2001:db8::1", 389}}},
+		{"[2001:db8::1]:636", []hostPort{{"2001:db8::1", 636}}},
+		{
+			"ldap1.example.com  ldap2.example.com:1389 [::1]:3389 10.0.0.1",
+			[]hostPort{{"ldap1.example.com", 389}, {"ldap2.example.com", 1389}, {"::1", 3389}, {"10.0.0.1", 389}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseHosts(tt.hosts, 389)
+		if err != nil {
+			t.Errorf("%q: %v", tt.hosts, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: expected %v, got %v", tt.hosts, tt.want, got)
+		}
+	}
+	if got := (hostPort{"::1", 636}).address(); got != "[::1]:636" {
+		t.Errorf("unexpected address %s", got)
+	}
+
+	for _, hosts := range []string{"", "ldap.example.com:", "ldap.example.com:ldaps", "ldap.example.com:70000", ":389", "[::1"} {
+		if _, err := parseHosts(hosts, 389); err == nil {
+			t.Errorf("%q: expected an error", hosts)
+		}
+	}
+	// the default port is only needed by the hosts without a port
+	if _, err := parseHosts("ldap.example.com:389", 0); err != nil {
+		t.Errorf("expected no default port to be needed, got %v", err)
+	}
+	if _, err := parseHosts("ldap.example.com", 0); err == nil {
+		t.Error("expected the missing port to be rejected")
+	}
+}
+
+func TestDialMixedHosts(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	// a port nothing listens on
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	server := &Server{Config: &ServerConfig{
+		Host: "127.0.0.1 127.0.0.1:" + strconv.Itoa(port),
+		Port: closedPort,
+	}}
+	if err := server.Dial(); err != nil {
+		t.Fatalf("expected the second host to be dialed, got %v", err)
+	}
+	server.Close()
+}
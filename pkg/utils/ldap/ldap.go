@@ -1,21 +1,23 @@
 package ldap
 
 import (
+	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"math"
 	"net"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"gitee.com/golden-go/golden-go/pkg/models"
 	"gitee.com/golden-go/golden-go/pkg/utils/logger"
 	"gitee.com/golden-go/golden-go/pkg/utils/types"
 	"github.com/davecgh/go-spew/spew"
-	goldap "github.com/go-ldap/ldap"
+	goldap "github.com/go-ldap/ldap/v3"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 )
 
@@ -26,26 +28,116 @@ type Config struct {
 
 // ServerConfig holds connection data to LDAP
 type ServerConfig struct {
-	Host          string       `json:"host"`
-	Port          int          `json:"port"`
-	UseSSL        bool         `json:"use_ssl"`
-	StartTLS      bool         `json:"start_tls"`
-	SkipVerifySSL bool         `json:"ssl_skip_verify"`
-	RootCACert    string       `json:"root_ca_cert"`
-	ClientCert    string       `json:"client_cert"`
-	ClientKey     string       `json:"client_key"`
-	BindDN        string       `json:"bind_dn"`
-	BindPassword  string       `json:"bind_password"`
-	Attr          AttributeMap `json:"attributes"`
+	Host          string `json:"host"`
+	Port          int    `json:"port"`
+	UseSSL        bool   `json:"use_ssl"`
+	StartTLS      bool   `json:"start_tls"`
+	SkipVerifySSL bool   `json:"ssl_skip_verify"`
+	// MinTLSVersion is the min TLS version of LDAPS and StartTLS, 1.2 or 1.3,
+	// DefaultMinTLSVersion by default
+	MinTLSVersion string `json:"min_tls_version"`
+	// CipherSuites are the names of the TLS 1.2 cipher suites allowed,
+	// e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, the Go defaults when empty
+	CipherSuites []string `json:"cipher_suites"`
+	// RootCACert, ClientCert and ClientKey are either inline PEM content or file paths,
+	// RootCACert can also be several space separated file paths
+	RootCACert   string       `json:"root_ca_cert"`
+	ClientCert   string       `json:"client_cert"`
+	ClientKey    string       `json:"client_key"`
+	BindDN       string       `json:"bind_dn"`
+	BindPassword string       `json:"bind_password"`
+	Attr         AttributeMap `json:"attributes"`
+	// ExtraAttributes are requested in addition to Attr and returned in user.Attributes,
+	// e.g. telephoneNumber or department
+	ExtraAttributes []string `json:"extra_attributes"`
+	// BindMethod is how the admin bind authenticates, BindSimple by default
+	BindMethod BindMethod `json:"bind_method"`
+	// PingMethod is how Ping and HealthCheck probe the server, PingTCPBind by default
+	PingMethod PingMethod `json:"ping_method"`
+	// PoolSize is the max amount of idle connections kept for reuse,
+	// 0 disables pooling and every login dials a new connection
+	PoolSize int `json:"pool_size"`
+	// ConnMaxIdle is how long a pooled connection may stay idle before it is
+	// discarded instead of reused, set it below the idle timeout of the server,
+	// 0 keeps idle connections forever
+	ConnMaxIdle time.Duration `json:"conn_max_idle"`
+	// DialTimeout bounds connecting to one host, including the TLS handshake
+	// and StartTLS, DefaultDialTimeout by default
+	DialTimeout time.Duration `json:"dial_timeout"`
+	// KeepAlive is the TCP keepalive period of the dialed connections,
+	// DefaultKeepAlive by default, negative disables keepalive
+	KeepAlive time.Duration `json:"keep_alive"`
+	// PageSize is the amount of entries requested per page of a user search,
+	// UsersMaxRequest by default
+	PageSize int `json:"page_size"`
+	// FollowReferrals makes the user search chase the referrals returned by the server
+	FollowReferrals bool `json:"follow_referrals"`
+	// MaxReferralDepth bounds how many referral hops are followed, DefaultMaxReferralDepth by default
+	MaxReferralDepth int `json:"max_referral_depth"`
+	// ResolveNestedGroups adds the groups the user's groups are members of to user.Groups
+	ResolveNestedGroups bool `json:"resolve_nested_groups"`
+	// NestedGroupsMaxDepth bounds how many levels of parent groups are resolved,
+	// DefaultNestedGroupsMaxDepth by default
+	NestedGroupsMaxDepth int `json:"nested_groups_max_depth"`
 
 	SearchFilter  string   `json:"search_filter"`
 	SearchBaseDNs []string `json:"search_base_dns"`
+	// SearchScope is how deep the user search goes below each search base,
+	// ScopeSub by default
+	SearchScope SearchScope `json:"search_scope"`
 
 	GroupSearchFilter              string   `json:"group_search_filter"`
 	GroupSearchFilterUserAttribute string   `json:"group_search_filter_user_attribute"`
 	GroupSearchBaseDNs             []string `json:"group_search_base_dns"`
+	// GroupSearchScope is how deep the group search goes below each group search base,
+	// ScopeSub by default
+	GroupSearchScope SearchScope `json:"group_search_scope"`
 
-	//Groups []*GroupToOrgRole `json:"group_mappings"`
+	Groups []*GroupToOrgRole `json:"group_mappings"`
+}
+
+// BindMethod is the authentication method of the admin bind
+type BindMethod string
+
+const (
+	// BindSimple binds with BindDN and BindPassword
+	BindSimple BindMethod = "simple"
+	// BindExternal binds with SASL EXTERNAL, the identity is taken
+	// from the client certificate presented during the TLS handshake
+	BindExternal BindMethod = "external"
+)
+
+// SearchScope is the scope of a search below its base DN
+type SearchScope string
+
+const (
+	// ScopeBase only matches the base DN entry itself
+	ScopeBase SearchScope = "base"
+	// ScopeOne matches the entries right below the base DN, e.g. the users
+	// of a single OU, which is much faster than ScopeSub on large directories
+	ScopeOne SearchScope = "one"
+	// ScopeSub matches the base DN and its whole subtree, it is the default
+	ScopeSub SearchScope = "sub"
+)
+
+// goldapScope returns the go-ldap scope, ScopeWholeSubtree when s is not set
+func (s SearchScope) goldapScope() int {
+	switch s {
+	case ScopeBase:
+		return goldap.ScopeBaseObject
+	case ScopeOne:
+		return goldap.ScopeSingleLevel
+	}
+	return goldap.ScopeWholeSubtree
+}
+
+// valid reports whether s is one of the known scopes or not set
+func (s SearchScope) valid() bool {
+	switch s {
+	case "", ScopeBase, ScopeOne, ScopeSub:
+		return true
+	}
+	return false
 }
 
 // AttributeMap is a struct representation for LDAP "attributes" setting
@@ -59,28 +151,28 @@ type AttributeMap struct {
 
 // GroupToOrgRole is a struct representation of LDAP
 // config "group_mappings" setting
-//type GroupToOrgRole struct {
-//	GroupDN string `json:"group_dn"`
-//	OrgId   int64  `json:"org_id"`
-//
-//	// This pointer specifies if setting was set (for backwards compatibility)
-//	IsGrafanaAdmin *bool `json:"grafana_admin"`
-//
-//	OrgRole models.RoleType `json:"org_role"`
-//}
-
-// func isMemberOf(memberOf []string, group string) bool {
-// 	if group == "*" {
-// 		return true
-// 	}
-
-// 	for _, member := range memberOf {
-// 		if strings.EqualFold(member, group) {
-// 			return true
-// 		}
-// 	}
-// 	return false
-// }
+type GroupToOrgRole struct {
+	GroupDN string `json:"group_dn"`
+	OrgId   int64  `json:"org_id"`
+
+	// This pointer specifies if setting was set (for backwards compatibility)
+	SuperAdmin *bool `json:"super_admin"`
+
+	OrgRole string `json:"org_role"`
+}
+
+func isMemberOf(memberOf []string, group string) bool {
+	if group == "*" {
+		return true
+	}
+
+	for _, member := range memberOf {
+		if strings.EqualFold(member, group) {
+			return true
+		}
+	}
+	return false
+}
 
 func appendIfNotEmpty(slice []string, values ...string) []string {
 	for _, v := range values {
@@ -123,6 +215,7 @@ func getArrayAttribute(name string, entry *goldap.Entry) []string {
 type IConnection interface {
 	Bind(username, password string) error
 	UnauthenticatedBind(username string) error
+	ExternalBind() error
 	Add(*goldap.AddRequest) error
 	Del(*goldap.DelRequest) error
 	Search(*goldap.SearchRequest) (*goldap.SearchResult, error)
@@ -133,10 +226,18 @@ type IConnection interface {
 // IServer LDAP 服务端认证接口interface
 type IServer interface {
 	Login(data *types.LoginData) (*models.User, error)
+	LoginContext(ctx context.Context, data *types.LoginData) (*models.User, error)
 	Users([]string) ([]*models.User, error)
+	UsersContext(ctx context.Context, logins []string) ([]*models.User, error)
+	UsersPartial(logins []string) ([]*models.User, []FailedLogin, error)
+	UsersPartialContext(ctx context.Context, logins []string) ([]*models.User, []FailedLogin, error)
+	LookupUser(login string) (*models.User, error)
+	LookupUserContext(ctx context.Context, login string) (*models.User, error)
 	Bind() error
+	BindContext(ctx context.Context) error
 	UserBind(string, string) error
 	Dial() error
+	DialContext(ctx context.Context) error
 	Close()
 }
 
@@ -144,6 +245,15 @@ type IServer interface {
 type Server struct {
 	Config     *ServerConfig
 	Connection IConnection
+	// Pool is optional, when set Dial() takes the connection from it
+	// and Close() gives the connection back
+	Pool *Pool
+
+	// Metrics is optional, when set the binds and searches are recorded
+	Metrics *Metrics
+
+	// referralDepth is the amount of referral hops which led to this server
+	referralDepth int
 }
 
 // Bind authenticates the connection with the LDAP server
@@ -153,6 +263,16 @@ type Server struct {
 // Dial() sets the connection with the server for this Struct. Therefore, we require a
 // call to Dial() before being able to execute this function.
 func (server *Server) Bind() error {
+	return server.BindContext(context.Background())
+}
+
+// BindContext is like Bind but honors the deadline and cancellation of ctx
+func (server *Server) BindContext(ctx context.Context) error {
+	return runWithContext(ctx, server.Connection, server.bind)
+}
+
+// bind is helper method for the BindContext()
+func (server *Server) bind() error {
 	if server.shouldAdminBind() {
 		if err := server.AdminBind(); err != nil {
 			return err
@@ -171,6 +291,18 @@ func (server *Server) Bind() error {
 // on how much items can we return in one request
 const UsersMaxRequest = 500
 
+// DefaultMaxReferralDepth is the default max amount of referral hops followed by a search
+const DefaultMaxReferralDepth = 3
+
+// DefaultNestedGroupsMaxDepth is the default max amount of parent group levels resolved
+const DefaultNestedGroupsMaxDepth = 10
+
+// DefaultDialTimeout is the default timeout of connecting to one host
+const DefaultDialTimeout = 10 * time.Second
+
+// DefaultKeepAlive is the default TCP keepalive period of the dialed connections
+const DefaultKeepAlive = 30 * time.Second
+
 var (
 
 	// ErrInvalidCredentials is returned if username and password do not match
@@ -178,6 +310,14 @@ var (
 
 	// ErrCouldNotFindUser is returned when username hasn't been found (not username+password)
 	ErrCouldNotFindUser = errors.New("can't find user in LDAP")
+
+	// ErrMultipleUsersFound is returned when the search of a single login matches
+	// more than one entry, which usually means the search filter is misconfigured
+	ErrMultipleUsersFound = errors.New("found multiple users in LDAP for the login")
+
+	// ErrExternalBindWithoutTLS is returned when SASL EXTERNAL bind is configured
+	// without a TLS connection and a client certificate
+	ErrExternalBindWithoutTLS = errors.New("LDAP external bind requires TLS and a client certificate")
 )
 
 // New creates the new LDAP connection
@@ -187,70 +327,90 @@ func NewLDAPServer(config *ServerConfig) IServer {
 	}
 }
 
+// NewLDAPServerWithPool creates the new LDAP connection which reuses the connections of pool
+func NewLDAPServerWithPool(config *ServerConfig, pool *Pool) IServer {
+	return &Server{
+		Config: config,
+		Pool:   pool,
+	}
+}
+
 // Dial dials in the LDAP
-// TODO: decrease cyclomatic complexity
 func (server *Server) Dial() error {
-	var err error
-	var certPool *x509.CertPool
-	if server.Config.RootCACert != "" {
-		certPool = x509.NewCertPool()
-		for _, caCertFile := range strings.Split(server.Config.RootCACert, " ") {
-			// nolint:gosec
-			// We can ignore the gosec G304 warning on this one because `caCertFile` comes from ldap config.
-			pem, err := ioutil.ReadFile(caCertFile)
-			if err != nil {
-				return err
-			}
-			if !certPool.AppendCertsFromPEM(pem) {
-				return errors.New("Failed to append CA certificate " + caCertFile)
-			}
-		}
-	}
-	var clientCert tls.Certificate
-	if server.Config.ClientCert != "" && server.Config.ClientKey != "" {
-		clientCert, err = tls.LoadX509KeyPair(server.Config.ClientCert, server.Config.ClientKey)
+	return server.DialContext(context.Background())
+}
+
+// DialContext dials in the LDAP, the deadline and cancellation of ctx are honored
+// while connecting, during the TLS handshake and during StartTLS
+func (server *Server) DialContext(ctx context.Context) error {
+	if server.Pool != nil {
+		conn, err := server.Pool.GetContext(ctx)
 		if err != nil {
 			return err
 		}
+		server.Connection = instrument(conn, server.Config.Host, server.Metrics)
+		return nil
 	}
-	for _, host := range strings.Split(server.Config.Host, " ") {
-		// Remove any square brackets enclosing IPv6 addresses, a format we support for backwards compatibility
-		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
-		address := net.JoinHostPort(host, strconv.Itoa(server.Config.Port))
-		if server.Config.UseSSL {
-			tlsCfg := &tls.Config{
-				InsecureSkipVerify: server.Config.SkipVerifySSL,
-				ServerName:         host,
-				RootCAs:            certPool,
-			}
-			if len(clientCert.Certificate) > 0 {
-				tlsCfg.Certificates = append(tlsCfg.Certificates, clientCert)
-			}
-			if server.Config.StartTLS {
-				server.Connection, err = goldap.Dial("tcp", address)
-				if err == nil {
-					if err = server.Connection.StartTLS(tlsCfg); err == nil {
-						return nil
-					}
-				}
-			} else {
-				server.Connection, err = goldap.DialTLS("tcp", address, tlsCfg)
-			}
-		} else {
-			server.Connection, err = goldap.Dial("tcp", address)
-		}
+	if err := server.dial(ctx); err != nil {
+		return err
+	}
+	server.Connection = instrument(server.Connection, server.Config.Host, server.Metrics)
+	return nil
+}
 
+// dial is helper method for the DialContext(), it always dials a new connection
+// TODO: decrease cyclomatic complexity
+func (server *Server) dial(ctx context.Context) error {
+	baseTLSCfg, err := server.Config.tlsConfig()
+	if err != nil {
+		return err
+	}
+	hosts, err := parseHosts(server.Config.Host, server.Config.Port)
+	if err != nil {
+		return err
+	}
+	for _, hp := range hosts {
+		var tlsCfg *tls.Config
+		if baseTLSCfg != nil {
+			tlsCfg = baseTLSCfg.Clone()
+			tlsCfg.ServerName = hp.host
+		}
+		server.Connection, err = server.dialHost(ctx, hp.address(), tlsCfg)
 		if err == nil {
 			return nil
 		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 	}
 	return err
 }
 
+// dialHost dials address within the DialTimeout of the config
+func (server *Server) dialHost(ctx context.Context, address string, tlsCfg *tls.Config) (IConnection, error) {
+	timeout := server.Config.DialTimeout
+	if timeout <= 0 {
+		timeout = DefaultDialTimeout
+	}
+	keepAlive := server.Config.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = DefaultKeepAlive
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return dialConn(ctx, &net.Dialer{KeepAlive: keepAlive}, address, tlsCfg, server.Config.StartTLS)
+}
+
 // Close closes the LDAP connection
 // Dial() sets the connection with the server for this Struct. Therefore, we require a
 // call to Dial() before being able to execute this function.
+// A pooled connection is given back to the pool instead of being closed.
 func (server *Server) Close() {
+	if server.Pool != nil {
+		server.Pool.Put(uninstrument(server.Connection))
+		server.Connection = nil
+		return
+	}
 	server.Connection.Close()
 }
 
@@ -274,9 +434,32 @@ func (server *Server) Close() {
 // call to Dial() before being able to execute this function.
 func (server *Server) Login(query *types.LoginData) (
 	*models.User, error,
+) {
+	return server.LoginContext(context.Background(), query)
+}
+
+// LoginContext is like Login but honors the deadline and cancellation of ctx,
+// a slow or unresponsive LDAP server will not block longer than ctx allows
+func (server *Server) LoginContext(ctx context.Context, query *types.LoginData) (
+	user *models.User, err error,
+) {
+	err = runWithContext(ctx, server.Connection, func() error {
+		user, err = server.login(ctx, query)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// login is helper method for the LoginContext()
+func (server *Server) login(ctx context.Context, query *types.LoginData) (
+	*models.User, error,
 ) {
 	var err error
 	var authAndBind bool
+	name := types.Normalize.Username(query.Name)
 
 	// Check if we can use a search user
 	switch {
@@ -287,23 +470,23 @@ func (server *Server) Login(query *types.LoginData) (
 	case server.shouldSingleBind():
 		authAndBind = true
 		err = server.UserBind(
-			server.singleBindDN(query.Name),
+			server.singleBindDN(name),
 			query.Password,
 		)
 		if err != nil {
-			return nil, err
+			return nil, wrapError(ErrBindFailed, err)
 		}
 	default:
 		err := server.Connection.UnauthenticatedBind(server.Config.BindDN)
 		if err != nil {
-			return nil, err
+			return nil, newOpError(ErrBindFailed, err)
 		}
 	}
 
 	// Find user entry & attributes
-	users, err := server.Users([]string{query.Name})
+	users, err := server.searchUsers(ctx, []string{name})
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrSearchFailed, err)
 	}
 
 	// If we couldn't find the user -
@@ -311,6 +494,9 @@ func (server *Server) Login(query *types.LoginData) (
 	if len(users) == 0 {
 		return nil, ErrCouldNotFindUser
 	}
+	if len(users) > 1 {
+		return nil, ErrMultipleUsersFound
+	}
 
 	user := users[0]
 	if err := server.validateGoldenUser(user); err != nil {
@@ -318,20 +504,71 @@ func (server *Server) Login(query *types.LoginData) (
 	}
 
 	if !authAndBind {
-		// Authenticate user
-		err = server.UserBind(user.Name, query.Password)
+		// Authenticate user with the DN of its entry,
+		// user.Name is the display name which is not bindable
+		err = server.UserBind(user.DN, query.Password)
 		if err != nil {
-			return nil, err
+			return nil, wrapError(ErrBindFailed, err)
 		}
 	}
 
 	return user, nil
 }
 
+// LookupUser finds the user by login without checking any credential,
+// for provisioning users from the directory.
+// The search is done with the admin bind, or an unauthenticated bind when no
+// bind password is configured. Like Login, a user outside of the configured
+// group mappings is rejected.
+//
+// Dial() sets the connection with the server for this Struct. Therefore, we require a
+// call to Dial() before being able to execute this function.
+func (server *Server) LookupUser(login string) (*models.User, error) {
+	return server.LookupUserContext(context.Background(), login)
+}
+
+// LookupUserContext is like LookupUser but honors the deadline and cancellation of ctx
+func (server *Server) LookupUserContext(ctx context.Context, login string) (
+	user *models.User, err error,
+) {
+	err = runWithContext(ctx, server.Connection, func() error {
+		user, err = server.lookupUser(ctx, login)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// lookupUser is helper method for the LookupUserContext()
+func (server *Server) lookupUser(ctx context.Context, login string) (*models.User, error) {
+	if err := server.bind(); err != nil {
+		return nil, wrapError(ErrBindFailed, err)
+	}
+
+	users, err := server.searchUsers(ctx, []string{login})
+	if err != nil {
+		return nil, wrapError(ErrSearchFailed, err)
+	}
+	if len(users) == 0 {
+		return nil, ErrCouldNotFindUser
+	}
+	if len(users) > 1 {
+		return nil, ErrMultipleUsersFound
+	}
+
+	user := users[0]
+	if err := server.validateGoldenUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
 // shouldAdminBind checks if we should use
-// admin username & password for LDAP bind
+// admin username & password, or the client certificate, for LDAP bind
 func (server *Server) shouldAdminBind() bool {
-	return server.Config.BindPassword != ""
+	return server.Config.BindPassword != "" || server.Config.BindMethod == BindExternal
 }
 
 // singleBindDN combines the bind with the username
@@ -351,10 +588,33 @@ func (server *Server) shouldSingleBind() bool {
 func (server *Server) Users(logins []string) (
 	[]*models.User,
 	error,
+) {
+	return server.UsersContext(context.Background(), logins)
+}
+
+// UsersContext is like Users but honors the deadline and cancellation of ctx
+func (server *Server) UsersContext(ctx context.Context, logins []string) (
+	users []*models.User,
+	err error,
+) {
+	err = runWithContext(ctx, server.Connection, func() error {
+		users, err = server.searchUsers(ctx, logins)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// searchUsers is helper method for the UsersContext()
+func (server *Server) searchUsers(ctx context.Context, logins []string) (
+	[]*models.User,
+	error,
 ) {
 	var users []*goldap.Entry
 	err := getUsersIteration(logins, func(previous, current int) error {
-		entries, err := server.users(logins[previous:current])
+		entries, err := server.users(ctx, logins[previous:current])
 		if err != nil {
 			return err
 		}
@@ -384,6 +644,75 @@ func (server *Server) Users(logins []string) (
 	return serializedUsers, nil
 }
 
+// FailedLogin is a login whose users search failed in UsersPartial
+type FailedLogin struct {
+	Login string
+	Err   error
+}
+
+// UsersPartial is like Users, but a failing chunk of logins doesn't abort the
+// whole batch: the users of the other chunks are returned along with the logins
+// of the failed chunks. An error is only returned when every chunk failed.
+func (server *Server) UsersPartial(logins []string) (
+	[]*models.User,
+	[]FailedLogin,
+	error,
+) {
+	return server.UsersPartialContext(context.Background(), logins)
+}
+
+// UsersPartialContext is like UsersPartial but honors the deadline and cancellation of ctx
+func (server *Server) UsersPartialContext(ctx context.Context, logins []string) (
+	users []*models.User,
+	failed []FailedLogin,
+	err error,
+) {
+	err = runWithContext(ctx, server.Connection, func() error {
+		users, failed, err = server.searchUsersPartial(ctx, logins)
+		return err
+	})
+	if err != nil {
+		return nil, failed, err
+	}
+	return users, failed, nil
+}
+
+// searchUsersPartial is helper method for the UsersPartialContext(),
+// every chunk of logins is searched and serialized on its own
+func (server *Server) searchUsersPartial(ctx context.Context, logins []string) (
+	[]*models.User,
+	[]FailedLogin,
+	error,
+) {
+	users := []*models.User{}
+	var failed []FailedLogin
+	var lastErr error
+	_ = getUsersIteration(logins, func(previous, current int) error {
+		chunk, err := server.searchUsers(ctx, logins[previous:current])
+		if err != nil {
+			logger.Warn(
+				"LDAP users search failed for a chunk of logins",
+				zap.Int("logins", current-previous),
+				zap.Error(err),
+			)
+			lastErr = err
+			for _, login := range logins[previous:current] {
+				failed = append(failed, FailedLogin{Login: login, Err: err})
+			}
+			return nil
+		}
+
+		users = append(users, chunk...)
+
+		return nil
+	})
+	if len(logins) > 0 && len(failed) == len(logins) {
+		return nil, failed, lastErr
+	}
+
+	return users, failed, nil
+}
+
 // getUsersIteration is a helper function for Users() method.
 // It divides the users by equal parts for the anticipated requests
 func getUsersIteration(logins []string, fn func(int, int) error) error {
@@ -408,42 +737,171 @@ func getUsersIteration(logins []string, fn func(int, int) error) error {
 }
 
 // users is helper method for the Users()
-func (server *Server) users(logins []string) (
+// Every search base is searched, so users living in different bases are all found.
+// The entries are aggregated and deduplicated by DN, since bases may overlap.
+// A base whose search fails is logged and skipped, an error is only returned
+// when the search fails in every base. No base, or no entry found, gives an empty slice.
+// ctx bounds the referrals which are followed.
+func (server *Server) users(ctx context.Context, logins []string) (
 	[]*goldap.Entry,
 	error,
 ) {
-	var result *goldap.SearchResult
+	entries := []*goldap.Entry{}
 	var Config = server.Config
-	var err error
+	var errs error
+	failed := 0
+	seen := map[string]bool{}
 
 	for _, base := range Config.SearchBaseDNs {
-		result, err = server.Connection.Search(
+		result, err := server.search(
 			server.getSearchRequest(base, logins),
 		)
+		if err != nil {
+			logger.Warn("unable to search LDAP base", zap.String("base", base), zap.Error(err))
+			errs = multierr.Append(errs, err)
+			failed++
+			continue
+		}
+
+		if Config.FollowReferrals && len(result.Referrals) > 0 {
+			result.Entries = append(
+				result.Entries,
+				server.followReferrals(ctx, result.Referrals, logins)...,
+			)
+		}
+
+		for _, entry := range result.Entries {
+			if seen[entry.DN] {
+				continue
+			}
+			seen[entry.DN] = true
+			entries = append(entries, entry)
+		}
+	}
+
+	if failed > 0 && failed == len(Config.SearchBaseDNs) {
+		return nil, errs
+	}
+	return entries, nil
+}
+
+// followReferrals searches the users on the servers the referral URLs point to,
+// reusing the TLS and bind settings of this server.
+// Referrals are followed at most MaxReferralDepth hops deep, so referral loops end,
+// and a referral which can't be followed is logged and skipped.
+// The deadline and cancellation of ctx are honored while dialing and searching the referred servers.
+func (server *Server) followReferrals(ctx context.Context, referrals []string, logins []string) []*goldap.Entry {
+	maxDepth := server.Config.MaxReferralDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxReferralDepth
+	}
+	if server.referralDepth >= maxDepth {
+		logger.Warn("LDAP referral max depth reached", zap.Strings("referrals", referrals))
+		return nil
+	}
+
+	var entries []*goldap.Entry
+	for _, referral := range referrals {
+		referred, err := server.referredServer(referral)
+		if err != nil {
+			logger.Warn("invalid LDAP referral", zap.String("referral", referral), zap.Error(err))
+			continue
+		}
+		if err = referred.DialContext(ctx); err != nil {
+			logger.Warn("unable to dial LDAP referral", zap.String("referral", referral), zap.Error(err))
+			continue
+		}
+		var found []*goldap.Entry
+		err = runWithContext(ctx, referred.Connection, func() error {
+			defer referred.Close()
+			if err := referred.bind(); err != nil {
+				return err
+			}
+			found, err = referred.users(ctx, logins)
+			return err
+		})
+		if err != nil {
+			logger.Warn("unable to search LDAP referral", zap.String("referral", referral), zap.Error(err))
+			continue
+		}
+		entries = append(entries, found...)
+	}
+	return entries
+}
+
+// referredServer creates the server a referral URL such as
+// ldap://child.example.com/dc=child,dc=example,dc=com points to
+func (server *Server) referredServer(referral string) (*Server, error) {
+	u, err := url.Parse(referral)
+	if err != nil {
+		return nil, err
+	}
+	config := *server.Config
+	config.PoolSize = 0
+	switch u.Scheme {
+	case "ldap":
+		config.Port = 389
+	case "ldaps":
+		config.Port = 636
+		config.UseSSL = true
+		config.StartTLS = false
+	default:
+		return nil, fmt.Errorf("unsupported referral scheme %q", u.Scheme)
+	}
+	config.Host = u.Hostname()
+	if port := u.Port(); port != "" {
+		if config.Port, err = strconv.Atoi(port); err != nil {
+			return nil, err
+		}
+	}
+	if base := strings.TrimPrefix(u.Path, "/"); base != "" {
+		config.SearchBaseDNs = []string{base}
+	}
+	return &Server{Config: &config, Metrics: server.Metrics, referralDepth: server.referralDepth + 1}, nil
+}
+
+// search runs the search request with the paging control and requests the
+// following pages until the server returns an empty cookie, so directories
+// capping the size of a result don't silently truncate it.
+// The entries of all the pages are aggregated in the returned result.
+func (server *Server) search(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+	pageSize := server.Config.PageSize
+	if pageSize <= 0 {
+		pageSize = UsersMaxRequest
+	}
+	paging := goldap.NewControlPaging(uint32(pageSize))
+	request.Controls = append(request.Controls, paging)
+
+	result := &goldap.SearchResult{}
+	for {
+		page, err := server.Connection.Search(request)
 		if err != nil {
 			return nil, err
 		}
+		result.Entries = append(result.Entries, page.Entries...)
+		result.Referrals = append(result.Referrals, page.Referrals...)
 
-		if len(result.Entries) > 0 {
+		control, ok := goldap.FindControl(page.Controls, goldap.ControlTypePaging).(*goldap.ControlPaging)
+		if !ok || len(control.Cookie) == 0 {
 			break
 		}
+		paging.SetCookie(control.Cookie)
 	}
 
-	return result.Entries, nil
+	return result, nil
 }
 
 // validateGoldenUser validates user access.
 // If there are no ldap group mappings access is true
 // otherwise a single group must match
 func (server *Server) validateGoldenUser(user *models.User) error {
-	/*	if len(server.Config.Groups) > 0 && len(user.OrgRoles) < 1 {
+	if len(server.Config.Groups) > 0 && len(user.OrgRoles) < 1 {
 		logger.Error(
 			"User does not belong in any of the specified LDAP groups",
-			"username", user.Login,
-			"groups", user.Groups,
+			zap.String("username", user.Name),
 		)
 		return ErrInvalidCredentials
-	}*/
+	}
 
 	return nil
 }
@@ -467,6 +925,7 @@ func (server *Server) getSearchRequest(
 		// In case for the POSIX LDAP schema server
 		server.Config.GroupSearchFilterUserAttribute,
 	)
+	attributes = appendIfNotEmpty(attributes, server.Config.ExtraAttributes...)
 
 	search := ""
 	for _, login := range logins {
@@ -482,7 +941,7 @@ func (server *Server) getSearchRequest(
 
 	searchRequest := &goldap.SearchRequest{
 		BaseDN:       base,
-		Scope:        goldap.ScopeWholeSubtree,
+		Scope:        server.Config.SearchScope.goldapScope(),
 		DerefAliases: goldap.NeverDerefAliases,
 		Attributes:   attributes,
 		Filter:       filter,
@@ -497,10 +956,10 @@ func (server *Server) getSearchRequest(
 
 // buildGoldenUser extracts info from UserInfo model to ExternalUserInfo
 func (server *Server) buildGoldenUser(user *goldap.Entry) (*models.User, error) {
-	/*	memberOf, err := server.getMemberOf(user)
-		if err != nil {
-			return nil, err
-		}*/
+	directGroups, memberOf, err := server.getMemberOf(user)
+	if err != nil {
+		return nil, err
+	}
 
 	attrs := server.Config.Attr
 	extUser := &models.User{
@@ -512,31 +971,39 @@ func (server *Server) buildGoldenUser(user *goldap.Entry) (*models.User, error)
 				getAttribute(attrs.Surname, user),
 			),
 		),
-		//Login:    getAttribute(attrs.Username, user),
-		Email: getAttribute(attrs.Email, user),
-		/*		Groups:   memberOf,
-				OrgRoles: map[int64]models.RoleType{},*/
+		Login:        getAttribute(attrs.Username, user),
+		DN:           getAttribute("dn", user),
+		Email:        getAttribute(attrs.Email, user),
+		Groups:       memberOf,
+		DirectGroups: directGroups,
+		OrgRoles:     map[int64]string{},
 	}
 
-	/*	for _, group := range server.Config.Groups {
-			// only use the first match for each org
-			if extUser.OrgRoles[group.OrgId] != "" {
-				continue
+	if len(server.Config.ExtraAttributes) > 0 {
+		extUser.Attributes = map[string][]string{}
+		for _, name := range server.Config.ExtraAttributes {
+			if values := user.GetEqualFoldAttributeValues(name); len(values) > 0 {
+				extUser.Attributes[name] = values
 			}
+		}
+	}
 
-			if isMemberOf(memberOf, group.GroupDN) {
-				extUser.OrgRoles[group.OrgId] = group.OrgRole
-				if extUser.IsGrafanaAdmin == nil || !*extUser.IsGrafanaAdmin {
-					extUser.IsGrafanaAdmin = group.IsGrafanaAdmin
-				}
-			}
+	for _, group := range server.Config.Groups {
+		// only use the first match for each org
+		if extUser.OrgRoles[group.OrgId] != "" {
+			continue
 		}
 
-		// If there are group org mappings configured, but no matching mappings,
-		// the user will not be able to login and will be disabled
-		if len(server.Config.Groups) > 0 && len(extUser.OrgRoles) == 0 {
-			extUser.IsDisabled = true
-		}*/
+		if isMemberOf(memberOf, group.GroupDN) {
+			extUser.OrgRoles[group.OrgId] = group.OrgRole
+			if extUser.Role == "" {
+				extUser.Role = group.OrgRole
+			}
+			if group.SuperAdmin != nil && *group.SuperAdmin {
+				extUser.SuperAdmin = true
+			}
+		}
+	}
 
 	return extUser, nil
 }
@@ -561,13 +1028,19 @@ func (server *Server) UserBind(username, password string) error {
 // Dial() sets the connection with the server for this Struct. Therefore, we require a
 // call to Dial() before being able to execute this function.
 func (server *Server) AdminBind() error {
-	err := server.userBind(server.Config.BindDN, server.Config.BindPassword)
+	var err error
+	if server.Config.BindMethod == BindExternal {
+		err = server.externalBind()
+	} else {
+		err = server.userBind(server.Config.BindDN, server.Config.BindPassword)
+	}
 	if err != nil {
 		logger.Error(
 			"Cannot authenticate admin user in LDAP",
 			zap.Error(err),
 		)
-		return err
+		// a rejected admin bind is a misconfiguration, not invalid user credentials
+		return newOpError(ErrBindFailed, err)
 	}
 
 	return nil
@@ -588,6 +1061,28 @@ func (server *Server) userBind(path, password string) error {
 	return nil
 }
 
+// externalBind binds with SASL EXTERNAL using the identity of the client certificate.
+// The connection is already encrypted at this point, either by LDAPS or by the
+// StartTLS done in Dial().
+func (server *Server) externalBind() error {
+	config := server.Config
+	if config.ClientCert == "" || (!config.UseSSL && !config.StartTLS) {
+		return ErrExternalBindWithoutTLS
+	}
+
+	err := server.Connection.ExternalBind()
+	if err != nil {
+		var ldapErr *goldap.Error
+		if errors.As(err, &ldapErr) && ldapErr.ResultCode == 49 {
+			return ErrInvalidCredentials
+		}
+
+		return err
+	}
+
+	return nil
+}
+
 // requestMemberOf use this function when POSIX LDAP
 // schema does not support memberOf, so it manually search the groups
 func (server *Server) requestMemberOf(entry *goldap.Entry) ([]string, error) {
@@ -627,7 +1122,7 @@ func (server *Server) requestMemberOf(entry *goldap.Entry) ([]string, error) {
 
 		groupSearchReq := goldap.SearchRequest{
 			BaseDN:       groupSearchBase,
-			Scope:        goldap.ScopeWholeSubtree,
+			Scope:        config.GroupSearchScope.goldapScope(),
 			DerefAliases: goldap.NeverDerefAliases,
 			Attributes:   []string{groupIDAttribute},
 			Filter:       filter,
@@ -670,20 +1165,159 @@ func (server *Server) serializeUsers(
 	return serialized, nil
 }
 
-// getMemberOf finds memberOf property or request it
+// getMemberOf finds memberOf property or request it, it returns the groups
+// the user is directly a member of and all of its groups, which include the
+// parent groups when ResolveNestedGroups is set
 func (server *Server) getMemberOf(result *goldap.Entry) (
-	[]string, error,
+	direct []string, all []string, err error,
 ) {
+	var memberOf []string
 	if server.Config.GroupSearchFilter == "" {
-		memberOf := getArrayAttribute(server.Config.Attr.MemberOf, result)
+		memberOf = getArrayAttribute(server.Config.Attr.MemberOf, result)
+	} else {
+		memberOf, err = server.requestMemberOf(result)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
-		return memberOf, nil
+	if server.Config.ResolveNestedGroups {
+		all, err = server.resolveNestedGroups(memberOf)
+		return memberOf, all, err
 	}
 
-	memberOf, err := server.requestMemberOf(result)
-	if err != nil {
-		return nil, err
+	return memberOf, memberOf, nil
+}
+
+// resolveNestedGroups returns groups along with the groups they are members of,
+// transitively, by reading the memberOf attribute of each discovered group DN.
+// Every DN is looked up once, so membership cycles end, and at most
+// NestedGroupsMaxDepth levels of parent groups are resolved.
+func (server *Server) resolveNestedGroups(groups []string) ([]string, error) {
+	maxDepth := server.Config.NestedGroupsMaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultNestedGroupsMaxDepth
+	}
+	memberOfAttribute := server.Config.Attr.MemberOf
+	if memberOfAttribute == "" {
+		memberOfAttribute = "memberOf"
 	}
 
-	return memberOf, nil
+	seen := map[string]bool{}
+	var resolved []string
+	for _, group := range groups {
+		if !seen[group] {
+			seen[group] = true
+			resolved = append(resolved, group)
+		}
+	}
+
+	level := resolved
+	for depth := 0; depth < maxDepth && len(level) > 0; depth++ {
+		var parents []string
+		for _, group := range level {
+			result, err := server.Connection.Search(&goldap.SearchRequest{
+				BaseDN:       group,
+				Scope:        goldap.ScopeBaseObject,
+				DerefAliases: goldap.NeverDerefAliases,
+				Filter:       "(objectClass=*)",
+				Attributes:   []string{memberOfAttribute},
+			})
+			if err != nil {
+				// the group may live outside of the directory we are bound to
+				if goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) {
+					continue
+				}
+				return nil, err
+			}
+			for _, entry := range result.Entries {
+				for _, parent := range getArrayAttribute(memberOfAttribute, entry) {
+					if !seen[parent] {
+						seen[parent] = true
+						parents = append(parents, parent)
+					}
+				}
+			}
+		}
+		resolved = append(resolved, parents...)
+		level = parents
+	}
+
+	return resolved, nil
+}
+
+// Validate checks the server config for missing fields and conflicting options,
+// all the problems found are combined in the returned error
+func (config *ServerConfig) Validate() (err error) {
+	// port is only required by the hosts without their own port
+	if _, e := parseHosts(config.Host, config.Port); e != nil {
+		err = multierr.Append(err, e)
+	}
+	if config.UseSSL && config.StartTLS {
+		err = multierr.Append(err, errors.New("use_ssl and start_tls are mutually exclusive"))
+	}
+	if (config.ClientCert == "") != (config.ClientKey == "") {
+		err = multierr.Append(err, errors.New("client_cert and client_key must be set together"))
+	}
+	err = multierr.Append(err, config.validateInlineCerts())
+	err = multierr.Append(err, config.validateTLS())
+	switch config.BindMethod {
+	case "", BindSimple:
+	case BindExternal:
+		if config.ClientCert == "" || (!config.UseSSL && !config.StartTLS) {
+			err = multierr.Append(err, ErrExternalBindWithoutTLS)
+		}
+	default:
+		err = multierr.Append(err, fmt.Errorf("unknown bind_method %q", config.BindMethod))
+	}
+	switch config.PingMethod {
+	case "", PingTCPBind, PingCLDAP:
+	default:
+		err = multierr.Append(err, fmt.Errorf("unknown ping_method %q", config.PingMethod))
+	}
+	if len(config.SearchBaseDNs) == 0 {
+		err = multierr.Append(err, errors.New("search_base_dns is required"))
+	}
+	if !config.SearchScope.valid() {
+		err = multierr.Append(err, fmt.Errorf("unknown search_scope %q, must be base, one or sub", config.SearchScope))
+	}
+	if !config.GroupSearchScope.valid() {
+		err = multierr.Append(err, fmt.Errorf("unknown group_search_scope %q, must be base, one or sub", config.GroupSearchScope))
+	}
+	err = multierr.Append(err, validateFilter("search_filter", config.SearchFilter))
+	if config.GroupSearchFilter != "" {
+		err = multierr.Append(err, validateFilter("group_search_filter", config.GroupSearchFilter))
+	}
+	if config.PoolSize < 0 || config.PageSize < 0 || config.MaxReferralDepth < 0 || config.NestedGroupsMaxDepth < 0 {
+		err = multierr.Append(err, errors.New("pool_size, page_size, max_referral_depth and nested_groups_max_depth can't be negative"))
+	}
+	if config.ConnMaxIdle < 0 || config.DialTimeout < 0 {
+		err = multierr.Append(err, errors.New("conn_max_idle and dial_timeout can't be negative"))
+	}
+	return err
+}
+
+// validateFilter checks the filter has the %s placeholder replaced by the login,
+// without it every login would search the same entries, and that its
+// parentheses are balanced, otherwise the search silently finds nothing
+func validateFilter(name, filter string) error {
+	if !strings.Contains(filter, "%s") {
+		return fmt.Errorf("%s %q must contain the %%s placeholder", name, filter)
+	}
+	depth := 0
+	for _, c := range filter {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth < 0 {
+			break
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("%s %q has unbalanced parentheses", name, filter)
+	}
+	return nil
 }
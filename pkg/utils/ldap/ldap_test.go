@@ -0,0 +1,754 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/utils/types"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// fakeConnection is an IConnection which records the binds and answers
+// the binds with bindFn and the searches with searchFn
+type fakeConnection struct {
+	binds    []string
+	searches []*goldap.SearchRequest
+	bindFn   func(username, password string) error
+	searchFn func(request *goldap.SearchRequest) (*goldap.SearchResult, error)
+	closed   bool
+}
+
+func (c *fakeConnection) Bind(username, password string) error {
+	c.binds = append(c.binds, username)
+	if c.bindFn == nil {
+		return nil
+	}
+	return c.bindFn(username, password)
+}
+
+func (c *fakeConnection) UnauthenticatedBind(username string) error {
+	c.binds = append(c.binds, username)
+	return nil
+}
+
+func (c *fakeConnection) ExternalBind() error {
+	c.binds = append(c.binds, "EXTERNAL")
+	return nil
+}
+
+func (c *fakeConnection) Add(*goldap.AddRequest) error {
+	return nil
+}
+
+func (c *fakeConnection) Del(*goldap.DelRequest) error {
+	return nil
+}
+
+func (c *fakeConnection) Search(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+	c.searches = append(c.searches, request)
+	if c.searchFn == nil {
+		return &goldap.SearchResult{}, nil
+	}
+	return c.searchFn(request)
+}
+
+func (c *fakeConnection) StartTLS(*tls.Config) error {
+	return nil
+}
+
+func (c *fakeConnection) Close() {
+	c.closed = true
+}
+
+func TestUsersPosixGroups(t *testing.T) {
+	conn := &fakeConnection{
+		searchFn: func(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+			switch request.BaseDN {
+			case "ou=users,dc=example,dc=com":
+				return &goldap.SearchResult{Entries: []*goldap.Entry{
+					goldap.NewEntry("cn=jdoe,ou=users,dc=example,dc=com", map[string][]string{
+						"uid":  {"jdoe"},
+						"cn":   {"John"},
+						"sn":   {"Doe"},
+						"mail": {"jdoe@example.com"},
+					}),
+				}}, nil
+			case "ou=groups,dc=example,dc=com":
+				if request.Filter != "(&(objectClass=posixGroup)(memberUid=jdoe))" {
+					t.Errorf("unexpected group filter %s", request.Filter)
+				}
+				return &goldap.SearchResult{Entries: []*goldap.Entry{
+					goldap.NewEntry("cn=admins,ou=groups,dc=example,dc=com", nil),
+					goldap.NewEntry("cn=devs,ou=groups,dc=example,dc=com", nil),
+				}}, nil
+			}
+			t.Errorf("unexpected base dn %s", request.BaseDN)
+			return &goldap.SearchResult{}, nil
+		},
+	}
+	server := &Server{
+		Config: &ServerConfig{
+			Attr: AttributeMap{
+				Username: "uid",
+				Name:     "cn",
+				Surname:  "sn",
+				Email:    "mail",
+			},
+			SearchFilter:       "(uid=%s)",
+			SearchBaseDNs:      []string{"ou=users,dc=example,dc=com"},
+			GroupSearchFilter:  "(&(objectClass=posixGroup)(memberUid=%s))",
+			GroupSearchBaseDNs: []string{"ou=groups,dc=example,dc=com"},
+		},
+		Connection: conn,
+	}
+
+	users, err := server.Users([]string{"jdoe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 {
+		t.Fatalf("expected 1 user, got %d", len(users))
+	}
+	groups := []string{
+		"cn=admins,ou=groups,dc=example,dc=com",
+		"cn=devs,ou=groups,dc=example,dc=com",
+	}
+	if !reflect.DeepEqual(users[0].Groups, groups) {
+		t.Errorf("expected groups %v, got %v", groups, users[0].Groups)
+	}
+}
+
+func TestLoginBindsWithEntryDN(t *testing.T) {
+	conn := &fakeConnection{
+		searchFn: func(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+			return &goldap.SearchResult{Entries: []*goldap.Entry{
+				goldap.NewEntry("cn=jdoe,ou=users,dc=example,dc=com", map[string][]string{
+					"uid": {"jdoe"},
+					"cn":  {"John"},
+					"sn":  {"Doe"},
+				}),
+			}}, nil
+		},
+	}
+	server := &Server{
+		Config: &ServerConfig{
+			BindDN:       "cn=admin,dc=example,dc=com",
+			BindPassword: "secret",
+			Attr: AttributeMap{
+				Username: "uid",
+				Name:     "cn",
+				Surname:  "sn",
+			},
+			SearchFilter:  "(uid=%s)",
+			SearchBaseDNs: []string{"ou=users,dc=example,dc=com"},
+		},
+		Connection: conn,
+	}
+
+	user, err := server.Login(&types.LoginData{Name: "jdoe", Password: "pwd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "John Doe" {
+		t.Errorf("expected name John Doe, got %s", user.Name)
+	}
+	if user.Login != "jdoe" {
+		t.Errorf("expected login jdoe, got %s", user.Login)
+	}
+	binds := []string{"cn=admin,dc=example,dc=com", "cn=jdoe,ou=users,dc=example,dc=com"}
+	if !reflect.DeepEqual(conn.binds, binds) {
+		t.Errorf("expected binds %v, got %v", binds, conn.binds)
+	}
+}
+
+func TestUsersPagedSearch(t *testing.T) {
+	conn := &fakeConnection{}
+	conn.searchFn = func(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+		paging, ok := goldap.FindControl(request.Controls, goldap.ControlTypePaging).(*goldap.ControlPaging)
+		if !ok {
+			t.Fatal("search request without paging control")
+		}
+		if paging.PagingSize != 1 {
+			t.Errorf("expected page size 1, got %d", paging.PagingSize)
+		}
+		if len(conn.searches) == 1 {
+			if len(paging.Cookie) != 0 {
+				t.Errorf("unexpected cookie %q in the first request", paging.Cookie)
+			}
+			return &goldap.SearchResult{
+				Entries: []*goldap.Entry{
+					goldap.NewEntry("cn=jdoe,ou=users,dc=example,dc=com", map[string][]string{"uid": {"jdoe"}}),
+				},
+				Controls: []goldap.Control{&goldap.ControlPaging{PagingSize: 1, Cookie: []byte("next")}},
+			}, nil
+		}
+		if string(paging.Cookie) != "next" {
+			t.Errorf("expected cookie next, got %q", paging.Cookie)
+		}
+		return &goldap.SearchResult{
+			Entries: []*goldap.Entry{
+				goldap.NewEntry("cn=asmith,ou=users,dc=example,dc=com", map[string][]string{"uid": {"asmith"}}),
+			},
+			Controls: []goldap.Control{&goldap.ControlPaging{PagingSize: 1}},
+		}, nil
+	}
+	server := &Server{
+		Config: &ServerConfig{
+			Attr:          AttributeMap{Username: "uid"},
+			SearchFilter:  "(uid=%s)",
+			SearchBaseDNs: []string{"ou=users,dc=example,dc=com"},
+			PageSize:      1,
+		},
+		Connection: conn,
+	}
+
+	users, err := server.Users([]string{"jdoe", "asmith"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.searches) != 2 {
+		t.Errorf("expected 2 searches, got %d", len(conn.searches))
+	}
+	var logins []string
+	for _, user := range users {
+		logins = append(logins, user.Login)
+	}
+	if !reflect.DeepEqual(logins, []string{"jdoe", "asmith"}) {
+		t.Errorf("expected users of both pages, got %v", logins)
+	}
+}
+
+func TestUsersNestedGroups(t *testing.T) {
+	parents := map[string][]string{
+		"cn=devs,ou=groups,dc=example,dc=com":  {"cn=staff,ou=groups,dc=example,dc=com"},
+		"cn=staff,ou=groups,dc=example,dc=com": {"cn=all,ou=groups,dc=example,dc=com"},
+		// a membership cycle
+		"cn=all,ou=groups,dc=example,dc=com": {"cn=devs,ou=groups,dc=example,dc=com"},
+	}
+	conn := &fakeConnection{
+		searchFn: func(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+			if request.Scope == goldap.ScopeBaseObject {
+				return &goldap.SearchResult{Entries: []*goldap.Entry{
+					goldap.NewEntry(request.BaseDN, map[string][]string{"memberOf": parents[request.BaseDN]}),
+				}}, nil
+			}
+			return &goldap.SearchResult{Entries: []*goldap.Entry{
+				goldap.NewEntry("cn=jdoe,ou=users,dc=example,dc=com", map[string][]string{
+					"uid":      {"jdoe"},
+					"memberOf": {"cn=devs,ou=groups,dc=example,dc=com"},
+				}),
+			}}, nil
+		},
+	}
+	server := &Server{
+		Config: &ServerConfig{
+			Attr:                AttributeMap{Username: "uid", MemberOf: "memberOf"},
+			SearchFilter:        "(uid=%s)",
+			SearchBaseDNs:       []string{"ou=users,dc=example,dc=com"},
+			ResolveNestedGroups: true,
+		},
+		Connection: conn,
+	}
+
+	users, err := server.Users([]string{"jdoe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := []string{
+		"cn=devs,ou=groups,dc=example,dc=com",
+		"cn=staff,ou=groups,dc=example,dc=com",
+		"cn=all,ou=groups,dc=example,dc=com",
+	}
+	if !reflect.DeepEqual(users[0].Groups, groups) {
+		t.Errorf("expected groups %v, got %v", groups, users[0].Groups)
+	}
+	if !reflect.DeepEqual(users[0].DirectGroups, groups[:1]) {
+		t.Errorf("expected direct groups %v, got %v", groups[:1], users[0].DirectGroups)
+	}
+	// one user search and one lookup per group
+	if len(conn.searches) != 4 {
+		t.Errorf("expected 4 searches, got %d", len(conn.searches))
+	}
+}
+
+func TestBindExternal(t *testing.T) {
+	conn := &fakeConnection{}
+	server := &Server{
+		Config: &ServerConfig{
+			StartTLS:   true,
+			ClientCert: "/etc/ssl/client.pem",
+			ClientKey:  "/etc/ssl/client.key",
+			BindMethod: BindExternal,
+		},
+		Connection: conn,
+	}
+
+	if err := server.Bind(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(conn.binds, []string{"EXTERNAL"}) {
+		t.Errorf("expected an external bind, got %v", conn.binds)
+	}
+
+	server.Config.StartTLS = false
+	if err := server.Bind(); !errors.Is(err, ErrExternalBindWithoutTLS) || !errors.Is(err, ErrBindFailed) {
+		t.Errorf("expected ErrExternalBindWithoutTLS, got %v", err)
+	}
+}
+
+func TestUsersSearchesAllBases(t *testing.T) {
+	jdoe := goldap.NewEntry("cn=jdoe,ou=staff,dc=example,dc=com", map[string][]string{"uid": {"jdoe"}})
+	asmith := goldap.NewEntry("cn=asmith,ou=staff,dc=example,dc=com", map[string][]string{"uid": {"asmith"}})
+	for _, tc := range []struct {
+		name    string
+		results map[string]*goldap.SearchResult
+		logins  []string
+		err     bool
+	}{
+		{
+			name: "second base has the user",
+			results: map[string]*goldap.SearchResult{
+				"ou=users,dc=example,dc=com": {},
+				"ou=staff,dc=example,dc=com": {Entries: []*goldap.Entry{jdoe}},
+			},
+			logins: []string{"jdoe"},
+		},
+		{
+			name: "first base errors",
+			results: map[string]*goldap.SearchResult{
+				"ou=staff,dc=example,dc=com": {Entries: []*goldap.Entry{jdoe}},
+			},
+			logins: []string{"jdoe"},
+		},
+		{
+			name: "overlapping bases",
+			results: map[string]*goldap.SearchResult{
+				"ou=users,dc=example,dc=com": {Entries: []*goldap.Entry{jdoe}},
+				"ou=staff,dc=example,dc=com": {Entries: []*goldap.Entry{jdoe, asmith}},
+			},
+			logins: []string{"jdoe", "asmith"},
+		},
+		{
+			name:    "every base errors",
+			results: map[string]*goldap.SearchResult{},
+			err:     true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := &fakeConnection{searchFn: func(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+				if result, ok := tc.results[request.BaseDN]; ok {
+					return result, nil
+				}
+				return nil, goldap.NewError(goldap.LDAPResultNoSuchObject, errors.New("no such object"))
+			}}
+			server := &Server{
+				Config: &ServerConfig{
+					Attr:          AttributeMap{Username: "uid"},
+					SearchFilter:  "(uid=%s)",
+					SearchBaseDNs: []string{"ou=users,dc=example,dc=com", "ou=staff,dc=example,dc=com"},
+				},
+				Connection: conn,
+			}
+
+			users, err := server.Users([]string{"jdoe", "asmith"})
+			if tc.err {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var logins []string
+			for _, user := range users {
+				logins = append(logins, user.Login)
+			}
+			if !reflect.DeepEqual(logins, tc.logins) {
+				t.Errorf("expected users %v, got %v", tc.logins, logins)
+			}
+		})
+	}
+}
+
+func TestUsersWithoutSearchBase(t *testing.T) {
+	conn := &fakeConnection{}
+	server := &Server{
+		Config: &ServerConfig{
+			Attr:         AttributeMap{Username: "uid"},
+			SearchFilter: "(uid=%s)",
+		},
+		Connection: conn,
+	}
+
+	entries, err := server.users(context.Background(), []string{"jdoe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries == nil || len(entries) != 0 {
+		t.Errorf("expected an empty slice, got %#v", entries)
+	}
+	if len(conn.searches) != 0 {
+		t.Errorf("expected no search, got %d", len(conn.searches))
+	}
+	users, err := server.Users([]string{"jdoe"})
+	if err != nil || len(users) != 0 {
+		t.Errorf("expected no user, got %v %v", users, err)
+	}
+}
+
+func TestValidateFilter(t *testing.T) {
+	for filter, valid := range map[string]bool{
+		"(uid=%s)": true,
+		"(&(objectClass=person)(|(uid=%s)(mail=%s)))": true,
+		"(uid=jdoe)":                     false,
+		"(&(objectClass=person)(uid=%s)": false,
+		"(uid=%s))":                      false,
+		")(uid=%s(":                      false,
+		"":                               false,
+	} {
+		if err := validateFilter("search_filter", filter); (err == nil) != valid {
+			t.Errorf("filter %q: expected valid %v, got %v", filter, valid, err)
+		}
+	}
+}
+
+func TestUsersPartial(t *testing.T) {
+	conn := &fakeConnection{
+		searchFn: func(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+			// the first chunk fails, the second one finds its user
+			if strings.Contains(request.Filter, "(uid=user0)") {
+				return nil, goldap.NewError(goldap.LDAPResultTimeLimitExceeded, errors.New("time limit exceeded"))
+			}
+			return &goldap.SearchResult{Entries: []*goldap.Entry{
+				goldap.NewEntry("cn=jdoe,ou=users,dc=example,dc=com", map[string][]string{"uid": {"jdoe"}}),
+			}}, nil
+		},
+	}
+	server := &Server{
+		Config: &ServerConfig{
+			Attr:          AttributeMap{Username: "uid"},
+			SearchFilter:  "(uid=%s)",
+			SearchBaseDNs: []string{"ou=users,dc=example,dc=com"},
+		},
+		Connection: conn,
+	}
+	logins := make([]string, UsersMaxRequest+1)
+	for i := range logins[:UsersMaxRequest] {
+		logins[i] = fmt.Sprintf("user%d", i)
+	}
+	logins[UsersMaxRequest] = "jdoe"
+
+	if _, err := server.Users(logins); err == nil {
+		t.Error("expected Users to fail as a whole")
+	}
+
+	users, failed, err := server.UsersPartial(logins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Login != "jdoe" {
+		t.Errorf("expected the user of the second chunk, got %v", users)
+	}
+	if len(failed) != UsersMaxRequest || failed[0].Login != "user0" || failed[0].Err == nil {
+		t.Errorf("expected the logins of the first chunk to fail, got %d", len(failed))
+	}
+
+	// every chunk failed
+	if users, failed, err = server.UsersPartial(logins[:2]); err == nil || users != nil || len(failed) != 2 {
+		t.Errorf("expected an error when every chunk fails, got %v %v %v", users, failed, err)
+	}
+}
+
+func TestSearchScope(t *testing.T) {
+	scopes := map[string]int{}
+	conn := &fakeConnection{
+		searchFn: func(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+			scopes[request.BaseDN] = request.Scope
+			if request.BaseDN == "ou=groups,dc=example,dc=com" {
+				return &goldap.SearchResult{}, nil
+			}
+			return &goldap.SearchResult{Entries: []*goldap.Entry{
+				goldap.NewEntry("cn=jdoe,ou=users,dc=example,dc=com", map[string][]string{"uid": {"jdoe"}}),
+			}}, nil
+		},
+	}
+	server := &Server{
+		Config: &ServerConfig{
+			Attr:               AttributeMap{Username: "uid"},
+			SearchFilter:       "(uid=%s)",
+			SearchBaseDNs:      []string{"ou=users,dc=example,dc=com"},
+			SearchScope:        ScopeOne,
+			GroupSearchFilter:  "(memberUid=%s)",
+			GroupSearchBaseDNs: []string{"ou=groups,dc=example,dc=com"},
+		},
+		Connection: conn,
+	}
+
+	if _, err := server.Users([]string{"jdoe"}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{
+		"ou=users,dc=example,dc=com": goldap.ScopeSingleLevel,
+		// the group search scope defaults to the whole subtree
+		"ou=groups,dc=example,dc=com": goldap.ScopeWholeSubtree,
+	}
+	if !reflect.DeepEqual(scopes, want) {
+		t.Errorf("expected scopes %v, got %v", want, scopes)
+	}
+
+	server.Config.GroupSearchScope = "subtree"
+	if err := server.Config.Validate(); err == nil || !strings.Contains(err.Error(), "group_search_scope") {
+		t.Errorf("expected an unknown group_search_scope error, got %v", err)
+	}
+}
+
+func TestLookupUser(t *testing.T) {
+	conn := &fakeConnection{
+		searchFn: func(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+			return &goldap.SearchResult{Entries: []*goldap.Entry{
+				goldap.NewEntry("cn=jdoe,ou=users,dc=example,dc=com", map[string][]string{
+					"uid":      {"jdoe"},
+					"memberOf": {"cn=devs,ou=groups,dc=example,dc=com"},
+				}),
+			}}, nil
+		},
+	}
+	config := &ServerConfig{
+		BindDN:        "cn=admin,dc=example,dc=com",
+		BindPassword:  "secret",
+		Attr:          AttributeMap{Username: "uid", MemberOf: "memberOf"},
+		SearchFilter:  "(uid=%s)",
+		SearchBaseDNs: []string{"ou=users,dc=example,dc=com"},
+	}
+	server := &Server{Config: config, Connection: conn}
+
+	user, err := server.LookupUser("jdoe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Login != "jdoe" {
+		t.Errorf("expected login jdoe, got %s", user.Login)
+	}
+	// only the admin bind, the user is never bound
+	if binds := []string{"cn=admin,dc=example,dc=com"}; !reflect.DeepEqual(conn.binds, binds) {
+		t.Errorf("expected binds %v, got %v", binds, conn.binds)
+	}
+
+	config.Groups = []*GroupToOrgRole{{GroupDN: "cn=admins,ou=groups,dc=example,dc=com", OrgRole: "Admin"}}
+	if _, err := server.LookupUser("jdoe"); err != ErrInvalidCredentials {
+		t.Errorf("expected a user outside of the groups to be rejected, got %v", err)
+	}
+}
+
+func TestUsersExtraAttributes(t *testing.T) {
+	conn := &fakeConnection{
+		searchFn: func(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+			return &goldap.SearchResult{Entries: []*goldap.Entry{
+				goldap.NewEntry("cn=jdoe,ou=users,dc=example,dc=com", map[string][]string{
+					"uid":             {"jdoe"},
+					"telephoneNumber": {"+1 555 0100", "+1 555 0101"},
+				}),
+			}}, nil
+		},
+	}
+	server := &Server{
+		Config: &ServerConfig{
+			Attr:            AttributeMap{Username: "uid"},
+			ExtraAttributes: []string{"telephoneNumber", "department"},
+			SearchFilter:    "(uid=%s)",
+			SearchBaseDNs:   []string{"ou=users,dc=example,dc=com"},
+		},
+		Connection: conn,
+	}
+
+	users, err := server.Users([]string{"jdoe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributes := conn.searches[0].Attributes
+	if !reflect.DeepEqual(attributes, []string{"uid", "telephoneNumber", "department"}) {
+		t.Errorf("expected the extra attributes to be requested, got %v", attributes)
+	}
+	want := map[string][]string{"telephoneNumber": {"+1 555 0100", "+1 555 0101"}}
+	if len(users) != 1 || !reflect.DeepEqual(users[0].Attributes, want) {
+		t.Errorf("expected attributes %v, got %+v", want, users)
+	}
+}
+
+func TestLoginNormalizesUsername(t *testing.T) {
+	defer func(n types.UsernameNormalizer) { types.Normalize = n }(types.Normalize)
+	types.Normalize = types.UsernameNormalizer{Lowercase: true, StripDomain: true}
+
+	for _, name := range []string{"  JDoe ", "JDOE@example.com", " jdoe@EXAMPLE.COM"} {
+		conn := &fakeConnection{
+			searchFn: func(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+				if request.Filter != "(|(uid=jdoe))" {
+					t.Errorf("%q: unexpected filter %s", name, request.Filter)
+				}
+				return &goldap.SearchResult{Entries: []*goldap.Entry{
+					goldap.NewEntry("uid=jdoe,ou=users,dc=example,dc=com", map[string][]string{"uid": {"jdoe"}}),
+				}}, nil
+			},
+		}
+		server := &Server{
+			Config: &ServerConfig{
+				BindDN:        "uid=%s,ou=users,dc=example,dc=com",
+				Attr:          AttributeMap{Username: "uid"},
+				SearchFilter:  "(uid=%s)",
+				SearchBaseDNs: []string{"ou=users,dc=example,dc=com"},
+			},
+			Connection: conn,
+		}
+
+		query := &types.LoginData{Name: name, Password: "PassWord"}
+		if _, err := server.Login(query); err != nil {
+			t.Fatalf("%q: %v", name, err)
+		}
+		if binds := []string{"uid=jdoe,ou=users,dc=example,dc=com"}; !reflect.DeepEqual(conn.binds, binds) {
+			t.Errorf("%q: expected binds %v, got %v", name, binds, conn.binds)
+		}
+		if query.Password != "PassWord" {
+			t.Errorf("%q: the password must not be normalized, got %s", name, query.Password)
+		}
+	}
+}
+
+func TestLoginErrorKinds(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		cause error
+		kind  error
+	}{
+		{"search failed", goldap.NewError(goldap.LDAPResultOperationsError, errors.New("operations error")), ErrSearchFailed},
+		{"connection failed", goldap.NewError(goldap.ErrorNetwork, errors.New("connection reset")), ErrConnection},
+	} {
+		conn := &fakeConnection{searchFn: func(*goldap.SearchRequest) (*goldap.SearchResult, error) {
+			return nil, tc.cause
+		}}
+		server := &Server{
+			Config: &ServerConfig{
+				Attr:          AttributeMap{Username: "uid"},
+				SearchFilter:  "(uid=%s)",
+				SearchBaseDNs: []string{"ou=users,dc=example,dc=com"},
+			},
+			Connection: conn,
+		}
+
+		_, err := server.Login(&types.LoginData{Name: "jdoe", Password: "pwd"})
+		if !errors.Is(err, tc.kind) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.kind, err)
+		}
+		if !errors.Is(err, tc.cause) {
+			t.Errorf("%s: expected the cause to be wrapped, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestLoginMultipleUsersFound(t *testing.T) {
+	conn := &fakeConnection{
+		searchFn: func(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+			return &goldap.SearchResult{Entries: []*goldap.Entry{
+				goldap.NewEntry("cn=jdoe,ou=users,dc=example,dc=com", map[string][]string{"uid": {"jdoe"}}),
+				goldap.NewEntry("cn=jdoe,ou=admins,dc=example,dc=com", map[string][]string{"uid": {"jdoe"}}),
+			}}, nil
+		},
+	}
+	server := &Server{
+		Config: &ServerConfig{
+			BindDN:        "cn=admin,dc=example,dc=com",
+			BindPassword:  "secret",
+			Attr:          AttributeMap{Username: "uid"},
+			SearchFilter:  "(|(uid=%s)(cn=%s))",
+			SearchBaseDNs: []string{"ou=users,dc=example,dc=com"},
+		},
+		Connection: conn,
+	}
+
+	if _, err := server.Login(&types.LoginData{Name: "jdoe", Password: "pwd"}); err != ErrMultipleUsersFound {
+		t.Errorf("expected ErrMultipleUsersFound, got %v", err)
+	}
+	// the user is never bound
+	if binds := []string{"cn=admin,dc=example,dc=com"}; !reflect.DeepEqual(conn.binds, binds) {
+		t.Errorf("expected binds %v, got %v", binds, conn.binds)
+	}
+	if _, err := server.LookupUser("jdoe"); err != ErrMultipleUsersFound {
+		t.Errorf("expected ErrMultipleUsersFound, got %v", err)
+	}
+}
+
+func TestPingWithRetry(t *testing.T) {
+	connErr := goldap.NewError(goldap.ErrorNetwork, errors.New("no such host"))
+	for _, tc := range []struct {
+		name   string
+		errs   []error
+		pings  int
+		failed bool
+	}{
+		{"available at once", []error{nil}, 1, false},
+		{"available after a connection error", []error{connErr, connErr, nil}, 3, false},
+		{"retries exhausted", []error{connErr, connErr, connErr, connErr}, 3, true},
+		{"config error is not retried", []error{errors.New("invalid TLS config"), nil}, 1, true},
+	} {
+		pings := 0
+		ping := func() ([]*ServerStatus, error) {
+			err := tc.errs[pings]
+			pings++
+			return []*ServerStatus{
+				{Host: "ldap1.example.com", Available: true},
+				{Host: "ldap2.example.com", Available: err == nil, Error: err},
+			}, nil
+		}
+		err := pingWithRetry(ping, 2, time.Millisecond)
+		if (err != nil) != tc.failed {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		}
+		if pings != tc.pings {
+			t.Errorf("%s: expected %d pings, got %d", tc.name, tc.pings, pings)
+		}
+	}
+}
+
+func TestFollowReferralsContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan struct{}, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- struct{}{}
+			conn.Close()
+		}
+	}()
+
+	metrics := &Metrics{}
+	server := &Server{Config: &ServerConfig{SearchFilter: "(uid=%s)"}, Metrics: metrics}
+	referral := "ldap://" + l.Addr().String() + "/dc=child,dc=example,dc=com"
+	referred, err := server.referredServer(referral)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if referred.Metrics != metrics {
+		t.Error("expected the referred server to record in the same metrics")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if entries := server.followReferrals(ctx, []string{referral}, []string{"jdoe"}); len(entries) != 0 {
+		t.Errorf("expected no entry, got %v", entries)
+	}
+	select {
+	case <-accepted:
+		t.Error("expected the referral not to be dialed once ctx is done")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
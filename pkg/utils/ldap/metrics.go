@@ -0,0 +1,112 @@
+package ldap
+
+import (
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds the Prometheus collectors of the LDAP operations,
+// labeled by host and operation (bind or search).
+// Nothing is registered until NewMetrics is called, so the collectors
+// only show up when metrics are enabled.
+type Metrics struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// NewMetrics creates the LDAP collectors and registers them with reg.
+// Collectors already registered with reg, e.g. by the MultiLDAP replaced
+// on a config reload, are reused.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ldap_operation_duration_seconds",
+		Help:    "Duration of LDAP operations in seconds.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"host", "operation"})
+	errorsTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ldap_operation_errors_total",
+		Help: "Total number of failed LDAP operations.",
+	}, []string{"host", "operation"})
+
+	if err := reg.Register(duration); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return nil, err
+		}
+		duration = are.ExistingCollector.(*prometheus.HistogramVec)
+	}
+	if err := reg.Register(errorsTotal); err != nil {
+		are, ok := err.(prometheus.AlreadyRegisteredError)
+		if !ok {
+			return nil, err
+		}
+		errorsTotal = are.ExistingCollector.(*prometheus.CounterVec)
+	}
+	return &Metrics{duration: duration, errors: errorsTotal}, nil
+}
+
+// observe records the duration of an operation started at start and counts its error
+func (metrics *Metrics) observe(host, operation string, start time.Time, err error) {
+	metrics.duration.WithLabelValues(host, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.errors.WithLabelValues(host, operation).Inc()
+	}
+}
+
+// instrumentedConn records the binds and searches of the wrapped connection
+type instrumentedConn struct {
+	IConnection
+	host    string
+	metrics *Metrics
+}
+
+func (c *instrumentedConn) Bind(username, password string) (err error) {
+	defer func(start time.Time) { c.metrics.observe(c.host, "bind", start, err) }(time.Now())
+	return c.IConnection.Bind(username, password)
+}
+
+func (c *instrumentedConn) UnauthenticatedBind(username string) (err error) {
+	defer func(start time.Time) { c.metrics.observe(c.host, "bind", start, err) }(time.Now())
+	return c.IConnection.UnauthenticatedBind(username)
+}
+
+func (c *instrumentedConn) ExternalBind() (err error) {
+	defer func(start time.Time) { c.metrics.observe(c.host, "bind", start, err) }(time.Now())
+	return c.IConnection.ExternalBind()
+}
+
+func (c *instrumentedConn) Search(request *goldap.SearchRequest) (result *goldap.SearchResult, err error) {
+	defer func(start time.Time) { c.metrics.observe(c.host, "search", start, err) }(time.Now())
+	return c.IConnection.Search(request)
+}
+
+// SetDeadline applies the deadline to the wrapped connection when it supports deadlines
+func (c *instrumentedConn) SetDeadline(t time.Time) error {
+	if d, ok := c.IConnection.(deadliner); ok {
+		return d.SetDeadline(t)
+	}
+	return nil
+}
+
+// IsClosing reports whether the wrapped connection is closing
+func (c *instrumentedConn) IsClosing() bool {
+	return isClosing(c.IConnection)
+}
+
+// instrument wraps conn so its operations are recorded by metrics, metrics may be nil
+func instrument(conn IConnection, host string, metrics *Metrics) IConnection {
+	if metrics == nil || conn == nil {
+		return conn
+	}
+	return &instrumentedConn{IConnection: conn, host: host, metrics: metrics}
+}
+
+// uninstrument returns the connection wrapped by instrument
+func uninstrument(conn IConnection) IConnection {
+	if c, ok := conn.(*instrumentedConn); ok {
+		return c.IConnection
+	}
+	return conn
+}
@@ -0,0 +1,42 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics, err := NewMetrics(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the collectors of a replaced MultiLDAP are reused
+	if again, err := NewMetrics(reg); err != nil || again.duration != metrics.duration {
+		t.Fatalf("expected the registered collectors to be reused, got %v", err)
+	}
+
+	conn := instrument(&fakeConnection{searchFn: func(*goldap.SearchRequest) (*goldap.SearchResult, error) {
+		return nil, errors.New("search failed")
+	}}, "ldap.example.com", metrics)
+	conn.Bind("cn=admin,dc=example,dc=com", "secret")
+	conn.Search(&goldap.SearchRequest{})
+	conn.Search(&goldap.SearchRequest{})
+
+	if n := testutil.CollectAndCount(metrics.duration); n != 2 {
+		t.Errorf("expected a bind and a search series, got %d", n)
+	}
+	if v := testutil.ToFloat64(metrics.errors.WithLabelValues("ldap.example.com", "search")); v != 2 {
+		t.Errorf("expected 2 search errors, got %v", v)
+	}
+	if v := testutil.ToFloat64(metrics.errors.WithLabelValues("ldap.example.com", "bind")); v != 0 {
+		t.Errorf("expected no bind error, got %v", v)
+	}
+	if _, ok := uninstrument(conn).(*fakeConnection); !ok {
+		t.Error("expected uninstrument to return the wrapped connection")
+	}
+}
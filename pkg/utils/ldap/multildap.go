@@ -1,11 +1,19 @@
 package ldap
 
 import (
+	"context"
 	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"gitee.com/golden-go/golden-go/pkg/models"
 	"gitee.com/golden-go/golden-go/pkg/utils/logger"
 	"gitee.com/golden-go/golden-go/pkg/utils/types"
+	goldap "github.com/go-ldap/ldap/v3"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 )
 
@@ -17,12 +25,20 @@ var ErrDidNotFindUser = errors.New("did not find a user")
 
 // ServerStatus holds the LDAP server status
 type ServerStatus struct {
-	Host      string
-	Port      int
-	Available bool
-	Error     error
+	Host        string
+	Port        int
+	Available   bool
+	LastChecked time.Time
+	Error       error
 }
 
+const (
+	// DefaultHealthCheckTTL is how long the result of HealthCheck is cached by default
+	DefaultHealthCheckTTL = 30 * time.Second
+	// DefaultHealthCheckTimeout bounds the probe of a single server by default
+	DefaultHealthCheckTimeout = 5 * time.Second
+)
+
 // IMultiLDAP is interface for MultiLDAP
 type IMultiLDAP interface {
 	Ping() ([]*ServerStatus, error)
@@ -30,6 +46,10 @@ type IMultiLDAP interface {
 		*models.User, error,
 	)
 
+	LoginContext(ctx context.Context, query *types.LoginData) (
+		*models.User, error,
+	)
+
 	Users(logins []string) (
 		[]*models.User, error,
 	)
@@ -37,17 +57,91 @@ type IMultiLDAP interface {
 	User(login string) (
 		*models.User, ServerConfig, error,
 	)
+
+	LookupUser(login string) (
+		*models.User, error,
+	)
+
+	LookupUsers(logins []string) (
+		map[string]*models.User, []FailedLogin, error,
+	)
+
+	HealthCheck(ctx context.Context) []ServerStatus
 }
 
+// ServerOrder is the policy used to pick the order in which the LDAP servers are tried
+type ServerOrder string
+
+const (
+	// OrderSequential always tries the servers in the configured order
+	OrderSequential ServerOrder = "sequential"
+	// OrderRoundRobin starts every operation with the server following
+	// the one the previous operation started with
+	OrderRoundRobin ServerOrder = "round_robin"
+)
+
 // MultiLDAP is basic struct of LDAP authorization
 type MultiLDAP struct {
+	// Order is the order policy of the servers, OrderSequential by default
+	Order ServerOrder
+	// HealthCheckTTL is how long the result of HealthCheck is cached
+	HealthCheckTTL time.Duration
+	// HealthCheckTimeout bounds the probe of a single server in HealthCheck
+	HealthCheckTimeout time.Duration
+	// Metrics is optional, when set the binds and searches of the servers are recorded
+	Metrics *Metrics
+
 	configs []*ServerConfig
+	pools   map[*ServerConfig]*Pool
+	next    uint32
+
+	healthMu sync.Mutex
+	health   []ServerStatus
 }
 
 // New creates the new LDAP auth
-func NewMultiLDAP(configs []*ServerConfig) IMultiLDAP {
+// A connection pool is created for every server config with a PoolSize
+func NewMultiLDAP(configs []*ServerConfig) *MultiLDAP {
+	pools := map[*ServerConfig]*Pool{}
+	for _, config := range configs {
+		if config.PoolSize > 0 {
+			pools[config] = NewPool(config)
+		}
+	}
 	return &MultiLDAP{
-		configs: configs,
+		Order:              OrderSequential,
+		HealthCheckTTL:     DefaultHealthCheckTTL,
+		HealthCheckTimeout: DefaultHealthCheckTimeout,
+		configs:            configs,
+		pools:              pools,
+	}
+}
+
+// Close closes the connection pools, it is called when the servers are
+// replaced, e.g. after a config reload
+func (multiples *MultiLDAP) Close() {
+	for _, pool := range multiples.pools {
+		pool.Close()
+	}
+}
+
+// orderedConfigs returns the server configs in the order they should be tried
+func (multiples *MultiLDAP) orderedConfigs() []*ServerConfig {
+	if multiples.Order != OrderRoundRobin || len(multiples.configs) < 2 {
+		return multiples.configs
+	}
+	start := int(atomic.AddUint32(&multiples.next, 1)-1) % len(multiples.configs)
+	configs := make([]*ServerConfig, 0, len(multiples.configs))
+	configs = append(configs, multiples.configs[start:]...)
+	return append(configs, multiples.configs[:start]...)
+}
+
+// newServer creates the LDAP server for config, reusing its pool if there is one
+func (multiples *MultiLDAP) newServer(config *ServerConfig) IServer {
+	return &Server{
+		Config:  config,
+		Pool:    multiples.pools[config],
+		Metrics: multiples.Metrics,
 	}
 }
 
@@ -63,14 +157,13 @@ func (multiples *MultiLDAP) Ping() ([]*ServerStatus, error) {
 
 		status.Host = config.Host
 		status.Port = config.Port
+		status.LastChecked = time.Now()
 
-		server := NewLDAPServer(config)
-		err := server.Dial()
+		err := ping(context.Background(), config)
 
 		if err == nil {
 			status.Available = true
 			serverStatuses = append(serverStatuses, status)
-			server.Close()
 		} else {
 			status.Available = false
 			status.Error = err
@@ -81,53 +174,183 @@ func (multiples *MultiLDAP) Ping() ([]*ServerStatus, error) {
 	return serverStatuses, nil
 }
 
+// maxPingInterval bounds the backoff of PingWithRetry
+const maxPingInterval = 30 * time.Second
+
+// PingWithRetry pings the LDAP servers of iml and returns the aggregated error of the
+// unavailable ones. When every failure is a connection error, e.g. the DNS of the domain
+// controllers is not ready yet at startup, the servers are pinged again up to retries times,
+// waiting interval at first and doubling it after every retry. Any other error, e.g. an
+// invalid TLS config, is returned at once since retrying can't fix it.
+func PingWithRetry(iml IMultiLDAP, retries int, interval time.Duration) error {
+	return pingWithRetry(iml.Ping, retries, interval)
+}
+
+func pingWithRetry(ping func() ([]*ServerStatus, error), retries int, interval time.Duration) error {
+	for i := 0; ; i++ {
+		statuses, err := ping()
+		if err != nil {
+			return err
+		}
+		retryable := true
+		for _, status := range statuses {
+			if status.Error != nil && !isConnectionError(status.Error) {
+				retryable = false
+			}
+			err = multierr.Append(err, status.Error)
+		}
+		if err == nil || !retryable || i >= retries {
+			return err
+		}
+		logger.Warn("LDAP servers unavailable, waiting to retry", zap.Int("retry", i+1), zap.Duration("interval", interval), zap.Error(err))
+		time.Sleep(interval)
+		if interval *= 2; interval > maxPingInterval {
+			interval = maxPingInterval
+		}
+	}
+}
+
+// HealthCheck probes each of the LDAP servers, every probe is bounded by HealthCheckTimeout.
+// The result is cached for HealthCheckTTL, so it is cheap enough to back a readiness endpoint.
+// A result produced while ctx was canceled says nothing about the servers and isn't cached.
+func (multiples *MultiLDAP) HealthCheck(ctx context.Context) []ServerStatus {
+	multiples.healthMu.Lock()
+	defer multiples.healthMu.Unlock()
+
+	if len(multiples.health) > 0 && time.Since(multiples.health[0].LastChecked) < multiples.HealthCheckTTL {
+		return append([]ServerStatus(nil), multiples.health...)
+	}
+
+	statuses := make([]ServerStatus, len(multiples.configs))
+	var wg sync.WaitGroup
+	for index, config := range multiples.configs {
+		wg.Add(1)
+		go func(index int, config *ServerConfig) {
+			defer wg.Done()
+			statuses[index] = multiples.probe(ctx, config)
+		}(index, config)
+	}
+	wg.Wait()
+
+	if ctx.Err() == nil {
+		multiples.health = statuses
+	}
+	return append([]ServerStatus(nil), statuses...)
+}
+
+// probe dials the server of config and returns its status
+func (multiples *MultiLDAP) probe(ctx context.Context, config *ServerConfig) ServerStatus {
+	status := ServerStatus{
+		Host:        config.Host,
+		Port:        config.Port,
+		LastChecked: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, multiples.HealthCheckTimeout)
+	defer cancel()
+
+	if err := ping(ctx, config); err != nil {
+		logDialFailure(err, config)
+		status.Error = err
+		return status
+	}
+
+	status.Available = true
+	return status
+}
+
+// ping checks the server of config is reachable with its PingMethod,
+// a failed CLDAP ping falls back to dialing the server over TCP
+func ping(ctx context.Context, config *ServerConfig) error {
+	if config.PingMethod == PingCLDAP {
+		err := cldapPing(ctx, config)
+		if err == nil {
+			return nil
+		}
+		logger.Debug("CLDAP ping failed, falling back to TCP", zap.String("host", config.Host), zap.Error(err))
+	}
+	server := NewLDAPServer(config)
+	if err := server.DialContext(ctx); err != nil {
+		return err
+	}
+	server.Close()
+	return nil
+}
+
 // Login tries to log in the user in multiples LDAP
 func (multiples *MultiLDAP) Login(query *types.LoginData) (
 	*models.User, error,
+) {
+	return multiples.LoginContext(context.Background(), query)
+}
+
+// LoginContext is like Login but honors the deadline and cancellation of ctx
+// while dialing and talking to each of the LDAP servers.
+// The servers are tried in the order given by multiples.Order, a server which
+// can't be reached or whose connection breaks is skipped and the next one is
+// tried. Invalid credentials are returned at once, so a bad password is never
+// retried against every server.
+func (multiples *MultiLDAP) LoginContext(ctx context.Context, query *types.LoginData) (
+	*models.User, error,
 ) {
 	if len(multiples.configs) == 0 {
 		return nil, ErrNoLDAPServers
 	}
 
-	for index, config := range multiples.configs {
-		server := NewLDAPServer(config)
-
-		if err := server.Dial(); err != nil {
-			logDialFailure(err, config)
-
-			// Only return an error if it is the last server so we can try next server
-			if index == len(multiples.configs)-1 {
-				return nil, err
-			}
+	var errs error
+	for _, config := range multiples.orderedConfigs() {
+		user, err := multiples.login(ctx, config, query)
+		if err == nil {
+			return user, nil
+		}
+		if isConnectionError(err) {
+			logger.Warn(
+				"unable to login with LDAP - connection failure, trying next server",
+				zap.String("host", config.Host),
+				zap.Int("port", config.Port),
+				zap.Error(err),
+			)
+			errs = multierr.Append(errs, err)
 			continue
 		}
-
-		defer server.Close()
-
-		user, err := server.Login(query)
-		// FIXME
-		if user != nil {
-			return user, nil
+		if isSilentError(err) {
+			logger.Debug(
+				"unable to login with LDAP - skipping server",
+				zap.String("host", config.Host),
+				zap.Int("port", config.Port),
+				zap.Error(err),
+			)
+			continue
 		}
-		if err != nil {
-			if isSilentError(err) {
-				logger.Debug(
-					"unable to login with LDAP - skipping server",
-					zap.String("host", config.Host),
-					zap.Int("port", config.Port),
-					zap.Error(err),
-				)
-				continue
-			}
 
-			return nil, err
-		}
+		return nil, err
+	}
+
+	// Every server which could be asked doesn't know the user,
+	// but some could not be asked at all
+	if errs != nil {
+		return nil, errs
 	}
 
 	// Return invalid credentials if we couldn't find the user anywhere
 	return nil, ErrInvalidCredentials
 }
 
+// login dials the server of config and logs in the user
+func (multiples *MultiLDAP) login(ctx context.Context, config *ServerConfig, query *types.LoginData) (
+	*models.User, error,
+) {
+	server := multiples.newServer(config)
+
+	if err := server.DialContext(ctx); err != nil {
+		logDialFailure(err, config)
+		return nil, dialError{err}
+	}
+	defer server.Close()
+
+	return server.LoginContext(ctx, query)
+}
+
 // User attempts to find an user by login/username by searching into all of the configured LDAP servers. Then, if the user is found it returns the user alongisde the server it was found.
 func (multiples *MultiLDAP) User(login string) (
 	*models.User,
@@ -139,14 +362,15 @@ func (multiples *MultiLDAP) User(login string) (
 	}
 
 	search := []string{login}
-	for index, config := range multiples.configs {
-		server := NewLDAPServer(config)
+	configs := multiples.orderedConfigs()
+	for index, config := range configs {
+		server := multiples.newServer(config)
 
 		if err := server.Dial(); err != nil {
 			logDialFailure(err, config)
 
 			// Only return an error if it is the last server so we can try next server
-			if index == len(multiples.configs)-1 {
+			if index == len(configs)-1 {
 				return nil, *config, err
 			}
 			continue
@@ -171,6 +395,174 @@ func (multiples *MultiLDAP) User(login string) (
 	return nil, ServerConfig{}, ErrDidNotFindUser
 }
 
+// LookupUser finds the user by login in the servers, without checking any credential.
+// The servers are tried in the order given by multiples.Order, a server which
+// can't be reached or doesn't know the user is skipped.
+func (multiples *MultiLDAP) LookupUser(login string) (*models.User, error) {
+	if len(multiples.configs) == 0 {
+		return nil, ErrNoLDAPServers
+	}
+
+	var errs error
+	for _, config := range multiples.orderedConfigs() {
+		user, err := multiples.lookupUser(config, login)
+		if err == nil {
+			return user, nil
+		}
+		if isConnectionError(err) {
+			logger.Warn(
+				"unable to look up LDAP user - connection failure, trying next server",
+				zap.String("host", config.Host),
+				zap.Int("port", config.Port),
+				zap.Error(err),
+			)
+			errs = multierr.Append(errs, err)
+			continue
+		}
+		if isSilentError(err) {
+			continue
+		}
+
+		return nil, err
+	}
+
+	// Every server which could be asked doesn't know the user,
+	// but some could not be asked at all
+	if errs != nil {
+		return nil, errs
+	}
+	return nil, ErrDidNotFindUser
+}
+
+// lookupUser dials the server of config and looks up the user
+func (multiples *MultiLDAP) lookupUser(config *ServerConfig, login string) (*models.User, error) {
+	server := multiples.newServer(config)
+
+	if err := server.Dial(); err != nil {
+		logDialFailure(err, config)
+		return nil, dialError{err}
+	}
+	defer server.Close()
+
+	return server.LookupUser(login)
+}
+
+// LookupUsers is like LookupUser for many logins: every server is asked, in the order
+// given by multiples.Order, for the logins which haven't been found yet, in batches of
+// UsersMaxRequest via UsersPartial. The users found are keyed by their lowercased login,
+// every other login is returned in failed along with the reason of the failure.
+// An error is only returned when there is no server.
+func (multiples *MultiLDAP) LookupUsers(logins []string) (
+	map[string]*models.User,
+	[]FailedLogin,
+	error,
+) {
+	if len(multiples.configs) == 0 {
+		return nil, nil, ErrNoLDAPServers
+	}
+
+	found := map[string]*models.User{}
+	// the last error of each login, a login which failed with a connection
+	// error is still asked to the next servers
+	errs := map[string]error{}
+	pending := logins
+	for _, config := range multiples.orderedConfigs() {
+		if len(pending) == 0 {
+			break
+		}
+
+		users, failed, err := multiples.lookupUsers(config, pending)
+		if err != nil {
+			logger.Warn(
+				"unable to look up LDAP users",
+				zap.String("host", config.Host),
+				zap.Int("port", config.Port),
+				zap.Int("logins", len(pending)),
+				zap.Error(err),
+			)
+			failed = make([]FailedLogin, 0, len(pending))
+			for _, login := range pending {
+				failed = append(failed, FailedLogin{Login: login, Err: err})
+			}
+		}
+		failedErrs := map[string]error{}
+		for _, f := range failed {
+			failedErrs[strings.ToLower(f.Login)] = f.Err
+		}
+		byLogin := map[string][]*models.User{}
+		for _, user := range users {
+			key := strings.ToLower(user.Login)
+			byLogin[key] = append(byLogin[key], user)
+		}
+
+		var next []string
+		for _, login := range pending {
+			key := strings.ToLower(login)
+			if err := failedErrs[key]; err != nil {
+				errs[key] = err
+				if isConnectionError(err) {
+					next = append(next, login)
+				}
+				continue
+			}
+			switch users := byLogin[key]; {
+			case len(users) == 0:
+				next = append(next, login)
+			case len(users) > 1:
+				errs[key] = ErrMultipleUsersFound
+			case len(config.Groups) > 0 && len(users[0].OrgRoles) < 1:
+				// same as Server.validateGoldenUser
+				errs[key] = ErrInvalidCredentials
+			default:
+				found[key] = users[0]
+				delete(errs, key)
+			}
+		}
+		pending = next
+	}
+
+	var failed []FailedLogin
+	for _, login := range logins {
+		key := strings.ToLower(login)
+		if _, ok := found[key]; ok {
+			continue
+		}
+		err := errs[key]
+		if err == nil {
+			err = ErrDidNotFindUser
+		}
+		failed = append(failed, FailedLogin{Login: login, Err: err})
+	}
+	return found, failed, nil
+}
+
+// lookupUsers dials the server of config and searches the logins via UsersPartial
+func (multiples *MultiLDAP) lookupUsers(config *ServerConfig, logins []string) (
+	[]*models.User,
+	[]FailedLogin,
+	error,
+) {
+	server := multiples.newServer(config)
+
+	if err := server.Dial(); err != nil {
+		logDialFailure(err, config)
+		return nil, nil, dialError{err}
+	}
+	defer server.Close()
+
+	if err := server.Bind(); err != nil {
+		return nil, nil, wrapError(ErrBindFailed, err)
+	}
+	users, failed, err := server.UsersPartial(logins)
+	if err != nil {
+		return nil, nil, wrapError(ErrSearchFailed, err)
+	}
+	for i := range failed {
+		failed[i].Err = wrapError(ErrSearchFailed, failed[i].Err)
+	}
+	return users, failed, nil
+}
+
 // Users gets users from multiple LDAP servers
 func (multiples *MultiLDAP) Users(logins []string) (
 	[]*models.User,
@@ -183,7 +575,7 @@ func (multiples *MultiLDAP) Users(logins []string) (
 	}
 
 	for index, config := range multiples.configs {
-		server := NewLDAPServer(config)
+		server := multiples.newServer(config)
 
 		if err := server.Dial(); err != nil {
 			logDialFailure(err, config)
@@ -214,7 +606,7 @@ func (multiples *MultiLDAP) Users(logins []string) (
 // isSilentError evaluates an error and tells whenever we should fail the LDAP request
 // immediately or if we should continue into other LDAP servers
 func isSilentError(err error) bool {
-	continueErrs := []error{ErrInvalidCredentials, ErrCouldNotFindUser}
+	continueErrs := []error{ErrCouldNotFindUser}
 
 	for _, cerr := range continueErrs {
 		if errors.Is(err, cerr) {
@@ -233,3 +625,36 @@ func logDialFailure(err error, config *ServerConfig) {
 		zap.Error(err),
 	)
 }
+
+// dialError marks an error which happened while dialing a server
+type dialError struct {
+	err error
+}
+
+func (e dialError) Error() string {
+	return e.err.Error()
+}
+
+func (e dialError) Unwrap() error {
+	return e.err
+}
+
+// Is makes a dial error match ErrConnection
+func (e dialError) Is(target error) bool {
+	return target == ErrConnection
+}
+
+// isConnectionError tells whenever err is caused by the connection to the server
+// (dial failure, broken connection, timeout) rather than by the request itself
+func isConnectionError(err error) bool {
+	var de dialError
+	if errors.As(err, &de) {
+		return true
+	}
+	var ldapErr *goldap.Error
+	if errors.As(err, &ldapErr) && ldapErr.ResultCode == goldap.ErrorNetwork {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
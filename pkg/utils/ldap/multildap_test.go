@@ -0,0 +1,313 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/utils/types"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// directory is a fakeConnection searchFn which knows the users of logins,
+// the probe of the root DSE done by the pools finds nothing
+func directory(logins ...string) func(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+	return func(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+		result := &goldap.SearchResult{}
+		if request.BaseDN == "" {
+			return result, nil
+		}
+		filter := strings.ToLower(request.Filter)
+		for _, login := range logins {
+			if strings.Contains(filter, "(uid="+strings.ToLower(login)+")") {
+				result.Entries = append(result.Entries, goldap.NewEntry(
+					"cn="+login+",ou=users,dc=example,dc=com",
+					map[string][]string{"uid": {login}},
+				))
+			}
+		}
+		return result, nil
+	}
+}
+
+// userSearches returns the searches of conn without the probes of the root DSE
+func userSearches(conn *fakeConnection) []*goldap.SearchRequest {
+	var searches []*goldap.SearchRequest
+	for _, request := range conn.searches {
+		if request.BaseDN != "" {
+			searches = append(searches, request)
+		}
+	}
+	return searches
+}
+
+// unreachablePort returns a local port nothing listens on
+func unreachablePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	return port
+}
+
+// newTestMultiLDAP creates a MultiLDAP whose servers answer with conns, which
+// are handed out by the pools of the servers. A nil conn is a server which can't be reached.
+func newTestMultiLDAP(t *testing.T, conns ...*fakeConnection) (*MultiLDAP, []*ServerConfig) {
+	configs := make([]*ServerConfig, 0, len(conns))
+	for i, conn := range conns {
+		config := &ServerConfig{
+			Host:          fmt.Sprintf("ldap%d.example.com", i),
+			Port:          389,
+			PoolSize:      1,
+			BindDN:        "cn=admin,dc=example,dc=com",
+			BindPassword:  "secret",
+			Attr:          AttributeMap{Username: "uid", MemberOf: "memberOf"},
+			SearchFilter:  "(uid=%s)",
+			SearchBaseDNs: []string{"ou=users,dc=example,dc=com"},
+		}
+		if conn == nil {
+			config.Host = "127.0.0.1"
+			config.Port = unreachablePort(t)
+			config.PoolSize = 0
+		}
+		configs = append(configs, config)
+	}
+	multi := NewMultiLDAP(configs)
+	for i, conn := range conns {
+		if conn != nil {
+			multi.pools[configs[i]].Put(conn)
+		}
+	}
+	t.Cleanup(multi.Close)
+	return multi, configs
+}
+
+func TestLookupUsers(t *testing.T) {
+	second := &fakeConnection{searchFn: directory("jdoe", "asmith")}
+	third := &fakeConnection{searchFn: directory("bob", "jdoe")}
+	multi, _ := newTestMultiLDAP(t, nil, second, third)
+
+	users, failed, err := multi.LookupUsers([]string{"jdoe", "ASmith", "bob", "nobody"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, login := range []string{"jdoe", "asmith", "bob"} {
+		if users[login] == nil {
+			t.Errorf("expected %s to be found, got %v", login, users)
+		}
+	}
+	// like LookupUser, the unreachable server may know the user
+	if len(failed) != 1 || failed[0].Login != "nobody" || !errors.Is(failed[0].Err, ErrConnection) {
+		t.Errorf("expected only nobody to fail with a connection error, got %v", failed)
+	}
+	// the unreachable server is skipped, the third server is only asked
+	// for the logins the second one doesn't know
+	searches := userSearches(third)
+	if len(searches) != 1 || strings.Contains(searches[0].Filter, "jdoe") ||
+		!strings.Contains(searches[0].Filter, "(uid=bob)") {
+		t.Errorf("expected a single search of the remaining logins, got %v", searches)
+	}
+}
+
+func TestLookupUsersBatches(t *testing.T) {
+	conn := &fakeConnection{searchFn: directory("jdoe")}
+	multi, configs := newTestMultiLDAP(t, conn)
+
+	logins := make([]string, UsersMaxRequest+1)
+	for i := range logins {
+		logins[i] = fmt.Sprintf("user%d", i)
+	}
+	logins[UsersMaxRequest] = "jdoe"
+	users, failed, err := multi.LookupUsers(logins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || len(failed) != UsersMaxRequest || !errors.Is(failed[0].Err, ErrDidNotFindUser) {
+		t.Errorf("expected 1 user and %d logins not found, got %d %d", UsersMaxRequest, len(users), len(failed))
+	}
+	if n := len(userSearches(conn)); n != 2 {
+		t.Errorf("expected the logins to be searched in 2 batches, got %d searches", n)
+	}
+
+	// a user outside of the groups isn't looked up
+	configs[0].Groups = []*GroupToOrgRole{{GroupDN: "cn=admins,ou=groups,dc=example,dc=com", OrgRole: "Admin"}}
+	users, failed, err = multi.LookupUsers([]string{"jdoe"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 0 || len(failed) != 1 || !errors.Is(failed[0].Err, ErrInvalidCredentials) {
+		t.Errorf("expected jdoe to be rejected, got %v %v", users, failed)
+	}
+
+	if _, _, err := NewMultiLDAP(nil).LookupUsers([]string{"jdoe"}); err != ErrNoLDAPServers {
+		t.Errorf("expected %v, got %v", ErrNoLDAPServers, err)
+	}
+}
+
+// checkPassword is a fakeConnection bindFn which accepts the admin and the users with password
+func checkPassword(password string) func(username, password string) error {
+	return func(username, pwd string) error {
+		if username == "cn=admin,dc=example,dc=com" || pwd == password {
+			return nil
+		}
+		return goldap.NewError(goldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+}
+
+func TestMultiLDAPLoginContext(t *testing.T) {
+	// the connection breaks after the pool validated it
+	broken := func(request *goldap.SearchRequest) (*goldap.SearchResult, error) {
+		if request.BaseDN == "" {
+			return &goldap.SearchResult{}, nil
+		}
+		return nil, goldap.NewError(goldap.ErrorNetwork, errors.New("connection reset"))
+	}
+	// every server knows the user only when its searchFn is directory("jdoe")
+	for _, tc := range []struct {
+		name     string
+		searches []func(*goldap.SearchRequest) (*goldap.SearchResult, error)
+		password string
+		err      error
+		// asked is the amount of servers which searched the user, in order
+		asked int
+	}{
+		{"found on the first server", []func(*goldap.SearchRequest) (*goldap.SearchResult, error){directory("jdoe"), directory("jdoe")}, "pwd", nil, 1},
+		{"invalid credentials stop at the first server", []func(*goldap.SearchRequest) (*goldap.SearchResult, error){directory("jdoe"), directory("jdoe")}, "wrong", ErrInvalidCredentials, 1},
+		{"unknown user falls through", []func(*goldap.SearchRequest) (*goldap.SearchResult, error){directory(), directory("jdoe")}, "pwd", nil, 2},
+		{"broken connection falls through", []func(*goldap.SearchRequest) (*goldap.SearchResult, error){broken, directory("jdoe")}, "pwd", nil, 2},
+		{"unknown everywhere", []func(*goldap.SearchRequest) (*goldap.SearchResult, error){directory(), directory()}, "pwd", ErrInvalidCredentials, 2},
+		{"unknown or unreachable", []func(*goldap.SearchRequest) (*goldap.SearchResult, error){broken, directory()}, "pwd", ErrConnection, 2},
+	} {
+		conns := make([]*fakeConnection, 0, len(tc.searches))
+		for _, search := range tc.searches {
+			conns = append(conns, &fakeConnection{bindFn: checkPassword("pwd"), searchFn: search})
+		}
+		multi, _ := newTestMultiLDAP(t, conns...)
+
+		user, err := multi.LoginContext(context.Background(), &types.LoginData{Name: "jdoe", Password: tc.password})
+		if !errors.Is(err, tc.err) || (err == nil && user.Login != "jdoe") {
+			t.Errorf("%s: expected %v, got %v %v", tc.name, tc.err, user, err)
+		}
+		for i, conn := range conns {
+			if asked := len(userSearches(conn)) > 0; asked != (i < tc.asked) {
+				t.Errorf("%s: expected server %d asked %v", tc.name, i, i < tc.asked)
+			}
+		}
+	}
+}
+
+func TestMultiLDAPLoginUnreachable(t *testing.T) {
+	conn := &fakeConnection{bindFn: checkPassword("pwd"), searchFn: directory("jdoe")}
+	multi, _ := newTestMultiLDAP(t, nil, conn)
+
+	user, err := multi.LoginContext(context.Background(), &types.LoginData{Name: "jdoe", Password: "pwd"})
+	if err != nil || user.Login != "jdoe" {
+		t.Errorf("expected the unreachable server to be skipped, got %v %v", user, err)
+	}
+}
+
+func TestMultiLDAPLoginRoundRobin(t *testing.T) {
+	first := &fakeConnection{bindFn: checkPassword("pwd"), searchFn: directory("jdoe")}
+	second := &fakeConnection{bindFn: checkPassword("pwd"), searchFn: directory("jdoe")}
+	multi, _ := newTestMultiLDAP(t, first, second)
+	multi.Order = OrderRoundRobin
+
+	// every login starts with the server following the previous one
+	for i, want := range []*fakeConnection{first, second, first} {
+		before := len(userSearches(want))
+		if _, err := multi.LoginContext(context.Background(), &types.LoginData{Name: "jdoe", Password: "pwd"}); err != nil {
+			t.Fatal(err)
+		}
+		if len(userSearches(want)) != before+1 {
+			t.Errorf("login %d: expected to be served by server %d", i, i%2)
+		}
+	}
+	if n := len(userSearches(first)) + len(userSearches(second)); n != 3 {
+		t.Errorf("expected each login to ask a single server, got %d searches", n)
+	}
+}
+
+// silentListener accepts connections and never answers, it is closed with the test
+func silentListener(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { c.Close() })
+		}
+	}()
+	return ln
+}
+
+func TestHealthCheck(t *testing.T) {
+	ln := silentListener(t)
+	up := &ServerConfig{Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port}
+	down := &ServerConfig{Host: "127.0.0.1", Port: unreachablePort(t)}
+	multi := NewMultiLDAP([]*ServerConfig{up, down})
+
+	statuses := multi.HealthCheck(context.Background())
+	if len(statuses) != 2 {
+		t.Fatalf("expected 2 statuses, got %v", statuses)
+	}
+	if s := statuses[0]; s.Host != up.Host || s.Port != up.Port || !s.Available || s.Error != nil || s.LastChecked.IsZero() {
+		t.Errorf("expected the first server to be available, got %+v", s)
+	}
+	if s := statuses[1]; s.Port != down.Port || s.Available || s.Error == nil {
+		t.Errorf("expected the second server to be unavailable, got %+v", s)
+	}
+
+	// cached within HealthCheckTTL
+	up.Port = unreachablePort(t)
+	if cached := multi.HealthCheck(context.Background()); !cached[0].Available || cached[0].LastChecked != statuses[0].LastChecked {
+		t.Errorf("expected the cached statuses, got %+v", cached)
+	}
+
+	multi.HealthCheckTTL = 0
+	if statuses = multi.HealthCheck(context.Background()); statuses[0].Available {
+		t.Errorf("expected the servers to be probed again after HealthCheckTTL, got %+v", statuses[0])
+	}
+}
+
+func TestHealthCheckCanceled(t *testing.T) {
+	ln := silentListener(t)
+	multi := NewMultiLDAP([]*ServerConfig{{Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if statuses := multi.HealthCheck(ctx); statuses[0].Available {
+		t.Errorf("expected the probe to fail with a canceled ctx, got %+v", statuses[0])
+	}
+	if statuses := multi.HealthCheck(context.Background()); !statuses[0].Available {
+		t.Errorf("expected the result of the canceled probe not to be cached, got %+v", statuses[0])
+	}
+}
+
+func TestHealthCheckTimeout(t *testing.T) {
+	// the TLS handshake never completes
+	ln := silentListener(t)
+	config := &ServerConfig{Host: "127.0.0.1", Port: ln.Addr().(*net.TCPAddr).Port, UseSSL: true, SkipVerifySSL: true}
+	multi := NewMultiLDAP([]*ServerConfig{config})
+	multi.HealthCheckTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	statuses := multi.HealthCheck(context.Background())
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the probe to be bounded by HealthCheckTimeout, took %v", elapsed)
+	}
+	if statuses[0].Available || statuses[0].Error == nil {
+		t.Errorf("expected the server to be unavailable, got %+v", statuses[0])
+	}
+}
@@ -0,0 +1,145 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"gitee.com/golden-go/golden-go/pkg/utils/logger"
+	goldap "github.com/go-ldap/ldap/v3"
+	"go.uber.org/zap"
+)
+
+var errConnectionClosing = errors.New("ldap: connection is closing")
+
+// Pool keeps warm connections to one LDAP server, so that repeated logins
+// reuse an already dialed (and TLS handshaked) connection instead of dialing
+// a new one every time.
+//
+// A connection handed out by the pool keeps the identity of its last bind,
+// callers must always bind before searching, as Server.Login and Server.Bind do.
+type Pool struct {
+	config *ServerConfig
+	conns  chan idleConn
+	closed int32
+	// now returns the current time, replaced in tests
+	now func() time.Time
+}
+
+// idleConn is a connection waiting in the pool since its last use
+type idleConn struct {
+	conn  IConnection
+	since time.Time
+}
+
+// NewPool creates a pool holding at most config.PoolSize idle connections
+func NewPool(config *ServerConfig) *Pool {
+	size := config.PoolSize
+	if size < 1 {
+		size = 1
+	}
+	return &Pool{
+		config: config,
+		conns:  make(chan idleConn, size),
+		now:    time.Now,
+	}
+}
+
+// Get returns a validated idle connection from the pool, or dials a new one
+// when the pool is empty. Connections idle for longer than config.ConnMaxIdle
+// are discarded, the server has likely dropped them already
+func (pool *Pool) Get() (IConnection, error) {
+	return pool.GetContext(context.Background())
+}
+
+// GetContext is like Get but honors the deadline and cancellation of ctx
+func (pool *Pool) GetContext(ctx context.Context) (IConnection, error) {
+	for {
+		select {
+		case idle := <-pool.conns:
+			conn := idle.conn
+			if max := pool.config.ConnMaxIdle; max > 0 && pool.now().Sub(idle.since) >= max {
+				logger.Debug(
+					"discard idle LDAP connection",
+					zap.String("host", pool.config.Host),
+					zap.Duration("idle", pool.now().Sub(idle.since)),
+				)
+				conn.Close()
+				continue
+			}
+			if err := pool.validate(ctx, conn); err != nil {
+				logger.Debug(
+					"discard dead LDAP connection",
+					zap.String("host", pool.config.Host),
+					zap.Error(err),
+				)
+				conn.Close()
+				continue
+			}
+			return conn, nil
+		default:
+			server := &Server{Config: pool.config}
+			if err := server.dial(ctx); err != nil {
+				return nil, err
+			}
+			return server.Connection, nil
+		}
+	}
+}
+
+// Put gives conn back to the pool. Dead connections and connections exceeding
+// the pool size are closed.
+func (pool *Pool) Put(conn IConnection) {
+	if conn == nil {
+		return
+	}
+	if isClosing(conn) || atomic.LoadInt32(&pool.closed) == 1 {
+		conn.Close()
+		return
+	}
+	select {
+	case pool.conns <- idleConn{conn: conn, since: pool.now()}:
+	default:
+		conn.Close()
+	}
+}
+
+// Close closes all the idle connections of the pool, connections put back
+// afterwards are closed as well
+func (pool *Pool) Close() {
+	atomic.StoreInt32(&pool.closed, 1)
+	for {
+		select {
+		case idle := <-pool.conns:
+			idle.conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// validate checks that conn is still usable with a lightweight base search
+// of the root DSE which requests no attributes
+func (pool *Pool) validate(ctx context.Context, conn IConnection) error {
+	if isClosing(conn) {
+		return goldap.NewError(goldap.ErrorNetwork, errConnectionClosing)
+	}
+	return runWithContext(ctx, conn, func() error {
+		_, err := conn.Search(&goldap.SearchRequest{
+			BaseDN:       "",
+			Scope:        goldap.ScopeBaseObject,
+			DerefAliases: goldap.NeverDerefAliases,
+			SizeLimit:    1,
+			Filter:       "(objectClass=*)",
+			Attributes:   []string{"1.1"},
+		})
+		return err
+	})
+}
+
+// isClosing reports whether conn is known to be closed or closing
+func isClosing(conn IConnection) bool {
+	c, ok := conn.(interface{ IsClosing() bool })
+	return ok && c.IsClosing()
+}
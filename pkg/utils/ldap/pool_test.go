@@ -0,0 +1,102 @@
+package ldap
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestPoolDiscardsIdleConnections(t *testing.T) {
+	// the replacement connection is dialed to a listener which accepts but never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	now := time.Now()
+	pool := NewPool(&ServerConfig{Host: "127.0.0.1", Port: port, PoolSize: 1, ConnMaxIdle: time.Minute})
+	pool.now = func() time.Time { return now }
+	defer pool.Close()
+
+	fresh := &fakeConnection{}
+	pool.Put(fresh)
+	now = now.Add(30 * time.Second)
+	conn, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn != fresh || fresh.closed {
+		t.Error("expected the connection idle within conn_max_idle to be reused")
+	}
+
+	stale := &fakeConnection{}
+	pool.Put(stale)
+	now = now.Add(time.Minute)
+	if conn, err = pool.Get(); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn == stale || !stale.closed {
+		t.Error("expected the connection idle past conn_max_idle to be closed and replaced")
+	}
+	if len(stale.searches) != 0 {
+		t.Error("expected the stale connection to be discarded without validating it")
+	}
+}
+
+func TestPoolDiscardsDeadConnections(t *testing.T) {
+	// the replacement connection is dialed to a listener which accepts but never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	pool := NewPool(&ServerConfig{Host: "127.0.0.1", Port: port, PoolSize: 1})
+	defer pool.Close()
+
+	dead := &fakeConnection{
+		searchFn: func(*goldap.SearchRequest) (*goldap.SearchResult, error) {
+			return nil, goldap.NewError(goldap.ErrorNetwork, errors.New("connection reset"))
+		},
+	}
+	pool.Put(dead)
+	conn, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if len(dead.searches) != 1 {
+		t.Errorf("expected the idle connection to be validated once, got %d searches", len(dead.searches))
+	}
+	if conn == dead || !dead.closed {
+		t.Error("expected the connection failing the validation to be closed and a fresh one dialed")
+	}
+	if _, ok := conn.(*fakeConnection); ok {
+		t.Error("expected a dialed connection")
+	}
+}
@@ -0,0 +1,65 @@
+package ldap
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Reloadable holds the current IMultiLDAP, which is replaced atomically by Reload,
+// e.g. after the LDAP servers are changed in the config file.
+//
+// Callers should Load once per request and keep using that instance, an in-flight
+// login finishes on the old instance: closing a MultiLDAP only closes its idle
+// pooled connections, the connections in use are closed when they are put back.
+type Reloadable struct {
+	build   func() (IMultiLDAP, error)
+	current atomic.Value
+	// mu serializes Reload, so that the instance replaced is always closed once
+	mu sync.Mutex
+}
+
+// imlHolder keeps the stored type of the atomic.Value the same for every IMultiLDAP
+type imlHolder struct {
+	iml IMultiLDAP
+}
+
+// NewReloadable creates the Reloadable holding the IMultiLDAP created by build,
+// the same build is called by every Reload
+func NewReloadable(build func() (IMultiLDAP, error)) (*Reloadable, error) {
+	iml, err := build()
+	if err != nil {
+		return nil, err
+	}
+	return NewReloadableWith(iml, build), nil
+}
+
+// NewReloadableWith creates the Reloadable holding iml, Reload calls build.
+// Use it when the startup needs more than a rebuild, e.g. pinging the servers with
+// retries, which should not block a reload: reachability is left to the health check
+func NewReloadableWith(iml IMultiLDAP, build func() (IMultiLDAP, error)) *Reloadable {
+	r := &Reloadable{build: build}
+	r.current.Store(imlHolder{iml})
+	return r
+}
+
+// Load returns the current IMultiLDAP
+func (r *Reloadable) Load() IMultiLDAP {
+	return r.current.Load().(imlHolder).iml
+}
+
+// Reload rebuilds the IMultiLDAP and replaces the current one, which is then closed.
+// The current one is kept when the rebuild fails.
+func (r *Reloadable) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	iml, err := r.build()
+	if err != nil {
+		return err
+	}
+	old := r.current.Load().(imlHolder).iml
+	r.current.Store(imlHolder{iml})
+	if ml, ok := old.(*MultiLDAP); ok && old != iml {
+		ml.Close()
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package ldap
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReloadable(t *testing.T) {
+	first := NewMultiLDAP([]*ServerConfig{{Host: "ldap1.example.com", Port: 389, PoolSize: 1}})
+	second := NewMultiLDAP([]*ServerConfig{{Host: "ldap2.example.com", Port: 389}})
+	builds := []IMultiLDAP{first, nil, second}
+	r, err := NewReloadable(func() (IMultiLDAP, error) {
+		iml := builds[0]
+		builds = builds[1:]
+		if iml == nil {
+			return nil, errors.New("invalid config")
+		}
+		return iml, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	inFlight := r.Load()
+
+	if err := r.Reload(); err == nil {
+		t.Error("expected the error of the failed rebuild")
+	}
+	if r.Load() != first {
+		t.Error("expected the current instance to be kept when the rebuild fails")
+	}
+
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Load() != second {
+		t.Error("expected the rebuilt instance")
+	}
+	if inFlight != first {
+		t.Error("expected the instance loaded before the reload to be unchanged")
+	}
+	// a connection put back to the pool of the replaced instance is closed
+	conn := &fakeConnection{}
+	first.pools[first.configs[0]].Put(conn)
+	if !conn.closed {
+		t.Error("expected the connection put back after the reload to be closed")
+	}
+}
+
+func TestNewReloadableWith(t *testing.T) {
+	initial := NewMultiLDAP([]*ServerConfig{{Host: "ldap1.example.com", Port: 389}})
+	rebuilt := NewMultiLDAP([]*ServerConfig{{Host: "ldap2.example.com", Port: 389}})
+	builds := 0
+	r := NewReloadableWith(initial, func() (IMultiLDAP, error) {
+		builds++
+		return rebuilt, nil
+	})
+	if r.Load() != initial || builds != 0 {
+		t.Errorf("expected the initial instance without a build, got %d builds", builds)
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Load() != rebuilt || builds != 1 {
+		t.Errorf("expected the reload to use the build, got %d builds", builds)
+	}
+}
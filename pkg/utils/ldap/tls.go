@@ -0,0 +1,101 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// DefaultMinTLSVersion is the min TLS version when MinTLSVersion is not set
+const DefaultMinTLSVersion = tls.VersionTLS12
+
+// tlsVersions are the accepted values of MinTLSVersion, older versions are rejected
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// minTLSVersion parses MinTLSVersion, DefaultMinTLSVersion when it's empty
+func (config *ServerConfig) minTLSVersion() (uint16, error) {
+	if config.MinTLSVersion == "" {
+		return DefaultMinTLSVersion, nil
+	}
+	v, ok := tlsVersions[strings.TrimPrefix(strings.ToUpper(config.MinTLSVersion), "TLS")]
+	if !ok {
+		return 0, fmt.Errorf("min_tls_version %q is not supported, use 1.2 or 1.3", config.MinTLSVersion)
+	}
+	return v, nil
+}
+
+// cipherSuites parses the names of CipherSuites, the insecure ones are rejected.
+// It returns nil when CipherSuites is empty, then the Go defaults are used.
+// The suites of TLS 1.3 are not configurable, CipherSuites only applies to TLS 1.2.
+func (config *ServerConfig) cipherSuites() ([]uint16, error) {
+	if len(config.CipherSuites) == 0 {
+		return nil, nil
+	}
+	secure := map[string]uint16{}
+	for _, cs := range tls.CipherSuites() {
+		secure[cs.Name] = cs.ID
+	}
+	insecure := map[string]bool{}
+	for _, cs := range tls.InsecureCipherSuites() {
+		insecure[cs.Name] = true
+	}
+	ids := make([]uint16, 0, len(config.CipherSuites))
+	for _, name := range config.CipherSuites {
+		id, ok := secure[name]
+		switch {
+		case insecure[name]:
+			return nil, fmt.Errorf("cipher suite %s is insecure", name)
+		case !ok:
+			return nil, fmt.Errorf("unknown cipher suite %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// tlsConfig is the TLS config of the connections without the ServerName,
+// it returns nil when neither UseSSL nor StartTLS is set
+func (config *ServerConfig) tlsConfig() (*tls.Config, error) {
+	if !config.UseSSL && !config.StartTLS {
+		return nil, nil
+	}
+	certPool, err := config.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+	clientCert, err := config.clientCertificate()
+	if err != nil {
+		return nil, err
+	}
+	minVersion, err := config.minTLSVersion()
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := config.cipherSuites()
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg := &tls.Config{
+		// nolint:gosec
+		InsecureSkipVerify: config.SkipVerifySSL,
+		RootCAs:            certPool,
+		MinVersion:         minVersion,
+		CipherSuites:       cipherSuites,
+	}
+	if len(clientCert.Certificate) > 0 {
+		tlsCfg.Certificates = append(tlsCfg.Certificates, clientCert)
+	}
+	return tlsCfg, nil
+}
+
+// validateTLS checks MinTLSVersion and CipherSuites
+func (config *ServerConfig) validateTLS() error {
+	if _, err := config.minTLSVersion(); err != nil {
+		return err
+	}
+	_, err := config.cipherSuites()
+	return err
+}
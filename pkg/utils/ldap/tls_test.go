@@ -0,0 +1,49 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+)
+
+func TestTLSConfig(t *testing.T) {
+	config := &ServerConfig{}
+	if tlsCfg, err := config.tlsConfig(); err != nil || tlsCfg != nil {
+		t.Errorf("expected no TLS without use_ssl and start_tls, got %v %v", tlsCfg, err)
+	}
+
+	config.StartTLS = true
+	tlsCfg, err := config.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsCfg == nil || tlsCfg.MinVersion != tls.VersionTLS12 || tlsCfg.CipherSuites != nil {
+		t.Errorf("expected TLS 1.2 and the default cipher suites, got %+v", tlsCfg)
+	}
+
+	config.MinTLSVersion = "TLS1.3"
+	config.CipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+	if tlsCfg, err = config.tlsConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if tlsCfg.MinVersion != tls.VersionTLS13 || !reflect.DeepEqual(tlsCfg.CipherSuites, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}) {
+		t.Errorf("unexpected TLS config %+v", tlsCfg)
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	for _, config := range []*ServerConfig{
+		{MinTLSVersion: "1.0"},
+		{MinTLSVersion: "1.1"},
+		{MinTLSVersion: "ssl3"},
+		{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		{CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "TLS_NOT_A_SUITE"}},
+	} {
+		if err := config.validateTLS(); err == nil {
+			t.Errorf("expected %+v to be rejected", config)
+		}
+	}
+	if err := (&ServerConfig{MinTLSVersion: "1.2"}).validateTLS(); err != nil {
+		t.Error(err)
+	}
+}
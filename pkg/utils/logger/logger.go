@@ -1,11 +1,13 @@
 package logger
 
 import (
+	"context"
 	"runtime/debug"
 	"sync"
 
 	zl "gitee.com/golden-go/golden-go/pkg/utils/zap_logger"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 var logger *zap.Logger
@@ -38,15 +40,16 @@ func LoggerInit(env, dir, service, when string) {
 	logger.Debug("logger init ok", zap.String("dir", dir))
 }
 
-func JsonLoggerInit(env string) {
+// JsonLoggerInit 初始化 JSON 格式输出到标准输出的 logger，opts 例如 zl.WithSampling 开启日志采样
+func JsonLoggerInit(env string, opts ...zap.Option) {
 	mu.Lock()
 	defer mu.Unlock()
 	logger.Sync()
 	var err error
 	if env == "dev" || env == "local" {
-		logger, Closer, err = zl.GetDevJsonLogger()
+		logger, Closer, err = zl.GetDevJsonLogger(opts...)
 	} else {
-		logger, Closer, err = zl.GetDevJsonLogger()
+		logger, Closer, err = zl.GetDevJsonLogger(opts...)
 	}
 	if err != nil {
 		l, _ := zap.NewDevelopment()
@@ -55,6 +58,31 @@ func JsonLoggerInit(env string) {
 	logger.Debug("logger init ok")
 }
 
+// SetLevel 修改日志级别 debug info warn error
+func SetLevel(level string) error {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return err
+	}
+	zl.Level.SetLevel(l)
+	return nil
+}
+
+// Level 返回日志使用的 zap.AtomicLevel，修改后立即生效
+func Level() zap.AtomicLevel {
+	return zl.Level
+}
+
+// SetSampling 给当前的 logger 开启日志采样，error 及以上级别的日志不采样
+func SetSampling(sc zl.SamplingConfig) {
+	SetLogger(logger.WithOptions(zl.WithSampling(sc)))
+}
+
+// With 返回带有 fields 的 logger
+func With(fields ...zap.Field) *zap.Logger {
+	return logger.With(fields...)
+}
+
 func GetLogger() *zap.Logger {
 	return logger
 }
@@ -84,3 +112,21 @@ func Warn(msg string, fields ...zap.Field) {
 func Error(msg string, fields ...zap.Field) {
 	logger.Error(msg+"\n---------------------------->stack:\n"+string(debug.Stack())+"\n<----------------------------stack", fields...)
 }
+
+type fieldsKey struct{}
+
+// WithFields 返回携带日志字段的 context，FromContext 取出的 logger 都会带上这些字段
+func WithFields(ctx context.Context, fields ...zap.Field) context.Context {
+	if old, ok := ctx.Value(fieldsKey{}).([]zap.Field); ok {
+		fields = append(append([]zap.Field{}, old...), fields...)
+	}
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// FromContext 返回带有 ctx 中日志字段的 logger
+func FromContext(ctx context.Context) *zap.Logger {
+	if fields, ok := ctx.Value(fieldsKey{}).([]zap.Field); ok {
+		return logger.With(fields...)
+	}
+	return logger
+}
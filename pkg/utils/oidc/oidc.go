@@ -0,0 +1,201 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"gitee.com/golden-go/golden-go/pkg/models"
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// 默认配置
+const (
+	DefaultUsernameClaim = "preferred_username"
+	DefaultGroupsClaim   = "groups"
+)
+
+// DefaultScopes 默认申请的 scope
+var DefaultScopes = []string{gooidc.ScopeOpenID, "profile", "email"}
+
+var (
+	// ErrMissingIDToken token 接口没有返回 id_token
+	ErrMissingIDToken = errors.New("OIDC 响应中没有 id_token")
+	// ErrNonceMismatch id_token 的 nonce 和登录时的不一致
+	ErrNonceMismatch = errors.New("OIDC id_token 的 nonce 不匹配")
+	// ErrMissingUsername id_token 中没有用户名
+	ErrMissingUsername = errors.New("OIDC id_token 中没有用户名")
+	// ErrMissingSubject id_token 中没有 sub
+	ErrMissingSubject = errors.New("OIDC id_token 中没有 sub")
+)
+
+// ExternalID 身份提供方的用户在本地保存的唯一标识，由 issuer 和 sub 组成，
+// 用户名可能被修改或规范化后重复，sub 在同一个 issuer 中唯一且不变
+func ExternalID(issuer, subject string) string {
+	return issuer + "#" + subject
+}
+
+// Config OIDC 配置
+type Config struct {
+	// IssuerURL 身份提供方的地址，用于获取 /.well-known/openid-configuration
+	IssuerURL    string `mapstructure:"issuer_url"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+	// RedirectURL 回调地址，即 /login/oidc/callback 接口的完整地址
+	RedirectURL string   `mapstructure:"redirect_url"`
+	Scopes      []string `mapstructure:"scopes"`
+	// UsernameClaim 作为用户名的 claim，默认为 preferred_username
+	UsernameClaim string `mapstructure:"username_claim"`
+	// GroupsClaim 作为用户组的 claim，默认为 groups
+	GroupsClaim string `mapstructure:"groups_claim"`
+}
+
+// Validate 检查必填项
+func (c *Config) Validate() error {
+	var errs []string
+	if u, err := url.Parse(c.IssuerURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, "issuer_url 不是有效的地址")
+	}
+	if c.ClientID == "" {
+		errs = append(errs, "client_id 不能为空")
+	}
+	if u, err := url.Parse(c.RedirectURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, "redirect_url 不是有效的地址")
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "，"))
+	}
+	return nil
+}
+
+// Provider OIDC 身份提供方，第一次使用时获取身份提供方的配置，获取失败时下次使用重试
+type Provider struct {
+	Config *Config
+
+	mu       sync.Mutex
+	oauth2   *oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// NewProvider 创建 OIDC 身份提供方
+func NewProvider(config *Config) *Provider {
+	return &Provider{Config: config}
+}
+
+// init 获取身份提供方的配置
+func (p *Provider) init(ctx context.Context) (*oauth2.Config, *gooidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauth2 != nil {
+		return p.oauth2, p.verifier, nil
+	}
+	provider, err := gooidc.NewProvider(ctx, p.Config.IssuerURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	scopes := p.Config.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+	p.oauth2 = &oauth2.Config{
+		ClientID:     p.Config.ClientID,
+		ClientSecret: p.Config.ClientSecret,
+		RedirectURL:  p.Config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	p.verifier = provider.Verifier(&gooidc.Config{ClientID: p.Config.ClientID})
+	return p.oauth2, p.verifier, nil
+}
+
+// AuthCodeURL 返回身份提供方的登录地址，state 和 nonce 需要保存下来在回调时校验
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce string) (string, error) {
+	oc, _, err := p.init(ctx)
+	if err != nil {
+		return "", err
+	}
+	return oc.AuthCodeURL(state, gooidc.Nonce(nonce)), nil
+}
+
+// Exchange 用回调的 code 换取 id_token，校验 id_token 的签名、issuer、audience、有效期和 nonce，
+// 返回 id_token 中的用户信息，ExternalID 为 issuer 和 sub
+func (p *Provider) Exchange(ctx context.Context, code, nonce string) (*models.User, error) {
+	oc, verifier, err := p.init(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := oc.Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, ErrMissingIDToken
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if nonce == "" || idToken.Nonce != nonce {
+		return nil, ErrNonceMismatch
+	}
+	if idToken.Subject == "" {
+		return nil, ErrMissingSubject
+	}
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+	u, err := p.user(claims)
+	if err != nil {
+		return nil, err
+	}
+	u.ExternalID = ExternalID(idToken.Issuer, idToken.Subject)
+	return u, nil
+}
+
+// user id_token 中的用户信息
+func (p *Provider) user(claims map[string]interface{}) (*models.User, error) {
+	usernameClaim := p.Config.UsernameClaim
+	if usernameClaim == "" {
+		usernameClaim = DefaultUsernameClaim
+	}
+	groupsClaim := p.Config.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = DefaultGroupsClaim
+	}
+	username, _ := claims[usernameClaim].(string)
+	if username == "" {
+		return nil, fmt.Errorf("%w: %s", ErrMissingUsername, usernameClaim)
+	}
+	u := &models.User{
+		AuthModule: models.AuthModuleOIDC,
+		Name:       username,
+		Login:      username,
+	}
+	u.DisplayName, _ = claims["name"].(string)
+	u.Email, _ = claims["email"].(string)
+	if groups, ok := claims[groupsClaim].([]interface{}); ok {
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				u.Groups = append(u.Groups, s)
+			}
+		}
+	}
+	return u, nil
+}
+
+// RandomString 生成 state 和 nonce 使用的随机字符串
+func RandomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
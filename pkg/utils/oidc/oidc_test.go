@@ -0,0 +1,107 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	jwtgo "github.com/golang-jwt/jwt"
+)
+
+// newTestIssuer 启动一个签发 claims 的 id_token 的身份提供方
+func newTestIssuer(t *testing.T, claims jwtgo.MapClaims) *httptest.Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                srv.URL,
+			"authorization_endpoint":                srv.URL + "/auth",
+			"token_endpoint":                        srv.URL + "/token",
+			"jwks_uri":                              srv.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		c := jwtgo.MapClaims{"iss": srv.URL, "aud": "client", "exp": time.Now().Add(time.Hour).Unix(), "iat": time.Now().Unix()}
+		for k, v := range claims {
+			c[k] = v
+		}
+		token := jwtgo.NewWithClaims(jwtgo.SigningMethodRS256, c)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access", "token_type": "Bearer", "id_token": idToken})
+	})
+	return srv
+}
+
+func TestExchange(t *testing.T) {
+	srv := newTestIssuer(t, jwtgo.MapClaims{
+		"sub":                "1",
+		"nonce":              "nonce",
+		"preferred_username": "jdoe",
+		"name":               "John Doe",
+		"email":              "jdoe@example.com",
+		"groups":             []string{"devs"},
+	})
+	p := NewProvider(&Config{IssuerURL: srv.URL, ClientID: "client", RedirectURL: "http://localhost/callback"})
+	ctx := context.Background()
+
+	u, err := p.Exchange(ctx, "code", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "jdoe" || u.DisplayName != "John Doe" || u.Email != "jdoe@example.com" || !reflect.DeepEqual(u.Groups, []string{"devs"}) || u.ExternalID != ExternalID(srv.URL, "1") {
+		t.Errorf("unexpected user %+v", u)
+	}
+	if _, err := p.Exchange(ctx, "code", "other"); err != ErrNonceMismatch {
+		t.Errorf("expected ErrNonceMismatch, got %v", err)
+	}
+	if _, err := p.Exchange(ctx, "bad", "nonce"); err == nil {
+		t.Error("expected an invalid code to be rejected")
+	}
+
+	p.Config.UsernameClaim = "upn"
+	if _, err := p.Exchange(ctx, "code", "nonce"); err == nil {
+		t.Error("expected a missing username claim to be rejected")
+	}
+}
+
+func TestExchangeWrongAudience(t *testing.T) {
+	srv := newTestIssuer(t, jwtgo.MapClaims{"sub": "1", "nonce": "nonce", "preferred_username": "jdoe"})
+	p := NewProvider(&Config{IssuerURL: srv.URL, ClientID: "other", RedirectURL: "http://localhost/callback"})
+
+	if _, err := p.Exchange(context.Background(), "code", "nonce"); err == nil {
+		t.Error("expected an id_token for another client to be rejected")
+	}
+}
@@ -7,3 +7,25 @@ type TableData struct {
 	TotalPage  int         `json:"total_page"`
 	TotalCount int         `json:"total_count"`
 }
+
+// PageData 分页数据
+type PageData struct {
+	Items    interface{} `json:"items"`
+	Total    int64       `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"page_size"`
+}
+
+// GroupMembers 分页的组成员
+type GroupMembers struct {
+	Group  string `json:"group"`
+	Nested bool   `json:"nested"` //是否包括通过嵌套的组间接所属的成员
+	PageData
+}
+
+// CursorPageData 游标分页数据，NextCursor 为空时没有下一页
+type CursorPageData struct {
+	Items      interface{} `json:"items"`
+	PageSize   int         `json:"page_size"`
+	NextCursor string      `json:"next_cursor"`
+}
@@ -1,7 +1,82 @@
 package types
 
+import (
+	"strings"
+	"time"
+)
+
 type LoginData struct {
 	Name     string `json:"name"`
 	Password string `json:"password"`
 	Verify   string `json:"verify"`
 }
+
+// UsernameNormalizer 登录时用户名的规范化规则，只处理用户名，不处理密码
+type UsernameNormalizer struct {
+	Lowercase   bool `mapstructure:"lowercase"`    //转换为小写
+	StripDomain bool `mapstructure:"strip_domain"` //去掉 UPN 后缀，jdoe@example.com 转换为 jdoe
+}
+
+// Normalize 登录使用的用户名规范化规则，启动时按配置设置
+var Normalize UsernameNormalizer
+
+// Username 去掉用户名前后的空白，并按规则转换
+func (n UsernameNormalizer) Username(name string) string {
+	name = strings.TrimSpace(name)
+	if n.StripDomain {
+		if i := strings.LastIndex(name, "@"); i > 0 {
+			name = name[:i]
+		}
+	}
+	if n.Lowercase {
+		name = strings.ToLower(name)
+	}
+	return name
+}
+
+type RefreshData struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type TokenData struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// WhoAmIData 当前 token 中的用户信息
+type WhoAmIData struct {
+	Subject     string    `json:"sub"`
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"display_name"`
+	Email       string    `json:"email"`
+	SuperAdmin  bool      `json:"super_admin"`
+	Roles       []string  `json:"roles"`
+	Groups      []string  `json:"groups"`
+	OrgId       int64     `json:"org_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type LogLevelData struct {
+	Level string `json:"level" binding:"required"`
+}
+
+type ImportData struct {
+	Logins []string `json:"logins"`
+}
+
+type ImportResult struct {
+	Login   string `json:"login"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BatchResult 批量创建用户时每个用户的结果
+type BatchResult struct {
+	Index   int               `json:"index"`            //请求中的下标 从0开始
+	Name    string            `json:"name"`             //用户名
+	ID      int64             `json:"id,omitempty"`     //创建成功的用户ID
+	Success bool              `json:"success"`          //是否创建成功
+	Error   string            `json:"error,omitempty"`  //失败原因
+	Fields  map[string]string `json:"fields,omitempty"` //参数校验失败的字段 字段名->原因
+}
@@ -0,0 +1,49 @@
+package zap_logger
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// SamplingConfig 日志采样配置，每秒内相同级别和内容的日志先输出 Initial 条，之后每 Thereafter 条输出一条。
+// Initial 为 0 时不采样，error 及以上级别的日志不采样
+type SamplingConfig struct {
+	Initial    int `mapstructure:"initial"`
+	Thereafter int `mapstructure:"thereafter"`
+}
+
+// WithSampling 返回开启日志采样的 zap.Option，Initial 为 0 时不采样
+func WithSampling(sc SamplingConfig) zap.Option {
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if sc.Initial <= 0 {
+			return core
+		}
+		return zapcore.NewTee(
+			zapcore.NewSamplerWithOptions(levelCore{Core: core, enabled: func(l zapcore.Level) bool { return l < zapcore.ErrorLevel }}, time.Second, sc.Initial, sc.Thereafter),
+			levelCore{Core: core, enabled: func(l zapcore.Level) bool { return l >= zapcore.ErrorLevel }},
+		)
+	})
+}
+
+// levelCore 只输出 enabled 的级别的日志
+type levelCore struct {
+	zapcore.Core
+	enabled func(zapcore.Level) bool
+}
+
+func (c levelCore) Enabled(l zapcore.Level) bool {
+	return c.enabled(l) && c.Core.Enabled(l)
+}
+
+func (c levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return levelCore{Core: c.Core.With(fields), enabled: c.enabled}
+}
+
+func (c levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
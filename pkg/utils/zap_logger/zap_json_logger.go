@@ -7,25 +7,25 @@ import (
 	"os"
 )
 
-func GetProdJsonLogger() (logger *zap.Logger, closer Closer, err error) {
+func GetProdJsonLogger(opts ...zap.Option) (logger *zap.Logger, closer Closer, err error) {
 	core, err := buildZapJsonCore(false)
 	if err != nil {
 		return nil, nil, err
 	}
 	//zap.AddCallerSkip(1),
-	logger = zap.New(core, zap.AddCaller(), zap.AddCallerSkip(2), zap.Development())
+	logger = zap.New(core, append([]zap.Option{zap.AddCaller(), zap.AddCallerSkip(2), zap.Development()}, opts...)...)
 	return logger, func() error {
 		return multierr.Combine(logger.Sync())
 	}, nil
 }
 
-func GetDevJsonLogger() (logger *zap.Logger, closer Closer, err error) {
+func GetDevJsonLogger(opts ...zap.Option) (logger *zap.Logger, closer Closer, err error) {
 	core, err := buildZapJsonCore(true)
 	if err != nil {
 		return nil, nil, err
 	}
 	//zap.AddCallerSkip(1),
-	logger = zap.New(core, zap.AddCaller(), zap.AddCallerSkip(2), zap.Development())
+	logger = zap.New(core, append([]zap.Option{zap.AddCaller(), zap.AddCallerSkip(2), zap.Development()}, opts...)...)
 	return logger, func() error {
 		return logger.Sync()
 	}, nil
@@ -33,7 +33,7 @@ func GetDevJsonLogger() (logger *zap.Logger, closer Closer, err error) {
 
 func buildZapJsonCore(isdev bool) (core zapcore.Core, err error) {
 	// 设置日志级别
-	atomicLevel := zap.NewAtomicLevel()
+	atomicLevel := Level
 	if isdev {
 		atomicLevel.SetLevel(zapcore.DebugLevel)
 	} else {
@@ -11,6 +11,9 @@ import (
 
 type Closer func() error
 
+// Level 所有 logger 共用的日志级别，创建 logger 时按环境设置默认级别，运行时可以修改
+var Level = zap.NewAtomicLevel()
+
 func GetProdLogger(path, service, when string) (logger *zap.Logger, closer Closer, err error) {
 	core, err := buildZapCore(path, service, when, false)
 	if err != nil {
@@ -43,7 +46,7 @@ func buildZapCore(path, service, when string, isdev bool) (core zapcore.Core, er
 	}
 	var ws zapcore.WriteSyncer
 	// 设置日志级别
-	atomicLevel := zap.NewAtomicLevel()
+	atomicLevel := Level
 	if isdev {
 		atomicLevel.SetLevel(zapcore.DebugLevel)
 		ws = zapcore.NewMultiWriteSyncer(zapcore.AddSync(os.Stdout), lw)
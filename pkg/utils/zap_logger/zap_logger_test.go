@@ -2,6 +2,8 @@ package zap_logger
 
 import (
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 	"testing"
 	//"time"
 )
@@ -21,3 +23,18 @@ func TestGetLogger(t *testing.T) {
 	prodlogger.Error("log", zap.Bool("debug", true), zap.Int("d", 3))
 	defer prodcloser()
 }
+
+func TestWithSampling(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(core, WithSampling(SamplingConfig{Initial: 2, Thereafter: 100}))
+	for i := 0; i < 10; i++ {
+		logger.Info("sampled")
+		logger.Error("never sampled")
+	}
+	if n := logs.FilterMessage("sampled").Len(); n != 2 {
+		t.Errorf("expected 2 sampled info logs, got %d", n)
+	}
+	if n := logs.FilterMessage("never sampled").Len(); n != 10 {
+		t.Errorf("expected all 10 error logs, got %d", n)
+	}
+}